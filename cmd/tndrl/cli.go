@@ -2,17 +2,32 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/a2aproject/a2a-go/a2a"
+	"github.com/a2aproject/a2a-go/a2asrv"
 	"github.com/google/uuid"
 	"gopkg.in/yaml.v3"
 
+	"github.com/shanemcd/tndrl/pkg/a2aexec"
+	"github.com/shanemcd/tndrl/pkg/authz"
+	"github.com/shanemcd/tndrl/pkg/control"
+	"github.com/shanemcd/tndrl/pkg/enroll"
 	"github.com/shanemcd/tndrl/pkg/llm"
 	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/policy"
+	"github.com/shanemcd/tndrl/pkg/session"
+	"github.com/shanemcd/tndrl/pkg/session/local"
+	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+	tcptransport "github.com/shanemcd/tndrl/pkg/transport/tcp"
 )
 
 // ConfigVersion is the current config file version.
@@ -22,17 +37,20 @@ const ConfigVersion = "v1"
 // It serves as the single source of truth for CLI flags, env vars, and config files.
 type CLI struct {
 	// Global flags (shared across all subcommands)
-	Config   string `short:"c" help:"Path to config file" type:"path" yaml:"-"`
-	LogLevel string `help:"Log level (debug, info, warn, error)" default:"info" env:"TNDRL_LOG_LEVEL" yaml:"logLevel"`
-	Verbose  bool   `short:"v" help:"Verbose output (same as --log-level=debug)" yaml:"-"`
+	Config    string `short:"c" help:"Path to config file" type:"path" yaml:"-"`
+	LogLevel  string `help:"Log level (debug, info, warn, error)" default:"info" env:"TNDRL_LOG_LEVEL" yaml:"logLevel"`
+	Verbose   bool   `short:"v" help:"Verbose output (same as --log-level=debug)" yaml:"-"`
+	Transport string `help:"Transport for connecting to peers (quic, tcp)" env:"TNDRL_TRANSPORT" yaml:"transport"`
 
 	// Embedded config (populated from file + CLI + env)
-	Version string       `yaml:"version" kong:"-"`
-	Server  ServerConfig `embed:"" prefix:"server-" yaml:"server"`
-	Agent   AgentConfig  `embed:"" prefix:"agent-" yaml:"agent"`
-	LLM     LLMConfig    `embed:"" prefix:"llm-" yaml:"llm"`
-	PKI     PKIConfig    `embed:"" prefix:"pki-" yaml:"pki"`
-	Peers   []PeerConfig `yaml:"peers" kong:"-"`
+	Version  string        `yaml:"version" kong:"-"`
+	Server   ServerConfig  `embed:"" prefix:"server-" yaml:"server"`
+	Agent    AgentConfig   `embed:"" prefix:"agent-" yaml:"agent"`
+	LLM      LLMConfig     `embed:"" prefix:"llm-" yaml:"llm"`
+	PKI      PKIConfig     `embed:"" prefix:"pki-" yaml:"pki"`
+	Policy   PolicyConfig  `embed:"" prefix:"policy-" yaml:"policy"`
+	Sessions SessionConfig `embed:"" prefix:"session-" yaml:"sessions"`
+	Peers    []PeerConfig  `yaml:"peers" kong:"-"`
 
 	// Subcommands
 	Serve    ServeCmd    `cmd:"" help:"Run as daemon (listen for connections)"`
@@ -41,11 +59,26 @@ type CLI struct {
 	Prompt   PromptCmd   `cmd:"" help:"Send prompt to peer"`
 	Discover DiscoverCmd `cmd:"" help:"Discover peer capabilities (AgentCard)"`
 	Shutdown ShutdownCmd `cmd:"" help:"Request peer shutdown"`
+	Session  SessionCmd  `cmd:"" help:"Manage agent sessions"`
+	File     FileCmd     `cmd:"" help:"Transfer files to and from a peer"`
+	PKITool  PKICmd      `cmd:"" name:"pki" help:"Manage certificates"`
+	Join     JoinCmd     `cmd:"" help:"Enroll this node with a CA host using a join token"`
 }
 
 // ServerConfig holds server-mode configuration.
 type ServerConfig struct {
-	Addr string `help:"Address to listen on" env:"TNDRL_ADDR" yaml:"addr"`
+	Addr       string        `help:"Address to listen on" env:"TNDRL_ADDR" yaml:"addr"`
+	Transports []string      `help:"Transports to listen on at addr (quic, tcp)" env:"TNDRL_SERVER_TRANSPORTS" yaml:"transports"`
+	TaskStore  string        `help:"Task store (memory, file)" env:"TNDRL_TASK_STORE" yaml:"taskStore"`
+	TaskDir    string        `help:"Directory for the file task store" env:"TNDRL_TASK_DIR" yaml:"taskDir"`
+	TaskMax    int           `help:"Tasks kept by the file task store, least recently updated finished ones removed first (default 1000)" env:"TNDRL_TASK_MAX" yaml:"taskMax"`
+	TaskMaxAge time.Duration `help:"How long the file task store keeps finished tasks (default 168h)" env:"TNDRL_TASK_MAX_AGE" yaml:"taskMaxAge"`
+	FileDir    string        `help:"Directory for files transferred to this node" env:"TNDRL_FILE_DIR" yaml:"fileDir"`
+	FileMax    int64         `help:"Bytes the files in the file directory may take, least recently used removed first (default 16 GiB)" env:"TNDRL_FILE_MAX" yaml:"fileMax"`
+	Enroll     bool          `help:"Accept nodes joining with a join token (requires the CA key)" env:"TNDRL_SERVER_ENROLL" yaml:"enroll"`
+
+	// Authz restricts RPCs to allowed SPIFFE identities (config file only)
+	Authz []authz.Rule `yaml:"authz" kong:"-"`
 }
 
 // AgentConfig holds A2A agent card configuration.
@@ -69,13 +102,17 @@ type Skill struct {
 
 // LLMConfig holds LLM provider configuration.
 type LLMConfig struct {
-	Provider      string                         `help:"LLM provider (echo, ollama, mcphost)" env:"TNDRL_LLM_PROVIDER" yaml:"provider"`
-	Model         string                         `help:"LLM model name" env:"TNDRL_LLM_MODEL" yaml:"model"`
-	URL           string                         `help:"LLM API URL" env:"TNDRL_LLM_URL" yaml:"url"`
-	SystemPrompt  string                         `help:"System prompt for the LLM" env:"TNDRL_LLM_SYSTEM_PROMPT" yaml:"systemPrompt"`
-	MaxSteps      int                            `help:"Maximum tool call steps (0=unlimited)" env:"TNDRL_LLM_MAX_STEPS" yaml:"maxSteps"`
-	MCPConfigFile string                         `help:"Path to mcphost config file" env:"TNDRL_MCP_CONFIG" yaml:"mcpConfigFile"`
-	MCPServers    map[string]llm.MCPServerConfig `yaml:"mcpServers" kong:"-"`
+	Provider        string                         `help:"LLM provider (echo, ollama, mcphost)" env:"TNDRL_LLM_PROVIDER" yaml:"provider"`
+	Model           string                         `help:"LLM model name" env:"TNDRL_LLM_MODEL" yaml:"model"`
+	URL             string                         `help:"LLM API URL" env:"TNDRL_LLM_URL" yaml:"url"`
+	SystemPrompt    string                         `help:"System prompt for the LLM" env:"TNDRL_LLM_SYSTEM_PROMPT" yaml:"systemPrompt"`
+	MaxSteps        int                            `help:"Maximum tool call steps (0=unlimited)" env:"TNDRL_LLM_MAX_STEPS" yaml:"maxSteps"`
+	AskUser         *bool                          `help:"Offer the model an ask_user tool (mcphost only, default true)" env:"TNDRL_LLM_ASK_USER" yaml:"askUser"`
+	HistoryTurns    int                            `help:"Maximum conversation messages kept per context (default 50)" env:"TNDRL_LLM_HISTORY_TURNS" yaml:"historyTurns"`
+	HistoryChars    int                            `help:"Maximum conversation characters kept per context (default 1048576)" env:"TNDRL_LLM_HISTORY_CHARS" yaml:"historyChars"`
+	HistoryContexts int                            `help:"Maximum conversation contexts kept, least recently used forgotten first (default 1000)" env:"TNDRL_LLM_HISTORY_CONTEXTS" yaml:"historyContexts"`
+	MCPConfigFile   string                         `help:"Path to mcphost config file" env:"TNDRL_MCP_CONFIG" yaml:"mcpConfigFile"`
+	MCPServers      map[string]llm.MCPServerConfig `yaml:"mcpServers" kong:"-"`
 }
 
 // PKIConfig holds PKI-related configuration.
@@ -86,12 +123,69 @@ type PKIConfig struct {
 	Cert   string `help:"Certificate path" env:"TNDRL_CERT" yaml:"cert"`
 	Key    string `help:"Private key path" env:"TNDRL_KEY" yaml:"key"`
 	Init   bool   `help:"Initialize PKI if missing" env:"TNDRL_INIT_PKI" yaml:"init"`
+
+	RenewBefore time.Duration `help:"Renew the node certificate from the CA when it expires within this window (0 disables)" env:"TNDRL_PKI_RENEW_BEFORE" yaml:"renewBefore"`
+
+	ExpiryWarn     []time.Duration `help:"Log a warning when the node or CA certificate comes within each of these windows of expiry (default 336h,168h,24h)" env:"TNDRL_PKI_EXPIRY_WARN" yaml:"expiryWarn"`
+	ExpiryDegraded time.Duration   `help:"Report the node degraded when the node or CA certificate expires within this window (default 168h)" env:"TNDRL_PKI_EXPIRY_DEGRADED" yaml:"expiryDegraded"`
+
+	TrustDomain  string   `help:"SPIFFE trust domain of node identities (default tndrl)" env:"TNDRL_PKI_TRUST_DOMAIN" yaml:"trustDomain"`
+	KeyAlgorithm string   `help:"Key algorithm for new certificates (ecdsa-p256, ecdsa-p384, ed25519)" env:"TNDRL_PKI_KEY_ALGORITHM" yaml:"keyAlgorithm"`
+	SANs         []string `name:"san" help:"Extra DNS names or IP addresses for this node's certificate" env:"TNDRL_PKI_SANS" yaml:"sans"`
+
+	EncryptKeys      bool   `help:"Encrypt private keys written from now on with a passphrase" env:"TNDRL_PKI_ENCRYPT_KEYS" yaml:"encryptKeys"`
+	PassphraseSource string `help:"Where to read the key passphrase: env (TNDRL_PKI_PASSPHRASE), prompt, fd:<n>, file:<path>, keyring[:<name>] (default: env if set, else prompt)" env:"TNDRL_PKI_PASSPHRASE_SOURCE" yaml:"passphraseSource"`
+
+	CASigner string `help:"Sign with a CA key held by another process instead of pki-ca-key: unix:<socket> or exec:<command>" env:"TNDRL_PKI_CA_SIGNER" yaml:"caSigner"`
+	NoCAKey  bool   `help:"Use only the CA certificate, ignoring any configured CA key or signer" env:"TNDRL_PKI_NO_CA_KEY" yaml:"noCAKey"`
+
+	// TrustBundles adds the roots of other trust domains, or further roots
+	// of the local one during a CA rollover. Config file only.
+	TrustBundles []TrustBundleConfig `kong:"-" yaml:"trustBundles"`
+}
+
+// TrustBundleConfig names a file of root CA certificates trusted for a
+// SPIFFE trust domain.
+type TrustBundleConfig struct {
+	TrustDomain string `yaml:"trustDomain"`
+	CACert      string `yaml:"caCert"`
+}
+
+// PolicyConfig holds OPA policy configuration.
+type PolicyConfig struct {
+	Dir string `help:"Rego policy bundle directory (policy disabled if unset)" env:"TNDRL_POLICY_DIR" yaml:"dir"`
+}
+
+// SessionConfig holds session management configuration.
+type SessionConfig struct {
+	Dir    string            `help:"Session registry directory" env:"TNDRL_SESSION_DIR" yaml:"dir"`
+	Driver string            `help:"Default session driver (local)" env:"TNDRL_SESSION_DRIVER" yaml:"driver"`
+	Local  LocalDriverConfig `embed:"" prefix:"local-" yaml:"local"`
+}
+
+// LocalDriverConfig holds configuration for the local session driver.
+type LocalDriverConfig struct {
+	Workdir string `help:"Directory holding each local session's private workdir" env:"TNDRL_SESSION_LOCAL_WORKDIR" yaml:"workdir"`
 }
 
 // PeerConfig holds configuration for a known peer.
 type PeerConfig struct {
 	Name string `yaml:"name"`
 	Addr string `yaml:"addr"`
+
+	// Identity is the SPIFFE ID (or node name) the peer's certificate must
+	// carry. When set, the host name in Addr is not checked against the
+	// certificate unless VerifyHostname is also set.
+	Identity       string `yaml:"identity"`
+	VerifyHostname bool   `yaml:"verifyHostname"`
+
+	// TrustDomains lists foreign trust domains, besides Identity's, the
+	// peer's certificate may belong to. Each needs a trust bundle.
+	TrustDomains []string `yaml:"trustDomains"`
+
+	// Transport overrides the global transport for this peer, e.g. tcp for
+	// a peer behind a network that drops UDP.
+	Transport string `yaml:"transport"`
 }
 
 // LoadConfigFile loads configuration from a YAML file into the CLI struct.
@@ -118,9 +212,48 @@ func (cli *CLI) ApplyDefaults() {
 	if cli.Server.Addr == "" {
 		cli.Server.Addr = "[::]:4433"
 	}
+	if cli.Transport == "" {
+		cli.Transport = quictransport.TransportQUIC
+	}
+	if len(cli.Server.Transports) == 0 {
+		cli.Server.Transports = []string{quictransport.TransportQUIC}
+	}
+	if cli.Server.TaskStore == "" {
+		cli.Server.TaskStore = "memory"
+	}
+	if cli.Server.TaskDir == "" {
+		cli.Server.TaskDir = "~/.tndrl/tasks"
+	}
+	if cli.Server.FileDir == "" {
+		cli.Server.FileDir = "~/.tndrl/files"
+	}
 	if cli.PKI.Dir == "" {
 		cli.PKI.Dir = "~/.tndrl/pki"
 	}
+	if cli.PKI.RenewBefore == 0 {
+		cli.PKI.RenewBefore = 30 * 24 * time.Hour
+	}
+	if len(cli.PKI.ExpiryWarn) == 0 {
+		cli.PKI.ExpiryWarn = control.DefaultExpiryWarnings
+	}
+	if cli.PKI.ExpiryDegraded == 0 {
+		cli.PKI.ExpiryDegraded = control.DefaultExpiryDegraded
+	}
+	if cli.PKI.TrustDomain == "" {
+		cli.PKI.TrustDomain = string(pki.DefaultTrustDomain)
+	}
+	if cli.PKI.KeyAlgorithm == "" {
+		cli.PKI.KeyAlgorithm = string(pki.DefaultKeyAlgorithm)
+	}
+	if cli.Sessions.Dir == "" {
+		cli.Sessions.Dir = "~/.tndrl/sessions"
+	}
+	if cli.Sessions.Driver == "" {
+		cli.Sessions.Driver = "local"
+	}
+	if cli.Sessions.Local.Workdir == "" {
+		cli.Sessions.Local.Workdir = "~/.tndrl/workspaces"
+	}
 	if len(cli.Agent.InputModes) == 0 {
 		cli.Agent.InputModes = []string{"text"}
 	}
@@ -131,6 +264,13 @@ func (cli *CLI) ApplyDefaults() {
 		t := true
 		cli.Agent.Streaming = &t
 	}
+	if cli.LLM.HistoryTurns == 0 {
+		cli.LLM.HistoryTurns = 50
+	}
+	if cli.LLM.AskUser == nil {
+		t := true
+		cli.LLM.AskUser = &t
+	}
 }
 
 // IsStreaming returns whether streaming is enabled (defaults to true).
@@ -141,6 +281,14 @@ func (cli *CLI) IsStreaming() bool {
 	return *cli.Agent.Streaming
 }
 
+// IsAskUser returns whether the ask_user tool is enabled (defaults to true).
+func (cli *CLI) IsAskUser() bool {
+	if cli.LLM.AskUser == nil {
+		return true
+	}
+	return *cli.LLM.AskUser
+}
+
 // MergeCLIInPlace fills in dst with values from config where dst has zero values.
 // This implements: CLI > config (CLI values are preserved, config fills gaps).
 func MergeCLIInPlace(dst, config *CLI) {
@@ -185,6 +333,73 @@ func mergeStructsInPlace(dst, config reflect.Value) {
 	}
 }
 
+// Validate checks settings that kong does not, once config and defaults
+// have been applied.
+func (cli *CLI) Validate() error {
+	if _, err := pki.ParseTrustDomain(cli.PKI.TrustDomain); err != nil {
+		return err
+	}
+	if _, err := pki.ParseKeyAlgorithm(cli.PKI.KeyAlgorithm); err != nil {
+		return err
+	}
+	if err := validatePassphraseSource(cli.PKI.PassphraseSource); err != nil {
+		return err
+	}
+	if err := validateCASigner(cli.PKI.CASigner); err != nil {
+		return err
+	}
+	for _, w := range cli.PKI.ExpiryWarn {
+		if w <= 0 {
+			return fmt.Errorf("invalid expiry warning window %s: must be positive", w)
+		}
+	}
+	for _, b := range cli.PKI.TrustBundles {
+		if _, err := pki.ParseTrustDomain(b.TrustDomain); err != nil {
+			return fmt.Errorf("trust bundle: %w", err)
+		}
+		if b.CACert == "" {
+			return fmt.Errorf("trust bundle for %s: caCert is required", b.TrustDomain)
+		}
+	}
+	if cli.Transport != "" {
+		if err := validateTransport(cli.Transport); err != nil {
+			return err
+		}
+	}
+	seen := make(map[string]bool)
+	for _, t := range cli.Server.Transports {
+		if err := validateTransport(t); err != nil {
+			return fmt.Errorf("server: %w", err)
+		}
+		if seen[t] {
+			return fmt.Errorf("server: transport %s listed twice", t)
+		}
+		seen[t] = true
+	}
+	for _, p := range cli.Peers {
+		if p.Transport != "" {
+			if err := validateTransport(p.Transport); err != nil {
+				return fmt.Errorf("peer %s: %w", p.Name, err)
+			}
+		}
+		for _, td := range p.TrustDomains {
+			if _, err := pki.ParseTrustDomain(td); err != nil {
+				return fmt.Errorf("peer %s: %w", p.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateTransport checks that name is a supported transport.
+func validateTransport(name string) error {
+	switch name {
+	case quictransport.TransportQUIC, tcptransport.Transport:
+		return nil
+	}
+	return fmt.Errorf("unknown transport %q (expected %s or %s)", name, quictransport.TransportQUIC, tcptransport.Transport)
+}
+
 // ValidateConfigVersion checks that the config file version is supported.
 func ValidateConfigVersion(version string) error {
 	if version == "" {
@@ -210,6 +425,76 @@ func (cli *CLI) ResolvePaths() error {
 		cli.PKI.Dir = dir
 	}
 
+	// Expand ~ in task directory
+	if cli.Server.TaskDir != "" {
+		dir, err := expandHome(cli.Server.TaskDir)
+		if err != nil {
+			return err
+		}
+		cli.Server.TaskDir = dir
+	}
+
+	// Expand ~ in file directory
+	if cli.Server.FileDir != "" {
+		dir, err := expandHome(cli.Server.FileDir)
+		if err != nil {
+			return err
+		}
+		cli.Server.FileDir = dir
+	}
+
+	// Expand ~ in policy directory
+	if cli.Policy.Dir != "" {
+		dir, err := expandHome(cli.Policy.Dir)
+		if err != nil {
+			return err
+		}
+		cli.Policy.Dir = dir
+	}
+
+	// Expand ~ in session directory
+	if cli.Sessions.Dir != "" {
+		dir, err := expandHome(cli.Sessions.Dir)
+		if err != nil {
+			return err
+		}
+		cli.Sessions.Dir = dir
+	}
+	if cli.Sessions.Local.Workdir != "" {
+		dir, err := expandHome(cli.Sessions.Local.Workdir)
+		if err != nil {
+			return err
+		}
+		cli.Sessions.Local.Workdir = dir
+	}
+
+	// Expand ~ in a passphrase file
+	if path, ok := strings.CutPrefix(cli.PKI.PassphraseSource, "file:"); ok {
+		path, err := expandHome(path)
+		if err != nil {
+			return err
+		}
+		cli.PKI.PassphraseSource = "file:" + path
+	}
+
+	// Expand ~ in a CA signer socket
+	if path, ok := strings.CutPrefix(cli.PKI.CASigner, "unix:"); ok {
+		path, err := expandHome(path)
+		if err != nil {
+			return err
+		}
+		cli.PKI.CASigner = "unix:" + path
+	}
+
+	// Expand ~ in trust bundle paths
+	for i, b := range cli.PKI.TrustBundles {
+		path, err := expandHome(b.CACert)
+		if err != nil {
+			return err
+		}
+		cli.PKI.TrustBundles[i].CACert = path
+	}
+
 	// Set defaults for PKI paths if not explicitly set
 	if cli.PKI.CACert == "" {
 		cli.PKI.CACert = filepath.Join(cli.PKI.Dir, "ca.crt")
@@ -224,6 +509,12 @@ func (cli *CLI) ResolvePaths() error {
 		cli.PKI.Key = filepath.Join(cli.PKI.Dir, "tndrl.key")
 	}
 
+	// A node told to hold no CA key ignores one set by config or default
+	if cli.PKI.NoCAKey {
+		cli.PKI.CAKey = ""
+		cli.PKI.CASigner = ""
+	}
+
 	return nil
 }
 
@@ -237,17 +528,237 @@ func (cli *CLI) ResolvePeer(nameOrAddr string) string {
 	return nameOrAddr
 }
 
+// PeerTransport returns the transport for connecting to the peer at addr:
+// the configured peer's own, or the global one.
+func (cli *CLI) PeerTransport(addr string) string {
+	for _, p := range cli.Peers {
+		if p.Addr == addr && p.Transport != "" {
+			return p.Transport
+		}
+	}
+	return cli.Transport
+}
+
+// ServerVerification returns how to verify the peer at addr. If a configured
+// peer has that address and an identity, its SPIFFE ID is checked, and its
+// host name only if the peer asks for it. Otherwise the host name is checked.
+// A configured peer's foreign trust domains are allowed either way.
+func (cli *CLI) ServerVerification(addr string) pki.ServerVerification {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	for _, p := range cli.Peers {
+		if p.Addr != addr {
+			continue
+		}
+		v := pki.ServerVerification{ServerName: host}
+		for _, td := range p.TrustDomains {
+			v.TrustDomains = append(v.TrustDomains, pki.TrustDomain(td))
+		}
+		if p.Identity != "" {
+			v.Identity = cli.NodeIdentity(p.Identity)
+			if !p.VerifyHostname {
+				v.ServerName = ""
+			}
+		}
+		return v
+	}
+	return pki.ServerVerification{ServerName: host}
+}
+
 // Identity returns the node identity string, generating one if not set.
 func (cli *CLI) Identity() string {
 	name := cli.Agent.Name
 	if name == "" {
 		name = uuid.New().String()[:8]
 	}
-	return pki.UnitIdentity(name)
+	return cli.NodeIdentity(name)
+}
+
+// NodeIdentity returns the SPIFFE identity of the named node in the
+// configured trust domain. A name that is already a SPIFFE ID is returned
+// unchanged.
+func (cli *CLI) NodeIdentity(name string) string {
+	if strings.HasPrefix(name, "spiffe://") {
+		return name
+	}
+	return pki.TrustDomain(cli.PKI.TrustDomain).NodeIdentity(name)
+}
+
+// CertOptions returns the SANs and key algorithm for this node's certificates.
+func (cli *CLI) CertOptions() pki.CertOptions {
+	dnsNames, ips := pki.ParseSANs(cli.PKI.SANs)
+	return pki.CertOptions{
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		KeyAlgorithm: pki.KeyAlgorithm(cli.PKI.KeyAlgorithm),
+	}
+}
+
+// LoadCA loads the CA. The private key is loaded only if it is present, so
+// nodes that were given just the CA certificate can still verify peers.
+// If trust bundles are configured, they are attached to the CA.
+func (cli *CLI) LoadCA() (*pki.CA, error) {
+	if !cli.HasCAKey() {
+		return cli.LoadCACertificate()
+	}
+	ca, err := cli.LoadSigningCA()
+	if err != nil {
+		return nil, err
+	}
+	return ca, cli.attachTrustBundles(ca)
+}
+
+// HasCAKey reports whether this node can issue certificates: the CA private
+// key is present, or an external signer holds it.
+func (cli *CLI) HasCAKey() bool {
+	return cli.PKI.CASigner != "" || pki.CertExists(cli.PKI.CACert, cli.PKI.CAKey)
+}
+
+// caSigner is the external CA signer, opened once per invocation.
+var caSigner struct {
+	mu     sync.Mutex
+	signer *pki.ExternalSigner
+}
+
+// LoadSigningCA loads the CA with its private key, or with the external
+// signer if --pki-ca-signer is set.
+func (cli *CLI) LoadSigningCA() (*pki.CA, error) {
+	if cli.PKI.CASigner == "" {
+		return pki.LoadCAWithOptions(cli.PKI.CACert, cli.PKI.CAKey, cli.KeyOptions())
+	}
+
+	caSigner.mu.Lock()
+	defer caSigner.mu.Unlock()
+	if caSigner.signer == nil {
+		signer, err := pki.OpenSigner(cli.PKI.CASigner)
+		if err != nil {
+			return nil, err
+		}
+		caSigner.signer = signer
+	}
+	return pki.LoadCAWithSigner(cli.PKI.CACert, caSigner.signer)
+}
+
+// validateCASigner checks a --pki-ca-signer value.
+func validateCASigner(addr string) error {
+	if addr == "" {
+		return nil
+	}
+	kind, arg, _ := strings.Cut(addr, ":")
+	if (kind != "unix" && kind != "exec") || strings.TrimSpace(arg) == "" {
+		return fmt.Errorf("invalid CA signer %q (want unix:<socket> or exec:<command>)", addr)
+	}
+	return nil
+}
+
+// LoadCACertificate loads the CA without its private key, for commands
+// that only verify certificates, so an encrypted key need not be unlocked.
+func (cli *CLI) LoadCACertificate() (*pki.CA, error) {
+	ca, err := pki.LoadCACertificate(cli.PKI.CACert)
+	if err != nil {
+		return nil, err
+	}
+	return ca, cli.attachTrustBundles(ca)
+}
+
+// attachTrustBundles sets the CA's bundle from the configured trust bundles.
+func (cli *CLI) attachTrustBundles(ca *pki.CA) error {
+	if len(cli.PKI.TrustBundles) == 0 {
+		return nil
+	}
+	ca.Bundle = pki.NewBundle(pki.TrustDomain(cli.PKI.TrustDomain))
+	for _, b := range cli.PKI.TrustBundles {
+		if err := ca.Bundle.AddFile(pki.TrustDomain(b.TrustDomain), b.CACert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSRPath returns where a certificate request for the node certificate is kept.
+func (cli *CLI) CSRPath() string {
+	return strings.TrimSuffix(cli.PKI.Cert, filepath.Ext(cli.PKI.Cert)) + ".csr"
+}
+
+// TokensPath returns where join tokens are kept, next to the CA key.
+func (cli *CLI) TokensPath() string {
+	return filepath.Join(filepath.Dir(cli.PKI.CAKey), enroll.TokensFile)
+}
+
+// LedgerPath returns the path of the CA's issuance ledger, kept next to ca.crt.
+func (cli *CLI) LedgerPath() string {
+	return filepath.Join(filepath.Dir(cli.PKI.CACert), pki.LedgerFile)
+}
+
+// NodeName returns the name to use in a new node certificate: name if set,
+// else --agent-name, else the hostname.
+func (cli *CLI) NodeName(name string) (string, error) {
+	if name == "" {
+		name = cli.Agent.Name
+	}
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	if name == "" {
+		return "", fmt.Errorf("--name is required")
+	}
+	return name, nil
+}
+
+// CertReloader loads the node certificate for serving it to TLS handshakes.
+// If the CA key or signer is available, the certificate is renewed from the
+// CA once it is within the renewal window of expiry. A node with only the CA
+// certificate warns instead: its certificate is renewed on the CA host (by
+// `tndrl pki renew`, or by the session driver that started it) and picked
+// up once the file is replaced. The reloader also re-reads the CA's CRL when
+// it changes. Callers must stop the reloader.
+func (cli *CLI) CertReloader(ca *pki.CA) (*pki.Reloader, error) {
+	opts := pki.ReloaderOptions{RenewBefore: cli.PKI.RenewBefore, Keys: cli.KeyOptions(), CRL: ca.CRL}
+	if ca.Key != nil {
+		opts.Renew = ca.Reissue
+	}
+	r, err := pki.NewReloader(cli.PKI.Cert, cli.PKI.Key, opts)
+	if err != nil {
+		return nil, fmt.Errorf("load cert (try --pki-init to generate): %w", err)
+	}
+	return r, nil
+}
+
+// ExpiryMonitor tracks the expiry of the node certificate served by certs
+// and of the CA.
+func (cli *CLI) ExpiryMonitor(certs *pki.Reloader, ca *pki.CA) *control.ExpiryMonitor {
+	return control.NewExpiryMonitor(func() (*x509.Certificate, []*x509.Certificate) {
+		return certs.Certificate().Cert, ca.Certificates()
+	}, control.ExpiryOptions{
+		Warnings: cli.PKI.ExpiryWarn,
+		Degraded: cli.PKI.ExpiryDegraded,
+	})
+}
+
+// AuthzPolicy builds the RPC authorization policy from the configured rules.
+func (cli *CLI) AuthzPolicy() (*authz.Policy, error) {
+	p, err := authz.NewPolicy(cli.Server.Authz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid authz rules: %w", err)
+	}
+	return p, nil
+}
+
+// PolicyEngine loads the configured policy bundle for the node with the given identity.
+// It returns nil, which allows everything, if no policy directory is set.
+func (cli *CLI) PolicyEngine(ctx context.Context, identity string) (*policy.Engine, error) {
+	if cli.Policy.Dir == "" {
+		return nil, nil
+	}
+	return policy.Load(ctx, cli.Policy.Dir, identity)
 }
 
 // CreateLLMProvider creates the configured LLM provider.
-func (cli *CLI) CreateLLMProvider(ctx context.Context) (llm.Provider, error) {
+// toolCheck, if non-nil, is consulted before each tool call (mcphost only).
+func (cli *CLI) CreateLLMProvider(ctx context.Context, toolCheck llm.ToolCheck) (llm.Provider, error) {
 	switch cli.LLM.Provider {
 	case "":
 		return nil, fmt.Errorf("--llm-provider is required (options: echo, ollama, mcphost)")
@@ -274,6 +785,8 @@ func (cli *CLI) CreateLLMProvider(ctx context.Context) (llm.Provider, error) {
 			MCPServers:    cli.LLM.MCPServers,
 			MaxSteps:      cli.LLM.MaxSteps,
 			Streaming:     cli.IsStreaming(),
+			AskUser:       cli.IsAskUser(),
+			ToolCheck:     toolCheck,
 		})
 	case "echo":
 		return llm.NewEchoProvider(), nil
@@ -282,6 +795,83 @@ func (cli *CLI) CreateLLMProvider(ctx context.Context) (llm.Provider, error) {
 	}
 }
 
+// CreateTaskStore creates the configured A2A task store.
+// A nil store means the a2a-go in-memory default is used.
+func (cli *CLI) CreateTaskStore() (a2asrv.TaskStore, error) {
+	switch cli.Server.TaskStore {
+	case "", "memory":
+		return nil, nil
+	case "file":
+		return a2aexec.NewFileTaskStoreWithOptions(cli.Server.TaskDir, a2aexec.FileTaskStoreOptions{
+			MaxTasks: cli.Server.TaskMax,
+			MaxAge:   cli.Server.TaskMaxAge,
+		})
+	default:
+		return nil, fmt.Errorf("unknown task store: %s (options: memory, file)", cli.Server.TaskStore)
+	}
+}
+
+// SessionRegistry opens the session registry.
+func (cli *CLI) SessionRegistry() (*session.Registry, error) {
+	return session.NewRegistry(cli.Sessions.Dir)
+}
+
+// CreateSessionDriver creates the named session driver.
+func (cli *CLI) CreateSessionDriver(name string) (session.Driver, error) {
+	switch name {
+	case local.DriverName:
+		return local.New(local.Options{
+			Root:        cli.Sessions.Local.Workdir,
+			CACert:      cli.PKI.CACert,
+			CAKey:       cli.PKI.CAKey,
+			CASigner:    cli.PKI.CASigner,
+			TrustDomain: pki.TrustDomain(cli.PKI.TrustDomain),
+			CertOptions: pki.CertOptions{KeyAlgorithm: pki.KeyAlgorithm(cli.PKI.KeyAlgorithm)},
+			Keys:        cli.KeyOptions(),
+			Args:        cli.childNodeArgs(),
+			Env:         cli.childNodeEnv(),
+		})
+	default:
+		return nil, fmt.Errorf("unknown session driver: %s (options: local)", name)
+	}
+}
+
+// childNodeEnv returns the environment that gives a child node the key
+// passphrase, since it cannot prompt. It is empty unless the passphrase has
+// been read (see unlockKeys).
+func (cli *CLI) childNodeEnv() []string {
+	passphrase.mu.Lock()
+	defer passphrase.mu.Unlock()
+	if !passphrase.read || passphrase.err != nil {
+		return nil
+	}
+	return []string{PassphraseEnv + "=" + string(passphrase.value), "TNDRL_PKI_PASSPHRASE_SOURCE=env"}
+}
+
+// childNodeArgs returns the `tndrl serve` arguments that make a child node
+// use this invocation's config file and LLM settings.
+func (cli *CLI) childNodeArgs() []string {
+	args := []string{"--log-level=" + cli.LogLevel}
+	if cli.Config != "" {
+		if path, err := filepath.Abs(cli.Config); err == nil {
+			args = append(args, "--config="+path)
+		}
+	}
+	if cli.LLM.Provider != "" {
+		args = append(args, "--llm-provider="+cli.LLM.Provider)
+	}
+	if cli.LLM.Model != "" {
+		args = append(args, "--llm-model="+cli.LLM.Model)
+	}
+	if cli.LLM.URL != "" {
+		args = append(args, "--llm-url="+cli.LLM.URL)
+	}
+	if cli.PKI.TrustDomain != string(pki.DefaultTrustDomain) {
+		args = append(args, "--pki-trust-domain="+cli.PKI.TrustDomain)
+	}
+	return args
+}
+
 // AgentCard builds an A2A AgentCard from the configuration.
 func (cli *CLI) AgentCard(addr string) *a2a.AgentCard {
 	name := cli.Agent.Name
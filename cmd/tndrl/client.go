@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log/slog"
@@ -10,44 +11,63 @@ import (
 
 	"github.com/a2aproject/a2a-go/a2aclient"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
 	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
 	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transfer"
+	"github.com/shanemcd/tndrl/pkg/transport"
 	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+	tcptransport "github.com/shanemcd/tndrl/pkg/transport/tcp"
 )
 
 // PeerConnection holds connections to a peer.
 type PeerConnection struct {
-	addr       string
-	muxDialer  *quictransport.MuxDialer
+	addr        string
+	dialer      transport.Dialer
 	controlConn *grpc.ClientConn
-	a2aConn    *grpc.ClientConn
+	a2aConn     *grpc.ClientConn
+	certs       *pki.Reloader
 }
 
 // ConnectToPeer establishes a connection to a peer.
 func ConnectToPeer(cli *CLI, peerAddr string) (*PeerConnection, error) {
-	tlsConfig, err := setupClientTLS(cli, peerAddr)
+	tlsConfig, certs, err := setupClientTLS(cli, peerAddr)
 	if err != nil {
 		return nil, fmt.Errorf("setup TLS: %w", err)
 	}
 
-	muxDialer := quictransport.NewMuxDialer(tlsConfig, nil)
+	var dialer transport.Dialer
+	if cli.PeerTransport(peerAddr) == tcptransport.Transport {
+		dialer = tcptransport.NewMuxDialer(tlsConfig, nil)
+	} else {
+		dialer = quictransport.NewMuxDialer(tlsConfig, nil)
+	}
+	pc, err := newPeerConnection(dialer, peerAddr)
+	if err != nil {
+		certs.Stop()
+		return nil, err
+	}
+	pc.certs = certs
+	return pc, nil
+}
 
+// newPeerConnection connects to a peer through dialer, taking ownership of
+// it.
+func newPeerConnection(dialer transport.Dialer, peerAddr string) (*PeerConnection, error) {
 	// Create Control gRPC connection
 	controlConn, err := grpc.NewClient(
 		peerAddr,
-		grpc.WithContextDialer(muxDialer.ControlDialer()),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(dialer.StreamDialer(transport.StreamTypeControl)),
+		grpc.WithTransportCredentials(transport.Credentials()),
 	)
 	if err != nil {
-		muxDialer.Close()
+		dialer.Close()
 		return nil, fmt.Errorf("create control connection: %w", err)
 	}
 
 	return &PeerConnection{
 		addr:        peerAddr,
-		muxDialer:   muxDialer,
+		dialer:      dialer,
 		controlConn: controlConn,
 	}, nil
 }
@@ -62,8 +82,8 @@ func (pc *PeerConnection) A2ATransport() (a2aclient.Transport, error) {
 	if pc.a2aConn == nil {
 		a2aConn, err := grpc.NewClient(
 			pc.addr,
-			grpc.WithContextDialer(pc.muxDialer.A2ADialer()),
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(pc.dialer.StreamDialer(transport.StreamTypeA2A)),
+			grpc.WithTransportCredentials(transport.Credentials()),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("create A2A connection: %w", err)
@@ -73,6 +93,17 @@ func (pc *PeerConnection) A2ATransport() (a2aclient.Transport, error) {
 	return a2aclient.NewGRPCTransport(pc.a2aConn), nil
 }
 
+// FileClient returns a client transferring files to and from the peer.
+func (pc *PeerConnection) FileClient() (*transfer.Client, error) {
+	dial, err := pc.dialer.RegisterStreamType(transfer.StreamType, transfer.StreamTypeName)
+	if err != nil {
+		return nil, err
+	}
+	return transfer.NewClient(func(ctx context.Context) (net.Conn, error) {
+		return dial(ctx, pc.addr)
+	}), nil
+}
+
 // Close closes all connections.
 func (pc *PeerConnection) Close() {
 	if pc.a2aConn != nil {
@@ -81,44 +112,43 @@ func (pc *PeerConnection) Close() {
 	if pc.controlConn != nil {
 		pc.controlConn.Close()
 	}
-	if pc.muxDialer != nil {
-		pc.muxDialer.Close()
+	if pc.dialer != nil {
+		pc.dialer.Close()
+	}
+	if pc.certs != nil {
+		pc.certs.Stop()
 	}
 }
 
-func setupClientTLS(cli *CLI, peerAddr string) (*tls.Config, error) {
+func setupClientTLS(cli *CLI, peerAddr string) (*tls.Config, *pki.Reloader, error) {
 	// Handle PKI initialization for client
 	if cli.PKI.Init {
 		if err := initializeClientPKI(cli); err != nil {
-			return nil, fmt.Errorf("initialize PKI: %w", err)
+			return nil, nil, fmt.Errorf("initialize PKI: %w", err)
 		}
 	}
 
-	// Load CA
-	ca, err := pki.LoadCA(cli.PKI.CACert, cli.PKI.CAKey)
+	// Load CA; only the certificate is needed to verify the peer
+	ca, err := cli.LoadCA()
 	if err != nil {
-		return nil, fmt.Errorf("load CA (run 'tndrl serve --pki-init' first): %w", err)
+		return nil, nil, fmt.Errorf("load CA certificate (copy ca.crt from the CA host, or run 'tndrl serve --pki-init' there first): %w", err)
 	}
 
 	// Load certificate
-	cert, err := pki.LoadCert(cli.PKI.Cert, cli.PKI.Key)
-	if err != nil {
-		return nil, fmt.Errorf("load cert (try --pki-init to generate): %w", err)
-	}
-
-	// Extract hostname for TLS ServerName verification
-	host, _, err := net.SplitHostPort(peerAddr)
+	certs, err := cli.CertReloader(ca)
 	if err != nil {
-		host = peerAddr
+		return nil, nil, err
 	}
 
-	return pki.ClientTLSConfig(cert, ca, host)
+	v := cli.ServerVerification(peerAddr)
+	slog.Debug("verifying peer", "addr", peerAddr, "identity", v.Identity, "server_name", v.ServerName)
+	return pki.ReloadingClientTLSConfigFor(certs, ca, v), certs, nil
 }
 
 func initializeClientPKI(cli *CLI) error {
-	// Check if CA exists (we need CA to sign client cert)
-	if !pki.CertExists(cli.PKI.CACert, cli.PKI.CAKey) {
-		return fmt.Errorf("CA not found at %s - run 'tndrl serve --pki-init' first to create CA", cli.PKI.CACert)
+	// The CA certificate is needed to verify peers
+	if _, err := os.Stat(cli.PKI.CACert); err != nil {
+		return fmt.Errorf("CA certificate not found at %s - copy ca.crt from the CA host, or run 'tndrl serve --pki-init' to create a CA", cli.PKI.CACert)
 	}
 
 	// Check if cert already exists
@@ -132,26 +162,32 @@ func initializeClientPKI(cli *CLI) error {
 		return fmt.Errorf("create directory: %w", err)
 	}
 
+	// Use a unique node identity based on hostname
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "client"
+	}
+	identity := cli.NodeIdentity(hostname)
+
+	// Without the CA key, the certificate must be signed on the CA host
+	if !cli.HasCAKey() {
+		return requestCertificate(cli, identity)
+	}
+
 	// Load CA to sign cert
-	ca, err := pki.LoadCA(cli.PKI.CACert, cli.PKI.CAKey)
+	ca, err := cli.LoadSigningCA()
 	if err != nil {
 		return fmt.Errorf("load CA: %w", err)
 	}
 
 	// Generate certificate (client + server for peer-to-peer)
-	// Use a unique node identity based on hostname
-	hostname, _ := os.Hostname()
-	if hostname == "" {
-		hostname = "client"
-	}
 	slog.Info("generating certificate", "hostname", hostname)
-	identity := pki.NodeIdentity(hostname)
-	cert, err := pki.GenerateCert(ca, identity, true, true)
+	cert, err := pki.GenerateCertWithOptions(ca, identity, true, true, cli.CertOptions())
 	if err != nil {
 		return fmt.Errorf("generate cert: %w", err)
 	}
 
-	if err := cert.Save(cli.PKI.Cert, cli.PKI.Key); err != nil {
+	if err := cert.SaveWithOptions(cli.PKI.Cert, cli.PKI.Key, cli.KeyOptions()); err != nil {
 		return fmt.Errorf("save cert: %w", err)
 	}
 	slog.Info("certificate saved", "path", cli.PKI.Cert)
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/shanemcd/tndrl/pkg/transfer"
+)
+
+// FileCmd transfers files to and from a peer.
+type FileCmd struct {
+	Put FilePutCmd `cmd:"" help:"Upload a file to a peer"`
+	Get FileGetCmd `cmd:"" help:"Download a file from a peer"`
+}
+
+// FilePutCmd uploads a file to a peer.
+type FilePutCmd struct {
+	Peer string `arg:"" help:"Peer address or name"`
+	Path string `arg:"" help:"File to upload" type:"existingfile"`
+}
+
+// Run executes the file put command.
+func (c *FilePutCmd) Run(cli *CLI) error {
+	addr := cli.ResolvePeer(c.Peer)
+	slog.Debug("uploading file", "addr", addr, "path", c.Path)
+
+	conn, err := ConnectToPeer(cli, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	files, err := conn.FileClient()
+	if err != nil {
+		return err
+	}
+	ref, err := files.Upload(context.Background(), c.Path)
+	if err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+
+	fmt.Printf("Uploaded %s (%d bytes)\n", ref.Name, ref.Size)
+	fmt.Printf("  URI: %s\n", ref.URI())
+	return nil
+}
+
+// FileGetCmd downloads a file from a peer.
+type FileGetCmd struct {
+	Peer   string `arg:"" help:"Peer address or name"`
+	File   string `arg:"" help:"File URI or SHA-256"`
+	Output string `short:"o" help:"Where to write the file (default: its SHA-256 in the current directory)" type:"path"`
+}
+
+// Run executes the file get command.
+func (c *FileGetCmd) Run(cli *CLI) error {
+	sum := c.File
+	if strings.HasPrefix(sum, transfer.URIScheme+":") {
+		var err error
+		if sum, err = transfer.ParseURI(sum); err != nil {
+			return err
+		}
+	}
+	path := c.Output
+	if path == "" {
+		path = sum
+	}
+
+	addr := cli.ResolvePeer(c.Peer)
+	slog.Debug("downloading file", "addr", addr, "sha256", sum)
+
+	conn, err := ConnectToPeer(cli, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	files, err := conn.FileClient()
+	if err != nil {
+		return err
+	}
+	ref, err := files.Download(context.Background(), sum, path)
+	if err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	fmt.Printf("Downloaded %s (%d bytes)\n", path, ref.Size)
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/enroll"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// joinTimeout bounds the enrollment RPC.
+const joinTimeout = 30 * time.Second
+
+// JoinCmd enrolls this node with a CA host using a join token.
+type JoinCmd struct {
+	Addr  string `arg:"" help:"Address of a node serving with --server-enroll"`
+	Token string `help:"Join token from 'tndrl pki token create'" env:"TNDRL_JOIN_TOKEN" required:""`
+	Name  string `help:"Node name for the certificate identity (default: --agent-name or hostname)"`
+}
+
+// Run executes the join command.
+func (c *JoinCmd) Run(cli *CLI) error {
+	token, err := enroll.ParseToken(c.Token)
+	if err != nil {
+		return err
+	}
+
+	name, err := cli.NodeName(c.Name)
+	if err != nil {
+		return err
+	}
+	identity := cli.NodeIdentity(name)
+
+	if pki.CertExists(cli.PKI.Cert, cli.PKI.Key) {
+		return fmt.Errorf("certificate already exists at %s", cli.PKI.Cert)
+	}
+
+	// A CA certificate already present must chain to the root the token pins
+	if existing, err := pki.LoadCACertificate(cli.PKI.CACert); err == nil {
+		if pki.Fingerprint(existing.Root()) != token.CAFingerprint {
+			return fmt.Errorf("token is for a different CA than %s", cli.PKI.CACert)
+		}
+	}
+
+	addr := cli.ResolvePeer(c.Addr)
+	slog.Debug("joining", "addr", addr, "identity", identity)
+
+	ctx, cancel := context.WithTimeout(context.Background(), joinTimeout)
+	defer cancel()
+
+	cert, ca, err := enroll.Join(ctx, addr, token, identity, cli.CertOptions())
+	if err != nil {
+		return err
+	}
+
+	if err := pki.SaveCertificates(cli.PKI.CACert, ca.Certificates()...); err != nil {
+		return fmt.Errorf("save CA certificate: %w", err)
+	}
+	if err := cert.SaveWithOptions(cli.PKI.Cert, cli.PKI.Key, cli.KeyOptions()); err != nil {
+		return fmt.Errorf("save cert: %w", err)
+	}
+
+	fmt.Printf("Enrolled as %s (expires %s)\n", identity, cert.Cert.NotAfter.Format(time.DateOnly))
+	fmt.Printf("Certificate written to %s\n", cli.PKI.Cert)
+	return nil
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readKeyring reads a passphrase stored in the kernel keyring, as added with
+// `keyctl add user <name> <passphrase> @u` (or @s for the session keyring).
+func readKeyring(name string) ([]byte, error) {
+	var id int
+	var err error
+	for _, ring := range []int{unix.KEY_SPEC_SESSION_KEYRING, unix.KEY_SPEC_USER_KEYRING} {
+		if id, err = unix.KeyctlSearch(ring, "user", name, 0); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find %q in the kernel keyring: %w", name, err)
+	}
+
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return nil, fmt.Errorf("read %q from the kernel keyring: %w", name, err)
+	}
+	buf := make([]byte, size)
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil {
+		return nil, fmt.Errorf("read %q from the kernel keyring: %w", name, err)
+	}
+	return buf[:min(n, size)], nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// readKeyring is only supported with the Linux kernel keyring.
+func readKeyring(name string) ([]byte, error) {
+	return nil, errors.New("the keyring passphrase source is only supported on Linux")
+}
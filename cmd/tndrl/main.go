@@ -77,6 +77,10 @@ func main() {
 		slog.Error("failed to resolve paths", "err", err)
 		os.Exit(1)
 	}
+	if err := cliArgs.Validate(); err != nil {
+		slog.Error("invalid configuration", "err", err)
+		os.Exit(1)
+	}
 
 	// Run the selected command (Kong passes cliArgs to Run method)
 	err := ctx.Run(&cliArgs)
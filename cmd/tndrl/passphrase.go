@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// PassphraseEnv holds the private key passphrase for the "env" source.
+const PassphraseEnv = "TNDRL_PKI_PASSPHRASE"
+
+// defaultKeyringName is the keyring entry read by the "keyring" source.
+const defaultKeyringName = "tndrl"
+
+// passphrase caches the key passphrase once read, so that a prompt is shown
+// once and child nodes can be given it.
+var passphrase struct {
+	mu    sync.Mutex
+	value []byte
+	err   error
+	read  bool
+}
+
+// KeyOptions returns how this invocation protects private keys at rest.
+func (cli *CLI) KeyOptions() pki.KeyOptions {
+	return pki.KeyOptions{
+		Encrypt:    cli.PKI.EncryptKeys,
+		Passphrase: cli.keyPassphrase,
+	}
+}
+
+// keyPassphrase reads the key passphrase from the configured source the
+// first time it is needed. A prompt asks twice if the passphrase is first
+// needed to encrypt a key.
+func (cli *CLI) keyPassphrase(encrypt bool) ([]byte, error) {
+	passphrase.mu.Lock()
+	defer passphrase.mu.Unlock()
+	if !passphrase.read {
+		passphrase.value, passphrase.err = readPassphrase(cli.PKI.PassphraseSource, encrypt)
+		passphrase.read = true
+	}
+	return passphrase.value, passphrase.err
+}
+
+// unlockKeys reads the passphrase now if keys are encrypted, before
+// starting child nodes that need it.
+func (cli *CLI) unlockKeys() error {
+	if !cli.keysEncrypted() {
+		return nil
+	}
+	_, err := cli.keyPassphrase(false)
+	return err
+}
+
+// keysEncrypted reports whether this invocation encrypts keys or the CA key
+// on disk is encrypted, so that child nodes will need the passphrase.
+func (cli *CLI) keysEncrypted() bool {
+	if cli.PKI.EncryptKeys {
+		return true
+	}
+	data, err := os.ReadFile(cli.PKI.CAKey)
+	return err == nil && pki.IsEncryptedKey(data)
+}
+
+// validatePassphraseSource checks a --pki-passphrase-source value.
+func validatePassphraseSource(source string) error {
+	kind, arg, _ := strings.Cut(source, ":")
+	switch kind {
+	case "", "env", "prompt", "keyring":
+		return nil
+	case "fd":
+		if _, err := strconv.Atoi(arg); err != nil {
+			return fmt.Errorf("passphrase source %q: expected fd:<number>", source)
+		}
+		return nil
+	case "file":
+		if arg == "" {
+			return fmt.Errorf("passphrase source %q: expected file:<path>", source)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown passphrase source %q (options: env, prompt, fd:<n>, file:<path>, keyring[:<name>])", source)
+	}
+}
+
+// readPassphrase reads the passphrase from a source. The empty source uses
+// the environment if PassphraseEnv is set, and otherwise prompts.
+func readPassphrase(source string, confirm bool) ([]byte, error) {
+	kind, arg, _ := strings.Cut(source, ":")
+	switch kind {
+	case "":
+		if value, ok := os.LookupEnv(PassphraseEnv); ok {
+			return []byte(value), nil
+		}
+		return promptPassphrase(confirm)
+	case "env":
+		value, ok := os.LookupEnv(PassphraseEnv)
+		if !ok {
+			return nil, fmt.Errorf("%s is not set", PassphraseEnv)
+		}
+		return []byte(value), nil
+	case "prompt":
+		return promptPassphrase(confirm)
+	case "fd":
+		fd, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("passphrase source %q: expected fd:<number>", source)
+		}
+		f := os.NewFile(uintptr(fd), "passphrase")
+		if f == nil {
+			return nil, fmt.Errorf("passphrase file descriptor %d is not open", fd)
+		}
+		defer f.Close()
+		return readFirstLine(f)
+	case "file":
+		f, err := os.Open(arg)
+		if err != nil {
+			return nil, fmt.Errorf("open passphrase file: %w", err)
+		}
+		defer f.Close()
+		return readFirstLine(f)
+	case "keyring":
+		name := arg
+		if name == "" {
+			name = defaultKeyringName
+		}
+		return readKeyring(name)
+	default:
+		return nil, validatePassphraseSource(source)
+	}
+}
+
+// readFirstLine reads a passphrase up to the first newline.
+func readFirstLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// promptPassphrase asks for the passphrase on the terminal, twice if
+// confirm is set.
+func promptPassphrase(confirm bool) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("private key passphrase needed but stdin is not a terminal: set %s or --pki-passphrase-source", PassphraseEnv)
+	}
+
+	fmt.Fprint(os.Stderr, "Private key passphrase: ")
+	value, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	if !confirm {
+		return value, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+	again, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+	if !bytes.Equal(value, again) {
+		return nil, errors.New("passphrases do not match")
+	}
+	return value, nil
+}
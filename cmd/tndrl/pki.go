@@ -0,0 +1,747 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/enroll"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// PKICmd groups the certificate management subcommands.
+type PKICmd struct {
+	Init    PKIInitCmd    `cmd:"" help:"Create the CA if missing and a certificate for this node"`
+	Request PKIRequestCmd `cmd:"" help:"Create a key and certificate request for this node"`
+	Sign    PKISignCmd    `cmd:"" help:"Sign a certificate request with the CA"`
+	Issue   PKIIssueCmd   `cmd:"" help:"Issue a certificate and key for a node with the CA"`
+	Renew   PKIRenewCmd   `cmd:"" help:"Reissue a certificate with the CA now"`
+	Inspect PKIInspectCmd `cmd:"" help:"Show the contents of a certificate file and whether peers accept it"`
+	List    PKIListCmd    `cmd:"" help:"List the certificates issued by the CA"`
+	Export  PKIExportCmd  `cmd:"" help:"Write the CA certificate, and optionally a node certificate, for a remote node"`
+	Revoke  PKIRevokeCmd  `cmd:"" help:"Revoke a certificate by serial, identity or file"`
+	Token   PKITokenCmd   `cmd:"" help:"Manage join tokens"`
+	Key     PKIKeyCmd     `cmd:"" help:"Encrypt or decrypt private keys at rest"`
+	Signer  PKISignerCmd  `cmd:"" help:"Hold the CA key in a separate signing process for --pki-ca-signer"`
+
+	Intermediate PKIIntermediateCmd `cmd:"" help:"Create an intermediate CA signed by this CA"`
+}
+
+// PKIInitCmd does what --pki-init does when a node starts, without starting it.
+type PKIInitCmd struct {
+	Name string `help:"Node name for the certificate identity (default: --agent-name or hostname)"`
+}
+
+// Run executes the pki init command.
+func (c *PKIInitCmd) Run(cli *CLI) error {
+	name, err := cli.NodeName(c.Name)
+	if err != nil {
+		return err
+	}
+	if err := initializeServerPKI(cli, name); err != nil {
+		return err
+	}
+
+	ca, err := cli.LoadCACertificate()
+	if err != nil {
+		return err
+	}
+	cert, err := pki.LoadCertificate(cli.PKI.Cert)
+	if err != nil {
+		return err
+	}
+	identity, _ := pki.IdentityFromCert(cert)
+
+	fmt.Printf("CA certificate: %s (fingerprint %s)\n", cli.PKI.CACert, pki.Fingerprint(ca.Root()))
+	if cli.PKI.CASigner != "" {
+		fmt.Printf("CA key:         held by %s\n", cli.PKI.CASigner)
+	} else if pki.CertExists(cli.PKI.CACert, cli.PKI.CAKey) {
+		fmt.Printf("CA key:         %s\n", cli.PKI.CAKey)
+	}
+	fmt.Printf("Certificate:    %s (%s, expires %s)\n", cli.PKI.Cert, identity, cert.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+// PKIRequestCmd creates the node's key and a CSR to be signed on the CA host.
+type PKIRequestCmd struct {
+	Name string `help:"Node name for the certificate identity (default: --agent-name or hostname)"`
+}
+
+// Run executes the pki request command.
+func (c *PKIRequestCmd) Run(cli *CLI) error {
+	name, err := cli.NodeName(c.Name)
+	if err != nil {
+		return err
+	}
+
+	if pki.CertExists(cli.PKI.Cert, cli.PKI.Key) {
+		return fmt.Errorf("certificate already exists at %s", cli.PKI.Cert)
+	}
+
+	if err := writeCertRequest(cli, cli.NodeIdentity(name)); err != nil {
+		return err
+	}
+	fmt.Printf("Certificate request written to %s\n", cli.CSRPath())
+	fmt.Printf("To enroll, %s\n", enrollmentHint(cli))
+	return nil
+}
+
+// PKISignCmd issues a node certificate for a CSR.
+type PKISignCmd struct {
+	CSR string `arg:"" help:"Certificate request file" type:"existingfile"`
+	Out string `help:"Where to write the certificate (default: the request path with .crt)"`
+}
+
+// Run executes the pki sign command.
+func (c *PKISignCmd) Run(cli *CLI) error {
+	ca, err := cli.LoadSigningCA()
+	if err != nil {
+		return fmt.Errorf("load CA (signing needs the CA private key): %w", err)
+	}
+
+	csr, err := pki.LoadCSR(c.CSR)
+	if err != nil {
+		return err
+	}
+
+	// The operator vouches for the SANs of a request they sign by hand
+	cert, err := ca.SignCSR(csr, true, true, pki.SignOptions{ // server + client
+		TrustDomain: pki.TrustDomain(cli.PKI.TrustDomain),
+		DNSNames:    csr.DNSNames,
+		IPAddresses: csr.IPAddresses,
+	})
+	if err != nil {
+		return err
+	}
+
+	out := c.Out
+	if out == "" {
+		out = strings.TrimSuffix(c.CSR, filepath.Ext(c.CSR)) + ".crt"
+	}
+	if err := pki.SaveCertificates(out, append([]*x509.Certificate{cert}, ca.IssuerChain()...)...); err != nil {
+		return err
+	}
+
+	identity, _ := pki.IdentityFromCert(cert)
+	fmt.Printf("Issued certificate for %s (serial %x, expires %s)\n", identity, cert.SerialNumber, cert.NotAfter.Format(time.DateOnly))
+	fmt.Printf("Certificate written to %s\n", out)
+	return nil
+}
+
+// PKIIssueCmd issues a node certificate together with its key on the CA
+// host, for nodes that cannot create their own request.
+type PKIIssueCmd struct {
+	Name string `arg:"" help:"Node name or SPIFFE ID for the certificate identity"`
+	Out  string `help:"Path of the certificate; the key is written beside it with .key (default: <name>.crt)"`
+
+	issueFlags
+}
+
+// Run executes the pki issue command.
+func (c *PKIIssueCmd) Run(cli *CLI) error {
+	identity := cli.NodeIdentity(c.Name)
+	certPath := c.Out
+	if certPath == "" {
+		certPath = path.Base(identity) + ".crt"
+	}
+	keyPath := keyPathFor(certPath)
+	if err := checkNotExist(certPath, keyPath); err != nil {
+		return err
+	}
+
+	ca, err := cli.LoadSigningCA()
+	if err != nil {
+		return fmt.Errorf("load CA (issuing needs the CA private key): %w", err)
+	}
+	cert, err := c.issue(cli, ca, identity)
+	if err != nil {
+		return err
+	}
+	if err := cert.SaveWithOptions(certPath, keyPath, cli.KeyOptions()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Issued certificate for %s (serial %x, expires %s)\n", identity, cert.Cert.SerialNumber, cert.Cert.NotAfter.Format(time.DateOnly))
+	fmt.Printf("Certificate written to %s, key to %s\n", certPath, keyPath)
+	return nil
+}
+
+// issueFlags are the certificate options of the commands that issue a
+// certificate together with its key.
+type issueFlags struct {
+	SAN          []string `name:"san" help:"Extra DNS names or IP addresses for the certificate"`
+	KeyAlgorithm string   `help:"Key algorithm (ecdsa-p256, ecdsa-p384, ed25519; default: --pki-key-algorithm)"`
+}
+
+// issue issues a server and client certificate for the identity with the
+// flags' options.
+func (f issueFlags) issue(cli *CLI, ca *pki.CA, identity string) (*pki.Cert, error) {
+	alg := f.KeyAlgorithm
+	if alg == "" {
+		alg = cli.PKI.KeyAlgorithm
+	}
+	keyAlg, err := pki.ParseKeyAlgorithm(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := pki.CertOptions{KeyAlgorithm: keyAlg}
+	opts.DNSNames, opts.IPAddresses = pki.ParseSANs(f.SAN)
+	return pki.GenerateCertWithOptions(ca, identity, true, true, opts) // server + client
+}
+
+// PKIRenewCmd reissues a certificate, regardless of how long it is valid.
+type PKIRenewCmd struct {
+	Cert string `help:"Certificate to renew; its key is beside it with .key (default: this node's certificate)" type:"existingfile"`
+}
+
+// Run executes the pki renew command.
+func (c *PKIRenewCmd) Run(cli *CLI) error {
+	certPath, keyPath := cli.PKI.Cert, cli.PKI.Key
+	if c.Cert != "" {
+		certPath, keyPath = c.Cert, keyPathFor(c.Cert)
+	}
+
+	old, err := pki.LoadCertificate(certPath)
+	if err != nil {
+		return err
+	}
+	ca, err := cli.LoadSigningCA()
+	if err != nil {
+		return fmt.Errorf("load CA (renewing needs the CA private key; on other nodes use 'tndrl pki request' or 'tndrl join'): %w", err)
+	}
+
+	cert, err := ca.Reissue(old)
+	if err != nil {
+		return err
+	}
+	if err := cert.SaveWithOptions(certPath, keyPath, cli.KeyOptions()); err != nil {
+		return err
+	}
+
+	identity, _ := pki.IdentityFromCert(cert.Cert)
+	fmt.Printf("Renewed certificate for %s (serial %x, expires %s)\n", identity, cert.Cert.SerialNumber, cert.Cert.NotAfter.Format(time.DateOnly))
+	fmt.Printf("Certificate written to %s, key to %s; a running node picks it up within a minute\n", certPath, keyPath)
+	return nil
+}
+
+// PKIInspectCmd prints what peers see in a certificate file.
+type PKIInspectCmd struct {
+	Cert string `arg:"" help:"Certificate file (PEM, optionally followed by its chain)" type:"existingfile"`
+}
+
+// Run executes the pki inspect command.
+func (c *PKIInspectCmd) Run(cli *CLI) error {
+	data, err := os.ReadFile(c.Cert)
+	if err != nil {
+		return err
+	}
+	certs, err := pki.ParseCertificates(data)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, cert := range certs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(certs) > 1 {
+			fmt.Fprintf(w, "Certificate %d of %d\n", i+1, len(certs))
+		}
+		describeCertificate(w, cert)
+	}
+
+	// A node certificate is checked against the local CA, as a peer would
+	if !certs[0].IsCA {
+		fmt.Fprintln(w)
+		if ca, err := cli.LoadCACertificate(); err != nil {
+			fmt.Fprintf(w, "Verification:\tskipped (%v)\n", err)
+		} else if err := ca.VerifyCertificate(certs); err != nil {
+			fmt.Fprintf(w, "Verification:\tFAILED against %s: %v\n", cli.PKI.CACert, err)
+		} else {
+			fmt.Fprintf(w, "Verification:\tok against %s\n", cli.PKI.CACert)
+		}
+	}
+	return w.Flush()
+}
+
+// describeCertificate writes the fields of a certificate that matter for
+// handshakes.
+func describeCertificate(w io.Writer, cert *x509.Certificate) {
+	if identity, err := pki.IdentityFromCert(cert); err == nil {
+		fmt.Fprintf(w, "Identity:\t%s\n", identity)
+	}
+	fmt.Fprintf(w, "Subject:\t%s\n", cert.Subject)
+	fmt.Fprintf(w, "Issuer:\t%s\n", cert.Issuer)
+	fmt.Fprintf(w, "Serial:\t%x\n", cert.SerialNumber)
+	fmt.Fprintf(w, "Valid from:\t%s\n", cert.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(w, "Valid until:\t%s (%s)\n", cert.NotAfter.Format(time.RFC3339), describeExpiry(cert.NotAfter))
+	if len(cert.DNSNames) > 0 {
+		fmt.Fprintf(w, "DNS names:\t%s\n", strings.Join(cert.DNSNames, ", "))
+	}
+	if len(cert.IPAddresses) > 0 {
+		ips := make([]string, len(cert.IPAddresses))
+		for i, ip := range cert.IPAddresses {
+			ips[i] = ip.String()
+		}
+		fmt.Fprintf(w, "IP addresses:\t%s\n", strings.Join(ips, ", "))
+	}
+	if alg, err := pki.KeyAlgorithmOf(cert.PublicKey); err == nil {
+		fmt.Fprintf(w, "Key:\t%s\n", alg)
+	} else {
+		fmt.Fprintf(w, "Key:\t%v\n", err)
+	}
+	fmt.Fprintf(w, "Usages:\t%s\n", strings.Join(certUsages(cert), ", "))
+	fmt.Fprintf(w, "Fingerprint:\t%s\n", pki.Fingerprint(cert))
+}
+
+// describeExpiry says how long until, or since, a certificate expires.
+func describeExpiry(notAfter time.Time) string {
+	if d := time.Until(notAfter); d > 0 {
+		return "expires in " + formatAge(d)
+	}
+	return "EXPIRED " + formatAge(time.Since(notAfter)) + " ago"
+}
+
+// certUsages names the roles a certificate may be used in.
+func certUsages(cert *x509.Certificate) []string {
+	var usages []string
+	if cert.IsCA {
+		ca := "CA"
+		if cert.MaxPathLen > 0 || cert.MaxPathLenZero {
+			ca = fmt.Sprintf("CA (max path length %d)", cert.MaxPathLen)
+		}
+		usages = append(usages, ca)
+	}
+	for _, u := range cert.ExtKeyUsage {
+		switch u {
+		case x509.ExtKeyUsageServerAuth:
+			usages = append(usages, "server")
+		case x509.ExtKeyUsageClientAuth:
+			usages = append(usages, "client")
+		case x509.ExtKeyUsageAny:
+			usages = append(usages, "any")
+		default:
+			usages = append(usages, fmt.Sprintf("extended usage %d", u))
+		}
+	}
+	if len(usages) == 0 {
+		usages = append(usages, "none")
+	}
+	return usages
+}
+
+// PKIListCmd lists the CA's issuance ledger.
+type PKIListCmd struct {
+	Identity string `help:"Only list certificates for this node name or SPIFFE ID"`
+}
+
+// Run executes the pki list command.
+func (c *PKIListCmd) Run(cli *CLI) error {
+	ca, err := cli.LoadCACertificate()
+	if err != nil {
+		return fmt.Errorf("load CA: %w", err)
+	}
+	certs, err := pki.NewLedger(cli.LedgerPath()).Certificates()
+	if err != nil {
+		return err
+	}
+
+	var identity string
+	if c.Identity != "" {
+		identity = cli.NodeIdentity(c.Identity)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SERIAL\tIDENTITY\tISSUED\tEXPIRES\tSTATUS")
+	for _, cert := range certs {
+		certIdentity, _ := pki.IdentityFromCert(cert)
+		if identity != "" && certIdentity != identity {
+			continue
+		}
+		status := "valid"
+		switch {
+		case ca.CRL.IsRevoked(cert):
+			status = "revoked"
+		case time.Now().After(cert.NotAfter):
+			status = "expired"
+		}
+		fmt.Fprintf(w, "%x\t%s\t%s\t%s\t%s\n", cert.SerialNumber, certIdentity,
+			cert.NotBefore.Format(time.DateOnly), cert.NotAfter.Format(time.DateOnly), status)
+	}
+	return w.Flush()
+}
+
+// PKIExportCmd writes what a remote node needs to trust this CA, and
+// optionally a certificate for it, into a directory to copy over.
+type PKIExportCmd struct {
+	Name string `arg:"" optional:"" help:"Node name or SPIFFE ID to issue a certificate for (default: only the CA certificate and CRL)"`
+	Out  string `help:"Directory to write to, for use as the remote node's --pki-dir" required:"" type:"path"`
+
+	issueFlags
+}
+
+// Run executes the pki export command.
+func (c *PKIExportCmd) Run(cli *CLI) error {
+	caPath := filepath.Join(c.Out, "ca.crt")
+	crlPath := filepath.Join(c.Out, pki.CRLFile)
+	certPath := filepath.Join(c.Out, "tndrl.crt")
+	keyPath := filepath.Join(c.Out, "tndrl.key")
+	if err := checkNotExist(caPath, crlPath, certPath, keyPath); err != nil {
+		return err
+	}
+
+	// The CA key is only needed, and unlocked, to issue a certificate
+	ca, err := cli.LoadCACertificate()
+	if err != nil {
+		return fmt.Errorf("load CA: %w", err)
+	}
+
+	var cert *pki.Cert
+	if c.Name != "" {
+		if !cli.HasCAKey() {
+			return fmt.Errorf("no CA private key at %s: certificates are issued on the CA host", cli.PKI.CAKey)
+		}
+		if ca, err = cli.LoadCA(); err != nil {
+			return fmt.Errorf("load CA: %w", err)
+		}
+		if cert, err = c.issue(cli, ca, cli.NodeIdentity(c.Name)); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(c.Out, 0700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	if err := pki.SaveCertificates(caPath, ca.Certificates()...); err != nil {
+		return err
+	}
+	fmt.Printf("CA certificate written to %s\n", caPath)
+
+	// The CRL only exists once something has been revoked
+	if crl, err := os.ReadFile(filepath.Join(filepath.Dir(cli.PKI.CACert), pki.CRLFile)); err == nil {
+		if err := os.WriteFile(crlPath, crl, 0644); err != nil {
+			return fmt.Errorf("write CRL: %w", err)
+		}
+		fmt.Printf("CRL written to %s\n", crlPath)
+	}
+
+	if cert != nil {
+		if err := cert.SaveWithOptions(certPath, keyPath, cli.KeyOptions()); err != nil {
+			return err
+		}
+		identity, _ := pki.IdentityFromCert(cert.Cert)
+		fmt.Printf("Issued certificate for %s (serial %x, expires %s)\n", identity, cert.Cert.SerialNumber, cert.Cert.NotAfter.Format(time.DateOnly))
+		fmt.Printf("Certificate written to %s, key to %s\n", certPath, keyPath)
+	}
+	fmt.Printf("Copy %s to the remote node and run it with --pki-dir pointing at the copy\n", c.Out)
+	return nil
+}
+
+// keyPathFor returns the path of the key kept beside a certificate.
+func keyPathFor(certPath string) string {
+	return strings.TrimSuffix(certPath, filepath.Ext(certPath)) + ".key"
+}
+
+// checkNotExist returns an error if any of the paths exists, so commands do
+// not overwrite certificates or keys.
+func checkNotExist(paths ...string) error {
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return fmt.Errorf("%s already exists", p)
+		}
+	}
+	return nil
+}
+
+// PKIRevokeCmd adds a certificate to the CA's revocation list.
+type PKIRevokeCmd struct {
+	Serial   string `help:"Serial number of the certificate to revoke (hex, colons allowed)" xor:"target" required:""`
+	Identity string `help:"Revoke every certificate issued so far for this node name or SPIFFE ID" xor:"target" required:""`
+	Cert     string `help:"Path of the certificate to revoke" type:"existingfile" xor:"target" required:""`
+}
+
+// Run executes the pki revoke command.
+func (c *PKIRevokeCmd) Run(cli *CLI) error {
+	ca, err := cli.LoadSigningCA()
+	if err != nil {
+		return fmt.Errorf("load CA: %w", err)
+	}
+
+	switch {
+	case c.Serial != "":
+		serial, ok := new(big.Int).SetString(strings.ReplaceAll(c.Serial, ":", ""), 16)
+		if !ok {
+			return fmt.Errorf("invalid serial number: %s", c.Serial)
+		}
+		ca.CRL.RevokeSerial(serial)
+		fmt.Printf("Revoked certificate with serial %x\n", serial)
+	case c.Identity != "":
+		identity := cli.NodeIdentity(c.Identity)
+		ca.CRL.RevokeIdentity(identity)
+		fmt.Printf("Revoked all certificates issued so far for %s\n", identity)
+	case c.Cert != "":
+		cert, err := pki.LoadCertificate(c.Cert)
+		if err != nil {
+			return err
+		}
+		ca.CRL.RevokeSerial(cert.SerialNumber)
+		fmt.Printf("Revoked certificate %s (serial %x)\n", cert.Subject.CommonName, cert.SerialNumber)
+	}
+
+	dir := filepath.Dir(cli.PKI.CACert)
+	if err := ca.SaveCRL(dir); err != nil {
+		return err
+	}
+	fmt.Printf("CRL written to %s (%d revoked)\n", filepath.Join(dir, pki.CRLFile), ca.CRL.Len())
+	return nil
+}
+
+// PKIIntermediateCmd issues an intermediate CA, so that an environment can
+// sign node certificates while the root key stays offline.
+type PKIIntermediateCmd struct {
+	Name string `arg:"" help:"Name of the intermediate CA (e.g. the environment)"`
+	Out  string `help:"Directory to write ca.crt and ca.key to" required:"" type:"path"`
+}
+
+// Run executes the pki intermediate command.
+func (c *PKIIntermediateCmd) Run(cli *CLI) error {
+	if pki.CAExists(c.Out) {
+		return fmt.Errorf("CA already exists in %s", c.Out)
+	}
+
+	parent, err := cli.LoadSigningCA()
+	if err != nil {
+		return fmt.Errorf("load CA (issuing needs the CA private key): %w", err)
+	}
+
+	ca, err := pki.GenerateIntermediateCA(parent, c.Name)
+	if err != nil {
+		return err
+	}
+	if err := ca.SaveWithOptions(c.Out, cli.KeyOptions()); err != nil {
+		return err
+	}
+
+	fmt.Printf("Intermediate CA %q written to %s (expires %s)\n", c.Name, c.Out, ca.Cert.NotAfter.Format(time.DateOnly))
+	fmt.Printf("Use it on the signing host with --pki-ca-cert %s --pki-ca-key %s;\n",
+		filepath.Join(c.Out, "ca.crt"), filepath.Join(c.Out, "ca.key"))
+	fmt.Printf("peers keep trusting the root CA certificate.\n")
+	return nil
+}
+
+// PKITokenCmd groups the join token subcommands.
+type PKITokenCmd struct {
+	Create PKITokenCreateCmd `cmd:"" help:"Create a one-time join token for enrolling a node"`
+}
+
+// PKITokenCreateCmd creates a join token for 'tndrl join'.
+type PKITokenCreateCmd struct {
+	TTL  time.Duration `help:"How long the token is valid" default:"15m"`
+	Name string        `help:"Name (or SPIFFE ID) of the node the token enrolls" required:""`
+	SANs []string      `name:"san" help:"DNS name or IP address the node may request in its certificate (repeatable)"`
+}
+
+// Run executes the pki token create command.
+func (c *PKITokenCreateCmd) Run(cli *CLI) error {
+	if !cli.HasCAKey() {
+		return fmt.Errorf("no CA at %s: join tokens are created on the CA host", cli.PKI.CACert)
+	}
+	ca, err := pki.LoadCACertificate(cli.PKI.CACert)
+	if err != nil {
+		return err
+	}
+
+	identity := cli.NodeIdentity(c.Name)
+	if _, err := pki.TrustDomain(cli.PKI.TrustDomain).NodeID(identity); err != nil {
+		return err
+	}
+	grant := enroll.Grant{Identity: identity}
+	grant.DNSNames, grant.IPAddresses = pki.ParseSANs(c.SANs)
+
+	token, err := enroll.NewTokens(cli.TokensPath()).Create(pki.Fingerprint(ca.Root()), grant, c.TTL)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	fmt.Fprintf(os.Stderr, "Token expires %s. On the new node run:\n", time.Now().Add(c.TTL).Format(time.RFC3339))
+	fmt.Fprintf(os.Stderr, "  tndrl join <this host's address> --token %s\n", token)
+	fmt.Fprintf(os.Stderr, "This host must be serving with --server-enroll.\n")
+	return nil
+}
+
+// PKISignerCmd serves the CA key to nodes started with --pki-ca-signer, so
+// that only this process reads it.
+type PKISignerCmd struct {
+	Socket string `help:"Unix socket to listen on, for --pki-ca-signer=unix:<socket>" xor:"mode" required:""`
+	Stdio  bool   `help:"Serve on stdin and stdout, as a plugin started by --pki-ca-signer=exec:<command>" xor:"mode" required:""`
+	Key    string `help:"Private key to sign with (default: --pki-ca-key)" type:"existingfile"`
+}
+
+// Run executes the pki signer command.
+func (c *PKISignerCmd) Run(cli *CLI) error {
+	keyPath := c.Key
+	if keyPath == "" {
+		keyPath = cli.PKI.CAKey
+	}
+	key, err := pki.LoadKeyWithOptions(keyPath, cli.KeyOptions())
+	if err != nil {
+		return err
+	}
+
+	if c.Stdio {
+		return pki.ServeSignerConn(os.Stdin, os.Stdout, key)
+	}
+
+	// Replace the socket of a signer that has gone away
+	if fi, err := os.Lstat(c.Socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", c.Socket); err == nil {
+			conn.Close()
+			return fmt.Errorf("a signer is already listening on %s", c.Socket)
+		}
+		os.Remove(c.Socket)
+	}
+	l, err := net.Listen("unix", c.Socket)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	// Only this user may have keys signed
+	if err := os.Chmod(c.Socket, 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+	go func() {
+		<-sigChan
+		l.Close()
+	}()
+
+	slog.Info("signer listening", "socket", c.Socket, "key", keyPath)
+	if err := pki.ServeSigner(l, key); err != nil {
+		return err
+	}
+	slog.Info("stopped")
+	return nil
+}
+
+// PKIKeyCmd groups the private key subcommands.
+type PKIKeyCmd struct {
+	Encrypt PKIKeyEncryptCmd `cmd:"" help:"Encrypt private keys with the passphrase"`
+	Decrypt PKIKeyDecryptCmd `cmd:"" help:"Store private keys unencrypted"`
+}
+
+// PKIKeyEncryptCmd encrypts existing private keys.
+type PKIKeyEncryptCmd struct {
+	Keys []string `arg:"" optional:"" help:"Key files (default: the CA key, if present, and this node's key)" type:"existingfile"`
+}
+
+// Run executes the pki key encrypt command.
+func (c *PKIKeyEncryptCmd) Run(cli *CLI) error {
+	return rewriteKeys(cli, c.Keys, pki.KeyOptions{Encrypt: true, Passphrase: cli.keyPassphrase})
+}
+
+// PKIKeyDecryptCmd decrypts existing private keys.
+type PKIKeyDecryptCmd struct {
+	Keys []string `arg:"" optional:"" help:"Key files (default: the CA key, if present, and this node's key)" type:"existingfile"`
+}
+
+// Run executes the pki key decrypt command.
+func (c *PKIKeyDecryptCmd) Run(cli *CLI) error {
+	return rewriteKeys(cli, c.Keys, pki.KeyOptions{Passphrase: cli.keyPassphrase})
+}
+
+// rewriteKeys loads each key and saves it again protected as opts asks,
+// skipping keys that are already in the wanted form.
+func rewriteKeys(cli *CLI, paths []string, opts pki.KeyOptions) error {
+	if len(paths) == 0 {
+		for _, p := range []string{cli.PKI.CAKey, cli.PKI.Key} {
+			if _, err := os.Stat(p); err == nil {
+				paths = append(paths, p)
+			}
+		}
+		if len(paths) == 0 {
+			return fmt.Errorf("no keys at %s or %s", cli.PKI.CAKey, cli.PKI.Key)
+		}
+	}
+
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("read key: %w", err)
+		}
+		if pki.IsEncryptedKey(data) == opts.Encrypt {
+			fmt.Printf("%s: already %s\n", p, keyState(opts.Encrypt))
+			continue
+		}
+
+		key, err := pki.LoadKeyWithOptions(p, opts)
+		if err != nil {
+			return err
+		}
+		if err := pki.SaveKeyWithOptions(p, key, opts); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s\n", p, keyState(opts.Encrypt))
+	}
+	return nil
+}
+
+// keyState describes whether a key is encrypted.
+func keyState(encrypted bool) string {
+	if encrypted {
+		return "encrypted"
+	}
+	return "unencrypted"
+}
+
+// requestCertificate prepares enrollment of a node that does not hold the
+// CA key. It writes a certificate request and returns an error explaining
+// how to get it signed.
+func requestCertificate(cli *CLI, identity string) error {
+	if err := writeCertRequest(cli, identity); err != nil {
+		return err
+	}
+	return fmt.Errorf("no CA private key to issue a certificate: %s", enrollmentHint(cli))
+}
+
+// writeCertRequest writes the node key and a CSR for the identity, unless
+// a request is already pending.
+func writeCertRequest(cli *CLI, identity string) error {
+	csrPath := cli.CSRPath()
+	if pki.CertExists(csrPath, cli.PKI.Key) {
+		slog.Debug("certificate request already exists", "path", csrPath)
+		return nil
+	}
+
+	req, err := pki.NewCertRequestWithOptions(identity, cli.CertOptions())
+	if err != nil {
+		return err
+	}
+	if err := req.SaveWithOptions(csrPath, cli.PKI.Key, cli.KeyOptions()); err != nil {
+		return err
+	}
+	slog.Info("certificate request saved", "identity", identity, "path", csrPath)
+	return nil
+}
+
+// enrollmentHint tells the user how to get the pending request signed.
+func enrollmentHint(cli *CLI) string {
+	return fmt.Sprintf("on the CA host run 'tndrl pki sign %s', then copy the resulting certificate to %s",
+		filepath.Base(cli.CSRPath()), cli.PKI.Cert)
+}
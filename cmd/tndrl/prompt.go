@@ -1,19 +1,25 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"log/slog"
+	"os"
+	"strings"
 
 	"github.com/a2aproject/a2a-go/a2a"
 	"github.com/a2aproject/a2a-go/a2aclient"
+
+	"github.com/shanemcd/tndrl/pkg/transfer"
 )
 
 // PromptCmd sends a prompt to a peer via A2A.
 type PromptCmd struct {
-	Peer    string `arg:"" help:"Peer address or name"`
-	Message string `arg:"" help:"Message to send"`
-	Stream  bool   `help:"Use streaming response" short:"s"`
+	Peer    string   `arg:"" help:"Peer address or name"`
+	Message string   `arg:"" help:"Message to send"`
+	Stream  bool     `help:"Use streaming response" short:"s"`
+	Attach  []string `help:"Upload a file to the peer and attach it to the message" short:"a" type:"existingfile"`
 }
 
 // Run executes the prompt command.
@@ -34,54 +40,121 @@ func (c *PromptCmd) Run(cli *CLI) error {
 	defer transport.Destroy()
 
 	ctx := context.Background()
-	if c.Stream {
-		return doStreamingPrompt(ctx, transport, c.Message)
+	in := bufio.NewScanner(os.Stdin)
+	parts := []a2a.Part{a2a.TextPart{Text: c.Message}}
+	if len(c.Attach) > 0 {
+		files, err := conn.FileClient()
+		if err != nil {
+			return err
+		}
+		for _, path := range c.Attach {
+			ref, err := files.Upload(ctx, path)
+			if err != nil {
+				return fmt.Errorf("attach %s: %w", path, err)
+			}
+			slog.Debug("attached file", "path", path, "uri", ref.URI())
+			parts = append(parts, ref.FilePart())
+		}
+	}
+	msg := a2a.NewMessage(a2a.MessageRoleUser, parts...)
+
+	// Keep answering while the agent asks for input
+	for {
+		var waiting *a2a.Task
+		if c.Stream {
+			waiting, err = doStreamingPrompt(ctx, transport, msg)
+		} else {
+			waiting, err = doPrompt(ctx, transport, msg)
+		}
+		if err != nil || waiting == nil {
+			return err
+		}
+
+		answer, ok := readAnswer(in)
+		if !ok {
+			fmt.Printf("Task %s is waiting for input.\n", waiting.ID)
+			return in.Err()
+		}
+		msg = a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: answer})
+		msg.TaskID = waiting.ID
+		msg.ContextID = waiting.ContextID
 	}
-	return doPrompt(ctx, transport, c.Message)
 }
 
-func doPrompt(ctx context.Context, transport a2aclient.Transport, content string) error {
-	msg := a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: content})
+// doPrompt sends a message and prints the response. It returns the task if
+// the agent is waiting for input.
+func doPrompt(ctx context.Context, transport a2aclient.Transport, msg *a2a.Message) (*a2a.Task, error) {
 	resp, err := transport.SendMessage(ctx, &a2a.MessageSendParams{Message: msg})
 	if err != nil {
-		return fmt.Errorf("send message failed: %w", err)
+		return nil, fmt.Errorf("send message failed: %w", err)
 	}
 
 	switch r := resp.(type) {
 	case *a2a.Task:
 		printTask(r)
+		if r.Status.State == a2a.TaskStateInputRequired {
+			return r, nil
+		}
 	case *a2a.Message:
 		printMessage(r)
 	default:
 		fmt.Printf("Response: %+v\n", resp)
 	}
-	return nil
+	return nil, nil
 }
 
-func doStreamingPrompt(ctx context.Context, transport a2aclient.Transport, content string) error {
-	msg := a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: content})
+// doStreamingPrompt sends a message and streams the response. It returns the
+// task if the agent is waiting for input.
+func doStreamingPrompt(ctx context.Context, transport a2aclient.Transport, msg *a2a.Message) (*a2a.Task, error) {
 	events := transport.SendStreamingMessage(ctx, &a2a.MessageSendParams{Message: msg})
 
+	var waiting *a2a.Task
 	for event, err := range events {
 		if err != nil {
-			return fmt.Errorf("streaming error: %w", err)
+			return nil, fmt.Errorf("streaming error: %w", err)
 		}
 
 		switch e := event.(type) {
 		case *a2a.TaskStatusUpdateEvent:
 			if e.Status.Message != nil {
 				for _, part := range e.Status.Message.Parts {
-					if text, ok := part.(a2a.TextPart); ok {
-						fmt.Print(text.Text)
+					switch p := part.(type) {
+					case a2a.TextPart:
+						fmt.Print(p.Text)
+					case a2a.FilePart:
+						fmt.Printf("\n%s\n", describeFile(p))
 					}
 				}
 			}
+			if e.Status.State == a2a.TaskStateInputRequired {
+				waiting = &a2a.Task{ID: e.TaskID, ContextID: e.ContextID, Status: e.Status}
+			}
 		case *a2a.TaskArtifactUpdateEvent:
 			fmt.Printf("\n[artifact] %s\n", e.Artifact.Name)
+			for _, part := range e.Artifact.Parts {
+				if file, ok := part.(a2a.FilePart); ok {
+					fmt.Printf("  %s\n", describeFile(file))
+				}
+			}
 		}
 	}
 	fmt.Println()
-	return nil
+	return waiting, nil
+}
+
+// readAnswer prompts for and reads a non-empty line from the user.
+// It returns false at end of input.
+func readAnswer(in *bufio.Scanner) (string, bool) {
+	for {
+		fmt.Print("> ")
+		if !in.Scan() {
+			fmt.Println()
+			return "", false
+		}
+		if answer := strings.TrimSpace(in.Text()); answer != "" {
+			return answer, true
+		}
+	}
 }
 
 func printTask(task *a2a.Task) {
@@ -91,16 +164,41 @@ func printTask(task *a2a.Task) {
 	if task.Status.Message != nil {
 		printMessage(task.Status.Message)
 	}
+	for _, artifact := range task.Artifacts {
+		fmt.Printf("Artifact %s:\n", artifact.Name)
+		printParts(artifact.Parts)
+	}
 }
 
 func printMessage(msg *a2a.Message) {
 	fmt.Printf("Message (role=%s):\n", msg.Role)
-	for _, part := range msg.Parts {
+	printParts(msg.Parts)
+}
+
+func printParts(parts a2a.ContentParts) {
+	for _, part := range parts {
 		switch p := part.(type) {
 		case a2a.TextPart:
 			fmt.Printf("  %s\n", p.Text)
+		case a2a.FilePart:
+			fmt.Printf("  %s\n", describeFile(p))
 		default:
 			fmt.Printf("  [%T]\n", part)
 		}
 	}
 }
+
+// describeFile names a file part and where to fetch it. Files transferred
+// between nodes are fetched with 'tndrl file get'.
+func describeFile(part a2a.FilePart) string {
+	if ref, ok := transfer.RefFromPart(part); ok {
+		return fmt.Sprintf("[file] %s (%d bytes) %s", ref.Name, ref.Size, ref.URI())
+	}
+	switch f := part.File.(type) {
+	case a2a.FileURI:
+		return fmt.Sprintf("[file] %s %s", f.Name, f.URI)
+	case a2a.FileBytes:
+		return fmt.Sprintf("[file] %s (inline)", f.Name)
+	}
+	return fmt.Sprintf("[%T]", part.File)
+}
@@ -5,22 +5,31 @@ import (
 	"crypto/tls"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/a2aproject/a2a-go/a2a"
+	"github.com/a2aproject/a2a-go/a2asrv"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
 
 	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
 	"github.com/shanemcd/tndrl/pkg/a2aexec"
+	"github.com/shanemcd/tndrl/pkg/authz"
 	"github.com/shanemcd/tndrl/pkg/control"
+	"github.com/shanemcd/tndrl/pkg/enroll"
 	"github.com/shanemcd/tndrl/pkg/llm"
 	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/policy"
+	"github.com/shanemcd/tndrl/pkg/transfer"
+	"github.com/shanemcd/tndrl/pkg/transport"
 	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+	tcptransport "github.com/shanemcd/tndrl/pkg/transport/tcp"
 )
 
 // ServeCmd runs tndrl as a daemon, listening for incoming connections.
@@ -30,32 +39,107 @@ type ServeCmd struct{}
 func (c *ServeCmd) Run(cli *CLI) error {
 	slog.Info("starting", "addr", cli.Server.Addr)
 
-	tlsConfig, err := setupServerTLS(cli)
+	tlsConfig, ca, certs, err := setupServerTLS(cli)
 	if err != nil {
 		return fmt.Errorf("setup TLS: %w", err)
 	}
+	defer certs.Stop()
 
-	// Create multiplexed QUIC listener
-	listener, err := quictransport.ListenMux(cli.Server.Addr, tlsConfig, nil)
+	var enroller *enroll.Service
+	if cli.Server.Enroll {
+		enroller, err = enroll.NewService(ca, enroll.NewTokens(cli.TokensPath()), pki.TrustDomain(cli.PKI.TrustDomain))
+		if err != nil {
+			return err
+		}
+		// Joining nodes have no certificate yet; only Enroll serves them
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		slog.Info("enrollment enabled", "tokens", cli.TokensPath())
+	}
+
+	policy, err := cli.AuthzPolicy()
 	if err != nil {
-		return fmt.Errorf("listen: %w", err)
+		return err
+	}
+	if len(cli.Server.Authz) > 0 {
+		slog.Info("authz policy configured", "rules", len(cli.Server.Authz))
 	}
 
-	// Create LLM provider (use background context since provider lifecycle is long)
 	ctx := context.Background()
-	provider, err := cli.CreateLLMProvider(ctx)
+	identity := cli.Identity()
+	engine, err := cli.PolicyEngine(ctx, identity)
+	if err != nil {
+		return err
+	}
+	if engine != nil {
+		slog.Info("policy configured", "dir", cli.Policy.Dir)
+	}
+
+	// Create a multiplexed listener per transport, all at the same address
+	var listeners []transport.Listener
+	for _, name := range cli.Server.Transports {
+		listener, err := listenMux(name, cli.Server.Addr, tlsConfig)
+		if err != nil {
+			closeListeners(listeners)
+			return fmt.Errorf("listen (%s): %w", name, err)
+		}
+		if engine != nil {
+			listener.SetAcceptFunc(engine.AcceptConn)
+		}
+		listeners = append(listeners, listener)
+	}
+
+	// Create LLM provider (use background context since provider lifecycle is long)
+	var toolCheck llm.ToolCheck
+	if engine != nil {
+		toolCheck = engine.CheckTool
+	}
+	provider, err := cli.CreateLLMProvider(ctx, toolCheck)
 	if err != nil {
 		return fmt.Errorf("create LLM provider: %w", err)
 	}
 	slog.Info("llm provider configured", "provider", provider.Name())
 
+	taskStore, err := cli.CreateTaskStore()
+	if err != nil {
+		return fmt.Errorf("create task store: %w", err)
+	}
+	slog.Info("task store configured", "type", cli.Server.TaskStore)
+
+	files, err := transfer.NewStoreWithOptions(cli.Server.FileDir, transfer.StoreOptions{
+		MaxSize: cli.Server.FileMax,
+	})
+	if err != nil {
+		return err
+	}
+	var fileListeners []net.Listener
+	for _, listener := range listeners {
+		fileListener, err := listener.RegisterStreamType(transfer.StreamType, transfer.StreamTypeName)
+		if err != nil {
+			closeListeners(listeners)
+			return fmt.Errorf("register file stream type: %w", err)
+		}
+		fileListeners = append(fileListeners, fileListener)
+	}
+
 	// Create and run server
 	srv := newServer(serverConfig{
-		listener:    listener,
-		identity:    cli.Identity(),
+		listeners:   listeners,
+		identity:    identity,
 		llmProvider: provider,
-		agentCard:   cli.AgentCard(listener.Addr().String()),
+		agentCard:   cli.AgentCard(listeners[0].Addr().String()),
 		streaming:   cli.IsStreaming(),
+		history: a2aexec.HistoryOptions{
+			MaxTurns:    cli.LLM.HistoryTurns,
+			MaxChars:    cli.LLM.HistoryChars,
+			MaxContexts: cli.LLM.HistoryContexts,
+		},
+		taskStore:     taskStore,
+		files:         files,
+		fileListeners: fileListeners,
+		authz:         policy,
+		policy:        engine,
+		enroller:      enroller,
+		expiry:        cli.ExpiryMonitor(certs, ca),
 	})
 
 	// Handle signals
@@ -76,12 +160,30 @@ func (c *ServeCmd) Run(cli *CLI) error {
 	return nil
 }
 
-// server encapsulates the daemon's runtime components.
+// listenMux creates a multiplexed listener over the named transport.
+func listenMux(name, addr string, tlsConfig *tls.Config) (transport.Listener, error) {
+	if name == tcptransport.Transport {
+		return tcptransport.ListenMux(addr, tlsConfig, nil)
+	}
+	return quictransport.ListenMux(addr, tlsConfig, nil)
+}
+
+func closeListeners(listeners []transport.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// server encapsulates the daemon's runtime components. The control, A2A and
+// file servers serve every listener alike, whichever transport carries it.
 type server struct {
-	listener      *quictransport.MuxListener
+	listeners     []transport.Listener
 	controlServer *grpc.Server
 	a2aServer     *grpc.Server
+	fileServer    *transfer.Server
+	fileListeners []net.Listener
 	state         *control.State
+	expiry        *control.ExpiryMonitor
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -89,74 +191,121 @@ type server struct {
 }
 
 type serverConfig struct {
-	listener    *quictransport.MuxListener
+	listeners   []transport.Listener
 	identity    string
 	llmProvider llm.Provider
 	agentCard   *a2a.AgentCard
 	streaming   bool
+	history     a2aexec.HistoryOptions
+	taskStore   a2asrv.TaskStore
+	files       *transfer.Store
+	authz       *authz.Policy
+	policy      *policy.Engine
+	enroller    *enroll.Service
+	expiry      *control.ExpiryMonitor
+
+	// fileListeners accept file transfer streams; none disables them
+	fileListeners []net.Listener
 }
 
 func newServer(cfg serverConfig) *server {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	s := &server{
-		listener: cfg.listener,
-		state:    control.NewState(cfg.identity),
-		ctx:      ctx,
-		cancel:   cancel,
+		listeners:     cfg.listeners,
+		fileListeners: cfg.fileListeners,
+		state:         control.NewState(cfg.identity),
+		expiry:        cfg.expiry,
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+	if cfg.expiry != nil {
+		s.state.SetExpiryMonitor(cfg.expiry)
+	}
+
+	// Both servers see the caller's certificate and enforce the authz
+	// allow-list, then OPA policy. When enrollment is enabled, callers
+	// without a certificate are first limited to Enroll.
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	if cfg.enroller != nil {
+		unary = append(unary, enroll.UnaryServerInterceptor())
+		stream = append(stream, enroll.StreamServerInterceptor())
+	}
+	unary = append(unary, cfg.authz.UnaryServerInterceptor(), cfg.policy.UnaryServerInterceptor())
+	stream = append(stream, cfg.authz.StreamServerInterceptor(), cfg.policy.StreamServerInterceptor())
+
+	opts := []grpc.ServerOption{
+		grpc.Creds(transport.Credentials()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
 	}
 
 	// Create control server
-	s.controlServer = grpc.NewServer()
+	s.controlServer = grpc.NewServer(opts...)
 	controlSvc := control.NewServer(s.state, s.triggerShutdown)
+	if cfg.enroller != nil {
+		controlSvc.SetEnroller(cfg.enroller)
+	}
 	tndrlv1.RegisterControlServiceServer(s.controlServer, controlSvc)
 
 	// Create A2A server with LLM provider
-	s.a2aServer = grpc.NewServer()
+	s.a2aServer = grpc.NewServer(opts...)
 	executor := &a2aexec.Executor{
 		Provider:  cfg.llmProvider,
 		Streaming: cfg.streaming,
+		History:   a2aexec.NewHistory(cfg.history),
+		Files:     cfg.files,
 	}
 
 	a2aexec.RegisterWithGRPC(s.a2aServer, &a2aexec.ServerConfig{
 		Executor:  executor,
 		AgentCard: cfg.agentCard,
+		TaskStore: cfg.taskStore,
 	})
 
+	// File transfers are checked against the same authz allow-list
+	if len(cfg.fileListeners) > 0 {
+		s.fileServer = &transfer.Server{Store: cfg.files, Policy: cfg.authz}
+	}
+
 	return s
 }
 
 func (s *server) run() error {
 	s.state.SetReady()
-	slog.Info("ready", "addr", s.listener.Addr(), "transport", "QUIC")
-	slog.Debug("stream type registered", "type", "control", "id", fmt.Sprintf("0x%02x", quictransport.StreamTypeControl))
-	slog.Debug("stream type registered", "type", "a2a", "id", fmt.Sprintf("0x%02x", quictransport.StreamTypeA2A))
+	for _, l := range s.listeners {
+		slog.Info("ready", "addr", l.Addr(), "transport", l.Transport())
+	}
+	slog.Debug("stream type registered", "type", "control", "id", fmt.Sprintf("0x%02x", transport.StreamTypeControl))
+	slog.Debug("stream type registered", "type", "a2a", "id", fmt.Sprintf("0x%02x", transport.StreamTypeA2A))
+	if s.fileServer != nil {
+		slog.Debug("stream type registered", "type", transfer.StreamTypeName, "id", fmt.Sprintf("0x%02x", transfer.StreamType))
+	}
 
-	errChan := make(chan error, 2)
+	errChan := make(chan error, 3*len(s.listeners))
 
-	// Start control server
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		if err := s.controlServer.Serve(s.listener.ControlListener()); err != nil {
-			select {
-			case <-s.ctx.Done():
-			case errChan <- fmt.Errorf("control server: %w", err):
-			}
-		}
-	}()
+	// Watch certificate expiry
+	if s.expiry != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.expiry.Run(s.ctx)
+		}()
+	}
 
-	// Start A2A server
-	s.wg.Add(1)
-	go func() {
-		defer s.wg.Done()
-		if err := s.a2aServer.Serve(s.listener.A2AListener()); err != nil {
-			select {
-			case <-s.ctx.Done():
-			case errChan <- fmt.Errorf("a2a server: %w", err):
-			}
+	// Start the control and A2A servers on every listener
+	for _, l := range s.listeners {
+		s.serve("control server", l, func() error { return s.controlServer.Serve(l.Listener(transport.StreamTypeControl)) }, errChan)
+		s.serve("a2a server", l, func() error { return s.a2aServer.Serve(l.Listener(transport.StreamTypeA2A)) }, errChan)
+	}
+
+	// Start file transfer server
+	if s.fileServer != nil {
+		for i, fl := range s.fileListeners {
+			s.serve("file server", s.listeners[i], func() error { return s.fileServer.Serve(fl) }, errChan)
 		}
-	}()
+	}
 
 	// Wait for context cancellation or error
 	select {
@@ -169,9 +318,24 @@ func (s *server) run() error {
 	return nil
 }
 
+// serve runs fn in the background, reporting its error on errChan unless
+// the server is shutting down.
+func (s *server) serve(name string, l transport.Listener, fn func() error, errChan chan<- error) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if err := fn(); err != nil {
+			select {
+			case <-s.ctx.Done():
+			case errChan <- fmt.Errorf("%s (%s): %w", name, l.Transport(), err):
+			}
+		}
+	}()
+}
+
 func (s *server) stopServers(graceful bool) {
 	s.cancel()
-	s.listener.Close()
+	closeListeners(s.listeners)
 	if graceful {
 		s.controlServer.GracefulStop()
 		s.a2aServer.GracefulStop()
@@ -204,55 +368,61 @@ func (s *server) shutdown() {
 	s.wg.Wait()
 }
 
-func setupServerTLS(cli *CLI) (*tls.Config, error) {
+func setupServerTLS(cli *CLI) (*tls.Config, *pki.CA, *pki.Reloader, error) {
 	// Handle PKI initialization
 	if cli.PKI.Init {
-		if err := initializeServerPKI(cli); err != nil {
-			return nil, fmt.Errorf("initialize PKI: %w", err)
+		if err := initializeServerPKI(cli, cli.Agent.Name); err != nil {
+			return nil, nil, nil, fmt.Errorf("initialize PKI: %w", err)
 		}
 	}
 
-	// Load CA
-	ca, err := pki.LoadCA(cli.PKI.CACert, cli.PKI.CAKey)
+	// Load CA (the private key is optional)
+	ca, err := cli.LoadCA()
 	if err != nil {
-		return nil, fmt.Errorf("load CA (try --pki-init to generate): %w", err)
+		return nil, nil, nil, fmt.Errorf("load CA (try --pki-init to generate): %w", err)
 	}
 
-	// Load certificate
-	cert, err := pki.LoadCert(cli.PKI.Cert, cli.PKI.Key)
+	// Load certificate, picking up replacements and renewals without a restart
+	certs, err := cli.CertReloader(ca)
 	if err != nil {
-		return nil, fmt.Errorf("load cert (try --pki-init to generate): %w", err)
+		return nil, nil, nil, err
 	}
 
 	// Create mTLS server config
-	return pki.ServerTLSConfig(cert, ca)
+	return pki.ReloadingServerTLSConfig(certs, ca), ca, certs, nil
 }
 
-func initializeServerPKI(cli *CLI) error {
+// initializeServerPKI creates the CA if there is none, and a certificate for
+// the named node (a random name if empty) if it has none.
+func initializeServerPKI(cli *CLI, name string) error {
 	// Ensure directory exists
 	if err := os.MkdirAll(cli.PKI.Dir, 0700); err != nil {
 		return fmt.Errorf("create PKI directory: %w", err)
 	}
 
-	// Check if CA exists
+	// Load the CA, or create one if there is none. A node given only the
+	// CA certificate must have its certificate signed on the CA host.
 	var ca *pki.CA
 	var err error
 
-	if pki.CAExists(cli.PKI.Dir) {
+	if cli.HasCAKey() {
 		slog.Debug("loading existing CA", "dir", cli.PKI.Dir)
-		ca, err = pki.LoadCA(cli.PKI.CACert, cli.PKI.CAKey)
+		ca, err = cli.LoadSigningCA()
 		if err != nil {
 			return fmt.Errorf("load existing CA: %w", err)
 		}
+	} else if _, statErr := os.Stat(cli.PKI.CACert); statErr == nil {
+		slog.Debug("CA private key not present", "cert", cli.PKI.CACert)
 	} else {
 		slog.Info("generating new CA")
 		ca, err = pki.GenerateCA()
 		if err != nil {
 			return fmt.Errorf("generate CA: %w", err)
 		}
-		if err := ca.Save(cli.PKI.Dir); err != nil {
+		if err := ca.SaveWithOptions(cli.PKI.Dir, cli.KeyOptions()); err != nil {
 			return fmt.Errorf("save CA: %w", err)
 		}
+		ca.Ledger = pki.NewLedger(filepath.Join(cli.PKI.Dir, pki.LedgerFile))
 		slog.Info("CA saved", "dir", cli.PKI.Dir)
 	}
 
@@ -263,19 +433,22 @@ func initializeServerPKI(cli *CLI) error {
 	}
 
 	// Generate certificate
-	name := cli.Agent.Name
 	if name == "" {
 		name = uuid.New().String()[:8]
 	}
+	identity := cli.NodeIdentity(name)
+
+	if ca == nil {
+		return requestCertificate(cli, identity)
+	}
 
 	slog.Info("generating certificate", "name", name)
-	identity := pki.UnitIdentity(name)
-	cert, err := pki.GenerateCert(ca, identity, true, true) // server + client
+	cert, err := pki.GenerateCertWithOptions(ca, identity, true, true, cli.CertOptions()) // server + client
 	if err != nil {
 		return fmt.Errorf("generate cert: %w", err)
 	}
 
-	if err := cert.Save(cli.PKI.Cert, cli.PKI.Key); err != nil {
+	if err := cert.SaveWithOptions(cli.PKI.Cert, cli.PKI.Key, cli.KeyOptions()); err != nil {
 		return fmt.Errorf("save cert: %w", err)
 	}
 	slog.Info("certificate saved", "path", cli.PKI.Cert)
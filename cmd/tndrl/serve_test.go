@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/a2aproject/a2a-go/a2a"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/authz"
+	"github.com/shanemcd/tndrl/pkg/llm"
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transfer"
+	"github.com/shanemcd/tndrl/pkg/transport"
+	"github.com/shanemcd/tndrl/pkg/transport/memory"
+)
+
+// The address is an IP literal so that gRPC's default resolver passes it to
+// the dialer unchanged.
+const testAddr = "127.0.0.1:4433"
+
+// testServer runs a server on a memory listener and returns the network
+// peers reach it on.
+func testServer(t *testing.T) (srv *server, network *memory.Network, ca *pki.CA, files *transfer.Store) {
+	t.Helper()
+
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	cert, err := pki.GenerateCert(ca, pki.NodeIdentity("server"), true, true)
+	if err != nil {
+		t.Fatalf("generate cert: %v", err)
+	}
+
+	network = memory.NewNetwork()
+	listener, err := network.Listen(testAddr, cert.Cert)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	fileListener, err := listener.RegisterStreamType(transfer.StreamType, transfer.StreamTypeName)
+	if err != nil {
+		t.Fatalf("register file stream type: %v", err)
+	}
+
+	policy, err := authz.NewPolicy([]authz.Rule{{
+		Methods: []string{"/tndrl.v1.ControlService/Shutdown"},
+		Allow:   []string{pki.NodeIdentity("ops")},
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	files, err = transfer.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	srv = newServer(serverConfig{
+		listeners:     []transport.Listener{listener},
+		identity:      pki.NodeIdentity("server"),
+		llmProvider:   llm.NewEchoProvider(),
+		agentCard:     &a2a.AgentCard{Name: "server"},
+		files:         files,
+		fileListeners: []net.Listener{fileListener},
+		authz:         policy,
+	})
+	errc := make(chan error, 1)
+	go func() { errc <- srv.run() }()
+	t.Cleanup(func() {
+		srv.triggerShutdown(false, 0, "test done")
+		if err := <-errc; err != nil {
+			t.Errorf("run: %v", err)
+		}
+		srv.wg.Wait()
+	})
+
+	return srv, network, ca, files
+}
+
+// connect connects to the test server as the named node.
+func connect(t *testing.T, network *memory.Network, ca *pki.CA, name string) *PeerConnection {
+	t.Helper()
+
+	cert, err := pki.GenerateCert(ca, pki.NodeIdentity(name), false, true)
+	if err != nil {
+		t.Fatalf("generate cert: %v", err)
+	}
+	pc, err := newPeerConnection(network.Dialer(cert.Cert), testAddr)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pc.Close)
+	return pc
+}
+
+func TestServer_Services(t *testing.T) {
+	_, network, ca, files := testServer(t)
+	pc := connect(t, network, ca, "client")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Control
+	st, err := pc.ControlClient().GetStatus(ctx, &tndrlv1.GetStatusRequest{})
+	if err != nil {
+		t.Fatalf("GetStatus: %v", err)
+	}
+	if st.Identity != pki.NodeIdentity("server") {
+		t.Errorf("identity = %q, want %q", st.Identity, pki.NodeIdentity("server"))
+	}
+
+	// A2A, with the echo provider
+	a2aTransport, err := pc.A2ATransport()
+	if err != nil {
+		t.Fatalf("A2ATransport: %v", err)
+	}
+	defer a2aTransport.Destroy()
+	resp, err := a2aTransport.SendMessage(ctx, &a2a.MessageSendParams{
+		Message: a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: "hello"}),
+	})
+	if err != nil {
+		t.Fatalf("SendMessage: %v", err)
+	}
+	reply, ok := resp.(*a2a.Message)
+	if !ok {
+		t.Fatalf("response is %T, want *a2a.Message", resp)
+	}
+	if text := reply.Parts[0].(a2a.TextPart).Text; text != "hello" {
+		t.Errorf("reply = %q, want %q", text, "hello")
+	}
+
+	// File transfer
+	src := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(src, []byte("some notes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fileClient, err := pc.FileClient()
+	if err != nil {
+		t.Fatalf("FileClient: %v", err)
+	}
+	ref, err := fileClient.Upload(ctx, src)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if size, err := files.Stat(ref.SHA256); err != nil || size != int64(len("some notes")) {
+		t.Errorf("stored file size = %d, %v", size, err)
+	}
+}
+
+func TestServer_Authz(t *testing.T) {
+	srv, network, ca, _ := testServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only ops may shut the server down
+	intruder := connect(t, network, ca, "intruder")
+	_, err := intruder.ControlClient().Shutdown(ctx, &tndrlv1.ShutdownRequest{Reason: "test"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Shutdown by intruder = %v, want PermissionDenied", err)
+	}
+
+	// A forced shutdown may close the connection before the reply arrives,
+	// so check that the server stops instead
+	ops := connect(t, network, ca, "ops")
+	_, err = ops.ControlClient().Shutdown(ctx, &tndrlv1.ShutdownRequest{Reason: "test"})
+	if status.Code(err) == codes.PermissionDenied {
+		t.Fatalf("Shutdown by ops: %v", err)
+	}
+	select {
+	case <-srv.ctx.Done():
+	case <-ctx.Done():
+		t.Error("server did not stop")
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/a2aproject/a2a-go/a2a"
+	"github.com/a2aproject/a2a-go/a2aclient"
+
+	"github.com/shanemcd/tndrl/pkg/session"
+)
+
+// SessionCmd groups the session management subcommands.
+type SessionCmd struct {
+	Create SessionCreateCmd `cmd:"" help:"Create a session and start its task"`
+	List   SessionListCmd   `cmd:"" help:"List sessions"`
+	Attach SessionAttachCmd `cmd:"" help:"Attach to a session for interactive conversation"`
+	Delete SessionDeleteCmd `cmd:"" help:"Delete a session"`
+	Logs   SessionLogsCmd   `cmd:"" help:"Show session environment logs"`
+}
+
+// SessionCreateCmd creates a session and sends it the initial task.
+type SessionCreateCmd struct {
+	Task   string `help:"Task description for the agent" required:""`
+	Driver string `help:"Environment driver (local); defaults to --session-driver"`
+	Peer   string `help:"Run the session on an existing node instead of provisioning one (address or peer name)"`
+}
+
+// Run executes the session create command.
+func (c *SessionCreateCmd) Run(cli *CLI) error {
+	if c.Peer != "" && c.Driver != "" {
+		return fmt.Errorf("--peer and --driver are mutually exclusive")
+	}
+
+	reg, err := cli.SessionRegistry()
+	if err != nil {
+		return err
+	}
+
+	driverName := c.Driver
+	if driverName == "" {
+		driverName = cli.Sessions.Driver
+	}
+	if c.Peer != "" {
+		driverName = "peer"
+	}
+
+	var driver session.Driver
+	if c.Peer == "" {
+		if err := cli.unlockKeys(); err != nil {
+			return err
+		}
+		driver, err = cli.CreateSessionDriver(driverName)
+		if err != nil {
+			return err
+		}
+	}
+
+	sess := session.New(driverName, c.Task)
+	if err := reg.Create(sess); err != nil {
+		return err
+	}
+	fmt.Printf("Creating session %s...\n", sess.ID)
+
+	ctx := context.Background()
+	if driver == nil {
+		// No environment to provision: the node is already running
+		sess.Endpoint = cli.ResolvePeer(c.Peer)
+		if err := transitionSession(reg, sess, session.StateStarting); err != nil {
+			return err
+		}
+	} else if err := startEnvironment(ctx, reg, sess, driver); err != nil {
+		return err
+	}
+
+	conn, err := ConnectToPeer(cli, sess.Endpoint)
+	if err != nil {
+		return failSession(reg, sess, err)
+	}
+	defer conn.Close()
+
+	transport, err := conn.A2ATransport()
+	if err != nil {
+		return failSession(reg, sess, err)
+	}
+	defer transport.Destroy()
+
+	if err := transitionSession(reg, sess, session.StateWorking); err != nil {
+		return err
+	}
+	fmt.Printf("Session %s created.\n", sess.ID)
+
+	return sendSessionMessage(ctx, reg, sess, transport, c.Task)
+}
+
+// startEnvironment provisions and starts the session's environment, moving
+// the session from creating to starting. The environment is recorded in the
+// registry so that a later delete can tear it down.
+func startEnvironment(ctx context.Context, reg *session.Registry, sess *session.Session, driver session.Driver) error {
+	fmt.Printf("Provisioning %s environment...\n", driver.Name())
+	env, err := driver.Provision(ctx, session.ProvisionOptions{SessionID: sess.ID, Task: sess.Task})
+	if err != nil {
+		return failSession(reg, sess, fmt.Errorf("provision: %w", err))
+	}
+	if err := reg.SaveEnvironment(env); err != nil {
+		return err
+	}
+
+	if err := transitionSession(reg, sess, session.StateStarting); err != nil {
+		return err
+	}
+
+	fmt.Println("Waiting for tndrl node...")
+	startErr := driver.Start(ctx, env)
+	if err := reg.SaveEnvironment(env); err != nil {
+		return err
+	}
+	if startErr != nil {
+		return failSession(reg, sess, fmt.Errorf("start: %w", startErr))
+	}
+
+	sess.Endpoint = env.Endpoint
+	slog.Debug("session environment started", "session", sess.ID, "driver", driver.Name(), "addr", env.Endpoint)
+	return reg.Save(sess)
+}
+
+// SessionListCmd lists sessions in the registry.
+type SessionListCmd struct{}
+
+// Run executes the session list command.
+func (c *SessionListCmd) Run(cli *CLI) error {
+	reg, err := cli.SessionRegistry()
+	if err != nil {
+		return err
+	}
+
+	sessions, err := reg.List()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tDRIVER\tSTATUS\tTASK\tAGE")
+	for _, s := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.ID, s.Driver, s.State, truncate(s.Task, 28), formatAge(time.Since(s.CreatedAt)))
+	}
+	return w.Flush()
+}
+
+// SessionAttachCmd attaches to a session for an interactive conversation.
+type SessionAttachCmd struct {
+	ID      string `arg:"" help:"Session ID"`
+	History int    `help:"Number of recent messages to show" default:"10"`
+}
+
+// Run executes the session attach command.
+func (c *SessionAttachCmd) Run(cli *CLI) error {
+	reg, err := cli.SessionRegistry()
+	if err != nil {
+		return err
+	}
+
+	sess, err := reg.Get(c.ID)
+	if err != nil {
+		return err
+	}
+
+	history, err := reg.History(sess.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[Session %s - %s]\n\n", sess.ID, sess.State)
+	msgs := history.Messages
+	if c.History >= 0 && len(msgs) > c.History {
+		msgs = msgs[len(msgs)-c.History:]
+	}
+	for _, m := range msgs {
+		printSessionMessage(m.Role, m.Content)
+	}
+
+	if sess.State != session.StateWaiting {
+		if sess.Error != "" {
+			fmt.Printf("Error: %s\n", sess.Error)
+		}
+		fmt.Printf("Session is %s; not waiting for input.\n", sess.State)
+		return nil
+	}
+
+	conn, err := ConnectToPeer(cli, sess.Endpoint)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	transport, err := conn.A2ATransport()
+	if err != nil {
+		return err
+	}
+	defer transport.Destroy()
+
+	ctx := context.Background()
+	scanner := bufio.NewScanner(os.Stdin)
+	for sess.State == session.StateWaiting {
+		fmt.Print("You: ")
+		if !scanner.Scan() {
+			// Ctrl-D detaches; the session keeps its state
+			fmt.Println()
+			break
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+
+		if err := sendSessionMessage(ctx, reg, sess, transport, input); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read input: %w", err)
+	}
+
+	if sess.State == session.StateWaiting {
+		fmt.Printf("Detached from session %s.\n", sess.ID)
+	} else {
+		fmt.Printf("Session %s is %s.\n", sess.ID, sess.State)
+	}
+	return nil
+}
+
+// SessionDeleteCmd stops and removes a session.
+type SessionDeleteCmd struct {
+	ID string `arg:"" help:"Session ID"`
+}
+
+// Run executes the session delete command.
+func (c *SessionDeleteCmd) Run(cli *CLI) error {
+	reg, err := cli.SessionRegistry()
+	if err != nil {
+		return err
+	}
+
+	sess, err := reg.Get(c.ID)
+	if err != nil {
+		return err
+	}
+
+	// Tear down the environment first so a failure leaves the session listed
+	env, err := reg.Environment(sess.ID)
+	if err != nil {
+		return err
+	}
+	if env != nil {
+		driver, err := cli.CreateSessionDriver(env.Driver)
+		if err != nil {
+			return err
+		}
+		if err := driver.Destroy(context.Background(), env); err != nil {
+			return fmt.Errorf("destroy environment: %w", err)
+		}
+	}
+
+	if sess.State != session.StateStopped {
+		if err := transitionSession(reg, sess, session.StateStopped); err != nil {
+			return err
+		}
+	}
+
+	if err := reg.Delete(sess.ID); err != nil {
+		return err
+	}
+	fmt.Printf("Session %s deleted.\n", sess.ID)
+	return nil
+}
+
+// SessionLogsCmd prints the logs of a session's environment.
+type SessionLogsCmd struct {
+	ID string `arg:"" help:"Session ID"`
+}
+
+// Run executes the session logs command.
+func (c *SessionLogsCmd) Run(cli *CLI) error {
+	reg, err := cli.SessionRegistry()
+	if err != nil {
+		return err
+	}
+
+	env, err := reg.Environment(c.ID)
+	if err != nil {
+		return err
+	}
+	if env == nil {
+		return fmt.Errorf("session %s has no managed environment", c.ID)
+	}
+
+	driver, err := cli.CreateSessionDriver(env.Driver)
+	if err != nil {
+		return err
+	}
+
+	logs, err := driver.Logs(context.Background(), env)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	_, err = io.Copy(os.Stdout, logs)
+	return err
+}
+
+// sendSessionMessage sends a user message in the session's context, records
+// both sides of the exchange, and moves the session to the state implied by
+// the agent's response.
+func sendSessionMessage(ctx context.Context, reg *session.Registry, sess *session.Session, transport a2aclient.Transport, content string) error {
+	if sess.State == session.StateWaiting {
+		if err := transitionSession(reg, sess, session.StateWorking); err != nil {
+			return err
+		}
+	}
+
+	msg := a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: content})
+	msg.ContextID = sess.ContextID
+	if sess.TaskID != "" {
+		msg.TaskID = a2a.TaskID(sess.TaskID)
+	}
+
+	if err := reg.AppendHistory(sess.ID, session.Message{Role: "user", Content: content}); err != nil {
+		return err
+	}
+
+	slog.Debug("sending session message", "session", sess.ID, "addr", sess.Endpoint)
+	resp, err := transport.SendMessage(ctx, &a2a.MessageSendParams{Message: msg})
+	if err != nil {
+		sess.Error = err.Error()
+		if saveErr := reg.Save(sess); saveErr != nil {
+			slog.Warn("failed to save session", "session", sess.ID, "err", saveErr)
+		}
+		return fmt.Errorf("send message failed: %w", err)
+	}
+
+	reply, next := sessionResponse(sess, resp)
+	if reply != "" {
+		printSessionMessage("assistant", reply)
+		if err := reg.AppendHistory(sess.ID, session.Message{Role: "assistant", Content: reply}); err != nil {
+			return err
+		}
+	}
+
+	if next == sess.State {
+		return reg.Save(sess)
+	}
+	return transitionSession(reg, sess, next)
+}
+
+// sessionResponse extracts the agent's reply and the next session state from
+// an A2A response. A plain message is a conversational reply awaiting the
+// human; tasks map by their final state.
+func sessionResponse(sess *session.Session, resp a2a.SendMessageResult) (string, session.State) {
+	sess.TaskID = ""
+	sess.Error = ""
+
+	switch r := resp.(type) {
+	case *a2a.Message:
+		return messageText(r), session.StateWaiting
+	case *a2a.Task:
+		var reply string
+		if r.Status.Message != nil {
+			reply = messageText(r.Status.Message)
+		}
+		switch r.Status.State {
+		case a2a.TaskStateInputRequired:
+			sess.TaskID = string(r.ID)
+			return reply, session.StateWaiting
+		case a2a.TaskStateCompleted:
+			return reply, session.StateComplete
+		case a2a.TaskStateFailed, a2a.TaskStateCanceled, a2a.TaskStateRejected:
+			sess.Error = fmt.Sprintf("task %s", r.Status.State)
+			if reply != "" {
+				sess.Error += ": " + reply
+			}
+			return reply, session.StateComplete
+		default:
+			sess.TaskID = string(r.ID)
+			return reply, session.StateWorking
+		}
+	default:
+		return "", sess.State
+	}
+}
+
+// transitionSession moves a session to a new state and persists it.
+func transitionSession(reg *session.Registry, sess *session.Session, to session.State) error {
+	if err := sess.Transition(to); err != nil {
+		return err
+	}
+	slog.Debug("session state transition", "session", sess.ID, "state", to)
+	return reg.Save(sess)
+}
+
+// failSession records a fatal error on a session, stops it, and returns the error.
+func failSession(reg *session.Registry, sess *session.Session, err error) error {
+	sess.Fail(err)
+	if saveErr := reg.Save(sess); saveErr != nil {
+		slog.Warn("failed to save session", "session", sess.ID, "err", saveErr)
+	}
+	return fmt.Errorf("session %s: %w", sess.ID, err)
+}
+
+func printSessionMessage(role, content string) {
+	switch role {
+	case "user":
+		fmt.Printf("You: %s\n\n", content)
+	default:
+		fmt.Printf("Agent: %s\n\n", content)
+	}
+}
+
+// messageText joins the text parts of an A2A message.
+func messageText(msg *a2a.Message) string {
+	var parts []string
+	for _, part := range msg.Parts {
+		if text, ok := part.(a2a.TextPart); ok {
+			parts = append(parts, text.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
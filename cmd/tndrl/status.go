@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"time"
 
 	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
 )
@@ -38,6 +39,20 @@ func doGetStatus(ctx context.Context, client tndrlv1.ControlServiceClient) error
 	fmt.Printf("  State:        %s\n", resp.State.String())
 	fmt.Printf("  Uptime:       %ds\n", resp.UptimeSeconds)
 	fmt.Printf("  Active Tasks: %d\n", resp.ActiveTasks)
+	if resp.Certificate != nil {
+		fmt.Printf("  Cert Expiry:  %s\n", describeCertificateStatus(resp.Certificate))
+	}
+	if resp.CaCertificate != nil {
+		fmt.Printf("  CA Expiry:    %s\n", describeCertificateStatus(resp.CaCertificate))
+	}
+	if resp.Degraded {
+		fmt.Printf("  Degraded:     yes\n")
+		for _, reason := range resp.DegradedReasons {
+			fmt.Printf("    - %s\n", reason)
+		}
+	} else {
+		fmt.Printf("  Degraded:     no\n")
+	}
 	if len(resp.Metadata) > 0 {
 		fmt.Printf("  Metadata:\n")
 		for k, v := range resp.Metadata {
@@ -46,3 +61,14 @@ func doGetStatus(ctx context.Context, client tndrlv1.ControlServiceClient) error
 	}
 	return nil
 }
+
+// describeCertificateStatus gives the days until a certificate expires,
+// rounded down, and its expiry date.
+func describeCertificateStatus(c *tndrlv1.CertificateStatus) string {
+	days := c.ExpiresInSeconds / (24 * 60 * 60)
+	notAfter := time.Unix(c.NotAfter, 0).UTC().Format(time.RFC3339)
+	if c.ExpiresInSeconds <= 0 {
+		return fmt.Sprintf("expired %d days ago (%s, %s)", -days, notAfter, c.Subject)
+	}
+	return fmt.Sprintf("%d days (%s, %s)", days, notAfter, c.Subject)
+}
@@ -7,6 +7,7 @@
 //   - Health checks (ping/pong)
 //   - Lifecycle management (shutdown)
 //   - State queries
+//   - Enrollment of new nodes
 //   - Future: provisioning, resource management
 
 // Code generated by protoc-gen-go. DO NOT EDIT.
@@ -236,9 +237,19 @@ type GetStatusResponse struct {
 	// Number of active tasks.
 	ActiveTasks int32 `protobuf:"varint,4,opt,name=active_tasks,json=activeTasks,proto3" json:"active_tasks,omitempty"`
 	// Additional status as key-value pairs.
-	Metadata      map[string]string `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+	Metadata map[string]string `protobuf:"bytes,5,rep,name=metadata,proto3" json:"metadata,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Expiry of the node's certificate.
+	Certificate *CertificateStatus `protobuf:"bytes,6,opt,name=certificate,proto3" json:"certificate,omitempty"`
+	// Expiry of the node's CA: the certificate in its chain that expires
+	// first.
+	CaCertificate *CertificateStatus `protobuf:"bytes,7,opt,name=ca_certificate,json=caCertificate,proto3" json:"ca_certificate,omitempty"`
+	// Whether the node needs attention although it is serving, for example
+	// because a certificate is about to expire.
+	Degraded bool `protobuf:"varint,8,opt,name=degraded,proto3" json:"degraded,omitempty"`
+	// Why the node is degraded.
+	DegradedReasons []string `protobuf:"bytes,9,rep,name=degraded_reasons,json=degradedReasons,proto3" json:"degraded_reasons,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
 func (x *GetStatusResponse) Reset() {
@@ -306,6 +317,106 @@ func (x *GetStatusResponse) GetMetadata() map[string]string {
 	return nil
 }
 
+func (x *GetStatusResponse) GetCertificate() *CertificateStatus {
+	if x != nil {
+		return x.Certificate
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetCaCertificate() *CertificateStatus {
+	if x != nil {
+		return x.CaCertificate
+	}
+	return nil
+}
+
+func (x *GetStatusResponse) GetDegraded() bool {
+	if x != nil {
+		return x.Degraded
+	}
+	return false
+}
+
+func (x *GetStatusResponse) GetDegradedReasons() []string {
+	if x != nil {
+		return x.DegradedReasons
+	}
+	return nil
+}
+
+type CertificateStatus struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// SPIFFE ID of a node certificate, or subject common name of a CA.
+	Subject string `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	// Serial number (hex).
+	Serial string `protobuf:"bytes,2,opt,name=serial,proto3" json:"serial,omitempty"`
+	// Expiry time (seconds since epoch).
+	NotAfter int64 `protobuf:"varint,3,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	// Seconds until expiry when the status was taken; negative once expired.
+	ExpiresInSeconds int64 `protobuf:"varint,4,opt,name=expires_in_seconds,json=expiresInSeconds,proto3" json:"expires_in_seconds,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *CertificateStatus) Reset() {
+	*x = CertificateStatus{}
+	mi := &file_tndrl_v1_control_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CertificateStatus) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CertificateStatus) ProtoMessage() {}
+
+func (x *CertificateStatus) ProtoReflect() protoreflect.Message {
+	mi := &file_tndrl_v1_control_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CertificateStatus.ProtoReflect.Descriptor instead.
+func (*CertificateStatus) Descriptor() ([]byte, []int) {
+	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CertificateStatus) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *CertificateStatus) GetSerial() string {
+	if x != nil {
+		return x.Serial
+	}
+	return ""
+}
+
+func (x *CertificateStatus) GetNotAfter() int64 {
+	if x != nil {
+		return x.NotAfter
+	}
+	return 0
+}
+
+func (x *CertificateStatus) GetExpiresInSeconds() int64 {
+	if x != nil {
+		return x.ExpiresInSeconds
+	}
+	return 0
+}
+
 type ShutdownRequest struct {
 	state protoimpl.MessageState `protogen:"open.v1"`
 	// If true, wait for in-progress tasks to complete before shutting down.
@@ -320,7 +431,7 @@ type ShutdownRequest struct {
 
 func (x *ShutdownRequest) Reset() {
 	*x = ShutdownRequest{}
-	mi := &file_tndrl_v1_control_proto_msgTypes[4]
+	mi := &file_tndrl_v1_control_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -332,7 +443,7 @@ func (x *ShutdownRequest) String() string {
 func (*ShutdownRequest) ProtoMessage() {}
 
 func (x *ShutdownRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_tndrl_v1_control_proto_msgTypes[4]
+	mi := &file_tndrl_v1_control_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -345,7 +456,7 @@ func (x *ShutdownRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ShutdownRequest.ProtoReflect.Descriptor instead.
 func (*ShutdownRequest) Descriptor() ([]byte, []int) {
-	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{4}
+	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *ShutdownRequest) GetGraceful() bool {
@@ -381,7 +492,7 @@ type ShutdownResponse struct {
 
 func (x *ShutdownResponse) Reset() {
 	*x = ShutdownResponse{}
-	mi := &file_tndrl_v1_control_proto_msgTypes[5]
+	mi := &file_tndrl_v1_control_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -393,7 +504,7 @@ func (x *ShutdownResponse) String() string {
 func (*ShutdownResponse) ProtoMessage() {}
 
 func (x *ShutdownResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_tndrl_v1_control_proto_msgTypes[5]
+	mi := &file_tndrl_v1_control_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -406,7 +517,7 @@ func (x *ShutdownResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ShutdownResponse.ProtoReflect.Descriptor instead.
 func (*ShutdownResponse) Descriptor() ([]byte, []int) {
-	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{5}
+	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *ShutdownResponse) GetAccepted() bool {
@@ -423,6 +534,116 @@ func (x *ShutdownResponse) GetRejectionReason() string {
 	return ""
 }
 
+type EnrollRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Join token created on the CA host with `tndrl pki token create`.
+	Token string `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	// PEM-encoded certificate signing request for the joining node.
+	Csr           []byte `protobuf:"bytes,2,opt,name=csr,proto3" json:"csr,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnrollRequest) Reset() {
+	*x = EnrollRequest{}
+	mi := &file_tndrl_v1_control_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnrollRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnrollRequest) ProtoMessage() {}
+
+func (x *EnrollRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tndrl_v1_control_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnrollRequest.ProtoReflect.Descriptor instead.
+func (*EnrollRequest) Descriptor() ([]byte, []int) {
+	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *EnrollRequest) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *EnrollRequest) GetCsr() []byte {
+	if x != nil {
+		return x.Csr
+	}
+	return nil
+}
+
+type EnrollResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// PEM-encoded certificate issued for the CSR, followed by any
+	// intermediate CAs between it and the root.
+	Certificate []byte `protobuf:"bytes,1,opt,name=certificate,proto3" json:"certificate,omitempty"`
+	// PEM-encoded CA certificate, followed by its chain up to the root if it
+	// is an intermediate CA. The root is the one pinned by the token.
+	CaCertificate []byte `protobuf:"bytes,2,opt,name=ca_certificate,json=caCertificate,proto3" json:"ca_certificate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EnrollResponse) Reset() {
+	*x = EnrollResponse{}
+	mi := &file_tndrl_v1_control_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EnrollResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EnrollResponse) ProtoMessage() {}
+
+func (x *EnrollResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tndrl_v1_control_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EnrollResponse.ProtoReflect.Descriptor instead.
+func (*EnrollResponse) Descriptor() ([]byte, []int) {
+	return file_tndrl_v1_control_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *EnrollResponse) GetCertificate() []byte {
+	if x != nil {
+		return x.Certificate
+	}
+	return nil
+}
+
+func (x *EnrollResponse) GetCaCertificate() []byte {
+	if x != nil {
+		return x.CaCertificate
+	}
+	return nil
+}
+
 var File_tndrl_v1_control_proto protoreflect.FileDescriptor
 
 const file_tndrl_v1_control_proto_rawDesc = "" +
@@ -433,34 +654,50 @@ const file_tndrl_v1_control_proto_rawDesc = "" +
 	"\fPingResponse\x12%\n" +
 	"\x0eping_timestamp\x18\x01 \x01(\x03R\rpingTimestamp\x12%\n" +
 	"\x0epong_timestamp\x18\x02 \x01(\x03R\rpongTimestamp\"\x12\n" +
-	"\x10GetStatusRequest\"\xa8\x02\n" +
+	"\x10GetStatusRequest\"\xf2\x03\n" +
 	"\x11GetStatusResponse\x12\x1a\n" +
 	"\bidentity\x18\x01 \x01(\tR\bidentity\x12)\n" +
 	"\x05state\x18\x02 \x01(\x0e2\x13.tndrl.v1.NodeStateR\x05state\x12%\n" +
 	"\x0euptime_seconds\x18\x03 \x01(\x03R\ruptimeSeconds\x12!\n" +
 	"\factive_tasks\x18\x04 \x01(\x05R\vactiveTasks\x12E\n" +
-	"\bmetadata\x18\x05 \x03(\v2).tndrl.v1.GetStatusResponse.MetadataEntryR\bmetadata\x1a;\n" +
+	"\bmetadata\x18\x05 \x03(\v2).tndrl.v1.GetStatusResponse.MetadataEntryR\bmetadata\x12=\n" +
+	"\vcertificate\x18\x06 \x01(\v2\x1b.tndrl.v1.CertificateStatusR\vcertificate\x12B\n" +
+	"\x0eca_certificate\x18\a \x01(\v2\x1b.tndrl.v1.CertificateStatusR\rcaCertificate\x12\x1a\n" +
+	"\bdegraded\x18\b \x01(\bR\bdegraded\x12)\n" +
+	"\x10degraded_reasons\x18\t \x03(\tR\x0fdegradedReasons\x1a;\n" +
 	"\rMetadataEntry\x12\x10\n" +
 	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
-	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"n\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x90\x01\n" +
+	"\x11CertificateStatus\x12\x18\n" +
+	"\asubject\x18\x01 \x01(\tR\asubject\x12\x16\n" +
+	"\x06serial\x18\x02 \x01(\tR\x06serial\x12\x1b\n" +
+	"\tnot_after\x18\x03 \x01(\x03R\bnotAfter\x12,\n" +
+	"\x12expires_in_seconds\x18\x04 \x01(\x03R\x10expiresInSeconds\"n\n" +
 	"\x0fShutdownRequest\x12\x1a\n" +
 	"\bgraceful\x18\x01 \x01(\bR\bgraceful\x12'\n" +
 	"\x0ftimeout_seconds\x18\x02 \x01(\x03R\x0etimeoutSeconds\x12\x16\n" +
 	"\x06reason\x18\x03 \x01(\tR\x06reason\"Y\n" +
 	"\x10ShutdownResponse\x12\x1a\n" +
 	"\baccepted\x18\x01 \x01(\bR\baccepted\x12)\n" +
-	"\x10rejection_reason\x18\x02 \x01(\tR\x0frejectionReason*\x9c\x01\n" +
+	"\x10rejection_reason\x18\x02 \x01(\tR\x0frejectionReason\"7\n" +
+	"\rEnrollRequest\x12\x14\n" +
+	"\x05token\x18\x01 \x01(\tR\x05token\x12\x10\n" +
+	"\x03csr\x18\x02 \x01(\fR\x03csr\"Y\n" +
+	"\x0eEnrollResponse\x12 \n" +
+	"\vcertificate\x18\x01 \x01(\fR\vcertificate\x12%\n" +
+	"\x0eca_certificate\x18\x02 \x01(\fR\rcaCertificate*\x9c\x01\n" +
 	"\tNodeState\x12\x1a\n" +
 	"\x16NODE_STATE_UNSPECIFIED\x10\x00\x12\x17\n" +
 	"\x13NODE_STATE_STARTING\x10\x01\x12\x14\n" +
 	"\x10NODE_STATE_READY\x10\x02\x12\x13\n" +
 	"\x0fNODE_STATE_BUSY\x10\x03\x12\x17\n" +
 	"\x13NODE_STATE_DRAINING\x10\x04\x12\x16\n" +
-	"\x12NODE_STATE_STOPPED\x10\x052\xd0\x01\n" +
+	"\x12NODE_STATE_STOPPED\x10\x052\x8d\x02\n" +
 	"\x0eControlService\x125\n" +
 	"\x04Ping\x12\x15.tndrl.v1.PingRequest\x1a\x16.tndrl.v1.PingResponse\x12D\n" +
 	"\tGetStatus\x12\x1a.tndrl.v1.GetStatusRequest\x1a\x1b.tndrl.v1.GetStatusResponse\x12A\n" +
-	"\bShutdown\x12\x19.tndrl.v1.ShutdownRequest\x1a\x1a.tndrl.v1.ShutdownResponseB\x90\x01\n" +
+	"\bShutdown\x12\x19.tndrl.v1.ShutdownRequest\x1a\x1a.tndrl.v1.ShutdownResponse\x12;\n" +
+	"\x06Enroll\x12\x17.tndrl.v1.EnrollRequest\x1a\x18.tndrl.v1.EnrollResponseB\x90\x01\n" +
 	"\fcom.tndrl.v1B\fControlProtoP\x01Z1github.com/shanemcd/tndrl/gen/go/tndrl/v1;tndrlv1\xa2\x02\x03TXX\xaa\x02\bTndrl.V1\xca\x02\bTndrl\\V1\xe2\x02\x14Tndrl\\V1\\GPBMetadata\xea\x02\tTndrl::V1b\x06proto3"
 
 var (
@@ -476,31 +713,38 @@ func file_tndrl_v1_control_proto_rawDescGZIP() []byte {
 }
 
 var file_tndrl_v1_control_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
-var file_tndrl_v1_control_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_tndrl_v1_control_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
 var file_tndrl_v1_control_proto_goTypes = []any{
 	(NodeState)(0),            // 0: tndrl.v1.NodeState
 	(*PingRequest)(nil),       // 1: tndrl.v1.PingRequest
 	(*PingResponse)(nil),      // 2: tndrl.v1.PingResponse
 	(*GetStatusRequest)(nil),  // 3: tndrl.v1.GetStatusRequest
 	(*GetStatusResponse)(nil), // 4: tndrl.v1.GetStatusResponse
-	(*ShutdownRequest)(nil),   // 5: tndrl.v1.ShutdownRequest
-	(*ShutdownResponse)(nil),  // 6: tndrl.v1.ShutdownResponse
-	nil,                       // 7: tndrl.v1.GetStatusResponse.MetadataEntry
+	(*CertificateStatus)(nil), // 5: tndrl.v1.CertificateStatus
+	(*ShutdownRequest)(nil),   // 6: tndrl.v1.ShutdownRequest
+	(*ShutdownResponse)(nil),  // 7: tndrl.v1.ShutdownResponse
+	(*EnrollRequest)(nil),     // 8: tndrl.v1.EnrollRequest
+	(*EnrollResponse)(nil),    // 9: tndrl.v1.EnrollResponse
+	nil,                       // 10: tndrl.v1.GetStatusResponse.MetadataEntry
 }
 var file_tndrl_v1_control_proto_depIdxs = []int32{
-	0, // 0: tndrl.v1.GetStatusResponse.state:type_name -> tndrl.v1.NodeState
-	7, // 1: tndrl.v1.GetStatusResponse.metadata:type_name -> tndrl.v1.GetStatusResponse.MetadataEntry
-	1, // 2: tndrl.v1.ControlService.Ping:input_type -> tndrl.v1.PingRequest
-	3, // 3: tndrl.v1.ControlService.GetStatus:input_type -> tndrl.v1.GetStatusRequest
-	5, // 4: tndrl.v1.ControlService.Shutdown:input_type -> tndrl.v1.ShutdownRequest
-	2, // 5: tndrl.v1.ControlService.Ping:output_type -> tndrl.v1.PingResponse
-	4, // 6: tndrl.v1.ControlService.GetStatus:output_type -> tndrl.v1.GetStatusResponse
-	6, // 7: tndrl.v1.ControlService.Shutdown:output_type -> tndrl.v1.ShutdownResponse
-	5, // [5:8] is the sub-list for method output_type
-	2, // [2:5] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	0,  // 0: tndrl.v1.GetStatusResponse.state:type_name -> tndrl.v1.NodeState
+	10, // 1: tndrl.v1.GetStatusResponse.metadata:type_name -> tndrl.v1.GetStatusResponse.MetadataEntry
+	5,  // 2: tndrl.v1.GetStatusResponse.certificate:type_name -> tndrl.v1.CertificateStatus
+	5,  // 3: tndrl.v1.GetStatusResponse.ca_certificate:type_name -> tndrl.v1.CertificateStatus
+	1,  // 4: tndrl.v1.ControlService.Ping:input_type -> tndrl.v1.PingRequest
+	3,  // 5: tndrl.v1.ControlService.GetStatus:input_type -> tndrl.v1.GetStatusRequest
+	6,  // 6: tndrl.v1.ControlService.Shutdown:input_type -> tndrl.v1.ShutdownRequest
+	8,  // 7: tndrl.v1.ControlService.Enroll:input_type -> tndrl.v1.EnrollRequest
+	2,  // 8: tndrl.v1.ControlService.Ping:output_type -> tndrl.v1.PingResponse
+	4,  // 9: tndrl.v1.ControlService.GetStatus:output_type -> tndrl.v1.GetStatusResponse
+	7,  // 10: tndrl.v1.ControlService.Shutdown:output_type -> tndrl.v1.ShutdownResponse
+	9,  // 11: tndrl.v1.ControlService.Enroll:output_type -> tndrl.v1.EnrollResponse
+	8,  // [8:12] is the sub-list for method output_type
+	4,  // [4:8] is the sub-list for method input_type
+	4,  // [4:4] is the sub-list for extension type_name
+	4,  // [4:4] is the sub-list for extension extendee
+	0,  // [0:4] is the sub-list for field type_name
 }
 
 func init() { file_tndrl_v1_control_proto_init() }
@@ -514,7 +758,7 @@ func file_tndrl_v1_control_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tndrl_v1_control_proto_rawDesc), len(file_tndrl_v1_control_proto_rawDesc)),
 			NumEnums:      1,
-			NumMessages:   7,
+			NumMessages:   10,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -7,6 +7,7 @@
 //   - Health checks (ping/pong)
 //   - Lifecycle management (shutdown)
 //   - State queries
+//   - Enrollment of new nodes
 //   - Future: provisioning, resource management
 
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
@@ -33,6 +34,7 @@ const (
 	ControlService_Ping_FullMethodName      = "/tndrl.v1.ControlService/Ping"
 	ControlService_GetStatus_FullMethodName = "/tndrl.v1.ControlService/GetStatus"
 	ControlService_Shutdown_FullMethodName  = "/tndrl.v1.ControlService/Shutdown"
+	ControlService_Enroll_FullMethodName    = "/tndrl.v1.ControlService/Enroll"
 )
 
 // ControlServiceClient is the client API for ControlService service.
@@ -48,6 +50,9 @@ type ControlServiceClient interface {
 	GetStatus(ctx context.Context, in *GetStatusRequest, opts ...grpc.CallOption) (*GetStatusResponse, error)
 	// Shutdown requests graceful termination of the node.
 	Shutdown(ctx context.Context, in *ShutdownRequest, opts ...grpc.CallOption) (*ShutdownResponse, error)
+	// Enroll issues a node certificate in exchange for a one-time join token.
+	// It is the only RPC a caller without a client certificate may make.
+	Enroll(ctx context.Context, in *EnrollRequest, opts ...grpc.CallOption) (*EnrollResponse, error)
 }
 
 type controlServiceClient struct {
@@ -88,6 +93,16 @@ func (c *controlServiceClient) Shutdown(ctx context.Context, in *ShutdownRequest
 	return out, nil
 }
 
+func (c *controlServiceClient) Enroll(ctx context.Context, in *EnrollRequest, opts ...grpc.CallOption) (*EnrollResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EnrollResponse)
+	err := c.cc.Invoke(ctx, ControlService_Enroll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ControlServiceServer is the server API for ControlService service.
 // All implementations must embed UnimplementedControlServiceServer
 // for forward compatibility.
@@ -101,6 +116,9 @@ type ControlServiceServer interface {
 	GetStatus(context.Context, *GetStatusRequest) (*GetStatusResponse, error)
 	// Shutdown requests graceful termination of the node.
 	Shutdown(context.Context, *ShutdownRequest) (*ShutdownResponse, error)
+	// Enroll issues a node certificate in exchange for a one-time join token.
+	// It is the only RPC a caller without a client certificate may make.
+	Enroll(context.Context, *EnrollRequest) (*EnrollResponse, error)
 	mustEmbedUnimplementedControlServiceServer()
 }
 
@@ -120,6 +138,9 @@ func (UnimplementedControlServiceServer) GetStatus(context.Context, *GetStatusRe
 func (UnimplementedControlServiceServer) Shutdown(context.Context, *ShutdownRequest) (*ShutdownResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Shutdown not implemented")
 }
+func (UnimplementedControlServiceServer) Enroll(context.Context, *EnrollRequest) (*EnrollResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Enroll not implemented")
+}
 func (UnimplementedControlServiceServer) mustEmbedUnimplementedControlServiceServer() {}
 func (UnimplementedControlServiceServer) testEmbeddedByValue()                        {}
 
@@ -195,6 +216,24 @@ func _ControlService_Shutdown_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ControlService_Enroll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnrollRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ControlServiceServer).Enroll(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ControlService_Enroll_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ControlServiceServer).Enroll(ctx, req.(*EnrollRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ControlService_ServiceDesc is the grpc.ServiceDesc for ControlService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -214,6 +253,10 @@ var ControlService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Shutdown",
 			Handler:    _ControlService_Shutdown_Handler,
 		},
+		{
+			MethodName: "Enroll",
+			Handler:    _ControlService_Enroll_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "tndrl/v1/control.proto",
@@ -0,0 +1,34 @@
+// Package testutil provides helpers shared by tndrl's tests.
+package testutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"google.golang.org/grpc/peer"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// PeerContext returns a context whose gRPC peer presented a certificate for the node.
+func PeerContext(t testing.TB, node string) context.Context {
+	t.Helper()
+
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	cert, err := pki.GenerateCert(ca, pki.NodeIdentity(node), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert: %v", err)
+	}
+
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: transport.AuthInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Cert}},
+		},
+	})
+}
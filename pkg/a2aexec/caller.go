@@ -0,0 +1,40 @@
+package a2aexec
+
+import (
+	"context"
+
+	"github.com/a2aproject/a2a-go/a2asrv"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// CallerMetadataKey is the task metadata key holding the SPIFFE ID of the
+// node that sent the message a task was started or resumed by.
+const CallerMetadataKey = "tndrl.caller"
+
+// PeerAuthenticator is an a2asrv.CallInterceptor that sets the user of each
+// A2A call to the SPIFFE ID in the caller's verified certificate. Calls
+// from peers without one are left unauthenticated; rejecting them is up to
+// the authz interceptor.
+type PeerAuthenticator struct {
+	a2asrv.PassthroughCallInterceptor
+}
+
+// Before implements a2asrv.CallInterceptor.
+func (PeerAuthenticator) Before(ctx context.Context, callCtx *a2asrv.CallContext, req *a2asrv.Request) (context.Context, error) {
+	if identity, err := transport.PeerIdentity(ctx); err == nil {
+		callCtx.User = &a2asrv.AuthenticatedUser{UserName: identity}
+	}
+	return ctx, nil
+}
+
+// Caller returns the SPIFFE ID of the node that made the A2A call in ctx, or
+// "" if it is not known.
+func Caller(ctx context.Context) string {
+	callCtx, ok := a2asrv.CallContextFrom(ctx)
+	if ok && callCtx.User != nil && callCtx.User.Authenticated() {
+		return callCtx.User.Name()
+	}
+	identity, _ := transport.PeerIdentity(ctx)
+	return identity
+}
@@ -0,0 +1,71 @@
+package a2aexec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a2aproject/a2a-go/a2a"
+	"github.com/a2aproject/a2a-go/a2asrv"
+
+	"github.com/shanemcd/tndrl/internal/testutil"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+func TestCaller(t *testing.T) {
+	ctx := testutil.PeerContext(t, "frontend")
+	if got, want := Caller(ctx), pki.NodeIdentity("frontend"); got != want {
+		t.Errorf("Caller = %q, want %q", got, want)
+	}
+
+	// The authenticated user of the A2A call takes precedence
+	ctx, callCtx := a2asrv.WithCallContext(ctx, nil)
+	if _, err := (PeerAuthenticator{}).Before(ctx, callCtx, &a2asrv.Request{}); err != nil {
+		t.Fatalf("Before: %v", err)
+	}
+	if got, want := callCtx.User.Name(), pki.NodeIdentity("frontend"); got != want {
+		t.Errorf("call user = %q, want %q", got, want)
+	}
+	callCtx.User = &a2asrv.AuthenticatedUser{UserName: pki.NodeIdentity("other")}
+	if got, want := Caller(ctx), pki.NodeIdentity("other"); got != want {
+		t.Errorf("Caller = %q, want %q", got, want)
+	}
+
+	if got := Caller(context.Background()); got != "" {
+		t.Errorf("Caller without a peer = %q, want empty", got)
+	}
+}
+
+func TestPeerAuthenticator_NoPeer(t *testing.T) {
+	ctx, callCtx := a2asrv.WithCallContext(context.Background(), nil)
+	if _, err := (PeerAuthenticator{}).Before(ctx, callCtx, &a2asrv.Request{}); err != nil {
+		t.Fatalf("Before: %v", err)
+	}
+	if callCtx.User.Authenticated() {
+		t.Errorf("call without a peer certificate authenticated as %q", callCtx.User.Name())
+	}
+}
+
+func TestExecutor_RecordsCaller(t *testing.T) {
+	exec := NewExecutor()
+	exec.Streaming = true
+	handler := a2asrv.NewHandler(exec, a2asrv.WithCallInterceptor(PeerAuthenticator{}))
+
+	ctx := testutil.PeerContext(t, "frontend")
+	msg := a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: "Hello"})
+	result, err := handler.OnSendMessage(ctx, &a2a.MessageSendParams{Message: msg})
+	if err != nil {
+		t.Fatalf("OnSendMessage: %v", err)
+	}
+	task, ok := result.(*a2a.Task)
+	if !ok {
+		t.Fatalf("expected *a2a.Task, got %T", result)
+	}
+
+	task, err = handler.OnGetTask(ctx, &a2a.TaskQueryParams{ID: task.ID})
+	if err != nil {
+		t.Fatalf("OnGetTask: %v", err)
+	}
+	if got, want := task.Metadata[CallerMetadataKey], pki.NodeIdentity("frontend"); got != want {
+		t.Errorf("task caller = %v, want %q", got, want)
+	}
+}
@@ -3,6 +3,8 @@ package a2aexec
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
 
@@ -11,6 +13,7 @@ import (
 	"github.com/a2aproject/a2a-go/a2asrv/eventqueue"
 
 	"github.com/shanemcd/tndrl/pkg/llm"
+	"github.com/shanemcd/tndrl/pkg/transfer"
 )
 
 // Executor implements a2asrv.AgentExecutor for Tndrl nodes.
@@ -21,6 +24,15 @@ type Executor struct {
 
 	// Streaming enables streaming responses when true.
 	Streaming bool
+
+	// History stores per-context conversation history. If nil, each message
+	// is handled without any earlier context.
+	History *History
+
+	// Files holds files transferred to this node. File parts referring to
+	// them are described to the provider by their local path. If nil, file
+	// parts are described by URI only.
+	Files *transfer.Store
 }
 
 // NewExecutor creates a new Executor with the default echo provider.
@@ -35,13 +47,15 @@ func NewExecutor() *Executor {
 func (e *Executor) Execute(ctx context.Context, reqCtx *a2asrv.RequestContext, q eventqueue.Queue) error {
 	msg := reqCtx.Message
 
-	// Extract text content from the message
-	content := extractTextContent(msg)
-	slog.Debug("executing message", "task_id", reqCtx.TaskID, "streaming", e.Streaming, "content_length", len(content))
+	// Extract text content from the message, with any attached files
+	content := extractTextContent(msg) + e.describeFiles(msg)
+	slog.Debug("executing message", "task_id", reqCtx.TaskID, "caller", Caller(ctx), "streaming", e.Streaming, "content_length", len(content))
 
-	// Convert to LLM message format
-	messages := []llm.Message{
-		{Role: "user", Content: content},
+	// Convert to LLM message format, replaying earlier turns in this context
+	userMsg := llm.Message{Role: "user", Content: content}
+	messages := []llm.Message{userMsg}
+	if e.History != nil {
+		messages = e.History.Conversation(historyKey(ctx, reqCtx), userMsg)
 	}
 
 	provider := e.Provider
@@ -60,14 +74,24 @@ func (e *Executor) Execute(ctx context.Context, reqCtx *a2asrv.RequestContext, q
 func (e *Executor) executeNonStreaming(ctx context.Context, reqCtx *a2asrv.RequestContext, q eventqueue.Queue, provider llm.Provider, messages []llm.Message) error {
 	response, err := provider.Complete(ctx, messages)
 	if err != nil {
-		return e.writeError(ctx, reqCtx, q, err)
+		return e.writeFailure(ctx, reqCtx, q, messages, err)
 	}
 
+	e.recordTurn(ctx, reqCtx, messages, response)
+
 	// Write the response message
 	responseMsg := a2a.NewMessage(a2a.MessageRoleAgent, a2a.TextPart{
 		Text: response,
 	})
 
+	// A message does not update an existing task, so a reply that resumes a
+	// task waiting for input completes it instead.
+	if reqCtx.StoredTask != nil {
+		finalEvent := newStatusEvent(ctx, reqCtx, a2a.TaskStateCompleted, responseMsg)
+		finalEvent.Final = true
+		return q.Write(ctx, finalEvent)
+	}
+
 	return q.Write(ctx, responseMsg)
 }
 
@@ -75,7 +99,7 @@ func (e *Executor) executeNonStreaming(ctx context.Context, reqCtx *a2asrv.Reque
 func (e *Executor) executeStreaming(ctx context.Context, reqCtx *a2asrv.RequestContext, q eventqueue.Queue, provider llm.Provider, messages []llm.Message) error {
 	stream, err := provider.Stream(ctx, messages)
 	if err != nil {
-		return e.writeError(ctx, reqCtx, q, err)
+		return e.writeFailure(ctx, reqCtx, q, messages, err)
 	}
 
 	// Accumulate the full response for the final message
@@ -83,14 +107,14 @@ func (e *Executor) executeStreaming(ctx context.Context, reqCtx *a2asrv.RequestC
 
 	for event := range stream {
 		if event.Error != nil {
-			return e.writeError(ctx, reqCtx, q, event.Error)
+			return e.writeFailure(ctx, reqCtx, q, messages, event.Error)
 		}
 
 		if event.Content != "" {
 			fullResponse.WriteString(event.Content)
 
 			// Send a status update with the current content
-			statusEvent := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateWorking, &a2a.Message{
+			statusEvent := newStatusEvent(ctx, reqCtx, a2a.TaskStateWorking, &a2a.Message{
 				Role: a2a.MessageRoleAgent,
 				Parts: []a2a.Part{
 					a2a.TextPart{Text: event.Content},
@@ -102,8 +126,10 @@ func (e *Executor) executeStreaming(ctx context.Context, reqCtx *a2asrv.RequestC
 		}
 
 		if event.Done {
+			e.recordTurn(ctx, reqCtx, messages, fullResponse.String())
+
 			// Send the final completed status
-			finalEvent := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateCompleted, &a2a.Message{
+			finalEvent := newStatusEvent(ctx, reqCtx, a2a.TaskStateCompleted, &a2a.Message{
 				Role: a2a.MessageRoleAgent,
 				Parts: []a2a.Part{
 					a2a.TextPart{Text: fullResponse.String()},
@@ -115,7 +141,8 @@ func (e *Executor) executeStreaming(ctx context.Context, reqCtx *a2asrv.RequestC
 	}
 
 	// Stream ended without explicit done
-	finalEvent := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateCompleted, &a2a.Message{
+	e.recordTurn(ctx, reqCtx, messages, fullResponse.String())
+	finalEvent := newStatusEvent(ctx, reqCtx, a2a.TaskStateCompleted, &a2a.Message{
 		Role: a2a.MessageRoleAgent,
 		Parts: []a2a.Part{
 			a2a.TextPart{Text: fullResponse.String()},
@@ -125,10 +152,49 @@ func (e *Executor) executeStreaming(ctx context.Context, reqCtx *a2asrv.RequestC
 	return q.Write(ctx, finalEvent)
 }
 
+// recordTurn stores the user message and the agent's response in the context history.
+func (e *Executor) recordTurn(ctx context.Context, reqCtx *a2asrv.RequestContext, messages []llm.Message, response string) {
+	if e.History == nil || len(messages) == 0 {
+		return
+	}
+	e.History.Append(historyKey(ctx, reqCtx),
+		messages[len(messages)-1],
+		llm.Message{Role: "assistant", Content: response},
+	)
+}
+
+// historyKey returns the key of the conversation a request belongs to: its
+// context, as seen by the caller that made it.
+func historyKey(ctx context.Context, reqCtx *a2asrv.RequestContext) ConversationKey {
+	return ConversationKey{Caller: Caller(ctx), ContextID: reqCtx.ContextID}
+}
+
+// writeFailure ends the task for a provider error. If the model asked the
+// user a question, the task is parked in the input-required state until a
+// follow-up message on the same task answers it; otherwise the task fails.
+func (e *Executor) writeFailure(ctx context.Context, reqCtx *a2asrv.RequestContext, q eventqueue.Queue, messages []llm.Message, err error) error {
+	var inputErr *llm.InputRequiredError
+	if !errors.As(err, &inputErr) {
+		return e.writeError(ctx, reqCtx, q, err)
+	}
+
+	slog.Debug("task waiting for input", "task_id", reqCtx.TaskID)
+	e.recordTurn(ctx, reqCtx, messages, inputErr.Question)
+
+	event := newStatusEvent(ctx, reqCtx, a2a.TaskStateInputRequired, &a2a.Message{
+		Role: a2a.MessageRoleAgent,
+		Parts: []a2a.Part{
+			a2a.TextPart{Text: inputErr.Question},
+		},
+	})
+	event.Final = true
+	return q.Write(ctx, event)
+}
+
 // writeError writes an error status update to the queue.
 func (e *Executor) writeError(ctx context.Context, reqCtx *a2asrv.RequestContext, q eventqueue.Queue, err error) error {
 	slog.Error("task execution failed", "task_id", reqCtx.TaskID, "err", err)
-	failEvent := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateFailed, &a2a.Message{
+	failEvent := newStatusEvent(ctx, reqCtx, a2a.TaskStateFailed, &a2a.Message{
 		Role: a2a.MessageRoleAgent,
 		Parts: []a2a.Part{
 			a2a.TextPart{Text: err.Error()},
@@ -138,10 +204,20 @@ func (e *Executor) writeError(ctx context.Context, reqCtx *a2asrv.RequestContext
 	return q.Write(ctx, failEvent)
 }
 
+// newStatusEvent creates a status update for the task, recording the caller
+// in the task's metadata.
+func newStatusEvent(ctx context.Context, reqCtx *a2asrv.RequestContext, state a2a.TaskState, msg *a2a.Message) *a2a.TaskStatusUpdateEvent {
+	event := a2a.NewStatusUpdateEvent(reqCtx, state, msg)
+	if caller := Caller(ctx); caller != "" {
+		event.Metadata = map[string]any{CallerMetadataKey: caller}
+	}
+	return event
+}
+
 // Cancel implements a2asrv.AgentExecutor.
 // For now, it simply acknowledges the cancellation request.
 func (e *Executor) Cancel(ctx context.Context, reqCtx *a2asrv.RequestContext, q eventqueue.Queue) error {
-	slog.Info("task cancelled", "task_id", reqCtx.TaskID)
+	slog.Info("task cancelled", "task_id", reqCtx.TaskID, "caller", Caller(ctx))
 	event := a2a.NewStatusUpdateEvent(reqCtx, a2a.TaskStateCanceled, nil)
 	event.Final = true
 	return q.Write(ctx, event)
@@ -158,3 +234,35 @@ func extractTextContent(msg *a2a.Message) string {
 	}
 	return content
 }
+
+// describeFiles describes the files attached to a message, so that the
+// provider can read the ones transferred to this node.
+func (e *Executor) describeFiles(msg *a2a.Message) string {
+	var b strings.Builder
+	for _, part := range msg.Parts {
+		file, ok := part.(a2a.FilePart)
+		if !ok {
+			continue
+		}
+		b.WriteString("\n\n")
+		ref, ok := transfer.RefFromPart(file)
+		switch {
+		case ok && e.Files != nil:
+			if _, err := e.Files.Stat(ref.SHA256); err != nil {
+				fmt.Fprintf(&b, "[Attached file %q is not available on this node: %v]", ref.Name, err)
+				continue
+			}
+			fmt.Fprintf(&b, "[Attached file %q (%d bytes) is at %s]", ref.Name, ref.Size, e.Files.Path(ref.SHA256))
+		case ok:
+			fmt.Fprintf(&b, "[Attached file %q is not available on this node: %s]", ref.Name, ref.URI())
+		default:
+			switch f := file.File.(type) {
+			case a2a.FileURI:
+				fmt.Fprintf(&b, "[Attached file %q is at %s]", f.Name, f.URI)
+			case a2a.FileBytes:
+				fmt.Fprintf(&b, "[Attached file %q was sent inline, which is not supported]", f.Name)
+			}
+		}
+	}
+	return b.String()
+}
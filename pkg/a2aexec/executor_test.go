@@ -2,12 +2,15 @@ package a2aexec
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	"github.com/a2aproject/a2a-go/a2a"
 	"github.com/a2aproject/a2a-go/a2asrv"
 
+	"github.com/shanemcd/tndrl/internal/testutil"
 	"github.com/shanemcd/tndrl/pkg/llm"
+	"github.com/shanemcd/tndrl/pkg/transfer"
 )
 
 // testQueue is a simple queue for testing that collects events.
@@ -181,3 +184,241 @@ func TestExecutor_CustomProvider(t *testing.T) {
 		t.Errorf("expected %q, got %q", "Custom response", text.Text)
 	}
 }
+
+// recordingProvider is a test provider that records the messages it receives.
+type recordingProvider struct {
+	calls [][]llm.Message
+}
+
+func (p *recordingProvider) Complete(ctx context.Context, messages []llm.Message) (string, error) {
+	p.calls = append(p.calls, messages)
+	return "reply " + messages[len(messages)-1].Content, nil
+}
+
+func (p *recordingProvider) Stream(ctx context.Context, messages []llm.Message) (<-chan llm.StreamEvent, error) {
+	response, _ := p.Complete(ctx, messages)
+	ch := make(chan llm.StreamEvent, 1)
+	ch <- llm.StreamEvent{Content: response, Done: true}
+	close(ch)
+	return ch, nil
+}
+
+func (p *recordingProvider) Name() string { return "recording" }
+
+func TestExecutor_MultiTurnHistory(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		provider := &recordingProvider{}
+		exec := &Executor{
+			Provider:  provider,
+			Streaming: streaming,
+			History:   NewHistory(HistoryOptions{}),
+		}
+
+		send := func(contextID, text string) {
+			reqCtx := &a2asrv.RequestContext{
+				Message: &a2a.Message{
+					Role:  a2a.MessageRoleUser,
+					Parts: []a2a.Part{a2a.TextPart{Text: text}},
+				},
+				TaskID:    a2a.NewTaskID(),
+				ContextID: contextID,
+			}
+			if err := exec.Execute(context.Background(), reqCtx, &testQueue{}); err != nil {
+				t.Fatalf("Execute failed: %v", err)
+			}
+		}
+
+		send("ctx-1", "first")
+		send("ctx-1", "second")
+		send("ctx-2", "unrelated")
+
+		if len(provider.calls) != 3 {
+			t.Fatalf("expected 3 provider calls, got %d", len(provider.calls))
+		}
+
+		second := provider.calls[1]
+		want := []llm.Message{
+			{Role: "user", Content: "first"},
+			{Role: "assistant", Content: "reply first"},
+			{Role: "user", Content: "second"},
+		}
+		if len(second) != len(want) {
+			t.Fatalf("streaming=%v: expected %d messages replayed, got %d: %+v", streaming, len(want), len(second), second)
+		}
+		for i := range want {
+			if second[i] != want[i] {
+				t.Errorf("streaming=%v: message %d = %+v, want %+v", streaming, i, second[i], want[i])
+			}
+		}
+
+		if len(provider.calls[2]) != 1 {
+			t.Errorf("streaming=%v: expected other context to start fresh, got %+v", streaming, provider.calls[2])
+		}
+	}
+}
+
+func TestExecutor_HistoryPerCaller(t *testing.T) {
+	provider := &recordingProvider{}
+	exec := &Executor{
+		Provider: provider,
+		History:  NewHistory(HistoryOptions{}),
+	}
+
+	send := func(caller, text string) {
+		reqCtx := &a2asrv.RequestContext{
+			Message: &a2a.Message{
+				Role:  a2a.MessageRoleUser,
+				Parts: []a2a.Part{a2a.TextPart{Text: text}},
+			},
+			TaskID:    a2a.NewTaskID(),
+			ContextID: "shared",
+		}
+		if err := exec.Execute(testutil.PeerContext(t, caller), reqCtx, &testQueue{}); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+	}
+
+	// Two callers use the same context ID
+	send("alice", "secret")
+	send("mallory", "what did alice say?")
+	send("alice", "and then?")
+
+	if len(provider.calls) != 3 {
+		t.Fatalf("expected 3 provider calls, got %d", len(provider.calls))
+	}
+	if got := provider.calls[1]; len(got) != 1 {
+		t.Errorf("other caller saw %+v, want only its own message", got)
+	}
+	if got := provider.calls[2]; len(got) != 3 || got[0].Content != "secret" {
+		t.Errorf("caller's follow-up saw %+v, want its own earlier turn", got)
+	}
+}
+
+// askingProvider asks a question on the first turn and answers on the next.
+type askingProvider struct {
+	calls [][]llm.Message
+}
+
+func (p *askingProvider) Complete(ctx context.Context, messages []llm.Message) (string, error) {
+	p.calls = append(p.calls, messages)
+	if len(p.calls) == 1 {
+		return "", &llm.InputRequiredError{Question: "Which branch?"}
+	}
+	return "Using " + messages[len(messages)-1].Content, nil
+}
+
+func (p *askingProvider) Stream(ctx context.Context, messages []llm.Message) (<-chan llm.StreamEvent, error) {
+	ch := make(chan llm.StreamEvent, 1)
+	response, err := p.Complete(ctx, messages)
+	if err != nil {
+		ch <- llm.StreamEvent{Error: err}
+	} else {
+		ch <- llm.StreamEvent{Content: response, Done: true}
+	}
+	close(ch)
+	return ch, nil
+}
+
+func (p *askingProvider) Name() string { return "asking" }
+
+func TestExecutor_InputRequired(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		provider := &askingProvider{}
+		exec := &Executor{
+			Provider:  provider,
+			Streaming: streaming,
+			History:   NewHistory(HistoryOptions{}),
+		}
+
+		reqCtx := &a2asrv.RequestContext{
+			Message: &a2a.Message{
+				Role:  a2a.MessageRoleUser,
+				Parts: []a2a.Part{a2a.TextPart{Text: "Deploy it"}},
+			},
+			TaskID:    "task-1",
+			ContextID: "ctx-1",
+		}
+		q := &testQueue{}
+		if err := exec.Execute(context.Background(), reqCtx, q); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+
+		last := q.events[len(q.events)-1]
+		status, ok := last.(*a2a.TaskStatusUpdateEvent)
+		if !ok {
+			t.Fatalf("streaming=%v: expected *a2a.TaskStatusUpdateEvent, got %T", streaming, last)
+		}
+		if status.Status.State != a2a.TaskStateInputRequired || !status.Final {
+			t.Fatalf("streaming=%v: expected final input-required status, got %s (final=%v)", streaming, status.Status.State, status.Final)
+		}
+		if got := extractTextContent(status.Status.Message); got != "Which branch?" {
+			t.Errorf("streaming=%v: expected question %q, got %q", streaming, "Which branch?", got)
+		}
+
+		// The answer resumes the stored task in the same context
+		reqCtx = &a2asrv.RequestContext{
+			Message: &a2a.Message{
+				Role:  a2a.MessageRoleUser,
+				Parts: []a2a.Part{a2a.TextPart{Text: "main"}},
+			},
+			TaskID:     "task-1",
+			ContextID:  "ctx-1",
+			StoredTask: &a2a.Task{ID: "task-1", ContextID: "ctx-1", Status: status.Status},
+		}
+		q = &testQueue{}
+		if err := exec.Execute(context.Background(), reqCtx, q); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+
+		last = q.events[len(q.events)-1]
+		status, ok = last.(*a2a.TaskStatusUpdateEvent)
+		if !ok {
+			t.Fatalf("streaming=%v: expected *a2a.TaskStatusUpdateEvent, got %T", streaming, last)
+		}
+		if status.Status.State != a2a.TaskStateCompleted || !status.Final {
+			t.Errorf("streaming=%v: expected final completed status, got %s (final=%v)", streaming, status.Status.State, status.Final)
+		}
+
+		// The question is part of the conversation the answer is sent with
+		second := provider.calls[1]
+		if len(second) != 3 {
+			t.Fatalf("streaming=%v: expected 3 messages on resume, got %d", streaming, len(second))
+		}
+		if second[1].Role != "assistant" || second[1].Content != "Which branch?" {
+			t.Errorf("streaming=%v: expected question in history, got %+v", streaming, second[1])
+		}
+	}
+}
+
+func TestExecutor_AttachedFiles(t *testing.T) {
+	files, err := transfer.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	stored, err := files.Add(strings.NewReader("FAIL: TestFoo"))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	stored.Name = "build.log"
+	missing := transfer.Ref{SHA256: strings.Repeat("00", 32), Name: "repo.tar"}
+
+	exec := &Executor{Files: files}
+	msg := a2a.NewMessage(a2a.MessageRoleUser,
+		a2a.TextPart{Text: "Why did the build fail?"},
+		stored.FilePart(),
+		missing.FilePart(),
+	)
+	q := &testQueue{}
+	if err := exec.Execute(context.Background(), &a2asrv.RequestContext{Message: msg, TaskID: "t", ContextID: "c"}, q); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	// The echo provider replies with the content it was given
+	event, _ := q.Read(context.Background())
+	got := event.(*a2a.Message).Parts[0].(a2a.TextPart).Text
+	for _, want := range []string{"Why did the build fail?", files.Path(stored.SHA256), `"repo.tar" is not available`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("content %q does not contain %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package a2aexec
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/shanemcd/tndrl/pkg/llm"
+)
+
+// Default history limits, used where HistoryOptions leaves a limit at zero.
+// Every limit is bounded so that clients cannot grow the node's memory
+// without limit, whether with many contexts or one long one.
+const (
+	DefaultMaxTurns    = 50
+	DefaultMaxChars    = 1 << 20
+	DefaultMaxContexts = 1000
+)
+
+// HistoryOptions configures limits for a History store.
+type HistoryOptions struct {
+	// MaxTurns is the maximum number of messages kept per context
+	// (0 = DefaultMaxTurns). A user prompt and the agent's reply count as
+	// two messages.
+	MaxTurns int
+
+	// MaxChars is the maximum total content length kept per context
+	// (0 = DefaultMaxChars).
+	MaxChars int
+
+	// MaxContexts is the maximum number of contexts kept
+	// (0 = DefaultMaxContexts). Recording a new context beyond it forgets the
+	// least recently used one.
+	MaxContexts int
+}
+
+// History keeps per-context conversation history for the executor.
+// Conversations are keyed by the caller and the A2A context ID so that
+// follow-up messages reusing a context see the earlier turns, but a caller
+// never sees another caller's conversation by guessing its context ID.
+type History struct {
+	opts HistoryOptions
+
+	mu       sync.Mutex
+	contexts map[ConversationKey]*list.Element
+	lru      *list.List // of *conversation, most recently used first
+}
+
+// ConversationKey identifies a conversation in a History.
+type ConversationKey struct {
+	// Caller is the SPIFFE ID of the node holding the conversation, or ""
+	// if it is not known.
+	Caller string
+
+	// ContextID is the A2A context ID of the conversation.
+	ContextID string
+}
+
+// conversation is the history recorded for one context.
+type conversation struct {
+	key  ConversationKey
+	msgs []llm.Message
+}
+
+// NewHistory creates an empty history store with the given limits.
+func NewHistory(opts HistoryOptions) *History {
+	if opts.MaxTurns <= 0 {
+		opts.MaxTurns = DefaultMaxTurns
+	}
+	if opts.MaxChars <= 0 {
+		opts.MaxChars = DefaultMaxChars
+	}
+	if opts.MaxContexts <= 0 {
+		opts.MaxContexts = DefaultMaxContexts
+	}
+	return &History{
+		opts:     opts,
+		contexts: make(map[ConversationKey]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Messages returns a copy of the conversation recorded for a context.
+func (h *History) Messages(key ConversationKey) []llm.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msgs := h.messagesLocked(key)
+	result := make([]llm.Message, len(msgs))
+	copy(result, msgs)
+	return result
+}
+
+// Conversation returns the recorded conversation for a context followed by msgs,
+// trimmed to the configured limits. It does not record msgs.
+func (h *History) Conversation(key ConversationKey, msgs ...llm.Message) []llm.Message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	recorded := h.messagesLocked(key)
+	combined := make([]llm.Message, 0, len(recorded)+len(msgs))
+	combined = append(combined, recorded...)
+	combined = append(combined, msgs...)
+	return h.trim(combined)
+}
+
+// Append records messages for a context and trims the conversation to the
+// configured limits. The context becomes the most recently used.
+func (h *History) Append(key ConversationKey, msgs ...llm.Message) {
+	if key.ContextID == "" {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.contexts[key]; ok {
+		c := e.Value.(*conversation)
+		c.msgs = h.trim(append(c.msgs, msgs...))
+		h.lru.MoveToFront(e)
+		return
+	}
+
+	h.contexts[key] = h.lru.PushFront(&conversation{
+		key:  key,
+		msgs: h.trim(msgs),
+	})
+	for h.lru.Len() > h.opts.MaxContexts {
+		oldest := h.lru.Back()
+		h.lru.Remove(oldest)
+		delete(h.contexts, oldest.Value.(*conversation).key)
+	}
+}
+
+// Clear discards the conversation recorded for a context.
+func (h *History) Clear(key ConversationKey) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if e, ok := h.contexts[key]; ok {
+		h.lru.Remove(e)
+		delete(h.contexts, key)
+	}
+}
+
+func (h *History) messagesLocked(key ConversationKey) []llm.Message {
+	if e, ok := h.contexts[key]; ok {
+		return e.Value.(*conversation).msgs
+	}
+	return nil
+}
+
+// Len returns the number of contexts with recorded history.
+func (h *History) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.contexts)
+}
+
+// trim drops the oldest messages until the conversation fits within the limits.
+// The most recent message is always kept, even if it alone exceeds MaxChars.
+func (h *History) trim(msgs []llm.Message) []llm.Message {
+	if len(msgs) > h.opts.MaxTurns {
+		msgs = msgs[len(msgs)-h.opts.MaxTurns:]
+	}
+
+	total := 0
+	for _, m := range msgs {
+		total += len(m.Content)
+	}
+	for len(msgs) > 1 && total > h.opts.MaxChars {
+		total -= len(msgs[0].Content)
+		msgs = msgs[1:]
+	}
+
+	// Copy so the backing array of dropped messages can be released
+	result := make([]llm.Message, len(msgs))
+	copy(result, msgs)
+	return result
+}
@@ -0,0 +1,153 @@
+package a2aexec
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/shanemcd/tndrl/pkg/llm"
+)
+
+// key returns the key of a context whose caller is not known.
+func key(contextID string) ConversationKey {
+	return ConversationKey{ContextID: contextID}
+}
+
+func TestHistory_AppendAndMessages(t *testing.T) {
+	h := NewHistory(HistoryOptions{})
+
+	h.Append(key("ctx-1"),
+		llm.Message{Role: "user", Content: "hello"},
+		llm.Message{Role: "assistant", Content: "hi"},
+	)
+	h.Append(key("ctx-2"), llm.Message{Role: "user", Content: "other"})
+
+	msgs := h.Messages(key("ctx-1"))
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if msgs[0].Content != "hello" || msgs[1].Content != "hi" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+
+	if h.Len() != 2 {
+		t.Errorf("expected 2 contexts, got %d", h.Len())
+	}
+
+	h.Clear(key("ctx-1"))
+	if len(h.Messages(key("ctx-1"))) != 0 {
+		t.Error("expected ctx-1 to be empty after Clear")
+	}
+}
+
+func TestHistory_EmptyContextIDNotRecorded(t *testing.T) {
+	h := NewHistory(HistoryOptions{})
+	h.Append(key(""), llm.Message{Role: "user", Content: "hello"})
+
+	if h.Len() != 0 {
+		t.Errorf("expected no contexts, got %d", h.Len())
+	}
+}
+
+func TestHistory_MaxTurns(t *testing.T) {
+	h := NewHistory(HistoryOptions{MaxTurns: 3})
+
+	for _, c := range []string{"a", "b", "c", "d", "e"} {
+		h.Append(key("ctx"), llm.Message{Role: "user", Content: c})
+	}
+
+	msgs := h.Messages(key("ctx"))
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(msgs))
+	}
+	if msgs[0].Content != "c" || msgs[2].Content != "e" {
+		t.Errorf("expected oldest messages to be dropped, got %+v", msgs)
+	}
+}
+
+func TestHistory_MaxChars(t *testing.T) {
+	h := NewHistory(HistoryOptions{MaxChars: 10})
+
+	h.Append(key("ctx"),
+		llm.Message{Role: "user", Content: "12345"},
+		llm.Message{Role: "assistant", Content: "12345"},
+		llm.Message{Role: "user", Content: "123"},
+	)
+
+	msgs := h.Messages(key("ctx"))
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+
+	// The most recent message is kept even if it exceeds the limit on its own
+	h.Append(key("ctx"), llm.Message{Role: "user", Content: strings.Repeat("x", 20)})
+	msgs = h.Messages(key("ctx"))
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+}
+
+func TestHistory_ConversationDoesNotRecord(t *testing.T) {
+	h := NewHistory(HistoryOptions{MaxTurns: 2})
+	h.Append(key("ctx"),
+		llm.Message{Role: "user", Content: "first"},
+		llm.Message{Role: "assistant", Content: "reply"},
+	)
+
+	conv := h.Conversation(key("ctx"), llm.Message{Role: "user", Content: "second"})
+	if len(conv) != 2 {
+		t.Fatalf("expected conversation trimmed to 2 messages, got %d", len(conv))
+	}
+	if conv[0].Content != "reply" || conv[1].Content != "second" {
+		t.Errorf("unexpected conversation: %+v", conv)
+	}
+
+	if len(h.Messages(key("ctx"))) != 2 {
+		t.Error("Conversation should not record messages")
+	}
+}
+
+func TestHistory_MaxContexts(t *testing.T) {
+	h := NewHistory(HistoryOptions{MaxContexts: 2})
+
+	h.Append(key("ctx-1"), llm.Message{Role: "user", Content: "one"})
+	h.Append(key("ctx-2"), llm.Message{Role: "user", Content: "two"})
+
+	// Using ctx-1 again makes ctx-2 the least recently used
+	h.Append(key("ctx-1"), llm.Message{Role: "assistant", Content: "reply"})
+	h.Append(key("ctx-3"), llm.Message{Role: "user", Content: "three"})
+
+	if h.Len() != 2 {
+		t.Errorf("expected 2 contexts, got %d", h.Len())
+	}
+	if len(h.Messages(key("ctx-2"))) != 0 {
+		t.Error("expected ctx-2 to be forgotten")
+	}
+	if len(h.Messages(key("ctx-1"))) != 2 || len(h.Messages(key("ctx-3"))) != 1 {
+		t.Error("expected ctx-1 and ctx-3 to be kept")
+	}
+}
+
+func TestHistory_DefaultLimits(t *testing.T) {
+	h := NewHistory(HistoryOptions{})
+
+	for i := 0; i < DefaultMaxTurns+10; i++ {
+		h.Append(key("long"), llm.Message{Role: "user", Content: "x"})
+	}
+	if n := len(h.Messages(key("long"))); n != DefaultMaxTurns {
+		t.Errorf("expected %d messages, got %d", DefaultMaxTurns, n)
+	}
+
+	big := strings.Repeat("x", DefaultMaxChars/2+1)
+	h.Append(key("big"), llm.Message{Role: "user", Content: big}, llm.Message{Role: "user", Content: big})
+	if n := len(h.Messages(key("big"))); n != 1 {
+		t.Errorf("expected 1 message within DefaultMaxChars, got %d", n)
+	}
+
+	for i := 0; i < DefaultMaxContexts+10; i++ {
+		h.Append(key(fmt.Sprintf("ctx-%d", i)), llm.Message{Role: "user", Content: "hi"})
+	}
+	if h.Len() != DefaultMaxContexts {
+		t.Errorf("expected %d contexts, got %d", DefaultMaxContexts, h.Len())
+	}
+}
@@ -14,16 +14,24 @@ type ServerConfig struct {
 
 	// AgentCard describes this agent's capabilities.
 	AgentCard *a2a.AgentCard
+
+	// TaskStore persists tasks. If nil, the a2a-go in-memory store is used.
+	TaskStore a2asrv.TaskStore
 }
 
 // RegisterWithGRPC registers the A2A service with a gRPC server.
 // This wires up the executor with the a2a-go request handler and gRPC transport.
 func RegisterWithGRPC(server *grpc.Server, cfg *ServerConfig) {
 	// Create the transport-agnostic request handler
-	var opts []a2asrv.RequestHandlerOption
+	opts := []a2asrv.RequestHandlerOption{
+		a2asrv.WithCallInterceptor(PeerAuthenticator{}),
+	}
 	if cfg.AgentCard != nil {
 		opts = append(opts, a2asrv.WithExtendedAgentCard(cfg.AgentCard))
 	}
+	if cfg.TaskStore != nil {
+		opts = append(opts, a2asrv.WithTaskStore(cfg.TaskStore))
+	}
 	requestHandler := a2asrv.NewHandler(cfg.Executor, opts...)
 
 	// Create the gRPC transport handler
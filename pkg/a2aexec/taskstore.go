@@ -0,0 +1,276 @@
+package a2aexec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a2aproject/a2a-go/a2a"
+	"github.com/a2aproject/a2a-go/a2asrv"
+)
+
+// validTaskID matches task IDs that are safe to use as file names.
+var validTaskID = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Default task store limits, used where FileTaskStoreOptions leaves a limit
+// at zero.
+const (
+	DefaultMaxTasks   = 1000
+	DefaultMaxTaskAge = 7 * 24 * time.Hour
+)
+
+// FileTaskStoreOptions configures how long a FileTaskStore keeps finished
+// tasks. Tasks still in progress are never pruned.
+type FileTaskStoreOptions struct {
+	// MaxTasks is the number of tasks kept (0 = DefaultMaxTasks). Beyond
+	// it, the least recently updated finished tasks are removed.
+	MaxTasks int
+
+	// MaxAge is how long a finished task is kept after it was last updated
+	// (0 = DefaultMaxTaskAge).
+	MaxAge time.Duration
+}
+
+// FileTaskStore is an a2asrv.TaskStore that persists each task as a JSON file.
+// Tasks, their status history and artifacts survive a node restart, so GetTask
+// returns the final state of long-running jobs after a crash or redeploy.
+// Finished tasks are pruned by count and age, each time a task finishes.
+type FileTaskStore struct {
+	dir  string
+	opts FileTaskStoreOptions
+
+	mu sync.RWMutex
+}
+
+// NewFileTaskStore creates a task store rooted at dir with the default
+// limits, creating it if needed.
+func NewFileTaskStore(dir string) (*FileTaskStore, error) {
+	return NewFileTaskStoreWithOptions(dir, FileTaskStoreOptions{})
+}
+
+// NewFileTaskStoreWithOptions creates a task store rooted at dir with the
+// given limits, creating it if needed. Tasks left unfinished by an earlier
+// run can no longer finish, so they are marked failed.
+func NewFileTaskStoreWithOptions(dir string, opts FileTaskStoreOptions) (*FileTaskStore, error) {
+	if opts.MaxTasks <= 0 {
+		opts.MaxTasks = DefaultMaxTasks
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxTaskAge
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create task directory: %w", err)
+	}
+
+	s := &FileTaskStore{dir: dir, opts: opts}
+	if err := s.failUnfinished(context.Background()); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	return s, nil
+}
+
+// failUnfinished marks the tasks that were not finished when the store was
+// last used as failed.
+func (s *FileTaskStore) failUnfinished(ctx context.Context) error {
+	tasks, err := s.List(ctx)
+	if err != nil {
+		return fmt.Errorf("recover tasks: %w", err)
+	}
+	for _, task := range tasks {
+		if task.Status.State.Terminal() {
+			continue
+		}
+		slog.Info("failing task interrupted by restart", "task_id", task.ID, "state", task.Status.State)
+		now := time.Now()
+		task.Status = a2a.TaskStatus{
+			State:     a2a.TaskStateFailed,
+			Timestamp: &now,
+			Message: a2a.NewMessage(a2a.MessageRoleAgent, a2a.TextPart{
+				Text: "The node restarted before the task finished.",
+			}),
+		}
+		if err := s.Save(ctx, task); err != nil {
+			return fmt.Errorf("recover task %s: %w", task.ID, err)
+		}
+	}
+	return nil
+}
+
+// Save implements a2asrv.TaskStore.
+// The task is written to a temporary file and renamed into place so a crash
+// mid-write never leaves a truncated task behind.
+func (s *FileTaskStore) Save(ctx context.Context, task *a2a.Task) error {
+	path, err := s.path(task.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("marshal task: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmp, err := os.CreateTemp(s.dir, ".task-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write task: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync task: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close task: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename task: %w", err)
+	}
+	if task.Status.State.Terminal() {
+		s.prune()
+	}
+	return nil
+}
+
+// Get implements a2asrv.TaskStore.
+// It returns a2a.ErrTaskNotFound if no task with the given ID has been saved.
+func (s *FileTaskStore) Get(ctx context.Context, taskID a2a.TaskID) (*a2a.Task, error) {
+	path, err := s.path(taskID)
+	if err != nil {
+		return nil, a2a.ErrTaskNotFound
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return readTask(path)
+}
+
+// List returns all saved tasks, most recently updated first.
+func (s *FileTaskStore) List(ctx context.Context) ([]*a2a.Task, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read task directory: %w", err)
+	}
+
+	var tasks []*a2a.Task
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		task, err := readTask(filepath.Join(s.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		ti, tj := tasks[i].Status.Timestamp, tasks[j].Status.Timestamp
+		if ti == nil || tj == nil {
+			return tj == nil && ti != nil
+		}
+		return ti.After(*tj)
+	})
+
+	return tasks, nil
+}
+
+// prune removes the least recently updated finished tasks beyond MaxTasks,
+// and finished tasks older than MaxAge. Tasks are ordered by the
+// modification time of their files, which Save sets, so only the oldest
+// need to be read. Failures are logged. Callers must hold s.mu.
+func (s *FileTaskStore) prune() {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		slog.Warn("prune tasks", "err", err)
+		return
+	}
+
+	type taskFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []taskFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, taskFile{filepath.Join(s.dir, name), info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+
+	excess := len(files) - s.opts.MaxTasks
+	cutoff := time.Now().Add(-s.opts.MaxAge)
+	for _, f := range files {
+		if excess <= 0 && !f.modTime.Before(cutoff) {
+			break
+		}
+		task, err := readTask(f.path)
+		if err != nil || !task.Status.State.Terminal() {
+			continue
+		}
+		if err := os.Remove(f.path); err != nil {
+			slog.Warn("prune task", "path", f.path, "err", err)
+			continue
+		}
+		slog.Debug("pruned task", "task_id", task.ID)
+		excess--
+	}
+}
+
+// path returns the file path for a task, rejecting IDs that could escape the store directory.
+func (s *FileTaskStore) path(taskID a2a.TaskID) (string, error) {
+	id := string(taskID)
+	if !validTaskID.MatchString(id) || id == "." || id == ".." {
+		return "", fmt.Errorf("invalid task ID %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// readTask loads a single task file.
+func readTask(path string) (*a2a.Task, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, a2a.ErrTaskNotFound
+		}
+		return nil, fmt.Errorf("read task: %w", err)
+	}
+
+	var task a2a.Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("parse task %s: %w", filepath.Base(path), err)
+	}
+	return &task, nil
+}
+
+var _ a2asrv.TaskStore = (*FileTaskStore)(nil)
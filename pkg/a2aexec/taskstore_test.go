@@ -0,0 +1,244 @@
+package a2aexec
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/a2aproject/a2a-go/a2a"
+)
+
+func newTestTask(id a2a.TaskID, state a2a.TaskState, ts time.Time) *a2a.Task {
+	return &a2a.Task{
+		ID:        id,
+		ContextID: "ctx-1",
+		History: []*a2a.Message{
+			a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: "hello"}),
+		},
+		Artifacts: []*a2a.Artifact{
+			{ID: "artifact-1", Name: "result", Parts: a2a.ContentParts{a2a.TextPart{Text: "output"}}},
+		},
+		Status: a2a.TaskStatus{
+			State:     state,
+			Timestamp: &ts,
+			Message:   a2a.NewMessage(a2a.MessageRoleAgent, a2a.TextPart{Text: "done"}),
+		},
+	}
+}
+
+func TestFileTaskStore_SaveAndGet(t *testing.T) {
+	store, err := NewFileTaskStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+
+	ctx := context.Background()
+	task := newTestTask("task-1", a2a.TaskStateCompleted, time.Now())
+	if err := store.Save(ctx, task); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := store.Get(ctx, "task-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	if got.Status.State != a2a.TaskStateCompleted {
+		t.Errorf("State = %q, want %q", got.Status.State, a2a.TaskStateCompleted)
+	}
+	if len(got.History) != 1 {
+		t.Fatalf("expected 1 history message, got %d", len(got.History))
+	}
+	if text, ok := got.History[0].Parts[0].(a2a.TextPart); !ok || text.Text != "hello" {
+		t.Errorf("unexpected history part: %#v", got.History[0].Parts[0])
+	}
+	if len(got.Artifacts) != 1 || got.Artifacts[0].Name != "result" {
+		t.Errorf("unexpected artifacts: %+v", got.Artifacts)
+	}
+}
+
+func TestFileTaskStore_SurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewFileTaskStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+	if err := store.Save(ctx, newTestTask("task-1", a2a.TaskStateWorking, time.Now())); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := store.Save(ctx, newTestTask("task-1", a2a.TaskStateCompleted, time.Now())); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// Simulate a node restart with a fresh store on the same directory
+	reopened, err := NewFileTaskStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+	got, err := reopened.Get(ctx, "task-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Status.State != a2a.TaskStateCompleted {
+		t.Errorf("State = %q, want %q", got.Status.State, a2a.TaskStateCompleted)
+	}
+}
+
+func TestFileTaskStore_NotFound(t *testing.T) {
+	store, err := NewFileTaskStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+
+	for _, id := range []a2a.TaskID{"missing", "../etc/passwd", ""} {
+		_, err := store.Get(context.Background(), id)
+		if !errors.Is(err, a2a.ErrTaskNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrTaskNotFound", id, err)
+		}
+	}
+}
+
+func TestFileTaskStore_RejectsUnsafeID(t *testing.T) {
+	store, err := NewFileTaskStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+
+	task := newTestTask("../escape", a2a.TaskStateCompleted, time.Now())
+	if err := store.Save(context.Background(), task); err == nil {
+		t.Error("expected Save to reject task ID containing a path separator")
+	}
+}
+
+func TestFileTaskStore_List(t *testing.T) {
+	store, err := NewFileTaskStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	for i, id := range []a2a.TaskID{"old", "newest", "middle"} {
+		offsets := []time.Duration{-2 * time.Hour, 0, -time.Hour}
+		if err := store.Save(ctx, newTestTask(id, a2a.TaskStateCompleted, now.Add(offsets[i]))); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	tasks, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 tasks, got %d", len(tasks))
+	}
+
+	want := []a2a.TaskID{"newest", "middle", "old"}
+	for i, task := range tasks {
+		if task.ID != want[i] {
+			t.Errorf("tasks[%d].ID = %q, want %q", i, task.ID, want[i])
+		}
+	}
+}
+
+func TestFileTaskStore_FailsUnfinishedOnReopen(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := NewFileTaskStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+	for id, state := range map[a2a.TaskID]a2a.TaskState{
+		"working":  a2a.TaskStateWorking,
+		"waiting":  a2a.TaskStateInputRequired,
+		"finished": a2a.TaskStateCompleted,
+	} {
+		if err := store.Save(ctx, newTestTask(id, state, time.Now())); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	// The tasks in progress were interrupted by the restart
+	reopened, err := NewFileTaskStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileTaskStore: %v", err)
+	}
+	for id, want := range map[a2a.TaskID]a2a.TaskState{
+		"working":  a2a.TaskStateFailed,
+		"waiting":  a2a.TaskStateFailed,
+		"finished": a2a.TaskStateCompleted,
+	} {
+		got, err := reopened.Get(ctx, id)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", id, err)
+		}
+		if got.Status.State != want {
+			t.Errorf("%s: State = %q, want %q", id, got.Status.State, want)
+		}
+	}
+}
+
+// saveAged saves a task and sets its last update to age ago.
+func saveAged(t *testing.T, store *FileTaskStore, id a2a.TaskID, state a2a.TaskState, age time.Duration) {
+	t.Helper()
+	if err := store.Save(context.Background(), newTestTask(id, state, time.Now())); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	path, _ := store.path(id)
+	at := time.Now().Add(-age)
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatalf("Chtimes: %v", err)
+	}
+}
+
+func TestFileTaskStore_PrunesByCount(t *testing.T) {
+	store, err := NewFileTaskStoreWithOptions(t.TempDir(), FileTaskStoreOptions{MaxTasks: 2})
+	if err != nil {
+		t.Fatalf("NewFileTaskStoreWithOptions: %v", err)
+	}
+
+	saveAged(t, store, "running", a2a.TaskStateWorking, 4*time.Minute)
+	saveAged(t, store, "oldest", a2a.TaskStateCompleted, 3*time.Minute)
+	saveAged(t, store, "older", a2a.TaskStateFailed, 2*time.Minute)
+	saveAged(t, store, "newest", a2a.TaskStateCompleted, 0)
+
+	assertTasks(t, store, "newest", "running")
+}
+
+func TestFileTaskStore_PrunesByAge(t *testing.T) {
+	store, err := NewFileTaskStoreWithOptions(t.TempDir(), FileTaskStoreOptions{MaxAge: time.Hour})
+	if err != nil {
+		t.Fatalf("NewFileTaskStoreWithOptions: %v", err)
+	}
+
+	saveAged(t, store, "running", a2a.TaskStateWorking, 2*time.Hour)
+	saveAged(t, store, "expired", a2a.TaskStateCompleted, 2*time.Hour)
+	saveAged(t, store, "recent", a2a.TaskStateCompleted, time.Minute)
+	saveAged(t, store, "newest", a2a.TaskStateCompleted, 0)
+
+	assertTasks(t, store, "newest", "recent", "running")
+}
+
+// assertTasks checks that the store holds exactly the tasks with the given IDs.
+func assertTasks(t *testing.T, store *FileTaskStore, want ...a2a.TaskID) {
+	t.Helper()
+	tasks, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var got []a2a.TaskID
+	for _, task := range tasks {
+		got = append(got, task.ID)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("tasks = %v, want %v", got, want)
+	}
+}
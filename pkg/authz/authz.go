@@ -0,0 +1,100 @@
+// Package authz authorizes gRPC calls by the caller's SPIFFE identity.
+//
+// A Policy is an allow-list of rules. Each rule names the methods it covers
+// and the identities allowed to call them. A method that no rule covers is
+// open to any peer that completed mTLS; a covered method may only be called
+// by an identity allowed by one of the rules covering it.
+package authz
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// Rule allows a set of identities to call a set of methods.
+// Patterns use path.Match syntax, so "*" does not cross a "/".
+type Rule struct {
+	// Methods are full gRPC method names or patterns,
+	// e.g. "/tndrl.v1.ControlService/Shutdown" or "/tndrl.v1.ControlService/*".
+	Methods []string `yaml:"methods"`
+
+	// Allow are SPIFFE IDs or patterns, e.g. "spiffe://tndrl/node/ops-*".
+	Allow []string `yaml:"allow"`
+}
+
+// Policy is an allow-list of rules.
+type Policy struct {
+	rules []Rule
+}
+
+// NewPolicy validates the rules and returns a policy.
+func NewPolicy(rules []Rule) (*Policy, error) {
+	for i, rule := range rules {
+		if len(rule.Methods) == 0 {
+			return nil, fmt.Errorf("rule %d: no methods", i)
+		}
+		if err := validatePatterns(rule.Methods); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+		if err := validatePatterns(rule.Allow); err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return &Policy{rules: rules}, nil
+}
+
+// validatePatterns checks that every pattern is well-formed.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Covers reports whether any rule covers the method.
+func (p *Policy) Covers(method string) bool {
+	if p == nil {
+		return false
+	}
+	for _, rule := range p.rules {
+		if matchAny(rule.Methods, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether the identity may call the method.
+func (p *Policy) Allowed(identity, method string) bool {
+	if !p.Covers(method) {
+		return true
+	}
+	for _, rule := range p.rules {
+		if matchAny(rule.Methods, method) && matchAny(rule.Allow, identity) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether s matches any of the patterns.
+func matchAny(patterns []string, s string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// PeerIdentity returns the SPIFFE ID of the peer that made a gRPC call,
+// taken from its verified TLS client certificate. See
+// transport.PeerIdentity.
+func PeerIdentity(ctx context.Context) (string, error) {
+	return transport.PeerIdentity(ctx)
+}
@@ -0,0 +1,64 @@
+package authz
+
+import "testing"
+
+func TestNewPolicy_Validation(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{"no methods", []Rule{{Allow: []string{"spiffe://tndrl/node/*"}}}},
+		{"bad method pattern", []Rule{{Methods: []string{"/svc/["}}}},
+		{"bad identity pattern", []Rule{{Methods: []string{"/svc/*"}, Allow: []string{"spiffe://tndrl/node/["}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewPolicy(tt.rules); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestPolicy_Allowed(t *testing.T) {
+	p, err := NewPolicy([]Rule{
+		{
+			Methods: []string{"/tndrl.v1.ControlService/Shutdown"},
+			Allow:   []string{"spiffe://tndrl/node/ops-*"},
+		},
+		{
+			Methods: []string{"/a2a.v1.A2AService/*"},
+			Allow:   []string{"spiffe://tndrl/node/ops-*", "spiffe://tndrl/node/frontend"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	tests := []struct {
+		identity string
+		method   string
+		want     bool
+	}{
+		{"spiffe://tndrl/node/ops-1", "/tndrl.v1.ControlService/Shutdown", true},
+		{"spiffe://tndrl/node/worker", "/tndrl.v1.ControlService/Shutdown", false},
+		{"spiffe://tndrl/node/ops-1/extra", "/tndrl.v1.ControlService/Shutdown", false},
+		{"spiffe://tndrl/node/worker", "/tndrl.v1.ControlService/Ping", true},
+		{"spiffe://tndrl/node/frontend", "/a2a.v1.A2AService/SendMessage", true},
+		{"spiffe://tndrl/node/worker", "/a2a.v1.A2AService/SendMessage", false},
+	}
+
+	for _, tt := range tests {
+		if got := p.Allowed(tt.identity, tt.method); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.identity, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_NilAllowsEverything(t *testing.T) {
+	var p *Policy
+	if !p.Allowed("spiffe://tndrl/node/anyone", "/tndrl.v1.ControlService/Shutdown") {
+		t.Error("nil policy should allow every call")
+	}
+}
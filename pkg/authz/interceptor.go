@@ -0,0 +1,53 @@
+package authz
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor returns an interceptor that rejects unary calls the
+// policy does not allow. A nil policy allows every call.
+func (p *Policy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := p.authorize(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that rejects streaming calls
+// the policy does not allow. A nil policy allows every call.
+func (p *Policy) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := p.authorize(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// authorize checks the caller of method against the policy.
+func (p *Policy) authorize(ctx context.Context, method string) error {
+	if !p.Covers(method) {
+		return nil
+	}
+
+	identity, err := PeerIdentity(ctx)
+	if err != nil {
+		slog.Warn("rpc denied: unknown caller", "method", method, "err", err)
+		return status.Errorf(codes.Unauthenticated, "caller identity unknown: %v", err)
+	}
+
+	if !p.Allowed(identity, method) {
+		slog.Warn("rpc denied", "method", method, "caller", identity)
+		return status.Errorf(codes.PermissionDenied, "%s may not call %s", identity, method)
+	}
+
+	slog.Debug("rpc allowed", "method", method, "caller", identity)
+	return nil
+}
@@ -0,0 +1,67 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/shanemcd/tndrl/internal/testutil"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	p, err := NewPolicy([]Rule{{
+		Methods: []string{"/tndrl.v1.ControlService/Shutdown"},
+		Allow:   []string{"spiffe://tndrl/node/ops-*"},
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	interceptor := p.UnaryServerInterceptor()
+
+	call := func(ctx context.Context, method string) error {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req any) (any, error) { return "ok", nil })
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"allowed", testutil.PeerContext(t, "ops-1"), "/tndrl.v1.ControlService/Shutdown", codes.OK},
+		{"denied", testutil.PeerContext(t, "worker"), "/tndrl.v1.ControlService/Shutdown", codes.PermissionDenied},
+		{"uncovered", testutil.PeerContext(t, "worker"), "/tndrl.v1.ControlService/Ping", codes.OK},
+		{"no peer", context.Background(), "/tndrl.v1.ControlService/Shutdown", codes.Unauthenticated},
+		{"no peer uncovered", context.Background(), "/tndrl.v1.ControlService/Ping", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(call(tt.ctx, tt.method)); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeerIdentity(t *testing.T) {
+	id, err := PeerIdentity(testutil.PeerContext(t, "frontend"))
+	if err != nil {
+		t.Fatalf("PeerIdentity: %v", err)
+	}
+	if want := pki.NodeIdentity("frontend"); id != want {
+		t.Errorf("PeerIdentity = %q, want %q", id, want)
+	}
+
+	ctx := peer.NewContext(context.Background(), &peer.Peer{})
+	if _, err := PeerIdentity(ctx); err == nil {
+		t.Error("expected error for peer without TLS state")
+	}
+}
@@ -5,18 +5,28 @@ import (
 	"log/slog"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
 )
 
 // ShutdownFunc is called when a shutdown is requested via the Control RPC.
 type ShutdownFunc func(graceful bool, timeout time.Duration, reason string)
 
+// Enroller issues certificates to nodes joining with a join token.
+// Errors it returns should be gRPC status errors.
+type Enroller interface {
+	Enroll(ctx context.Context, token string, csr []byte) (cert, ca []byte, err error)
+}
+
 // Server implements tndrlv1.ControlServiceServer.
 type Server struct {
 	tndrlv1.UnimplementedControlServiceServer
 
 	state    *State
 	shutdown ShutdownFunc
+	enroller Enroller
 }
 
 // NewServer creates a new ControlService server.
@@ -27,6 +37,12 @@ func NewServer(state *State, shutdownFn ShutdownFunc) *Server {
 	}
 }
 
+// SetEnroller enables the Enroll RPC. Without an enroller, Enroll fails
+// with codes.Unimplemented.
+func (s *Server) SetEnroller(e Enroller) {
+	s.enroller = e
+}
+
 // Ping implements health check with latency measurement.
 func (s *Server) Ping(ctx context.Context, req *tndrlv1.PingRequest) (*tndrlv1.PingResponse, error) {
 	slog.Debug("ping received", "timestamp", req.Timestamp)
@@ -40,12 +56,18 @@ func (s *Server) Ping(ctx context.Context, req *tndrlv1.PingRequest) (*tndrlv1.P
 func (s *Server) GetStatus(ctx context.Context, req *tndrlv1.GetStatusRequest) (*tndrlv1.GetStatusResponse, error) {
 	state := s.state.GetState()
 	slog.Debug("status requested", "state", state.String())
+	cert, ca := s.state.GetCertificates()
+	reasons := s.state.GetDegradedReasons()
 	return &tndrlv1.GetStatusResponse{
-		Identity:      s.state.GetIdentity(),
-		State:         state,
-		UptimeSeconds: s.state.GetUptime(),
-		ActiveTasks:   s.state.GetActiveTasks(),
-		Metadata:      s.state.GetMetadata(),
+		Identity:        s.state.GetIdentity(),
+		State:           state,
+		UptimeSeconds:   s.state.GetUptime(),
+		ActiveTasks:     s.state.GetActiveTasks(),
+		Metadata:        s.state.GetMetadata(),
+		Certificate:     cert,
+		CaCertificate:   ca,
+		Degraded:        len(reasons) > 0,
+		DegradedReasons: reasons,
 	}, nil
 }
 
@@ -70,3 +92,19 @@ func (s *Server) Shutdown(ctx context.Context, req *tndrlv1.ShutdownRequest) (*t
 		Accepted: true,
 	}, nil
 }
+
+// Enroll issues a certificate to a joining node.
+func (s *Server) Enroll(ctx context.Context, req *tndrlv1.EnrollRequest) (*tndrlv1.EnrollResponse, error) {
+	if s.enroller == nil {
+		return nil, status.Error(codes.Unimplemented, "enrollment is not enabled on this node")
+	}
+
+	cert, ca, err := s.enroller.Enroll(ctx, req.Token, req.Csr)
+	if err != nil {
+		return nil, err
+	}
+	return &tndrlv1.EnrollResponse{
+		Certificate:   cert,
+		CaCertificate: ca,
+	}, nil
+}
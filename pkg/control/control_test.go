@@ -6,6 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
 	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
 )
 
@@ -139,3 +142,42 @@ func TestShutdownAlreadyStopped(t *testing.T) {
 		t.Errorf("expected shutdown to be rejected when already stopped")
 	}
 }
+
+// enrollerFunc adapts a function to the Enroller interface.
+type enrollerFunc func(ctx context.Context, token string, csr []byte) ([]byte, []byte, error)
+
+func (f enrollerFunc) Enroll(ctx context.Context, token string, csr []byte) ([]byte, []byte, error) {
+	return f(ctx, token, csr)
+}
+
+func TestEnrollDisabled(t *testing.T) {
+	server := NewServer(NewState("test"), nil)
+
+	_, err := server.Enroll(context.Background(), &tndrlv1.EnrollRequest{Token: "t", Csr: []byte("csr")})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got %v", err)
+	}
+}
+
+func TestEnroll(t *testing.T) {
+	server := NewServer(NewState("test"), nil)
+	server.SetEnroller(enrollerFunc(func(ctx context.Context, token string, csr []byte) ([]byte, []byte, error) {
+		if token != "good" {
+			return nil, nil, status.Error(codes.PermissionDenied, "bad token")
+		}
+		return append([]byte("cert for "), csr...), []byte("ca"), nil
+	}))
+
+	resp, err := server.Enroll(context.Background(), &tndrlv1.EnrollRequest{Token: "good", Csr: []byte("csr")})
+	if err != nil {
+		t.Fatalf("Enroll failed: %v", err)
+	}
+	if string(resp.Certificate) != "cert for csr" || string(resp.CaCertificate) != "ca" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+
+	_, err = server.Enroll(context.Background(), &tndrlv1.EnrollRequest{Token: "bad", Csr: []byte("csr")})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied, got %v", err)
+	}
+}
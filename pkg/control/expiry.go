@@ -0,0 +1,200 @@
+package control
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// DefaultExpiryWarnings are the times before a certificate expires at which
+// a warning is logged.
+var DefaultExpiryWarnings = []time.Duration{14 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour}
+
+// DefaultExpiryDegraded is how long before a certificate expires the node
+// is reported degraded.
+const DefaultExpiryDegraded = 7 * 24 * time.Hour
+
+// DefaultExpiryInterval is how often certificates are checked.
+const DefaultExpiryInterval = 10 * time.Minute
+
+// CertificatesFunc returns the node's current certificate and the CA
+// certificates above it. It is called on every check, so that renewed
+// certificates are picked up.
+type CertificatesFunc func() (cert *x509.Certificate, ca []*x509.Certificate)
+
+// ExpiryOptions configures an ExpiryMonitor.
+type ExpiryOptions struct {
+	// Warnings are the times before expiry at which a warning is logged,
+	// once for each certificate. Defaults to DefaultExpiryWarnings.
+	Warnings []time.Duration
+
+	// Degraded is how long before a certificate expires the node is
+	// reported degraded. Defaults to DefaultExpiryDegraded.
+	Degraded time.Duration
+
+	// Interval is how often Run checks (default DefaultExpiryInterval).
+	Interval time.Duration
+}
+
+// ExpiryMonitor tracks how long the node's certificate and its CA remain
+// valid, so that a node can warn before handshakes start failing.
+type ExpiryMonitor struct {
+	certs CertificatesFunc
+	opts  ExpiryOptions
+	now   func() time.Time
+
+	mu sync.Mutex
+	// warned holds the smallest warning window logged for each
+	// certificate, by serial
+	warned map[string]time.Duration
+}
+
+// NewExpiryMonitor creates a monitor for the certificates returned by certs.
+func NewExpiryMonitor(certs CertificatesFunc, opts ExpiryOptions) *ExpiryMonitor {
+	if opts.Warnings == nil {
+		opts.Warnings = DefaultExpiryWarnings
+	}
+	if opts.Degraded == 0 {
+		opts.Degraded = DefaultExpiryDegraded
+	}
+	if opts.Interval == 0 {
+		opts.Interval = DefaultExpiryInterval
+	}
+	// Largest window first, so the last one a certificate is within is the
+	// nearest to expiry
+	opts.Warnings = slices.Clone(opts.Warnings)
+	slices.Sort(opts.Warnings)
+	slices.Reverse(opts.Warnings)
+
+	return &ExpiryMonitor{
+		certs:  certs,
+		opts:   opts,
+		now:    time.Now,
+		warned: make(map[string]time.Duration),
+	}
+}
+
+// Run checks now and then every Interval until ctx is done.
+func (m *ExpiryMonitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		m.Check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check logs a warning for each certificate that has come within a warning
+// window since it was last checked, and an error for each that has expired.
+func (m *ExpiryMonitor) Check() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	for _, c := range m.watched() {
+		remaining := c.cert.NotAfter.Sub(now)
+		key := c.cert.SerialNumber.Text(16)
+		window, within := m.window(remaining)
+		if !within {
+			continue
+		}
+		if last, ok := m.warned[key]; ok && last <= window {
+			continue
+		}
+		m.warned[key] = window
+
+		if remaining <= 0 {
+			slog.Error("certificate expired", "certificate", c.kind, "subject", c.subject, "expired", c.cert.NotAfter)
+			continue
+		}
+		slog.Warn("certificate expires soon", "certificate", c.kind, "subject", c.subject,
+			"expires", c.cert.NotAfter, "remaining", formatRemaining(remaining))
+	}
+}
+
+// window returns the smallest warning window remaining is within, or 0 if
+// the certificate has expired.
+func (m *ExpiryMonitor) window(remaining time.Duration) (time.Duration, bool) {
+	if remaining <= 0 {
+		return 0, true
+	}
+	var window time.Duration
+	within := false
+	for _, w := range m.opts.Warnings {
+		if remaining <= w {
+			window, within = w, true
+		}
+	}
+	return window, within
+}
+
+// Status returns the expiry of the node's certificate and of the CA
+// certificate that expires first, and why the node is degraded, if any
+// certificate is within the degraded window.
+func (m *ExpiryMonitor) Status() (cert, ca *tndrlv1.CertificateStatus, degraded []string) {
+	now := m.now()
+	for _, c := range m.watched() {
+		status := &tndrlv1.CertificateStatus{
+			Subject:          c.subject,
+			Serial:           c.cert.SerialNumber.Text(16),
+			NotAfter:         c.cert.NotAfter.Unix(),
+			ExpiresInSeconds: int64(c.cert.NotAfter.Sub(now).Seconds()),
+		}
+		if c.kind == "node" {
+			cert = status
+		} else if ca == nil || status.NotAfter < ca.NotAfter {
+			ca = status
+		}
+
+		switch remaining := c.cert.NotAfter.Sub(now); {
+		case remaining <= 0:
+			degraded = append(degraded, fmt.Sprintf("%s certificate %s has expired", c.kind, c.subject))
+		case remaining <= m.opts.Degraded:
+			degraded = append(degraded, fmt.Sprintf("%s certificate %s expires in %s", c.kind, c.subject, formatRemaining(remaining)))
+		}
+	}
+	return cert, ca, degraded
+}
+
+type watchedCert struct {
+	kind    string
+	subject string
+	cert    *x509.Certificate
+}
+
+// watched returns the certificates to check.
+func (m *ExpiryMonitor) watched() []watchedCert {
+	leaf, cas := m.certs()
+	var certs []watchedCert
+	if leaf != nil {
+		subject, err := pki.IdentityFromCert(leaf)
+		if err != nil {
+			subject = leaf.Subject.CommonName
+		}
+		certs = append(certs, watchedCert{kind: "node", subject: subject, cert: leaf})
+	}
+	for _, c := range cas {
+		certs = append(certs, watchedCert{kind: "CA", subject: c.Subject.CommonName, cert: c})
+	}
+	return certs
+}
+
+// formatRemaining formats the time left before expiry in days, or more
+// precisely once it is under two days.
+func formatRemaining(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%d days", int(d.Hours()/24))
+	}
+	return d.Round(time.Minute).String()
+}
@@ -0,0 +1,113 @@
+package control
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// newTestMonitor returns a monitor for a new node certificate and its CA.
+func newTestMonitor(t *testing.T, opts ExpiryOptions) (*ExpiryMonitor, *x509.Certificate, *pki.CA) {
+	t.Helper()
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	cert, err := pki.GenerateCert(ca, pki.NodeIdentity("web"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	m := NewExpiryMonitor(func() (*x509.Certificate, []*x509.Certificate) {
+		return cert.Cert, ca.Certificates()
+	}, opts)
+	return m, cert.Cert, ca
+}
+
+func TestExpiryMonitor_Status(t *testing.T) {
+	m, cert, ca := newTestMonitor(t, ExpiryOptions{})
+
+	m.now = func() time.Time { return cert.NotAfter.Add(-30 * 24 * time.Hour) }
+	certStatus, caStatus, degraded := m.Status()
+	if certStatus.Subject != pki.NodeIdentity("web") {
+		t.Errorf("certificate subject = %q, want %q", certStatus.Subject, pki.NodeIdentity("web"))
+	}
+	if got, want := certStatus.ExpiresInSeconds, int64(30*24*60*60); got != want {
+		t.Errorf("certificate expires in %ds, want %ds", got, want)
+	}
+	if caStatus.NotAfter != ca.Cert.NotAfter.Unix() || caStatus.Serial != ca.Cert.SerialNumber.Text(16) {
+		t.Errorf("CA status = %v, want the CA certificate", caStatus)
+	}
+	if len(degraded) != 0 {
+		t.Errorf("degraded = %q, want none 30 days before expiry", degraded)
+	}
+
+	m.now = func() time.Time { return cert.NotAfter.Add(-3 * 24 * time.Hour) }
+	if _, _, degraded := m.Status(); len(degraded) != 1 {
+		t.Errorf("degraded = %q, want the node certificate 3 days before expiry", degraded)
+	}
+
+	m.now = func() time.Time { return ca.Cert.NotAfter.Add(time.Hour) }
+	certStatus, _, degraded = m.Status()
+	if certStatus.ExpiresInSeconds >= 0 {
+		t.Errorf("expired certificate expires in %ds, want negative", certStatus.ExpiresInSeconds)
+	}
+	if len(degraded) != 2 {
+		t.Errorf("degraded = %q, want both certificates expired", degraded)
+	}
+}
+
+func TestExpiryMonitor_Check(t *testing.T) {
+	m, cert, _ := newTestMonitor(t, ExpiryOptions{Warnings: []time.Duration{24 * time.Hour, 7 * 24 * time.Hour}})
+	serial := cert.SerialNumber.Text(16)
+
+	tests := []struct {
+		before time.Duration
+		want   time.Duration
+		warned bool
+	}{
+		{30 * 24 * time.Hour, 0, false},
+		{6 * 24 * time.Hour, 7 * 24 * time.Hour, true},
+		{5 * 24 * time.Hour, 7 * 24 * time.Hour, true},
+		{12 * time.Hour, 24 * time.Hour, true},
+		{-time.Hour, 0, true},
+	}
+	for _, tt := range tests {
+		m.now = func() time.Time { return cert.NotAfter.Add(-tt.before) }
+		m.Check()
+		got, warned := m.warned[serial]
+		if warned != tt.warned || got != tt.want {
+			t.Errorf("%s before expiry: warned for window %s (%v), want %s (%v)", tt.before, got, warned, tt.want, tt.warned)
+		}
+	}
+}
+
+func TestExpiryMonitor_Run(t *testing.T) {
+	m, _, _ := newTestMonitor(t, ExpiryOptions{Interval: time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	m.Run(ctx)
+}
+
+func TestGetStatus_Expiry(t *testing.T) {
+	m, cert, _ := newTestMonitor(t, ExpiryOptions{Degraded: 400 * 24 * time.Hour})
+	state := NewState(pki.NodeIdentity("web"))
+	state.SetExpiryMonitor(m)
+
+	resp, err := NewServer(state, nil).GetStatus(context.Background(), &tndrlv1.GetStatusRequest{})
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if resp.Certificate.GetNotAfter() != cert.NotAfter.Unix() {
+		t.Errorf("certificate not_after = %d, want %d", resp.Certificate.GetNotAfter(), cert.NotAfter.Unix())
+	}
+	if resp.CaCertificate == nil {
+		t.Error("CA certificate status missing")
+	}
+	if !resp.Degraded || len(resp.DegradedReasons) != 1 {
+		t.Errorf("degraded = %v %q, want the node certificate within the window", resp.Degraded, resp.DegradedReasons)
+	}
+}
@@ -19,6 +19,7 @@ type State struct {
 
 	mu       sync.RWMutex
 	metadata map[string]string
+	expiry   *ExpiryMonitor
 }
 
 // NewState creates a new State in STARTING mode.
@@ -106,3 +107,34 @@ func (s *State) GetMetadata() map[string]string {
 	}
 	return result
 }
+
+// SetExpiryMonitor makes the status include the expiry of the certificates
+// m tracks, and report the node degraded when they are close to expiry.
+func (s *State) SetExpiryMonitor(m *ExpiryMonitor) {
+	s.mu.Lock()
+	s.expiry = m
+	s.mu.Unlock()
+}
+
+// GetCertificates returns the expiry of the node's certificate and its CA,
+// or nils if no expiry monitor is set.
+func (s *State) GetCertificates() (cert, ca *tndrlv1.CertificateStatus) {
+	cert, ca, _ = s.expiryStatus()
+	return cert, ca
+}
+
+// GetDegradedReasons returns why the node is degraded, or nil if it is not.
+func (s *State) GetDegradedReasons() []string {
+	_, _, reasons := s.expiryStatus()
+	return reasons
+}
+
+func (s *State) expiryStatus() (cert, ca *tndrlv1.CertificateStatus, degraded []string) {
+	s.mu.RLock()
+	m := s.expiry
+	s.mu.RUnlock()
+	if m == nil {
+		return nil, nil, nil
+	}
+	return m.Status()
+}
@@ -0,0 +1,100 @@
+// Package enroll lets a new node obtain its certificate from a CA host
+// with a one-time join token, instead of copying a CSR and certificate
+// between machines by hand.
+//
+// The CA host creates a token with Tokens.Create and hands it to the new
+// node out of band. The node generates its key, then calls the Control
+// service's Enroll RPC with the token and a CSR. It has no client
+// certificate yet and does not trust the CA, so it connects with a TLS
+// config that pins the CA fingerprint carried in the token
+// (pki.PinnedTLSConfig). The CA host checks and consumes the token and
+// returns the signed certificate and the CA certificate. If the CA host
+// signs with an intermediate CA, the token pins the root and both
+// certificates come with their chains.
+package enroll
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// Service issues certificates to enrolling nodes. It implements
+// control.Enroller.
+type Service struct {
+	// CA signs the certificates. Its private key is required.
+	CA *pki.CA
+
+	// Tokens holds the join tokens that may be used.
+	Tokens *Tokens
+
+	// TrustDomain is the trust domain nodes enroll into. Only node
+	// identities in it are signed.
+	TrustDomain pki.TrustDomain
+}
+
+// NewService returns an enrollment service for a CA and its token store,
+// enrolling nodes into trust domain td (DefaultTrustDomain if empty).
+func NewService(ca *pki.CA, tokens *Tokens, td pki.TrustDomain) (*Service, error) {
+	if ca.Key == nil {
+		return nil, errors.New("enrollment requires the CA private key")
+	}
+	if td == "" {
+		td = pki.DefaultTrustDomain
+	}
+	return &Service{CA: ca, Tokens: tokens, TrustDomain: td}, nil
+}
+
+// Enroll checks and consumes the token, then signs the CSR with the SANs the
+// token allows. It returns the PEM-encoded certificate and CA certificate,
+// each followed by its chain.
+func (s *Service) Enroll(ctx context.Context, token string, csrPEM []byte) ([]byte, []byte, error) {
+	tok, err := ParseToken(token)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if tok.CAFingerprint != pki.Fingerprint(s.CA.Root()) {
+		return nil, nil, status.Errorf(codes.PermissionDenied, "%v: issued by a different CA", ErrInvalidToken)
+	}
+
+	csr, err := pki.ParseCSR(csrPEM)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	identity, err := pki.CSRIdentity(csr)
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := s.TrustDomain.NodeID(identity); err != nil {
+		return nil, nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	grant, err := s.Tokens.Consume(tok, identity)
+	if err != nil {
+		slog.Warn("enrollment rejected", "token", tok.ID, "identity", identity, "err", err)
+		if errors.Is(err, ErrInvalidToken) {
+			return nil, nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, nil, status.Error(codes.Internal, err.Error())
+	}
+
+	cert, err := s.CA.SignCSR(csr, true, true, pki.SignOptions{ // server + client
+		TrustDomain: s.TrustDomain,
+		DNSNames:    grant.DNSNames,
+		IPAddresses: grant.IPAddresses,
+	})
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Internal, "sign certificate: %v", err)
+	}
+
+	slog.Info("node enrolled", "token", tok.ID, "identity", identity, "serial", fmt.Sprintf("%x", cert.SerialNumber))
+	certPEM := pki.EncodeCertificate(append([]*x509.Certificate{cert}, s.CA.IssuerChain()...)...)
+	return certPEM, pki.EncodeCertificate(s.CA.Certificates()...), nil
+}
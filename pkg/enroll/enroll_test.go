@@ -0,0 +1,259 @@
+package enroll
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/control"
+	"github.com/shanemcd/tndrl/pkg/pki"
+	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+)
+
+// newTestService returns an enrollment service with a fresh CA and store.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	svc, err := NewService(ca, NewTokens(filepath.Join(t.TempDir(), TokensFile)), "")
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return svc
+}
+
+func TestNewService_RequiresCAKey(t *testing.T) {
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	ca.Key = nil
+
+	if _, err := NewService(ca, NewTokens(filepath.Join(t.TempDir(), TokensFile)), ""); err == nil {
+		t.Error("NewService without CA key succeeded")
+	}
+}
+
+func TestService_Enroll(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	identity := pki.NodeIdentity("worker")
+	req, err := pki.NewCertRequest(identity)
+	if err != nil {
+		t.Fatalf("NewCertRequest: %v", err)
+	}
+	tok, err := svc.Tokens.Create(pki.Fingerprint(svc.CA.Cert), Grant{Identity: identity}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	certPEM, caPEM, err := svc.Enroll(ctx, tok.String(), req.PEM())
+	if err != nil {
+		t.Fatalf("Enroll: %v", err)
+	}
+
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		t.Fatalf("ParseCertificate: %v", err)
+	}
+	if got, _ := pki.IdentityFromCert(cert); got != identity {
+		t.Errorf("identity = %q, want %q", got, identity)
+	}
+	ca, err := pki.ParseCertificate(caPEM)
+	if err != nil {
+		t.Fatalf("ParseCertificate CA: %v", err)
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("certificate not signed by returned CA: %v", err)
+	}
+
+	// The token is used up
+	if _, _, err := svc.Enroll(ctx, tok.String(), req.PEM()); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("reused token: code = %v, want PermissionDenied", status.Code(err))
+	}
+}
+
+func TestService_EnrollRejects(t *testing.T) {
+	svc := newTestService(t)
+	ctx := context.Background()
+
+	identity := pki.NodeIdentity("worker")
+	req, err := pki.NewCertRequest(identity)
+	if err != nil {
+		t.Fatalf("NewCertRequest: %v", err)
+	}
+	tok, err := svc.Tokens.Create(pki.Fingerprint(svc.CA.Cert), Grant{Identity: identity}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	otherCA := tok
+	otherCA.CAFingerprint = "00"
+
+	otherNode, err := pki.NewCertRequest(pki.NodeIdentity("other"))
+	if err != nil {
+		t.Fatalf("NewCertRequest: %v", err)
+	}
+	otherDomain, err := pki.NewCertRequest(pki.TrustDomain("example.org").NodeIdentity("worker"))
+	if err != nil {
+		t.Fatalf("NewCertRequest: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		csr   []byte
+		want  codes.Code
+	}{
+		{"malformed token", "nope", req.PEM(), codes.InvalidArgument},
+		{"other CA", otherCA.String(), req.PEM(), codes.PermissionDenied},
+		{"bad CSR", tok.String(), []byte("not a csr"), codes.InvalidArgument},
+		{"other node", tok.String(), otherNode.PEM(), codes.PermissionDenied},
+		{"other trust domain", tok.String(), otherDomain.PEM(), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := svc.Enroll(ctx, tt.token, tt.csr)
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+		})
+	}
+
+	// None of the failures used up the token
+	if _, _, err := svc.Enroll(ctx, tok.String(), req.PEM()); err != nil {
+		t.Errorf("Enroll: %v", err)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	cert, err := pki.GenerateCert(ca, pki.NodeIdentity("worker"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert: %v", err)
+	}
+
+	withCert := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: quictransport.AuthInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert.Cert}},
+		},
+	})
+	withoutCert := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: quictransport.AuthInfo{},
+	})
+
+	interceptor := UnaryServerInterceptor()
+	call := func(ctx context.Context, method string) error {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method},
+			func(ctx context.Context, req any) (any, error) { return "ok", nil })
+		return err
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"enroll without cert", withoutCert, Method, codes.OK},
+		{"ping without cert", withoutCert, tndrlv1.ControlService_Ping_FullMethodName, codes.Unauthenticated},
+		{"ping with cert", withCert, tndrlv1.ControlService_Ping_FullMethodName, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(call(tt.ctx, tt.method)); got != tt.want {
+				t.Errorf("code = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJoin(t *testing.T) {
+	// Sign with an intermediate CA, so the chain has to be carried through
+	svc := newTestService(t)
+	root := svc.CA
+	intermediate, err := pki.GenerateIntermediateCA(root, "test")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA: %v", err)
+	}
+	svc.CA = intermediate
+
+	serverCert, err := pki.GenerateCert(svc.CA, pki.NodeIdentity("ca-host"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert: %v", err)
+	}
+	serverTLS, err := pki.ServerTLSConfig(serverCert, svc.CA)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig: %v", err)
+	}
+	serverTLS.ClientAuth = tls.VerifyClientCertIfGiven
+
+	listener, err := quictransport.ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+
+	srv := grpc.NewServer(
+		grpc.Creds(quictransport.Credentials()),
+		grpc.UnaryInterceptor(UnaryServerInterceptor()),
+	)
+	controlSvc := control.NewServer(control.NewState("ca-host"), nil)
+	controlSvc.SetEnroller(svc)
+	tndrlv1.RegisterControlServiceServer(srv, controlSvc)
+	go srv.Serve(listener.ControlListener())
+	defer func() {
+		listener.Close()
+		srv.Stop()
+	}()
+
+	identity := pki.NodeIdentity("worker")
+	tok, err := svc.Tokens.Create(pki.Fingerprint(root.Cert), Grant{
+		Identity: identity,
+		DNSNames: []string{"worker.example.com"},
+	}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cert, ca, err := Join(ctx, listener.Addr().String(), tok, identity, pki.CertOptions{
+		DNSNames:     []string{"worker.example.com", "bank.example.com"},
+		KeyAlgorithm: pki.KeyEd25519,
+	})
+	if err != nil {
+		t.Fatalf("Join: %v", err)
+	}
+	if got, _ := pki.IdentityFromCert(cert.Cert); got != identity {
+		t.Errorf("identity = %q, want %q", got, identity)
+	}
+	if !ca.Cert.Equal(intermediate.Cert) || !ca.Root().Equal(root.Cert) {
+		t.Error("returned CA does not match")
+	}
+	if !slices.Contains(cert.Cert.DNSNames, "worker.example.com") || slices.Contains(cert.Cert.DNSNames, "bank.example.com") {
+		t.Errorf("DNSNames = %v, want only the name the token allows", cert.Cert.DNSNames)
+	}
+	if alg, _ := pki.KeyAlgorithmOf(cert.Cert.PublicKey); alg != pki.KeyEd25519 {
+		t.Errorf("key algorithm = %q, want %q", alg, pki.KeyEd25519)
+	}
+	if len(cert.Chain) != 1 || !cert.Chain[0].Equal(intermediate.Cert) {
+		t.Errorf("certificate chain = %d certs, want the intermediate", len(cert.Chain))
+	}
+}
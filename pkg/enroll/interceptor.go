@@ -0,0 +1,55 @@
+package enroll
+
+import (
+	"context"
+	"log/slog"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/authz"
+)
+
+// Method is the full gRPC method name of the enrollment RPC.
+const Method = tndrlv1.ControlService_Enroll_FullMethodName
+
+// A server accepting enrollments must let clients connect without a
+// certificate (tls.VerifyClientCertIfGiven). These interceptors then reject
+// every call from such clients except Enroll.
+
+// UnaryServerInterceptor returns an interceptor that rejects unary calls
+// from callers without a client certificate, other than Enroll.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := requireIdentity(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that rejects streaming
+// calls from callers without a client certificate.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := requireIdentity(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// requireIdentity checks that the caller of method presented a certificate,
+// unless method is Enroll.
+func requireIdentity(ctx context.Context, method string) error {
+	if method == Method {
+		return nil
+	}
+	if _, err := authz.PeerIdentity(ctx); err != nil {
+		slog.Warn("rpc denied: no client certificate", "method", method, "err", err)
+		return status.Errorf(codes.Unauthenticated, "client certificate required: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package enroll
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+
+	"google.golang.org/grpc"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/pki"
+	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+)
+
+// Join enrolls with the node at addr. It generates a key for identity,
+// using the key algorithm and requesting the SANs in opts, sends its CSR
+// with the token, and returns the issued certificate with
+// the key, and the issuing CA without its key. The root of the CA's chain
+// is checked against the fingerprint in the token.
+func Join(ctx context.Context, addr string, token Token, identity string, opts pki.CertOptions) (*pki.Cert, *pki.CA, error) {
+	req, err := pki.NewCertRequestWithOptions(identity, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dialer := quictransport.NewMuxDialer(pki.PinnedTLSConfig(token.CAFingerprint), nil)
+	defer dialer.Close()
+
+	// Connect before starting gRPC, so that a server that fails the pinned
+	// CA check is reported as such rather than as unavailable
+	stream, err := dialer.DialControl(ctx, addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	stream.Close()
+
+	conn, err := grpc.NewClient(
+		addr,
+		grpc.WithContextDialer(dialer.ControlDialer()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create control connection: %w", err)
+	}
+	defer conn.Close()
+
+	resp, err := tndrlv1.NewControlServiceClient(conn).Enroll(ctx, &tndrlv1.EnrollRequest{
+		Token: token.String(),
+		Csr:   req.PEM(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("enroll: %w", err)
+	}
+
+	caCerts, err := pki.ParseCertificates(resp.CaCertificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CA certificate: %w", err)
+	}
+	root := caCerts[len(caCerts)-1]
+	if pki.Fingerprint(root) != token.CAFingerprint {
+		return nil, nil, fmt.Errorf("CA certificate does not match the token fingerprint")
+	}
+
+	certs, err := pki.ParseCertificates(resp.Certificate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("certificate: %w", err)
+	}
+	cert := certs[0]
+	if err := verifyIssued(cert, certs[1:], root); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(cert.RawSubjectPublicKeyInfo, req.CSR.RawSubjectPublicKeyInfo) {
+		return nil, nil, fmt.Errorf("certificate is not for the requested key")
+	}
+
+	return &pki.Cert{Cert: cert, Key: req.Key, Chain: certs[1:]}, &pki.CA{Cert: caCerts[0], Chain: caCerts[1:]}, nil
+}
+
+// verifyIssued checks that cert chains to root through the intermediates.
+func verifyIssued(cert *x509.Certificate, intermediates []*x509.Certificate, root *x509.Certificate) error {
+	opts := x509.VerifyOptions{
+		Roots:         x509.NewCertPool(),
+		Intermediates: x509.NewCertPool(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	opts.Roots.AddCert(root)
+	for _, c := range intermediates {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return fmt.Errorf("certificate not issued by the CA: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package enroll
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokensFile is the name of the join token store, kept next to ca.key.
+const TokensFile = "join-tokens.json"
+
+// DefaultTokenTTL is how long a join token is valid by default.
+const DefaultTokenTTL = 15 * time.Minute
+
+// ErrInvalidToken is returned (wrapped) for a token that is unknown,
+// expired, already used, or bound to a different node.
+var ErrInvalidToken = errors.New("invalid join token")
+
+// Token is a join token. Its string form is "<id>.<secret>.<ca fingerprint>",
+// so a joining node needs nothing else to find and trust the CA.
+type Token struct {
+	// ID names the token in the store.
+	ID string
+
+	// Secret proves possession of the token. Only its hash is stored.
+	Secret string
+
+	// CAFingerprint is the SHA-256 fingerprint of the CA certificate
+	// (see pki.Fingerprint), pinned by the joining node.
+	CAFingerprint string
+}
+
+// String returns the token in the form accepted by ParseToken.
+func (t Token) String() string {
+	return t.ID + "." + t.Secret + "." + t.CAFingerprint
+}
+
+// ParseToken parses a token created by Tokens.Create.
+func ParseToken(s string) (Token, error) {
+	parts := strings.Split(strings.TrimSpace(s), ".")
+	if len(parts) != 3 {
+		return Token{}, fmt.Errorf("%w: expected <id>.<secret>.<ca fingerprint>", ErrInvalidToken)
+	}
+	for _, part := range parts {
+		if _, err := hex.DecodeString(part); err != nil || part == "" {
+			return Token{}, fmt.Errorf("%w: malformed", ErrInvalidToken)
+		}
+	}
+	return Token{ID: parts[0], Secret: parts[1], CAFingerprint: parts[2]}, nil
+}
+
+// Grant is what a token lets a node enroll as.
+type Grant struct {
+	// Identity is the SPIFFE identity the node must request.
+	Identity string
+
+	// DNSNames and IPAddresses are the SANs the node may request. Any
+	// others in its CSR are left out of the certificate.
+	DNSNames    []string
+	IPAddresses []net.IP
+}
+
+// tokenEntry is a stored token.
+type tokenEntry struct {
+	ID          string    `json:"id"`
+	Hash        string    `json:"hash"`
+	Name        string    `json:"name,omitempty"`
+	DNSNames    []string  `json:"dnsNames,omitempty"`
+	IPAddresses []net.IP  `json:"ipAddresses,omitempty"`
+	Expires     time.Time `json:"expires"`
+}
+
+// Tokens is the store of outstanding join tokens on the CA host. Each token
+// can be used once. The store is a JSON file that is re-read on every
+// operation, so tokens created by the CLI are seen by a running server.
+type Tokens struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewTokens returns the store kept in the file at path.
+// The file is created when the first token is.
+func NewTokens(path string) *Tokens {
+	return &Tokens{path: path}
+}
+
+// Create adds a token valid for ttl. The token can only enroll a node
+// requesting the identity in grant, with at most the SANs in grant.
+func (t *Tokens) Create(caFingerprint string, grant Grant, ttl time.Duration) (Token, error) {
+	if grant.Identity == "" {
+		return Token{}, errors.New("join token requires a node identity")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.load()
+	if err != nil {
+		return Token{}, err
+	}
+
+	id, err := randomHex(6)
+	if err != nil {
+		return Token{}, err
+	}
+	secret, err := randomHex(16)
+	if err != nil {
+		return Token{}, err
+	}
+
+	entries = append(entries, tokenEntry{
+		ID:          id,
+		Hash:        hashSecret(secret),
+		Name:        grant.Identity,
+		DNSNames:    grant.DNSNames,
+		IPAddresses: grant.IPAddresses,
+		Expires:     time.Now().Add(ttl).UTC(),
+	})
+	if err := t.save(entries); err != nil {
+		return Token{}, err
+	}
+	return Token{ID: id, Secret: secret, CAFingerprint: caFingerprint}, nil
+}
+
+// Consume checks a token presented by a node requesting identity and
+// removes it from the store, so it cannot be used again. It returns what the
+// token grants.
+func (t *Tokens) Consume(token Token, identity string) (Grant, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, err := t.load()
+	if err != nil {
+		return Grant{}, err
+	}
+
+	for i, entry := range entries {
+		if entry.ID != token.ID {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(entry.Hash), []byte(hashSecret(token.Secret))) != 1 {
+			return Grant{}, fmt.Errorf("%w: wrong secret", ErrInvalidToken)
+		}
+		// Tokens created before they had to name a node are not honoured
+		if entry.Name == "" {
+			return Grant{}, fmt.Errorf("%w: token is not bound to a node", ErrInvalidToken)
+		}
+		if entry.Name != identity {
+			return Grant{}, fmt.Errorf("%w: token is for %s", ErrInvalidToken, entry.Name)
+		}
+		if err := t.save(append(entries[:i], entries[i+1:]...)); err != nil {
+			return Grant{}, err
+		}
+		return Grant{Identity: entry.Name, DNSNames: entry.DNSNames, IPAddresses: entry.IPAddresses}, nil
+	}
+	return Grant{}, fmt.Errorf("%w: unknown or expired", ErrInvalidToken)
+}
+
+// load reads the unexpired tokens. A missing file holds no tokens.
+// Callers must hold t.mu.
+func (t *Tokens) load() ([]tokenEntry, error) {
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read join tokens: %w", err)
+	}
+
+	var entries []tokenEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse join tokens %s: %w", t.path, err)
+	}
+
+	now := time.Now()
+	valid := entries[:0]
+	for _, entry := range entries {
+		if now.Before(entry.Expires) {
+			valid = append(valid, entry)
+		}
+	}
+	return valid, nil
+}
+
+// save replaces the store file. Callers must hold t.mu.
+func (t *Tokens) save(entries []tokenEntry) error {
+	if entries == nil {
+		entries = []tokenEntry{}
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal join tokens: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("write join tokens: %w", err)
+	}
+	if err := os.Rename(tmp, t.path); err != nil {
+		return fmt.Errorf("write join tokens: %w", err)
+	}
+	return nil
+}
+
+// hashSecret returns the stored form of a token secret.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes as hex.
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
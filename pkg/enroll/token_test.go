@@ -0,0 +1,138 @@
+package enroll
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFingerprint = "0123456789abcdef"
+
+func TestParseToken(t *testing.T) {
+	tok := Token{ID: "a1b2", Secret: "c3d4", CAFingerprint: testFingerprint}
+
+	got, err := ParseToken(tok.String())
+	if err != nil {
+		t.Fatalf("ParseToken: %v", err)
+	}
+	if got != tok {
+		t.Errorf("ParseToken = %+v, want %+v", got, tok)
+	}
+
+	for _, bad := range []string{"", "a1b2.c3d4", "a1b2.c3d4.xyz", "a1b2..0123", "a.b.c.d"} {
+		if _, err := ParseToken(bad); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("ParseToken(%q) error = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+}
+
+func TestTokens_ConsumeOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokensFile)
+	tokens := NewTokens(path)
+
+	tok, err := tokens.Create(testFingerprint, Grant{Identity: "spiffe://tndrl/node/a"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if tok.CAFingerprint != testFingerprint {
+		t.Errorf("CAFingerprint = %q, want %q", tok.CAFingerprint, testFingerprint)
+	}
+
+	// The secret itself is never stored
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read store: %v", err)
+	}
+	if strings.Contains(string(data), tok.Secret) {
+		t.Error("store contains the token secret")
+	}
+
+	// Another handle on the same file sees the token, as a server would
+	if _, err := NewTokens(path).Consume(tok, "spiffe://tndrl/node/a"); err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if _, err := tokens.Consume(tok, "spiffe://tndrl/node/a"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("second Consume error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokens_Rejects(t *testing.T) {
+	tokens := NewTokens(filepath.Join(t.TempDir(), TokensFile))
+
+	bound, err := tokens.Create(testFingerprint, Grant{Identity: "spiffe://tndrl/node/worker"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	expired, err := tokens.Create(testFingerprint, Grant{Identity: "spiffe://tndrl/node/worker"}, -time.Second)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	wrongSecret := bound
+	wrongSecret.Secret = "00"
+
+	tests := []struct {
+		name     string
+		token    Token
+		identity string
+	}{
+		{"wrong identity", bound, "spiffe://tndrl/node/other"},
+		{"wrong secret", wrongSecret, "spiffe://tndrl/node/worker"},
+		{"expired", expired, "spiffe://tndrl/node/worker"},
+		{"unknown", Token{ID: "ffff", Secret: "00"}, "spiffe://tndrl/node/worker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tokens.Consume(tt.token, tt.identity); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Consume error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+
+	// A rejected attempt does not use up the token
+	if _, err := tokens.Consume(bound, "spiffe://tndrl/node/worker"); err != nil {
+		t.Errorf("Consume with the right identity: %v", err)
+	}
+}
+
+func TestTokens_Grant(t *testing.T) {
+	path := filepath.Join(t.TempDir(), TokensFile)
+	tokens := NewTokens(path)
+
+	if _, err := tokens.Create(testFingerprint, Grant{}, time.Minute); err == nil {
+		t.Error("Create without an identity succeeded")
+	}
+
+	grant := Grant{
+		Identity:    "spiffe://tndrl/node/worker",
+		DNSNames:    []string{"worker.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.7")},
+	}
+	tok, err := tokens.Create(testFingerprint, grant, time.Minute)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	got, err := tokens.Consume(tok, grant.Identity)
+	if err != nil {
+		t.Fatalf("Consume: %v", err)
+	}
+	if got.Identity != grant.Identity || !slices.Equal(got.DNSNames, grant.DNSNames) ||
+		len(got.IPAddresses) != 1 || !got.IPAddresses[0].Equal(grant.IPAddresses[0]) {
+		t.Errorf("Consume = %+v, want %+v", got, grant)
+	}
+
+	// Tokens stored before they had to name a node are refused
+	unbound := `[{"id": "a1b2", "hash": "` + hashSecret("c3d4") + `", "expires": "` +
+		time.Now().Add(time.Minute).UTC().Format(time.RFC3339) + `"}]`
+	if err := os.WriteFile(path, []byte(unbound), 0600); err != nil {
+		t.Fatalf("write store: %v", err)
+	}
+	if _, err := tokens.Consume(Token{ID: "a1b2", Secret: "c3d4"}, grant.Identity); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Consume of unbound token error = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// AskUserServerName is the MCP server name under which the ask_user tool is
+// registered with mcphost.
+const AskUserServerName = "tndrl"
+
+// askUserToolName is the name of the tool offered to the model.
+const askUserToolName = "ask_user"
+
+// askUserServer is a loopback MCP server exposing the ask_user tool.
+// When the model calls the tool, the question is recorded and the current
+// turn is cancelled so the provider can return an InputRequiredError.
+type askUserServer struct {
+	httpServer *http.Server
+	url        string
+
+	mu       sync.Mutex
+	cancel   context.CancelFunc
+	question string
+	asked    bool
+}
+
+// startAskUserServer starts the ask_user MCP server on a random loopback port.
+// The endpoint path includes a random token so other local processes cannot
+// easily interrupt turns.
+func startAskUserServer() (*askUserServer, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generate endpoint token: %w", err)
+	}
+	path := "/mcp/" + hex.EncodeToString(token)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	s := &askUserServer{
+		url: fmt.Sprintf("http://%s%s", ln.Addr(), path),
+	}
+
+	mcpServer := server.NewMCPServer(AskUserServerName, "1.0.0", server.WithToolCapabilities(false))
+	mcpServer.AddTool(mcp.NewTool(askUserToolName,
+		mcp.WithDescription("Ask the user a question when you need information or a decision "+
+			"to continue. Your turn ends after calling this tool; the user's answer arrives "+
+			"as their next message."),
+		mcp.WithString("question",
+			mcp.Required(),
+			mcp.Description("The question to ask the user"),
+		),
+	), s.handleAskUser)
+
+	mux := http.NewServeMux()
+	mux.Handle(path, server.NewStreamableHTTPServer(mcpServer,
+		server.WithEndpointPath(path),
+		server.WithStateLess(true),
+	))
+	s.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := s.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("ask_user server failed", "err", err)
+		}
+	}()
+
+	slog.Debug("ask_user server started", "addr", ln.Addr().String())
+	return s, nil
+}
+
+// URL returns the streamable HTTP endpoint of the server.
+func (s *askUserServer) URL() string {
+	return s.url
+}
+
+// beginTurn starts tracking a model turn. The returned context is cancelled
+// if the model asks the user a question.
+func (s *askUserServer) beginTurn(ctx context.Context) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cancel = cancel
+	s.question = ""
+	s.asked = false
+	return ctx
+}
+
+// endTurn stops tracking the current turn and reports whether the model
+// asked a question during it.
+func (s *askUserServer) endTurn() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+	return s.question, s.asked
+}
+
+// handleAskUser records the question and ends the current turn.
+func (s *askUserServer) handleAskUser(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	question, err := req.RequireString("question")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel == nil {
+		return mcp.NewToolResultError("no turn in progress"), nil
+	}
+
+	slog.Debug("model asked user a question", "question_length", len(question))
+	s.question = question
+	s.asked = true
+	s.cancel()
+
+	return mcp.NewToolResultText("The question has been sent to the user. Stop and wait for their reply."), nil
+}
+
+// Close shuts down the server.
+func (s *askUserServer) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.httpServer.Shutdown(ctx)
+}
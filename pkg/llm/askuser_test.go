@@ -0,0 +1,135 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func startTestAskUserServer(t *testing.T) *askUserServer {
+	t.Helper()
+	s, err := startAskUserServer()
+	if err != nil {
+		t.Fatalf("startAskUserServer: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// callAskUser calls the ask_user tool at url as mcphost would.
+func callAskUser(t *testing.T, url, question string) *mcp.CallToolResult {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := client.NewStreamableHttpClient(url)
+	if err != nil {
+		t.Fatalf("NewStreamableHttpClient: %v", err)
+	}
+	defer c.Close()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if _, err := c.Initialize(ctx, mcp.InitializeRequest{}); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	req := mcp.CallToolRequest{}
+	req.Params.Name = askUserToolName
+	req.Params.Arguments = map[string]any{"question": question}
+	result, err := c.CallTool(ctx, req)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	return result
+}
+
+func resultText(result *mcp.CallToolResult) string {
+	var text []string
+	for _, c := range result.Content {
+		if tc, ok := c.(mcp.TextContent); ok {
+			text = append(text, tc.Text)
+		}
+	}
+	return strings.Join(text, "")
+}
+
+func TestAskUser_EndsTurnWithInputRequired(t *testing.T) {
+	p := &MCPHostProvider{ask: startTestAskUserServer(t)}
+
+	turnCtx := p.beginTurn(context.Background())
+	result := callAskUser(t, p.ask.URL(), "Which branch?")
+	if result.IsError {
+		t.Fatalf("ask_user failed: %s", resultText(result))
+	}
+
+	// The turn is cancelled so that mcphost stops
+	select {
+	case <-turnCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("turn was not cancelled")
+	}
+
+	var inputRequired *InputRequiredError
+	if err := p.endTurn(); !errors.As(err, &inputRequired) {
+		t.Fatalf("endTurn = %v, want *InputRequiredError", err)
+	}
+	if inputRequired.Question != "Which branch?" {
+		t.Errorf("Question = %q, want %q", inputRequired.Question, "Which branch?")
+	}
+
+	// The next turn starts afresh
+	p.beginTurn(context.Background())
+	if err := p.endTurn(); err != nil {
+		t.Errorf("endTurn of a turn without a question = %v", err)
+	}
+}
+
+func TestAskUser_NoTurnInProgress(t *testing.T) {
+	s := startTestAskUserServer(t)
+
+	result := callAskUser(t, s.URL(), "Anyone there?")
+	if !result.IsError || !strings.Contains(resultText(result), "no turn in progress") {
+		t.Errorf("result = %q (error %v), want no turn in progress", resultText(result), result.IsError)
+	}
+	if _, asked := s.endTurn(); asked {
+		t.Error("question recorded outside a turn")
+	}
+}
+
+func TestAskUser_RejectsWrongPath(t *testing.T) {
+	s := startTestAskUserServer(t)
+	ctx := s.beginTurn(context.Background())
+	defer s.endTurn()
+
+	// Only the path with the server's random token reaches the tool
+	i := strings.LastIndex(s.URL(), "/")
+	for _, url := range []string{
+		s.URL()[:i+1] + strings.Repeat("0", 32),
+		s.URL()[:i],
+	} {
+		resp, err := http.Post(url, "application/json", strings.NewReader(
+			`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"ask_user","arguments":{"question":"hi"}}}`))
+		if err != nil {
+			t.Fatalf("POST %s: %v", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("POST %s = %d, want %d", url, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+
+	if ctx.Err() != nil {
+		t.Error("turn cancelled by a request to the wrong path")
+	}
+	if _, asked := s.endTurn(); asked {
+		t.Error("question recorded from a request to the wrong path")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"sync"
 
+	"github.com/cloudwego/eino/schema"
 	"github.com/mark3labs/mcphost/sdk"
 	"gopkg.in/yaml.v3"
 )
@@ -46,8 +47,22 @@ type MCPHostOptions struct {
 
 	// Streaming enables streaming responses
 	Streaming bool
+
+	// AskUser offers the model an ask_user tool. When the model calls it,
+	// Complete and Stream end the turn with an *InputRequiredError.
+	AskUser bool
+
+	// ToolCheck, if set, is called before each tool call. If it returns an
+	// error the tool is not called; the model is told the call was refused
+	// and the turn continues. Calls are checked by a guard in front of the
+	// MCP servers, so builtin servers cannot be used with a ToolCheck.
+	ToolCheck ToolCheck
 }
 
+// ToolCheck decides whether the model may call a tool. name is the
+// mcphost tool name (server__tool) and args the JSON-encoded arguments.
+type ToolCheck func(ctx context.Context, name, args string) error
+
 // mcpHostConfig is the config file format expected by mcphost SDK
 type mcpHostConfig struct {
 	MCPServers map[string]MCPServerConfig `yaml:"mcpServers"`
@@ -58,40 +73,114 @@ type mcpHostConfig struct {
 type MCPHostProvider struct {
 	host       *sdk.MCPHost
 	model      string
-	configFile string // temp config file to clean up
+	configFile string         // temp config file to clean up
+	ask        *askUserServer // nil unless AskUser is enabled
+	guard      *toolGuard     // nil unless there is a ToolCheck and MCP servers
 	mu         sync.Mutex
 }
 
 // NewMCPHostProvider creates a new MCPHostProvider.
 // If MCPConfigFile is set, it uses that external config file directly.
 // Otherwise, it writes a temporary config file from MCPServers.
+// With a ToolCheck, mcphost is pointed at a tool guard in front of the MCP
+// servers instead of the servers themselves.
 func NewMCPHostProvider(ctx context.Context, opts MCPHostOptions) (*MCPHostProvider, error) {
 	if opts.Model == "" {
 		return nil, fmt.Errorf("model is required")
 	}
 
-	var configFile string
-	var tempFile string // only set if we created a temp file
+	p := &MCPHostProvider{model: opts.Model}
+	fail := func(err error) (*MCPHostProvider, error) {
+		p.Close()
+		return nil, err
+	}
+
+	if opts.AskUser {
+		var err error
+		p.ask, err = startAskUserServer()
+		if err != nil {
+			return nil, fmt.Errorf("failed to start ask_user server: %w", err)
+		}
+	}
+
+	// The servers mcphost connects to in place of the configured ones
+	overrides := make(map[string]MCPServerConfig)
+	if opts.ToolCheck != nil {
+		servers := opts.MCPServers
+		if opts.MCPConfigFile != "" {
+			var err error
+			if servers, err = readMCPServers(opts.MCPConfigFile); err != nil {
+				return fail(err)
+			}
+		}
+		if _, ok := servers[AskUserServerName]; ok && p.ask != nil {
+			return fail(fmt.Errorf("MCP server name %q is reserved for the ask_user tool", AskUserServerName))
+		}
+		if len(servers) > 0 {
+			var err error
+			if p.guard, err = startToolGuard(ctx, servers, opts.ToolCheck); err != nil {
+				return fail(fmt.Errorf("failed to start tool guard: %w", err))
+			}
+			for name := range servers {
+				overrides[name] = MCPServerConfig{Type: "remote", URL: p.guard.URL(name)}
+			}
+		}
+	}
 
-	if opts.MCPConfigFile != "" {
+	var configFile string
+	if opts.MCPConfigFile != "" && p.ask == nil && p.guard == nil {
 		// Use external config file directly
 		configFile = opts.MCPConfigFile
 		slog.Debug("creating mcphost provider with external config",
 			"model", opts.Model,
 			"config_file", configFile,
 		)
+	} else if opts.MCPConfigFile != "" {
+		// Copy the external config, adding the ask_user server and
+		// pointing guarded servers at the guard
+		askUserURL := ""
+		if p.ask != nil {
+			askUserURL = p.ask.URL()
+		}
+		var err error
+		p.configFile, err = writeMergedConfig(opts.MCPConfigFile, overrides, askUserURL)
+		if err != nil {
+			return fail(fmt.Errorf("failed to write merged config: %w", err))
+		}
+		configFile = p.configFile
+		slog.Debug("creating mcphost provider with external config",
+			"model", opts.Model,
+			"config_file", opts.MCPConfigFile,
+			"ask_user", p.ask != nil,
+			"tool_guard", p.guard != nil,
+		)
 	} else {
+		servers := make(map[string]MCPServerConfig, len(opts.MCPServers)+1)
+		for name, server := range opts.MCPServers {
+			servers[name] = server
+		}
+		for name, server := range overrides {
+			servers[name] = server
+		}
+		if p.ask != nil {
+			if _, ok := servers[AskUserServerName]; ok {
+				return fail(fmt.Errorf("MCP server name %q is reserved for the ask_user tool", AskUserServerName))
+			}
+			servers[AskUserServerName] = MCPServerConfig{Type: "remote", URL: p.ask.URL()}
+		}
+
 		// Write MCP server config to a temp file
 		var err error
-		tempFile, err = writeTempConfig(opts.MCPServers)
+		p.configFile, err = writeTempConfig(servers)
 		if err != nil {
-			return nil, fmt.Errorf("failed to write temp config: %w", err)
+			return fail(fmt.Errorf("failed to write temp config: %w", err))
 		}
-		configFile = tempFile
+		configFile = p.configFile
 		slog.Debug("creating mcphost provider with embedded config",
 			"model", opts.Model,
 			"config_file", configFile,
-			"server_count", len(opts.MCPServers),
+			"server_count", len(servers),
+			"tool_guard", p.guard != nil,
 		)
 	}
 
@@ -105,27 +194,22 @@ func NewMCPHostProvider(ctx context.Context, opts MCPHostOptions) (*MCPHostProvi
 		Quiet:        true, // suppress debug output
 	})
 	if err != nil {
-		// Clean up temp file on error (only if we created it)
-		if tempFile != "" {
-			os.Remove(tempFile)
-		}
-		return nil, fmt.Errorf("failed to create mcphost: %w", err)
+		return fail(fmt.Errorf("failed to create mcphost: %w", err))
 	}
-
-	return &MCPHostProvider{
-		host:       host,
-		model:      opts.Model,
-		configFile: tempFile, // only clean up if we created it
-	}, nil
+	p.host = host
+	return p, nil
 }
 
 // writeTempConfig writes MCP server configuration to a temporary YAML file.
 func writeTempConfig(servers map[string]MCPServerConfig) (string, error) {
-	cfg := mcpHostConfig{
+	return writeTempYAML(mcpHostConfig{
 		MCPServers: servers,
-	}
+	})
+}
 
-	data, err := yaml.Marshal(cfg)
+// writeTempYAML marshals v to a temporary YAML file and returns its path.
+func writeTempYAML(v any) (string, error) {
+	data, err := yaml.Marshal(v)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal config: %w", err)
 	}
@@ -144,32 +228,65 @@ func writeTempConfig(servers map[string]MCPServerConfig) (string, error) {
 	return f.Name(), nil
 }
 
+// writeMergedConfig copies an external mcphost config file to a temporary
+// file, replacing the servers in overrides and, if askUserURL is set, adding
+// the ask_user server to its mcpServers section. A replaced server keeps its
+// allowedTools and excludedTools.
+func writeMergedConfig(path string, overrides map[string]MCPServerConfig, askUserURL string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read config: %w", err)
+	}
+
+	cfg := make(map[string]any)
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+
+	servers, _ := cfg["mcpServers"].(map[string]any)
+	if servers == nil {
+		servers = make(map[string]any)
+	}
+	for name, server := range overrides {
+		entry := map[string]any{"type": server.Type, "url": server.URL}
+		if old, ok := servers[name].(map[string]any); ok {
+			for _, key := range []string{"allowedTools", "excludedTools"} {
+				if v, ok := old[key]; ok {
+					entry[key] = v
+				}
+			}
+		}
+		servers[name] = entry
+	}
+	if askUserURL != "" {
+		if _, ok := servers[AskUserServerName]; ok {
+			return "", fmt.Errorf("MCP server name %q is reserved for the ask_user tool", AskUserServerName)
+		}
+		servers[AskUserServerName] = MCPServerConfig{Type: "remote", URL: askUserURL}
+	}
+	cfg["mcpServers"] = servers
+
+	return writeTempYAML(cfg)
+}
+
 // Complete generates a response for the given messages (non-streaming).
 // The mcphost SDK handles the tool calling loop internally.
 func (p *MCPHostProvider) Complete(ctx context.Context, messages []Message) (string, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	// Clear session for fresh conversation
-	p.host.ClearSession()
-
-	// Build the conversation from messages
-	// For now, we only use the last user message
-	// TODO: Consider building full conversation history
-	var userMessage string
-	for _, msg := range messages {
-		if msg.Role == "user" {
-			userMessage = msg.Content
-		}
-	}
-
-	if userMessage == "" {
-		return "", fmt.Errorf("no user message found")
+	userMessage, err := p.loadConversation(messages)
+	if err != nil {
+		return "", err
 	}
 
 	slog.Debug("mcphost complete", "message_length", len(userMessage))
 
-	response, err := p.host.Prompt(ctx, userMessage)
+	ctx = p.beginTurn(ctx)
+	response, err := p.host.PromptWithCallbacks(ctx, userMessage, onToolCall, nil, nil)
+	if turnErr := p.endTurn(); turnErr != nil {
+		return "", turnErr
+	}
 	if err != nil {
 		slog.Error("mcphost prompt failed", "err", err)
 		return "", err
@@ -181,37 +298,27 @@ func (p *MCPHostProvider) Complete(ctx context.Context, messages []Message) (str
 
 // Stream generates a streaming response.
 // Uses mcphost's callback-based streaming.
+// The provider stays locked until the stream finishes.
 func (p *MCPHostProvider) Stream(ctx context.Context, messages []Message) (<-chan StreamEvent, error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
-
-	// Clear session for fresh conversation
-	p.host.ClearSession()
 
-	// Build the conversation from messages
-	var userMessage string
-	for _, msg := range messages {
-		if msg.Role == "user" {
-			userMessage = msg.Content
-		}
-	}
-
-	if userMessage == "" {
-		return nil, fmt.Errorf("no user message found")
+	userMessage, err := p.loadConversation(messages)
+	if err != nil {
+		p.mu.Unlock()
+		return nil, err
 	}
 
 	slog.Debug("mcphost stream", "message_length", len(userMessage))
 
 	ch := make(chan StreamEvent, 16)
+	turnCtx := p.beginTurn(ctx)
 
 	go func() {
+		defer p.mu.Unlock()
 		defer close(ch)
 
-		response, err := p.host.PromptWithCallbacks(ctx, userMessage,
-			func(name, args string) {
-				// Tool call started
-				slog.Debug("mcphost tool call", "tool", name)
-			},
+		response, err := p.host.PromptWithCallbacks(turnCtx, userMessage,
+			onToolCall,
 			func(name, args, result string, isError bool) {
 				// Tool result received
 				slog.Debug("mcphost tool result", "tool", name, "is_error", isError)
@@ -226,8 +333,12 @@ func (p *MCPHostProvider) Stream(ctx context.Context, messages []Message) (<-cha
 			},
 		)
 
-		if err != nil {
+		if turnErr := p.endTurn(); turnErr != nil {
+			err = turnErr
+		} else if err != nil {
 			slog.Error("mcphost stream failed", "err", err)
+		}
+		if err != nil {
 			select {
 			case ch <- StreamEvent{Error: err}:
 			case <-ctx.Done():
@@ -245,6 +356,73 @@ func (p *MCPHostProvider) Stream(ctx context.Context, messages []Message) (<-cha
 	return ch, nil
 }
 
+// beginTurn starts a model turn. The returned context is cancelled if the
+// model asks the user a question, and is the one tool calls are checked in.
+// Callers must hold p.mu.
+func (p *MCPHostProvider) beginTurn(ctx context.Context) context.Context {
+	if p.ask != nil {
+		ctx = p.ask.beginTurn(ctx)
+	}
+	if p.guard != nil {
+		p.guard.beginTurn(ctx)
+	}
+	return ctx
+}
+
+// endTurn finishes the turn started by beginTurn. It returns an
+// *InputRequiredError if the model asked the user a question.
+func (p *MCPHostProvider) endTurn() error {
+	if p.guard != nil {
+		p.guard.endTurn()
+	}
+	if p.ask != nil {
+		if question, asked := p.ask.endTurn(); asked {
+			return &InputRequiredError{Question: question}
+		}
+	}
+	return nil
+}
+
+// onToolCall is the mcphost callback run before each tool call.
+func onToolCall(name, args string) {
+	slog.Debug("mcphost tool call", "tool", name)
+}
+
+// loadConversation resets the mcphost session and seeds it with every message
+// before the last user message, which is returned to be sent as the prompt.
+// Callers must hold p.mu.
+func (p *MCPHostProvider) loadConversation(messages []Message) (string, error) {
+	last := -1
+	for i, msg := range messages {
+		if msg.Role == "user" {
+			last = i
+		}
+	}
+	if last < 0 || messages[last].Content == "" {
+		return "", fmt.Errorf("no user message found")
+	}
+
+	// Clear session for fresh conversation
+	p.host.ClearSession()
+
+	var earlier []*schema.Message
+	for _, msg := range messages[:last] {
+		switch msg.Role {
+		case "user":
+			earlier = append(earlier, schema.UserMessage(msg.Content))
+		case "assistant":
+			earlier = append(earlier, schema.AssistantMessage(msg.Content, nil))
+		}
+	}
+	if len(earlier) > 0 {
+		if err := p.host.GetSessionManager().ReplaceAllMessages(earlier); err != nil {
+			return "", fmt.Errorf("load conversation history: %w", err)
+		}
+	}
+
+	return messages[last].Content, nil
+}
+
 // Name returns the provider identifier.
 func (p *MCPHostProvider) Name() string {
 	return "mcphost"
@@ -263,6 +441,18 @@ func (p *MCPHostProvider) Close() error {
 		}
 	}
 
+	if p.ask != nil {
+		if err := p.ask.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close ask_user server: %w", err))
+		}
+	}
+
+	if p.guard != nil {
+		if err := p.guard.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close tool guard: %w", err))
+		}
+	}
+
 	if p.configFile != "" {
 		if err := os.Remove(p.configFile); err != nil && !os.IsNotExist(err) {
 			errs = append(errs, fmt.Errorf("failed to remove temp config: %w", err))
@@ -0,0 +1,188 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// startTestToolServer serves an MCP server with a tool named "danger",
+// counting its invocations.
+func startTestToolServer(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	mcpServer := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(false))
+	mcpServer.AddTool(mcp.NewTool("danger", mcp.WithDescription("Does something dangerous")),
+		func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			calls.Add(1)
+			return mcp.NewToolResultText("done"), nil
+		})
+
+	srv := httptest.NewServer(server.NewStreamableHTTPServer(mcpServer, server.WithStateLess(true)))
+	t.Cleanup(srv.Close)
+	return srv.URL + "/mcp", &calls
+}
+
+// fakeModel is an OpenAI-compatible chat completions endpoint. Its first
+// reply calls the test__danger tool; its next replies are plain text. It
+// records the tool results sent back to it.
+type fakeModel struct {
+	mu          sync.Mutex
+	requests    int
+	toolResults []string
+}
+
+func (m *fakeModel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Messages []struct {
+			Role    string `json:"role"`
+			Content string `json:"content"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.requests++
+	first := m.requests == 1
+	for _, msg := range req.Messages {
+		if msg.Role == "tool" {
+			m.toolResults = append(m.toolResults, msg.Content)
+		}
+	}
+	m.mu.Unlock()
+
+	message := map[string]any{"role": "assistant", "content": "I could not do that."}
+	finish := "stop"
+	if first {
+		message = map[string]any{
+			"role":    "assistant",
+			"content": "",
+			"tool_calls": []map[string]any{{
+				"id":       "call_1",
+				"type":     "function",
+				"function": map[string]any{"name": "test__danger", "arguments": "{}"},
+			}},
+		}
+		finish = "tool_calls"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"id":      fmt.Sprintf("chatcmpl-%d", m.requests),
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   "test-model",
+		"choices": []map[string]any{{"index": 0, "message": message, "finish_reason": finish}},
+		"usage":   map[string]any{"prompt_tokens": 1, "completion_tokens": 1, "total_tokens": 2},
+	})
+}
+
+// writeTestConfig writes an mcphost config using the fake model at modelURL
+// and the given mcpServers section.
+func writeTestConfig(t *testing.T, modelURL, servers string) string {
+	t.Helper()
+	config := fmt.Sprintf("provider-url: %s\nprovider-api-key: test\nmcpServers:\n%s", modelURL, servers)
+	path := filepath.Join(t.TempDir(), "mcphost.yaml")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestMCPHostProvider_ToolCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		deny      error
+		wantCalls int32
+		wantText  string
+	}{
+		{"denied", errors.New("not allowed by policy"), 0, "was refused: not allowed by policy"},
+		{"allowed", nil, 1, "done"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolURL, calls := startTestToolServer(t)
+
+			model := &fakeModel{}
+			modelServer := httptest.NewServer(model)
+			t.Cleanup(modelServer.Close)
+			configFile := writeTestConfig(t, modelServer.URL, fmt.Sprintf("  test:\n    type: remote\n    url: %s\n", toolURL))
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			var (
+				mu      sync.Mutex
+				checked []string
+			)
+			p, err := NewMCPHostProvider(ctx, MCPHostOptions{
+				Model:         "openai:test-model",
+				MCPConfigFile: configFile,
+				ToolCheck: func(ctx context.Context, name, args string) error {
+					mu.Lock()
+					defer mu.Unlock()
+					checked = append(checked, name)
+					return tt.deny
+				},
+			})
+			if err != nil {
+				t.Fatalf("NewMCPHostProvider: %v", err)
+			}
+			defer p.Close()
+
+			response, err := p.Complete(ctx, []Message{{Role: "user", Content: "Do something dangerous"}})
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("tool was called %d times, want %d", n, tt.wantCalls)
+			}
+			mu.Lock()
+			if len(checked) != 1 || checked[0] != "test__danger" {
+				t.Errorf("ToolCheck called for %v, want [test__danger]", checked)
+			}
+			mu.Unlock()
+
+			// The model gets the refusal or the result, and the turn goes on
+			model.mu.Lock()
+			defer model.mu.Unlock()
+			if len(model.toolResults) != 1 || !strings.Contains(model.toolResults[0], tt.wantText) {
+				t.Errorf("tool results sent to the model = %q, want %q", model.toolResults, tt.wantText)
+			}
+			if response != "I could not do that." {
+				t.Errorf("response = %q, want the model's reply after the tool result", response)
+			}
+		})
+	}
+}
+
+func TestMCPHostProvider_ToolCheckRefusesBuiltin(t *testing.T) {
+	configFile := writeTestConfig(t, "http://127.0.0.1:1", "  fs:\n    type: builtin\n    name: fs\n")
+
+	_, err := NewMCPHostProvider(context.Background(), MCPHostOptions{
+		Model:         "openai:test-model",
+		MCPConfigFile: configFile,
+		ToolCheck:     func(context.Context, string, string) error { return nil },
+	})
+	if err == nil || !strings.Contains(err.Error(), "builtin") {
+		t.Errorf("NewMCPHostProvider error = %v, want builtin servers refused", err)
+	}
+}
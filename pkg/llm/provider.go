@@ -29,3 +29,14 @@ type StreamEvent struct {
 	Done    bool   // true if this is the final event
 	Error   error  // non-nil if an error occurred
 }
+
+// InputRequiredError is returned by a provider when the model has asked the
+// user a question and cannot continue until it is answered. The answer
+// arrives as the next user message in the same conversation.
+type InputRequiredError struct {
+	Question string
+}
+
+func (e *InputRequiredError) Error() string {
+	return "input required: " + e.Question
+}
@@ -0,0 +1,246 @@
+package llm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"gopkg.in/yaml.v3"
+)
+
+// toolGuardInitTimeout bounds connecting to and listing the tools of each
+// guarded MCP server.
+const toolGuardInitTimeout = 30 * time.Second
+
+// toolGuard is a loopback MCP server standing in for the configured MCP
+// servers when tool calls are checked. mcphost connects to it instead of the
+// real servers, and it forwards each tool call to the real server only if
+// the ToolCheck allows it. A denied call never reaches the real server; the
+// model gets a tool error saying it was refused.
+type toolGuard struct {
+	httpServer *http.Server
+	urls       map[string]string // server name -> guard endpoint
+	clients    []*client.Client
+	check      ToolCheck
+
+	mu  sync.Mutex
+	ctx context.Context // the current turn's context, nil between turns
+}
+
+// startToolGuard connects to each of servers and serves its tools on a
+// random loopback port, checked by check. Builtin servers run inside
+// mcphost and cannot be guarded, so they are refused.
+func startToolGuard(ctx context.Context, servers map[string]MCPServerConfig, check ToolCheck) (*toolGuard, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, fmt.Errorf("generate endpoint token: %w", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	g := &toolGuard{
+		urls:  make(map[string]string, len(servers)),
+		check: check,
+	}
+	mux := http.NewServeMux()
+	for name, cfg := range servers {
+		c, err := connectMCPServer(ctx, name, cfg)
+		if err != nil {
+			ln.Close()
+			g.closeClients()
+			return nil, err
+		}
+		g.clients = append(g.clients, c)
+
+		guarded, err := g.guardServer(ctx, name, c)
+		if err != nil {
+			ln.Close()
+			g.closeClients()
+			return nil, err
+		}
+
+		path := "/mcp/" + hex.EncodeToString(token) + "/" + name
+		mux.Handle(path, server.NewStreamableHTTPServer(guarded,
+			server.WithEndpointPath(path),
+			server.WithStateLess(true),
+		))
+		g.urls[name] = fmt.Sprintf("http://%s%s", ln.Addr(), path)
+	}
+
+	g.httpServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		if err := g.httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("tool guard server failed", "err", err)
+		}
+	}()
+
+	slog.Debug("tool guard started", "addr", ln.Addr().String(), "servers", len(servers))
+	return g, nil
+}
+
+// connectMCPServer connects and initializes a client for a configured
+// server, as mcphost would.
+func connectMCPServer(ctx context.Context, name string, cfg MCPServerConfig) (*client.Client, error) {
+	var c *client.Client
+	switch cfg.Type {
+	case "local":
+		if len(cfg.Command) == 0 {
+			return nil, fmt.Errorf("MCP server %q: command is required", name)
+		}
+		env := os.Environ()
+		for k, v := range cfg.Environment {
+			env = append(env, k+"="+v)
+		}
+		var err error
+		c, err = client.NewStdioMCPClient(cfg.Command[0], env, cfg.Command[1:]...)
+		if err != nil {
+			return nil, fmt.Errorf("MCP server %q: %w", name, err)
+		}
+	case "remote":
+		headers := make(map[string]string, len(cfg.Headers))
+		for _, header := range cfg.Headers {
+			if k, v, ok := strings.Cut(header, ":"); ok {
+				headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+		var err error
+		c, err = client.NewStreamableHttpClient(cfg.URL, transport.WithHTTPHeaders(headers))
+		if err != nil {
+			return nil, fmt.Errorf("MCP server %q: %w", name, err)
+		}
+		if err := c.Start(ctx); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("MCP server %q: %w", name, err)
+		}
+	case "builtin":
+		return nil, fmt.Errorf("MCP server %q: tool policy cannot be enforced on builtin servers", name)
+	default:
+		return nil, fmt.Errorf("MCP server %q: tool policy requires type local or remote, got %q", name, cfg.Type)
+	}
+
+	initCtx, cancel := context.WithTimeout(ctx, toolGuardInitTimeout)
+	defer cancel()
+	req := mcp.InitializeRequest{}
+	req.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	req.Params.ClientInfo = mcp.Implementation{Name: "tndrl", Version: "1.0.0"}
+	if _, err := c.Initialize(initCtx, req); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("MCP server %q: initialize: %w", name, err)
+	}
+	return c, nil
+}
+
+// guardServer returns an MCP server offering the tools of c, each checked
+// before it is forwarded.
+func (g *toolGuard) guardServer(ctx context.Context, name string, c *client.Client) (*server.MCPServer, error) {
+	listCtx, cancel := context.WithTimeout(ctx, toolGuardInitTimeout)
+	defer cancel()
+	tools, err := c.ListTools(listCtx, mcp.ListToolsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %q: list tools: %w", name, err)
+	}
+
+	guarded := server.NewMCPServer(name, "1.0.0", server.WithToolCapabilities(false))
+	for _, tool := range tools.Tools {
+		// mcphost names tools server__tool
+		qualified := name + "__" + tool.Name
+		guarded.AddTool(tool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if err := g.allow(qualified, req.Params.Arguments); err != nil {
+				slog.Warn("mcphost tool call denied", "tool", qualified, "err", err)
+				return mcp.NewToolResultError(fmt.Sprintf("tool call %s was refused: %v", qualified, err)), nil
+			}
+			return c.CallTool(ctx, req)
+		})
+	}
+	return guarded, nil
+}
+
+// allow checks a tool call against the ToolCheck in the current turn.
+func (g *toolGuard) allow(name string, args any) error {
+	g.mu.Lock()
+	ctx := g.ctx
+	g.mu.Unlock()
+	if ctx == nil {
+		return errors.New("no turn in progress")
+	}
+
+	var encoded string
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return fmt.Errorf("encode arguments: %w", err)
+		}
+		encoded = string(data)
+	}
+	return g.check(ctx, name, encoded)
+}
+
+// beginTurn records the context tool calls are checked in until endTurn.
+func (g *toolGuard) beginTurn(ctx context.Context) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ctx = ctx
+}
+
+// endTurn ends the turn started by beginTurn; later calls are refused.
+func (g *toolGuard) endTurn() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ctx = nil
+}
+
+// URL returns the guard endpoint standing in for the named server.
+func (g *toolGuard) URL(name string) string {
+	return g.urls[name]
+}
+
+// closeClients closes the connections to the real servers.
+func (g *toolGuard) closeClients() error {
+	var errs []error
+	for _, c := range g.clients {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the guard and disconnects from the real servers.
+func (g *toolGuard) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return errors.Join(g.httpServer.Shutdown(ctx), g.closeClients())
+}
+
+// readMCPServers reads the mcpServers section of an mcphost config file.
+func readMCPServers(path string) (map[string]MCPServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var cfg mcpHostConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return cfg.MCPServers, nil
+}
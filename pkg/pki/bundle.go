@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+)
+
+// Bundle holds trusted root CA certificates keyed by SPIFFE trust domain.
+// A peer's certificate must chain to a root of the trust domain in its
+// SPIFFE ID, so that a CA trusted for one domain cannot issue identities in
+// another.
+//
+// Set as CA.Bundle, it lets nodes of other trust domains (federation) and
+// nodes issued by another root of the local domain (CA rollover) be
+// verified alongside those issued by the CA itself.
+type Bundle struct {
+	// TrustDomain is the local trust domain, whose identities are issued
+	// by the CA the bundle is attached to.
+	TrustDomain TrustDomain
+
+	roots map[TrustDomain][]*x509.Certificate
+}
+
+// NewBundle returns a bundle for the local trust domain holding no roots
+// besides the CA's own.
+func NewBundle(local TrustDomain) *Bundle {
+	return &Bundle{TrustDomain: local, roots: make(map[TrustDomain][]*x509.Certificate)}
+}
+
+// Add trusts the root certificates for identities in the trust domain.
+func (b *Bundle) Add(td TrustDomain, roots ...*x509.Certificate) {
+	for _, root := range roots {
+		if !slices.ContainsFunc(b.roots[td], root.Equal) {
+			b.roots[td] = append(b.roots[td], root)
+		}
+	}
+}
+
+// AddFile trusts every CA certificate in a PEM file for identities in the
+// trust domain.
+func (b *Bundle) AddFile(td TrustDomain, path string) error {
+	certPEM, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read trust bundle: %w", err)
+	}
+	certs, err := ParseCertificates(certPEM)
+	if err != nil {
+		return fmt.Errorf("trust bundle %s: %w", path, err)
+	}
+	for _, cert := range certs {
+		if !cert.IsCA {
+			return fmt.Errorf("trust bundle %s: %s is not a CA certificate", path, cert.Subject.CommonName)
+		}
+	}
+	b.Add(td, certs...)
+	return nil
+}
+
+// Roots returns the roots added for the trust domain.
+func (b *Bundle) Roots(td TrustDomain) []*x509.Certificate {
+	return b.roots[td]
+}
+
+// TrustDomains returns the trust domains that have roots in the bundle.
+func (b *Bundle) TrustDomains() []TrustDomain {
+	var tds []TrustDomain
+	for td := range b.roots {
+		tds = append(tds, td)
+	}
+	slices.Sort(tds)
+	return tds
+}
+
+// TrustDomainOf returns the trust domain of a SPIFFE ID.
+func TrustDomainOf(identity string) (TrustDomain, error) {
+	u, err := url.Parse(identity)
+	if err != nil || u.Scheme != "spiffe" || u.Host == "" {
+		return "", fmt.Errorf("not a SPIFFE ID: %q", identity)
+	}
+	return TrustDomain(u.Host), nil
+}
+
+// rootsFor returns the roots a certificate for an identity in td must chain
+// to. Without a bundle, the CA's root is trusted for every trust domain.
+func (ca *CA) rootsFor(td TrustDomain) []*x509.Certificate {
+	if ca.Bundle == nil {
+		return []*x509.Certificate{ca.Root()}
+	}
+	roots := ca.Bundle.Roots(td)
+	if td == ca.Bundle.TrustDomain {
+		roots = append([]*x509.Certificate{ca.Root()}, roots...)
+	}
+	return roots
+}
+
+// verifyTrustDomain checks that at least one verified chain ends in a root
+// trusted for the trust domain of the leaf's SPIFFE ID, and, if allowed is
+// not nil, that the trust domain is one of allowed.
+func (ca *CA) verifyTrustDomain(chains [][]*x509.Certificate, allowed []TrustDomain) error {
+	if ca.Bundle == nil || len(chains) == 0 {
+		return nil
+	}
+
+	identity, err := IdentityFromCert(chains[0][0])
+	if err != nil {
+		return err
+	}
+	td, err := TrustDomainOf(identity)
+	if err != nil {
+		return err
+	}
+	if allowed != nil && !slices.Contains(allowed, td) {
+		return fmt.Errorf("trust domain %s of %s is not allowed for this peer", td, identity)
+	}
+
+	roots := ca.rootsFor(td)
+	for _, chain := range chains {
+		if slices.ContainsFunc(roots, chain[len(chain)-1].Equal) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not issued by a CA trusted for trust domain %s", identity, td)
+}
@@ -0,0 +1,200 @@
+package pki
+
+import (
+	"crypto/tls"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// handshake runs a TLS handshake between the configs over TCP and returns
+// the client's and the server's error.
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) (clientErr, serverErr error) {
+	t.Helper()
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("tls.Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		defer conn.Close()
+		if err := conn.(*tls.Conn).Handshake(); err != nil {
+			serverDone <- err
+			return
+		}
+		_, err = conn.Write([]byte{1})
+		serverDone <- err
+	}()
+
+	dialer := &net.Dialer{
+		Timeout: 2 * time.Second,
+	}
+	conn, clientErr := tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), clientConfig)
+	if clientErr == nil {
+		// With TLS 1.3 the client finishes first; reading the server's
+		// byte surfaces a rejection of the client certificate
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, clientErr = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	return clientErr, <-serverDone
+}
+
+func TestBundle_Federation(t *testing.T) {
+	const domainA, domainB TrustDomain = "a.example", "b.example"
+
+	caA, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	caB, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	// Each side trusts the other's root for the other's trust domain
+	caA.Bundle = NewBundle(domainA)
+	caA.Bundle.Add(domainB, caB.Cert)
+	caB.Bundle = NewBundle(domainB)
+	caB.Bundle.Add(domainA, caA.Cert)
+
+	serverCert, err := GenerateCert(caA, domainA.NodeIdentity("server"), true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	clientCert, err := GenerateCert(caB, domainB.NodeIdentity("client"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	// caB issuing an identity in A's trust domain
+	impostorCert, err := GenerateCert(caB, domainA.NodeIdentity("admin"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	serverConfig, err := ServerTLSConfig(serverCert, caA)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		client  *Cert
+		verify  ServerVerification
+		wantErr bool
+	}{
+		{"peer identity in foreign domain", clientCert, ServerVerification{Identity: domainA.NodeIdentity("server")}, false},
+		{"foreign domain not allowed for peer", clientCert, ServerVerification{ServerName: "localhost"}, true},
+		{"identity issued by the wrong domain's CA", impostorCert, ServerVerification{Identity: domainA.NodeIdentity("server")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientConfig, err := ClientTLSConfigFor(tt.client, caB, tt.verify)
+			if err != nil {
+				t.Fatalf("ClientTLSConfigFor() error = %v", err)
+			}
+			clientErr, serverErr := handshake(t, serverConfig, clientConfig)
+			if gotErr := clientErr != nil || serverErr != nil; gotErr != tt.wantErr {
+				t.Errorf("handshake errors = %v / %v, wantErr %v", clientErr, serverErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBundle_Rollover(t *testing.T) {
+	oldCA, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	newCA, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	// A node still on the old CA trusts the new root for its own domain
+	oldCA.Bundle = NewBundle(DefaultTrustDomain)
+	oldCA.Bundle.Add(DefaultTrustDomain, newCA.Cert)
+
+	serverCert, err := GenerateCert(newCA, NodeIdentity("server"), true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	clientCert, err := GenerateCert(oldCA, NodeIdentity("client"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	serverConfig, err := ServerTLSConfig(serverCert, newCA)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+	clientConfig, err := ClientTLSConfig(clientCert, oldCA, "localhost")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig() error = %v", err)
+	}
+
+	// The new node does not trust the old root yet
+	if clientErr, serverErr := handshake(t, serverConfig, clientConfig); serverErr == nil {
+		t.Errorf("handshake succeeded before the new node trusts the old root (client error %v)", clientErr)
+	}
+
+	newCA.Bundle = NewBundle(DefaultTrustDomain)
+	newCA.Bundle.Add(DefaultTrustDomain, oldCA.Cert)
+	serverConfig, err = ServerTLSConfig(serverCert, newCA)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+	if clientErr, serverErr := handshake(t, serverConfig, clientConfig); clientErr != nil || serverErr != nil {
+		t.Errorf("handshake errors = %v / %v", clientErr, serverErr)
+	}
+}
+
+func TestBundle_AddFile(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	cert, err := GenerateCert(ca, NodeIdentity("node"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	if err := SaveCertificate(cert.Cert, filepath.Join(dir, "node.crt")); err != nil {
+		t.Fatalf("SaveCertificate() error = %v", err)
+	}
+
+	b := NewBundle(DefaultTrustDomain)
+	if err := b.AddFile("other.example", filepath.Join(dir, "ca.crt")); err != nil {
+		t.Fatalf("AddFile() error = %v", err)
+	}
+	if roots := b.Roots("other.example"); len(roots) != 1 || !roots[0].Equal(ca.Cert) {
+		t.Errorf("Roots() = %d certs, want the CA", len(roots))
+	}
+	if err := b.AddFile("other.example", filepath.Join(dir, "node.crt")); err == nil {
+		t.Error("AddFile() of a non-CA certificate expected error")
+	}
+}
+
+func TestTrustDomainOf(t *testing.T) {
+	if td, err := TrustDomainOf("spiffe://example.org/node/web"); err != nil || td != "example.org" {
+		t.Errorf("TrustDomainOf() = %q, %v, want example.org", td, err)
+	}
+	for _, bad := range []string{"", "web", "https://example.org/node/web"} {
+		if _, err := TrustDomainOf(bad); err == nil {
+			t.Errorf("TrustDomainOf(%q) expected error", bad)
+		}
+	}
+}
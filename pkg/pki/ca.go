@@ -2,12 +2,13 @@
 package pki
 
 import (
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
-	"encoding/pem"
+	"errors"
 	"fmt"
 	"math/big"
 	"os"
@@ -16,38 +17,104 @@ import (
 )
 
 // CA represents a certificate authority.
+//
+// A CA is either a self-signed root or an intermediate signed by a root (see
+// GenerateIntermediateCA). Peers trust the root, so an intermediate per
+// environment can issue certificates while the root key stays offline.
 type CA struct {
 	Cert *x509.Certificate
-	Key  *ecdsa.PrivateKey
+
+	// Chain holds the certificates above Cert for an intermediate CA,
+	// ending with the root. It is empty for a root CA.
+	Chain []*x509.Certificate
+
+	// Key signs the certificates and revocation lists the CA issues. It is
+	// the private key itself, or an ExternalSigner for a key held by another
+	// process. It is nil for a CA loaded with LoadCACertificate, which can
+	// verify certificates but not issue them.
+	Key crypto.Signer
+
+	// CRL lists the certificates this CA has revoked.
+	CRL *CRL
+
+	// Ledger, if set, records the certificates the CA issues.
+	Ledger *Ledger
+
+	// Bundle, if set, holds the roots of other trust domains, and further
+	// roots of the local one, that peers may chain to. Peers' trust domains
+	// are only checked when it is set.
+	Bundle *Bundle
 }
 
-// GenerateCA creates a new certificate authority.
+// GenerateCA creates a new root certificate authority. It may sign one
+// level of intermediate CAs.
 func GenerateCA() (*CA, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
-	if err != nil {
-		return nil, fmt.Errorf("generate key: %w", err)
+	return newCA(&x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Tndrl"},
+			CommonName:   "Tndrl CA",
+		},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().AddDate(10, 0, 0), // 10 years
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}, nil)
+}
+
+// GenerateIntermediateCA creates a CA signed by parent, for example one per
+// environment or session driver. The intermediate issues node certificates
+// but not further CAs, and expires no later than its parent.
+func GenerateIntermediateCA(parent *CA, name string) (*CA, error) {
+	if parent.Key == nil {
+		return nil, errors.New("CA private key required to issue an intermediate CA")
+	}
+	if parent.Cert.MaxPathLenZero {
+		return nil, errors.New("CA may not issue intermediate CAs (path length exhausted)")
 	}
 
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
-	if err != nil {
-		return nil, fmt.Errorf("generate serial: %w", err)
+	notAfter := time.Now().AddDate(5, 0, 0) // 5 years
+	if parent.Cert.NotAfter.Before(notAfter) {
+		notAfter = parent.Cert.NotAfter
 	}
 
-	template := &x509.Certificate{
-		SerialNumber: serialNumber,
+	return newCA(&x509.Certificate{
 		Subject: pkix.Name{
 			Organization: []string{"Tndrl"},
-			CommonName:   "Tndrl CA",
+			CommonName:   "Tndrl Intermediate CA " + name,
 		},
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0), // 10 years
+		NotAfter:              notAfter,
 		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
-		MaxPathLen:            1,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}, parent)
+}
+
+// newCA generates a key and creates a CA from the template, signed by
+// parent, or self-signed if parent is nil.
+func newCA(template *x509.Certificate, parent *CA) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
 	}
 
-	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	template.SerialNumber, err = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate serial: %w", err)
+	}
+
+	issuer, signer := template, crypto.Signer(key)
+	var chain []*x509.Certificate
+	if parent != nil {
+		issuer, signer = parent.Cert, parent.Key
+		chain = parent.Certificates()
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
 	if err != nil {
 		return nil, fmt.Errorf("create certificate: %w", err)
 	}
@@ -57,75 +124,175 @@ func GenerateCA() (*CA, error) {
 		return nil, fmt.Errorf("parse certificate: %w", err)
 	}
 
-	return &CA{Cert: cert, Key: key}, nil
+	return &CA{Cert: cert, Chain: chain, Key: key, CRL: newCRL("", cert)}, nil
+}
+
+// Root returns the root of the CA's chain, which peers trust.
+func (ca *CA) Root() *x509.Certificate {
+	if len(ca.Chain) > 0 {
+		return ca.Chain[len(ca.Chain)-1]
+	}
+	return ca.Cert
+}
+
+// Certificates returns the CA certificate followed by its chain.
+func (ca *CA) Certificates() []*x509.Certificate {
+	return append([]*x509.Certificate{ca.Cert}, ca.Chain...)
+}
+
+// IssuerChain returns the certificates sent along with a certificate this
+// CA issues: the CA itself and any intermediates above it, but not the root.
+func (ca *CA) IssuerChain() []*x509.Certificate {
+	if len(ca.Chain) == 0 {
+		return nil
+	}
+	return ca.Certificates()[:len(ca.Chain)]
+}
+
+// pool returns a pool holding the CA's root and any roots in its bundle,
+// for verifying peers.
+func (ca *CA) pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Root())
+	if ca.Bundle != nil {
+		for _, td := range ca.Bundle.TrustDomains() {
+			for _, root := range ca.Bundle.Roots(td) {
+				pool.AddCert(root)
+			}
+		}
+	}
+	return pool
 }
 
-// LoadCA loads a CA from certificate and key files.
+// LoadCA loads a CA from certificate and key files. The certificate file
+// may hold an intermediate CA followed by its chain up to the root.
+// The revocation list is loaded from CRLFile next to the certificate, if
+// present, and issued certificates are recorded in LedgerFile beside it.
+// The key must not be encrypted; see LoadCAWithOptions.
 func LoadCA(certPath, keyPath string) (*CA, error) {
-	certPEM, err := os.ReadFile(certPath)
+	return LoadCAWithOptions(certPath, keyPath, KeyOptions{})
+}
+
+// LoadCAWithOptions is LoadCA decrypting an encrypted key with the
+// passphrase from opts.
+func LoadCAWithOptions(certPath, keyPath string, opts KeyOptions) (*CA, error) {
+	ca, err := LoadCACertificate(certPath)
 	if err != nil {
-		return nil, fmt.Errorf("read cert: %w", err)
+		return nil, err
 	}
 
-	keyPEM, err := os.ReadFile(keyPath)
+	key, err := LoadKeyWithOptions(keyPath, opts)
 	if err != nil {
-		return nil, fmt.Errorf("read key: %w", err)
+		return nil, err
+	}
+	if err := ca.setKey(certPath, key); err != nil {
+		return nil, fmt.Errorf("%s: %w", keyPath, err)
 	}
+	return ca, nil
+}
+
+// LoadCAWithSigner loads a CA from its certificate file, like LoadCA, with
+// a signer for its key, such as an ExternalSigner for a key held by a
+// signing daemon.
+func LoadCAWithSigner(certPath string, signer crypto.Signer) (*CA, error) {
+	ca, err := LoadCACertificate(certPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := ca.setKey(certPath, signer); err != nil {
+		return nil, fmt.Errorf("signer: %w", err)
+	}
+	return ca, nil
+}
 
-	certBlock, _ := pem.Decode(certPEM)
-	if certBlock == nil {
-		return nil, fmt.Errorf("decode cert PEM: no PEM data found")
+// setKey sets the key of a CA loaded from certPath, after checking that it
+// belongs to the certificate, and records issuances in the ledger beside it.
+func (ca *CA) setKey(certPath string, key crypto.Signer) error {
+	pub, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(ca.Cert.PublicKey) {
+		return fmt.Errorf("key does not match the CA certificate %s", certPath)
 	}
+	ca.Key = key
+	ca.Ledger = NewLedger(filepath.Join(filepath.Dir(certPath), LedgerFile))
+	return nil
+}
 
-	cert, err := x509.ParseCertificate(certBlock.Bytes)
+// LoadCACertificate loads a CA from its certificate alone, for nodes that
+// verify peers but do not hold the CA private key. The revocation list is
+// loaded as in LoadCA.
+func LoadCACertificate(certPath string) (*CA, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("read cert: %w", err)
+	}
+	certs, err := ParseCertificates(certPEM)
 	if err != nil {
-		return nil, fmt.Errorf("parse cert: %w", err)
+		return nil, err
 	}
 
-	keyBlock, _ := pem.Decode(keyPEM)
-	if keyBlock == nil {
-		return nil, fmt.Errorf("decode key PEM: no PEM data found")
+	for i, cert := range certs {
+		if !cert.IsCA {
+			return nil, fmt.Errorf("%s is not a CA certificate", certPath)
+		}
+		if i > 0 {
+			if err := certs[i-1].CheckSignatureFrom(cert); err != nil {
+				return nil, fmt.Errorf("%s: broken chain: %w", certPath, err)
+			}
+		}
 	}
 
-	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	crl, err := loadCRLNextTo(certPath, certs)
 	if err != nil {
-		return nil, fmt.Errorf("parse key: %w", err)
+		return nil, err
 	}
 
-	return &CA{Cert: cert, Key: key}, nil
+	return &CA{Cert: certs[0], Chain: certs[1:], CRL: crl}, nil
 }
 
-// Save persists the CA certificate and key to the specified directory.
+// loadCRLNextTo loads the CRL stored beside the CA certificates, signed by
+// any of them or by a CA peers chain to. A missing file yields an empty list
+// that is loaded once the file appears.
+func loadCRLNextTo(certPath string, certs []*x509.Certificate) (*CRL, error) {
+	path := filepath.Join(filepath.Dir(certPath), CRLFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return newCRL(path, certs...), nil
+	}
+	crl, err := LoadCRL(path, certs...)
+	if err != nil {
+		return nil, fmt.Errorf("load CRL: %w", err)
+	}
+	return crl, nil
+}
+
+// Save persists the CA certificate, its chain and key to the specified
+// directory, leaving the key unencrypted. A CA whose key is held by an
+// ExternalSigner cannot be saved.
 func (ca *CA) Save(dir string) error {
+	return ca.SaveWithOptions(dir, KeyOptions{})
+}
+
+// SaveWithOptions is Save protecting the key as opts asks.
+func (ca *CA) SaveWithOptions(dir string, opts KeyOptions) error {
+	if _, ok := ca.Key.(*ExternalSigner); ok {
+		return errors.New("CA key is held by an external signer and cannot be saved")
+	}
+	keyPEM, err := encodeKey(ca.Key, opts)
+	if err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(dir, 0700); err != nil {
 		return fmt.Errorf("create directory: %w", err)
 	}
 
-	// Save certificate
+	// Save certificate, followed by the chain for an intermediate
 	certPath := filepath.Join(dir, "ca.crt")
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: ca.Cert.Raw,
-	})
-	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
-		return fmt.Errorf("write cert: %w", err)
+	if err := SaveCertificates(certPath, ca.Certificates()...); err != nil {
+		return err
 	}
 
 	// Save key
-	keyPath := filepath.Join(dir, "ca.key")
-	keyBytes, err := x509.MarshalECPrivateKey(ca.Key)
-	if err != nil {
-		return fmt.Errorf("marshal key: %w", err)
-	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
-	})
-	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
-		return fmt.Errorf("write key: %w", err)
-	}
-
-	return nil
+	return writeKey(filepath.Join(dir, "ca.key"), keyPEM)
 }
 
 // CAExists checks if CA files exist in the given directory.
@@ -144,7 +311,13 @@ func CAExists(dir string) bool {
 
 // LoadCAFromDir loads a CA from the standard paths in a directory.
 func LoadCAFromDir(dir string) (*CA, error) {
+	return LoadCAFromDirWithOptions(dir, KeyOptions{})
+}
+
+// LoadCAFromDirWithOptions is LoadCAFromDir decrypting an encrypted key
+// with the passphrase from opts.
+func LoadCAFromDirWithOptions(dir string, opts KeyOptions) (*CA, error) {
 	certPath := filepath.Join(dir, "ca.crt")
 	keyPath := filepath.Join(dir, "ca.key")
-	return LoadCA(certPath, keyPath)
+	return LoadCAWithOptions(certPath, keyPath, opts)
 }
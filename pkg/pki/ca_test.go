@@ -1,6 +1,7 @@
 package pki
 
 import (
+	"crypto/ecdsa"
 	"crypto/x509"
 	"os"
 	"path/filepath"
@@ -80,15 +81,101 @@ func TestSaveAndLoadCA(t *testing.T) {
 	}
 
 	// Compare keys by comparing public key parameters
-	if !original.Key.PublicKey.Equal(&loaded.Key.PublicKey) {
+	originalKey, loadedKey := original.Key.(*ecdsa.PrivateKey), loaded.Key.(*ecdsa.PrivateKey)
+	if !originalKey.PublicKey.Equal(&loadedKey.PublicKey) {
 		t.Error("Loaded key public key does not match original")
 	}
 	// Compare private key D parameter
-	if original.Key.D.Cmp(loaded.Key.D) != 0 {
+	if originalKey.D.Cmp(loadedKey.D) != 0 {
 		t.Error("Loaded key private component does not match original")
 	}
 }
 
+func TestGenerateIntermediateCA(t *testing.T) {
+	root, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	intermediate, err := GenerateIntermediateCA(root, "prod")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+	if !intermediate.Cert.IsCA {
+		t.Error("Intermediate is not marked as CA")
+	}
+	if err := intermediate.Cert.CheckSignatureFrom(root.Cert); err != nil {
+		t.Errorf("Intermediate not signed by root: %v", err)
+	}
+	if !intermediate.Root().Equal(root.Cert) {
+		t.Error("Root() does not return the root CA")
+	}
+	if intermediate.Cert.NotAfter.After(root.Cert.NotAfter) {
+		t.Error("Intermediate outlives its root")
+	}
+
+	// Certificates issued by the intermediate verify against the root alone
+	cert, err := GenerateCert(intermediate, "spiffe://tndrl/node/test", true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	if len(cert.Chain) != 1 || !cert.Chain[0].Equal(intermediate.Cert) {
+		t.Fatalf("Chain = %d certs, want the intermediate", len(cert.Chain))
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(cert.Chain[0])
+	if _, err := cert.Cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	// The intermediate may not issue further CAs
+	if _, err := GenerateIntermediateCA(intermediate, "nested"); err == nil {
+		t.Error("GenerateIntermediateCA() from an intermediate expected error")
+	}
+}
+
+func TestSaveAndLoadIntermediateCA(t *testing.T) {
+	dir := t.TempDir()
+
+	root, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	original, err := GenerateIntermediateCA(root, "prod")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+	if err := original.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadCAFromDir(dir)
+	if err != nil {
+		t.Fatalf("LoadCAFromDir() error = %v", err)
+	}
+	if !loaded.Cert.Equal(original.Cert) {
+		t.Error("Loaded certificate does not match original")
+	}
+	if len(loaded.Chain) != 1 || !loaded.Root().Equal(root.Cert) {
+		t.Errorf("Loaded chain = %d certs, want the root", len(loaded.Chain))
+	}
+
+	// A key for a different certificate is rejected
+	rootDir := t.TempDir()
+	if err := root.Save(rootDir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := LoadCA(filepath.Join(dir, "ca.crt"), filepath.Join(rootDir, "ca.key")); err == nil {
+		t.Error("LoadCA() expected error for mismatched key")
+	}
+}
+
 func TestLoadCA_InvalidFiles(t *testing.T) {
 	t.Run("missing files", func(t *testing.T) {
 		dir := t.TempDir()
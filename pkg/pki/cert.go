@@ -1,26 +1,59 @@
 package pki
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
+	"crypto"
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"fmt"
-	"math/big"
 	"net"
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
 // Cert represents a certificate and its private key.
 type Cert struct {
 	Cert *x509.Certificate
-	Key  *ecdsa.PrivateKey
+	Key  crypto.Signer
+
+	// Chain holds the intermediate CAs between Cert and the root, if the
+	// certificate was issued by an intermediate. It is saved with the
+	// certificate and sent with it in TLS handshakes.
+	Chain []*x509.Certificate
+}
+
+// CertOptions customizes an issued certificate. The zero value issues a
+// certificate with an ECDSA P-256 key, valid for localhost only.
+type CertOptions struct {
+	// DNSNames and IPAddresses are added to the certificate's SANs, after
+	// localhost and the loopback addresses that are always included.
+	DNSNames    []string
+	IPAddresses []net.IP
+
+	// KeyAlgorithm selects the key generated for the certificate.
+	// Defaults to DefaultKeyAlgorithm.
+	KeyAlgorithm KeyAlgorithm
+}
+
+// ParseSANs splits names into DNS names and IP addresses, as for the SANs
+// of CertOptions.
+func ParseSANs(names []string) ([]string, []net.IP) {
+	var dnsNames []string
+	var ips []net.IP
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			ips = append(ips, ip)
+		} else if name != "" {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+	return dnsNames, ips
 }
 
 // GenerateCert creates a new certificate signed by the CA.
@@ -28,12 +61,37 @@ type Cert struct {
 // isServer enables server auth key usage
 // isClient enables client auth key usage
 func GenerateCert(ca *CA, identity string, isServer, isClient bool) (*Cert, error) {
-	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	return GenerateCertWithOptions(ca, identity, isServer, isClient, CertOptions{})
+}
+
+// GenerateCertWithOptions is like GenerateCert, with extra SANs and a choice
+// of key algorithm.
+func GenerateCertWithOptions(ca *CA, identity string, isServer, isClient bool, opts CertOptions) (*Cert, error) {
+	key, err := GenerateKey(opts.KeyAlgorithm)
 	if err != nil {
-		return nil, fmt.Errorf("generate key: %w", err)
+		return nil, err
+	}
+
+	cert, err := ca.issue(identity, key.Public(), isServer, isClient, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cert{Cert: cert, Key: key, Chain: ca.IssuerChain()}, nil
+}
+
+// issue signs a certificate for the identity and public key. The key
+// algorithm in opts is ignored.
+func (ca *CA) issue(identity string, pub crypto.PublicKey, isServer, isClient bool, opts CertOptions) (*x509.Certificate, error) {
+	if ca.Key == nil {
+		return nil, errors.New("CA private key required to issue certificates")
+	}
+	if _, err := KeyAlgorithmOf(pub); err != nil {
+		return nil, err
 	}
 
-	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	now := time.Now()
+	serialNumber, err := newSerial(now)
 	if err != nil {
 		return nil, fmt.Errorf("generate serial: %w", err)
 	}
@@ -50,14 +108,24 @@ func GenerateCert(ca *CA, identity string, isServer, isClient bool) (*Cert, erro
 			Organization: []string{"Tndrl"},
 			CommonName:   identity,
 		},
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().AddDate(1, 0, 0), // 1 year
+		NotBefore: now,
+		NotAfter:  now.AddDate(1, 0, 0), // 1 year
 		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
 		URIs:      []*url.URL{identityURI},
 		// Allow localhost and common local addresses for development
 		DNSNames:    []string{"localhost"},
 		IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
 	}
+	for _, name := range opts.DNSNames {
+		if !slices.Contains(template.DNSNames, name) {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+	for _, ip := range opts.IPAddresses {
+		if !slices.ContainsFunc(template.IPAddresses, ip.Equal) {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	}
 
 	// Set extended key usage based on role
 	if isServer && isClient {
@@ -71,7 +139,7 @@ func GenerateCert(ca *CA, identity string, isServer, isClient bool) (*Cert, erro
 		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
 	}
 
-	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, &key.PublicKey, ca.Key)
+	certDER, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, pub, ca.Key)
 	if err != nil {
 		return nil, fmt.Errorf("create certificate: %w", err)
 	}
@@ -80,22 +148,26 @@ func GenerateCert(ca *CA, identity string, isServer, isClient bool) (*Cert, erro
 	if err != nil {
 		return nil, fmt.Errorf("parse certificate: %w", err)
 	}
-
-	return &Cert{Cert: cert, Key: key}, nil
+	if ca.Ledger != nil {
+		if err := ca.Ledger.Record(cert); err != nil {
+			return nil, err
+		}
+	}
+	return cert, nil
 }
 
-// LoadCert loads a certificate and key from files.
-func LoadCert(certPath, keyPath string) (*Cert, error) {
+// LoadCertificate loads a PEM certificate without its key.
+func LoadCertificate(certPath string) (*x509.Certificate, error) {
 	certPEM, err := os.ReadFile(certPath)
 	if err != nil {
 		return nil, fmt.Errorf("read cert: %w", err)
 	}
+	return ParseCertificate(certPEM)
+}
 
-	keyPEM, err := os.ReadFile(keyPath)
-	if err != nil {
-		return nil, fmt.Errorf("read key: %w", err)
-	}
-
+// ParseCertificate parses a PEM certificate. Anything after the first
+// certificate is ignored.
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
 	certBlock, _ := pem.Decode(certPEM)
 	if certBlock == nil {
 		return nil, fmt.Errorf("decode cert PEM: no PEM data found")
@@ -105,22 +177,104 @@ func LoadCert(certPath, keyPath string) (*Cert, error) {
 	if err != nil {
 		return nil, fmt.Errorf("parse cert: %w", err)
 	}
+	return cert, nil
+}
+
+// ParseCertificates parses every certificate in PEM data, such as a
+// certificate followed by its chain.
+func ParseCertificates(certPEM []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, certPEM = pem.Decode(certPEM)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse cert: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("decode cert PEM: no PEM data found")
+	}
+	return certs, nil
+}
+
+// EncodeCertificate returns the PEM encoding of one or more certificates.
+func EncodeCertificate(certs ...*x509.Certificate) []byte {
+	var buf []byte
+	for _, cert := range certs {
+		buf = append(buf, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		})...)
+	}
+	return buf
+}
+
+// SaveCertificate writes a PEM certificate without its key.
+func SaveCertificate(cert *x509.Certificate, certPath string) error {
+	return SaveCertificates(certPath, cert)
+}
 
-	keyBlock, _ := pem.Decode(keyPEM)
-	if keyBlock == nil {
-		return nil, fmt.Errorf("decode key PEM: no PEM data found")
+// SaveCertificates writes PEM certificates, such as a certificate followed
+// by its chain, to one file.
+func SaveCertificates(certPath string, certs ...*x509.Certificate) error {
+	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
+		return fmt.Errorf("create cert directory: %w", err)
 	}
+	if err := os.WriteFile(certPath, EncodeCertificate(certs...), 0644); err != nil {
+		return fmt.Errorf("write cert: %w", err)
+	}
+	return nil
+}
+
+// LoadCert loads a certificate, its chain if present, and key from files.
+// The key must not be encrypted; see LoadCertWithOptions.
+func LoadCert(certPath, keyPath string) (*Cert, error) {
+	return LoadCertWithOptions(certPath, keyPath, KeyOptions{})
+}
 
-	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+// LoadCertWithOptions is LoadCert decrypting an encrypted key with the
+// passphrase from opts.
+func LoadCertWithOptions(certPath, keyPath string, opts KeyOptions) (*Cert, error) {
+	certPEM, err := os.ReadFile(certPath)
 	if err != nil {
-		return nil, fmt.Errorf("parse key: %w", err)
+		return nil, fmt.Errorf("read cert: %w", err)
+	}
+	certs, err := ParseCertificates(certPEM)
+	if err != nil {
+		return nil, err
 	}
 
-	return &Cert{Cert: cert, Key: key}, nil
+	key, err := LoadKeyWithOptions(keyPath, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cert{Cert: certs[0], Key: key, Chain: certs[1:]}, nil
 }
 
-// Save persists the certificate and key to files.
+// Save persists the certificate, its chain and key to files, leaving the
+// key unencrypted.
 func (c *Cert) Save(certPath, keyPath string) error {
+	return c.SaveWithOptions(certPath, keyPath, KeyOptions{})
+}
+
+// SaveWithOptions is Save protecting the key as opts asks.
+func (c *Cert) SaveWithOptions(certPath, keyPath string, opts KeyOptions) error {
+	// Encode the key first, so that a missing passphrase leaves no
+	// certificate without its key
+	keyPEM, err := encodeKey(c.Key, opts)
+	if err != nil {
+		return err
+	}
+
 	// Ensure directories exist
 	if err := os.MkdirAll(filepath.Dir(certPath), 0700); err != nil {
 		return fmt.Errorf("create cert directory: %w", err)
@@ -129,46 +283,29 @@ func (c *Cert) Save(certPath, keyPath string) error {
 		return fmt.Errorf("create key directory: %w", err)
 	}
 
-	// Save certificate
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: c.Cert.Raw,
-	})
-	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+	// Save certificate followed by its chain
+	if err := os.WriteFile(certPath, EncodeCertificate(c.Certificates()...), 0644); err != nil {
 		return fmt.Errorf("write cert: %w", err)
 	}
 
 	// Save key
-	keyBytes, err := x509.MarshalECPrivateKey(c.Key)
-	if err != nil {
-		return fmt.Errorf("marshal key: %w", err)
-	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
-	})
-	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
-		return fmt.Errorf("write key: %w", err)
-	}
+	return writeKey(keyPath, keyPEM)
+}
 
-	return nil
+// Certificates returns the certificate followed by its chain.
+func (c *Cert) Certificates() []*x509.Certificate {
+	return append([]*x509.Certificate{c.Cert}, c.Chain...)
 }
 
-// TLSCertificate returns a tls.Certificate for use with TLS configs.
+// TLSCertificate returns a tls.Certificate, including the chain, for use
+// with TLS configs.
 func (c *Cert) TLSCertificate() (tls.Certificate, error) {
-	certPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: c.Cert.Raw,
-	})
+	certPEM := EncodeCertificate(c.Certificates()...)
 
-	keyBytes, err := x509.MarshalECPrivateKey(c.Key)
+	keyPEM, err := encodeKey(c.Key, KeyOptions{})
 	if err != nil {
-		return tls.Certificate{}, fmt.Errorf("marshal key: %w", err)
+		return tls.Certificate{}, err
 	}
-	keyPEM := pem.EncodeToMemory(&pem.Block{
-		Type:  "EC PRIVATE KEY",
-		Bytes: keyBytes,
-	})
 
 	return tls.X509KeyPair(certPEM, keyPEM)
 }
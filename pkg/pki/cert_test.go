@@ -154,6 +154,42 @@ func TestCertIdentity(t *testing.T) {
 	}
 }
 
+func TestGenerateCert_SANs(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	opts := CertOptions{}
+	opts.DNSNames, opts.IPAddresses = ParseSANs([]string{"backend.example.com", "10.0.0.5", "localhost"})
+	cert, err := GenerateCertWithOptions(ca, "spiffe://tndrl/node/backend", true, true, opts)
+	if err != nil {
+		t.Fatalf("GenerateCertWithOptions() error = %v", err)
+	}
+
+	if err := cert.Cert.VerifyHostname("backend.example.com"); err != nil {
+		t.Errorf("VerifyHostname(backend.example.com) error = %v", err)
+	}
+	if err := cert.Cert.VerifyHostname("10.0.0.5"); err != nil {
+		t.Errorf("VerifyHostname(10.0.0.5) error = %v", err)
+	}
+	if err := cert.Cert.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("VerifyHostname(127.0.0.1) error = %v", err)
+	}
+	if len(cert.Cert.DNSNames) != 2 {
+		t.Errorf("DNSNames = %v, want localhost once and backend.example.com", cert.Cert.DNSNames)
+	}
+
+	// Renewal keeps the SANs
+	renewed, err := ca.Reissue(cert.Cert)
+	if err != nil {
+		t.Fatalf("Reissue() error = %v", err)
+	}
+	if err := renewed.Cert.VerifyHostname("backend.example.com"); err != nil {
+		t.Errorf("renewed VerifyHostname(backend.example.com) error = %v", err)
+	}
+}
+
 func TestSaveAndLoadCert(t *testing.T) {
 	dir := t.TempDir()
 	certPath := filepath.Join(dir, "test.crt")
@@ -184,6 +220,48 @@ func TestSaveAndLoadCert(t *testing.T) {
 	}
 }
 
+func TestSaveAndLoadCert_Chain(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "test.crt")
+	keyPath := filepath.Join(dir, "test.key")
+
+	root, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	intermediate, err := GenerateIntermediateCA(root, "test")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+
+	original, err := GenerateCert(intermediate, "spiffe://tndrl/test", true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	if err := original.Save(certPath, keyPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadCert(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("LoadCert() error = %v", err)
+	}
+	if !original.Cert.Equal(loaded.Cert) {
+		t.Error("Loaded certificate does not match original")
+	}
+	if len(loaded.Chain) != 1 || !loaded.Chain[0].Equal(intermediate.Cert) {
+		t.Errorf("Loaded chain = %d certs, want the intermediate", len(loaded.Chain))
+	}
+
+	tlsCert, err := loaded.TLSCertificate()
+	if err != nil {
+		t.Fatalf("TLSCertificate() error = %v", err)
+	}
+	if len(tlsCert.Certificate) != 2 {
+		t.Errorf("TLS certificate has %d certs, want leaf and intermediate", len(tlsCert.Certificate))
+	}
+}
+
 func TestCertExists(t *testing.T) {
 	dir := t.TempDir()
 	certPath := filepath.Join(dir, "test.crt")
@@ -0,0 +1,381 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// CRLFile is the name of the revocation list, stored next to ca.crt.
+const CRLFile = "ca.crl"
+
+// crlValidity is how far ahead a saved CRL's NextUpdate is set. Peers do not
+// reject stale CRLs; the field is required by the format.
+const crlValidity = 365 * 24 * time.Hour
+
+// CRL is the set of certificates a CA has revoked.
+//
+// Certificates are revoked by serial number or by SPIFFE identity. Revoking
+// an identity rejects every certificate for it issued at or before the
+// revocation time, so a node can be re-enrolled with a fresh certificate,
+// even within the same second. An identity revocation is recorded as an
+// ordinary X.509 CRL entry whose serial number is derived from the identity
+// and the exact revocation time (see identitySerial).
+//
+// The list may be signed by any CA peers chain to, such as an intermediate
+// above which a node only trusts the root. It is verified against the CA
+// named as its issuer: one of the certificates it was loaded with if
+// possible, else the first verified peer chain holding the issuer, and it
+// only takes effect once verified.
+//
+// A CRL loaded from a file is re-read when the file changes, on each check
+// of a Reloader it is given to, so running nodes pick up revocations without
+// a restart.
+type CRL struct {
+	mu         sync.Mutex
+	issuers    []*x509.Certificate // CAs the list is known to be signed by
+	number     *big.Int
+	entries    []x509.RevocationListEntry
+	revoked    map[string]bool      // serial (hex)
+	identities map[string]time.Time // identity hash (hex) -> revocation time
+
+	// pending is a list loaded from path whose issuer is not among issuers,
+	// waiting for a peer chain holding the issuer to verify it.
+	pending *x509.RevocationList
+
+	path    string
+	modTime time.Time
+}
+
+// newCRL returns an empty revocation list signed by one of issuers.
+// If path is set, the list is loaded from it once it exists.
+func newCRL(path string, issuers ...*x509.Certificate) *CRL {
+	return &CRL{
+		issuers:    issuers,
+		number:     big.NewInt(0),
+		revoked:    make(map[string]bool),
+		identities: make(map[string]time.Time),
+		path:       path,
+	}
+}
+
+// LoadCRL loads a revocation list and verifies it was signed by the issuer
+// it names, if that is one of issuers. A list naming another issuer takes
+// effect once a peer chain holding that issuer verifies it.
+func LoadCRL(path string, issuers ...*x509.Certificate) (*CRL, error) {
+	crl := newCRL(path, issuers...)
+	if err := crl.reload(); err != nil {
+		return nil, err
+	}
+	return crl, nil
+}
+
+// RevokeSerial revokes the certificate with the given serial number.
+func (c *CRL) RevokeSerial(serial *big.Int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.add(serial, time.Now())
+}
+
+// RevokeIdentity revokes every certificate for the SPIFFE identity issued
+// at or before now.
+func (c *CRL) RevokeIdentity(identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.add(identitySerial(identity, now), now)
+}
+
+// add records a revocation. A revocation of an identity replaces any
+// earlier one for it. Callers must hold c.mu.
+func (c *CRL) add(serial *big.Int, at time.Time) {
+	entry := x509.RevocationListEntry{
+		SerialNumber:   serial,
+		RevocationTime: at.UTC().Truncate(time.Second), // CRL times have second precision
+	}
+
+	key, revokedAt, ok := parseIdentitySerial(serial)
+	if !ok {
+		if !c.revoked[serial.Text(16)] {
+			c.revoked[serial.Text(16)] = true
+			c.entries = append(c.entries, entry)
+		}
+		return
+	}
+
+	if _, ok := c.identities[key]; ok {
+		c.entries = slices.DeleteFunc(c.entries, func(e x509.RevocationListEntry) bool {
+			k, _, ok := parseIdentitySerial(e.SerialNumber)
+			return ok && k == key
+		})
+	}
+	c.entries = append(c.entries, entry)
+	c.identities[key] = revokedAt
+}
+
+// Len returns the number of revocations.
+func (c *CRL) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// IsRevoked reports whether the certificate has been revoked, either by
+// serial number or by identity.
+func (c *CRL) IsRevoked(cert *x509.Certificate) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.revoked[cert.SerialNumber.Text(16)] {
+		return true
+	}
+	identity, err := IdentityFromCert(cert)
+	if err != nil {
+		return false
+	}
+	at, ok := c.identities[identityKey(identity)]
+	return ok && !issuedAt(cert).After(at)
+}
+
+// verifyPending verifies a pending list against a verified peer chain and,
+// if the chain holds its issuer, puts it into effect.
+func (c *CRL) verifyPending(chain []*x509.Certificate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		return
+	}
+	issuer, err := findCRLIssuer(c.pending, chain)
+	if issuer == nil {
+		if err != nil {
+			slog.Warn("ignoring CRL that does not verify", "path", c.path, "err", err)
+			c.pending = nil
+		}
+		return
+	}
+	c.issuers = append(c.issuers, issuer)
+	c.apply(c.pending)
+	c.pending = nil
+}
+
+// refresh re-reads the CRL file if it changed since it was last loaded.
+// A file that cannot be read or verified is ignored and the previous list
+// kept.
+func (c *CRL) refresh() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.path == "" {
+		return
+	}
+	info, err := os.Stat(c.path)
+	if err != nil || info.ModTime().Equal(c.modTime) {
+		return
+	}
+	if err := c.reload(); err != nil {
+		slog.Warn("ignoring unreadable CRL", "path", c.path, "err", err)
+	}
+}
+
+// reload replaces the list with the contents of c.path.
+// Callers must hold c.mu, or have exclusive access.
+func (c *CRL) reload() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return fmt.Errorf("stat CRL: %w", err)
+	}
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return fmt.Errorf("read CRL: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return fmt.Errorf("decode CRL PEM: no PEM data found")
+	}
+	list, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("parse CRL: %w", err)
+	}
+	c.modTime = info.ModTime()
+
+	issuer, err := findCRLIssuer(list, c.issuers)
+	if err != nil {
+		return err
+	}
+	if issuer == nil {
+		c.pending = list
+		return nil
+	}
+	c.pending = nil
+	c.apply(list)
+	return nil
+}
+
+// findCRLIssuer returns the CA among certs that the list names as its
+// issuer and is signed by. It returns nil and no error if none is named, and
+// an error if one is named but did not sign it.
+func findCRLIssuer(list *x509.RevocationList, certs []*x509.Certificate) (*x509.Certificate, error) {
+	var err error
+	for _, cert := range certs {
+		if !cert.IsCA || !bytes.Equal(cert.RawSubject, list.RawIssuer) {
+			continue
+		}
+		if err = list.CheckSignatureFrom(cert); err == nil {
+			return cert, nil
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("verify CRL: %w", err)
+	}
+	return nil, nil
+}
+
+// apply replaces the revocations with those of a verified list.
+// Callers must hold c.mu, or have exclusive access.
+func (c *CRL) apply(list *x509.RevocationList) {
+	c.number = list.Number
+	c.entries = nil
+	c.revoked = make(map[string]bool)
+	c.identities = make(map[string]time.Time)
+	for _, entry := range list.RevokedCertificateEntries {
+		c.add(entry.SerialNumber, entry.RevocationTime)
+	}
+}
+
+// identitySerialTag is the leading byte of identity revocation serials.
+const identitySerialTag = 0x01
+
+// identitySerial returns the serial number under which a revocation of the
+// identity at the given time is recorded: identitySerialTag, the first 10
+// bytes of the identity's SHA-256 hash and the revocation time in Unix
+// nanoseconds. At 145 bits it does not collide with the 128-bit serials of
+// issued certificates, and it keeps the revocation time at the full
+// precision the CRL's RevocationTime lacks.
+func identitySerial(identity string, at time.Time) *big.Int {
+	sum := sha256.Sum256([]byte(identity))
+	b := make([]byte, 0, 19)
+	b = append(b, identitySerialTag)
+	b = append(b, sum[:10]...)
+	b = binary.BigEndian.AppendUint64(b, uint64(at.UnixNano()))
+	return new(big.Int).SetBytes(b)
+}
+
+// identityKey returns the identity hash part of its revocation serials.
+func identityKey(identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:10])
+}
+
+// parseIdentitySerial returns the identity hash and revocation time of a
+// serial made by identitySerial. ok is false for any other serial.
+func parseIdentitySerial(serial *big.Int) (key string, at time.Time, ok bool) {
+	if serial.Sign() <= 0 || serial.BitLen() != 145 {
+		return "", time.Time{}, false
+	}
+	b := serial.FillBytes(make([]byte, 19))
+	if b[0] != identitySerialTag {
+		return "", time.Time{}, false
+	}
+	return hex.EncodeToString(b[1:11]), time.Unix(0, int64(binary.BigEndian.Uint64(b[11:]))), true
+}
+
+// newSerial returns a serial number for a certificate issued at t: the
+// issuance time in Unix nanoseconds in the high 64 bits and 64 random bits
+// below. It lets identity revocations be compared against the exact
+// issuance time, where NotBefore has second precision.
+func newSerial(t time.Time) (*big.Int, error) {
+	random, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, err
+	}
+	serial := new(big.Int).Lsh(big.NewInt(t.UnixNano()), 64)
+	return serial.Or(serial, random), nil
+}
+
+// issuedAt returns when the certificate was issued: the time in its serial
+// if it was made by newSerial, else its NotBefore. A random serial that
+// happens to encode a time in the same second as NotBefore is
+// astronomically unlikely.
+func issuedAt(cert *x509.Certificate) time.Time {
+	if cert.SerialNumber.Sign() > 0 && cert.SerialNumber.BitLen() <= 128 {
+		high := new(big.Int).Rsh(cert.SerialNumber, 64)
+		if high.IsInt64() {
+			t := time.Unix(0, high.Int64())
+			if !t.Before(cert.NotBefore) && t.Before(cert.NotBefore.Add(time.Second)) {
+				return t
+			}
+		}
+	}
+	return cert.NotBefore
+}
+
+// SaveCRL signs the CA's revocation list and writes it to CRLFile in dir.
+func (ca *CA) SaveCRL(dir string) error {
+	if ca.Key == nil {
+		return errors.New("CA private key required to sign CRL")
+	}
+	crl := ca.CRL
+
+	crl.mu.Lock()
+	defer crl.mu.Unlock()
+
+	now := time.Now()
+	number := new(big.Int).Add(crl.number, big.NewInt(1))
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(crlValidity),
+		RevokedCertificateEntries: crl.entries,
+	}, ca.Cert, ca.Key)
+	if err != nil {
+		return fmt.Errorf("create CRL: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("create directory: %w", err)
+	}
+	path := filepath.Join(dir, CRLFile)
+	crlPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "X509 CRL",
+		Bytes: der,
+	})
+	if err := os.WriteFile(path, crlPEM, 0644); err != nil {
+		return fmt.Errorf("write CRL: %w", err)
+	}
+
+	crl.number = number
+	if info, err := os.Stat(path); err == nil && path == crl.path {
+		crl.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// verifyNotRevoked is a tls.Config VerifyPeerCertificate callback that
+// rejects peers whose certificate the CA has revoked.
+func (ca *CA) verifyNotRevoked(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+	if ca.CRL == nil {
+		return nil
+	}
+	for _, chain := range verifiedChains {
+		ca.CRL.verifyPending(chain)
+		for _, cert := range chain {
+			if ca.CRL.IsRevoked(cert) {
+				return fmt.Errorf("certificate %s (serial %x) has been revoked", cert.Subject.CommonName, cert.SerialNumber)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package pki
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCRL_RevokeSerial(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	revoked, err := GenerateCert(ca, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	other, err := GenerateCert(ca, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	ca.CRL.RevokeSerial(revoked.Cert.SerialNumber)
+
+	if !ca.CRL.IsRevoked(revoked.Cert) {
+		t.Error("IsRevoked() = false for revoked serial")
+	}
+	if ca.CRL.IsRevoked(other.Cert) {
+		t.Error("IsRevoked() = true for another certificate with the same identity")
+	}
+}
+
+func TestCRL_RevokeIdentity(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	leaked, err := GenerateCert(ca, NodeIdentity("leaked"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	bystander, err := GenerateCert(ca, NodeIdentity("bystander"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	ca.CRL.RevokeIdentity(NodeIdentity("leaked"))
+
+	if !ca.CRL.IsRevoked(leaked.Cert) {
+		t.Error("IsRevoked() = false for revoked identity")
+	}
+	if ca.CRL.IsRevoked(bystander.Cert) {
+		t.Error("IsRevoked() = true for another identity")
+	}
+
+	// A certificate issued after the revocation is valid again
+	reissued := *leaked.Cert
+	reissued.NotBefore = time.Now().Add(2 * time.Second)
+	if ca.CRL.IsRevoked(&reissued) {
+		t.Error("IsRevoked() = true for certificate issued after revocation")
+	}
+}
+
+func TestCRL_ReissueRightAfterRevoke(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	dir := t.TempDir()
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Both certificates fall within the same second as the revocation,
+	// which is all the CRL's RevocationTime and NotBefore can express
+	leaked, err := GenerateCert(ca, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	ca.CRL.RevokeIdentity(NodeIdentity("a"))
+	reissued, err := GenerateCert(ca, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	if err := ca.SaveCRL(dir); err != nil {
+		t.Fatalf("SaveCRL() error = %v", err)
+	}
+	loaded, err := LoadCRL(filepath.Join(dir, CRLFile), ca.Cert)
+	if err != nil {
+		t.Fatalf("LoadCRL() error = %v", err)
+	}
+
+	for name, crl := range map[string]*CRL{"in memory": ca.CRL, "loaded": loaded} {
+		if !crl.IsRevoked(leaked.Cert) {
+			t.Errorf("%s: IsRevoked() = false for certificate issued before revocation", name)
+		}
+		if crl.IsRevoked(reissued.Cert) {
+			t.Errorf("%s: IsRevoked() = true for certificate issued right after revocation", name)
+		}
+	}
+
+	// Revoking the identity again replaces the earlier entry
+	ca.CRL.RevokeIdentity(NodeIdentity("a"))
+	if got := ca.CRL.Len(); got != 1 {
+		t.Errorf("Len() = %d after revoking the identity twice, want 1", got)
+	}
+	if !ca.CRL.IsRevoked(reissued.Cert) {
+		t.Error("IsRevoked() = false after revoking the identity again")
+	}
+}
+
+func TestCRL_SaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	cert, err := GenerateCert(ca, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	// A CA without a CRL file loads with an empty list
+	loaded, err := LoadCAFromDir(dir)
+	if err != nil {
+		t.Fatalf("LoadCAFromDir() error = %v", err)
+	}
+	if loaded.CRL.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", loaded.CRL.Len())
+	}
+
+	ca.CRL.RevokeSerial(cert.Cert.SerialNumber)
+	ca.CRL.RevokeIdentity(NodeIdentity("b"))
+	if err := ca.SaveCRL(dir); err != nil {
+		t.Fatalf("SaveCRL() error = %v", err)
+	}
+
+	// The already-loaded CA picks up the new file when refreshed
+	loaded.CRL.refresh()
+	if !loaded.CRL.IsRevoked(cert.Cert) {
+		t.Error("loaded CA did not pick up the saved CRL")
+	}
+
+	reloaded, err := LoadCRL(filepath.Join(dir, CRLFile), ca.Cert)
+	if err != nil {
+		t.Fatalf("LoadCRL() error = %v", err)
+	}
+	if reloaded.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", reloaded.Len())
+	}
+	if !reloaded.IsRevoked(cert.Cert) {
+		t.Error("IsRevoked() = false after reload")
+	}
+}
+
+func TestLoadCRL_WrongIssuer(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.SaveCRL(dir); err != nil {
+		t.Fatalf("SaveCRL() error = %v", err)
+	}
+
+	otherCA, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if _, err := LoadCRL(filepath.Join(dir, CRLFile), otherCA.Cert); err == nil {
+		t.Error("LoadCRL() succeeded for a CRL signed by another CA")
+	}
+
+	// LoadCA refuses a CA whose CRL does not verify
+	if err := otherCA.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if _, err := LoadCAFromDir(dir); err == nil {
+		t.Error("LoadCAFromDir() succeeded with a CRL signed by another CA")
+	}
+}
+
+func TestCRL_SignedByIntermediate(t *testing.T) {
+	root, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	intermediate, err := GenerateIntermediateCA(root, "prod")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+	revoked, err := GenerateCert(intermediate, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	valid, err := GenerateCert(intermediate, NodeIdentity("b"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	// The peer trusts only the root, beside the intermediate's CRL
+	dir := t.TempDir()
+	if err := SaveCertificates(filepath.Join(dir, "ca.crt"), root.Cert); err != nil {
+		t.Fatalf("SaveCertificates() error = %v", err)
+	}
+	intermediate.CRL.RevokeSerial(revoked.Cert.SerialNumber)
+	if err := intermediate.SaveCRL(dir); err != nil {
+		t.Fatalf("SaveCRL() error = %v", err)
+	}
+
+	peer, err := LoadCACertificate(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("LoadCACertificate() error = %v", err)
+	}
+	if err := peer.VerifyCertificate(revoked.Certificates()); err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("VerifyCertificate() of a revoked certificate error = %v, want revoked", err)
+	}
+	if err := peer.VerifyCertificate(valid.Certificates()); err != nil {
+		t.Errorf("VerifyCertificate() error = %v", err)
+	}
+}
+
+func TestLoadCRL_Missing(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if _, err := LoadCRL(filepath.Join(t.TempDir(), CRLFile), ca.Cert); err == nil {
+		t.Error("LoadCRL() succeeded for a missing file")
+	}
+}
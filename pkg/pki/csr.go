@@ -0,0 +1,177 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// CertRequest is a new private key and a certificate signing request for
+// it. A node without the CA key creates one and has the CA host sign it,
+// so the CA key never leaves that host.
+type CertRequest struct {
+	CSR *x509.CertificateRequest
+	Key crypto.Signer
+}
+
+// NewCertRequest generates a key and a CSR for the SPIFFE identity.
+func NewCertRequest(identity string) (*CertRequest, error) {
+	return NewCertRequestWithOptions(identity, CertOptions{})
+}
+
+// NewCertRequestWithOptions is like NewCertRequest, with a choice of key
+// algorithm. The SANs in opts are requested in the CSR.
+func NewCertRequestWithOptions(identity string, opts CertOptions) (*CertRequest, error) {
+	key, err := GenerateKey(opts.KeyAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	identityURI, err := url.Parse(identity)
+	if err != nil {
+		return nil, fmt.Errorf("parse identity URI: %w", err)
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{
+			Organization: []string{"Tndrl"},
+			CommonName:   identity,
+		},
+		URIs:        []*url.URL{identityURI},
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("create CSR: %w", err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse CSR: %w", err)
+	}
+
+	return &CertRequest{CSR: csr, Key: key}, nil
+}
+
+// Save writes the CSR and the private key to files, leaving the key
+// unencrypted.
+func (r *CertRequest) Save(csrPath, keyPath string) error {
+	return r.SaveWithOptions(csrPath, keyPath, KeyOptions{})
+}
+
+// SaveWithOptions is Save protecting the key as opts asks.
+func (r *CertRequest) SaveWithOptions(csrPath, keyPath string, opts KeyOptions) error {
+	keyPEM, err := encodeKey(r.Key, opts)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(csrPath), 0700); err != nil {
+		return fmt.Errorf("create CSR directory: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyPath), 0700); err != nil {
+		return fmt.Errorf("create key directory: %w", err)
+	}
+
+	if err := os.WriteFile(csrPath, r.PEM(), 0644); err != nil {
+		return fmt.Errorf("write CSR: %w", err)
+	}
+
+	return writeKey(keyPath, keyPEM)
+}
+
+// PEM returns the PEM encoding of the CSR.
+func (r *CertRequest) PEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: r.CSR.Raw,
+	})
+}
+
+// LoadCSR loads a CSR and checks its signature.
+func LoadCSR(csrPath string) (*x509.CertificateRequest, error) {
+	csrPEM, err := os.ReadFile(csrPath)
+	if err != nil {
+		return nil, fmt.Errorf("read CSR: %w", err)
+	}
+	return ParseCSR(csrPEM)
+}
+
+// ParseCSR parses a PEM-encoded CSR and checks its signature.
+func ParseCSR(csrPEM []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil {
+		return nil, fmt.Errorf("decode CSR PEM: no PEM data found")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse CSR: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("verify CSR: %w", err)
+	}
+
+	return csr, nil
+}
+
+// SignOptions limits what SignCSR issues for a request.
+type SignOptions struct {
+	// TrustDomain is the trust domain whose node identities may be
+	// requested. Defaults to DefaultTrustDomain.
+	TrustDomain TrustDomain
+
+	// DNSNames and IPAddresses are the SANs the request may ask for. Any
+	// others it asks for are left out of the certificate.
+	DNSNames    []string
+	IPAddresses []net.IP
+}
+
+// SignCSR issues a certificate for the key in a CSR. The CSR must ask for a
+// node identity in the trust domain in opts, and only the DNS and IP SANs
+// that opts allows are honoured; every other field is set by the CA as in
+// GenerateCert.
+func (ca *CA) SignCSR(csr *x509.CertificateRequest, isServer, isClient bool, opts SignOptions) (*x509.Certificate, error) {
+	identity, err := CSRIdentity(csr)
+	if err != nil {
+		return nil, err
+	}
+	td := opts.TrustDomain
+	if td == "" {
+		td = DefaultTrustDomain
+	}
+	if _, err := td.NodeID(identity); err != nil {
+		return nil, err
+	}
+
+	var certOpts CertOptions
+	for _, name := range csr.DNSNames {
+		if slices.Contains(opts.DNSNames, name) {
+			certOpts.DNSNames = append(certOpts.DNSNames, name)
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if slices.ContainsFunc(opts.IPAddresses, ip.Equal) {
+			certOpts.IPAddresses = append(certOpts.IPAddresses, ip)
+		}
+	}
+	return ca.issue(identity, csr.PublicKey, isServer, isClient, certOpts)
+}
+
+// CSRIdentity returns the SPIFFE identity requested in a CSR.
+func CSRIdentity(csr *x509.CertificateRequest) (string, error) {
+	for _, uri := range csr.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String(), nil
+		}
+	}
+	return "", fmt.Errorf("CSR has no SPIFFE identity")
+}
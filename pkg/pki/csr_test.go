@@ -0,0 +1,202 @@
+package pki
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCertRequest_SignAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	req, err := NewCertRequest(NodeIdentity("laptop"))
+	if err != nil {
+		t.Fatalf("NewCertRequest() error = %v", err)
+	}
+	csrPath := filepath.Join(dir, "tndrl.csr")
+	keyPath := filepath.Join(dir, "tndrl.key")
+	if err := req.Save(csrPath, keyPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	csr, err := LoadCSR(csrPath)
+	if err != nil {
+		t.Fatalf("LoadCSR() error = %v", err)
+	}
+	signed, err := ca.SignCSR(csr, true, true, SignOptions{})
+	if err != nil {
+		t.Fatalf("SignCSR() error = %v", err)
+	}
+
+	identity, err := IdentityFromCert(signed)
+	if err != nil || identity != NodeIdentity("laptop") {
+		t.Errorf("identity = %q (%v), want %q", identity, err, NodeIdentity("laptop"))
+	}
+	if err := signed.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("certificate not signed by CA: %v", err)
+	}
+
+	// The signed certificate pairs with the key saved by the request
+	certPath := filepath.Join(dir, "tndrl.crt")
+	if err := SaveCertificate(signed, certPath); err != nil {
+		t.Fatalf("SaveCertificate() error = %v", err)
+	}
+	cert, err := LoadCert(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("LoadCert() error = %v", err)
+	}
+	if _, err := cert.TLSCertificate(); err != nil {
+		t.Errorf("TLSCertificate() error = %v", err)
+	}
+}
+
+func TestCertRequest_Options(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	opts := CertOptions{KeyAlgorithm: KeyECDSAP384}
+	opts.DNSNames, opts.IPAddresses = ParseSANs([]string{"laptop.example.com", "192.0.2.7"})
+	req, err := NewCertRequestWithOptions(NodeIdentity("laptop"), opts)
+	if err != nil {
+		t.Fatalf("NewCertRequestWithOptions() error = %v", err)
+	}
+
+	signed, err := ca.SignCSR(req.CSR, true, true, SignOptions{
+		DNSNames:    opts.DNSNames,
+		IPAddresses: opts.IPAddresses,
+	})
+	if err != nil {
+		t.Fatalf("SignCSR() error = %v", err)
+	}
+	if alg, _ := KeyAlgorithmOf(signed.PublicKey); alg != KeyECDSAP384 {
+		t.Errorf("key algorithm = %q, want %q", alg, KeyECDSAP384)
+	}
+	for _, host := range []string{"laptop.example.com", "192.0.2.7", "localhost"} {
+		if err := signed.VerifyHostname(host); err != nil {
+			t.Errorf("VerifyHostname(%s) error = %v", host, err)
+		}
+	}
+}
+
+func TestSignCSR_DropsSANsNotAllowed(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	opts := CertOptions{}
+	opts.DNSNames, opts.IPAddresses = ParseSANs([]string{"laptop.example.com", "bank.example.com", "192.0.2.7", "192.0.2.8"})
+	req, err := NewCertRequestWithOptions(NodeIdentity("laptop"), opts)
+	if err != nil {
+		t.Fatalf("NewCertRequestWithOptions() error = %v", err)
+	}
+
+	allowed, allowedIPs := ParseSANs([]string{"laptop.example.com", "192.0.2.7"})
+	signed, err := ca.SignCSR(req.CSR, true, true, SignOptions{DNSNames: allowed, IPAddresses: allowedIPs})
+	if err != nil {
+		t.Fatalf("SignCSR() error = %v", err)
+	}
+	for _, host := range []string{"laptop.example.com", "192.0.2.7", "localhost"} {
+		if err := signed.VerifyHostname(host); err != nil {
+			t.Errorf("VerifyHostname(%s) error = %v", host, err)
+		}
+	}
+	for _, host := range []string{"bank.example.com", "192.0.2.8"} {
+		if err := signed.VerifyHostname(host); err == nil {
+			t.Errorf("VerifyHostname(%s) succeeded for a SAN that was not allowed", host)
+		}
+	}
+}
+
+func TestSignCSR_RequiresNodeIdentity(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		identity string
+		td       TrustDomain
+	}{
+		{"other trust domain", TrustDomain("example.org").NodeIdentity("laptop"), ""},
+		{"not a node", "spiffe://tndrl/admin/laptop", ""},
+		{"nested path", "spiffe://tndrl/node/laptop/extra", ""},
+		{"empty node", "spiffe://tndrl/node/", ""},
+		{"default domain with configured domain", NodeIdentity("laptop"), "example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := NewCertRequest(tt.identity)
+			if err != nil {
+				t.Fatalf("NewCertRequest() error = %v", err)
+			}
+			if _, err := ca.SignCSR(req.CSR, true, true, SignOptions{TrustDomain: tt.td}); err == nil {
+				t.Errorf("SignCSR(%s) succeeded", tt.identity)
+			}
+		})
+	}
+
+	req, err := NewCertRequest(TrustDomain("example.org").NodeIdentity("laptop"))
+	if err != nil {
+		t.Fatalf("NewCertRequest() error = %v", err)
+	}
+	if _, err := ca.SignCSR(req.CSR, true, true, SignOptions{TrustDomain: "example.org"}); err != nil {
+		t.Errorf("SignCSR() in the configured trust domain error = %v", err)
+	}
+}
+
+func TestSignCSR_RequiresCAKey(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	verifyOnly, err := LoadCACertificate(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("LoadCACertificate() error = %v", err)
+	}
+	if verifyOnly.Key != nil {
+		t.Error("LoadCACertificate() loaded a private key")
+	}
+
+	req, err := NewCertRequest(NodeIdentity("laptop"))
+	if err != nil {
+		t.Fatalf("NewCertRequest() error = %v", err)
+	}
+	if _, err := verifyOnly.SignCSR(req.CSR, true, true, SignOptions{}); err == nil {
+		t.Error("SignCSR() succeeded without the CA key")
+	}
+	if _, err := GenerateCert(verifyOnly, NodeIdentity("laptop"), true, true); err == nil {
+		t.Error("GenerateCert() succeeded without the CA key")
+	}
+}
+
+func TestLoadCACertificate_NotCA(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	cert, err := GenerateCert(ca, NodeIdentity("a"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	certPath := filepath.Join(dir, "tndrl.crt")
+	if err := SaveCertificate(cert.Cert, certPath); err != nil {
+		t.Fatalf("SaveCertificate() error = %v", err)
+	}
+
+	if _, err := LoadCACertificate(certPath); err == nil {
+		t.Error("LoadCACertificate() accepted a node certificate")
+	}
+}
@@ -0,0 +1,269 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrKeyEncrypted is returned (wrapped) when loading an encrypted private
+// key without a passphrase.
+var ErrKeyEncrypted = errors.New("private key is encrypted and no passphrase is available")
+
+// Encrypted keys are PKCS #8 EncryptedPrivateKeyInfo (RFC 5958) using PBES2
+// (RFC 8018) with scrypt (RFC 7914) and AES-256-CBC, as written by
+// `openssl pkcs8 -topk8 -scrypt`, so operators can still read them with
+// openssl.
+var (
+	oidPBES2     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidScrypt    = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// scryptKeyLen is the length of the derived AES-256 key.
+const scryptKeyLen = 32
+
+// maxScryptWork bounds the cost a key file can make us pay: scrypt takes
+// time in proportion to N·r·p and 128·N·r bytes of memory, so this allows
+// 1 GiB at p = 1.
+const maxScryptWork = 1 << 23
+
+// ScryptParams are the scrypt cost parameters (RFC 7914) used to derive the
+// encryption key of a private key from the passphrase.
+type ScryptParams struct {
+	N int // CPU/memory cost, a power of two
+	R int // block size
+	P int // parallelization
+}
+
+// DefaultScrypt are the parameters of `openssl pkcs8 -scrypt` (16 MiB),
+// since openssl refuses to decrypt keys that need more than 32 MiB.
+var DefaultScrypt = ScryptParams{N: 1 << 14, R: 8, P: 1}
+
+// check reports whether the parameters are valid and within maxScryptWork.
+func (p ScryptParams) check() error {
+	if p.N < 2 || p.N&(p.N-1) != 0 {
+		return fmt.Errorf("scrypt cost %d is not a power of two above 1", p.N)
+	}
+	if p.R < 1 || p.P < 1 {
+		return fmt.Errorf("scrypt block size %d and parallelization %d must be positive", p.R, p.P)
+	}
+	if p.R > maxScryptWork/p.N || p.P > maxScryptWork/(p.N*p.R) {
+		return fmt.Errorf("scrypt cost N=%d r=%d p=%d exceeds N·r·p = %d", p.N, p.R, p.P, maxScryptWork)
+	}
+	return nil
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// KeyOptions controls how a private key is protected at rest.
+type KeyOptions struct {
+	// Encrypt makes saved keys encrypted with the passphrase. Encrypted
+	// keys are decrypted on load whether or not it is set.
+	Encrypt bool
+
+	// Passphrase returns the passphrase. encrypt is true if it is needed to
+	// encrypt a key, so that a prompt can ask for confirmation. Without it,
+	// encrypted keys can be neither saved nor loaded.
+	Passphrase func(encrypt bool) ([]byte, error)
+
+	// Scrypt sets the cost of encrypting saved keys. The zero value selects
+	// DefaultScrypt.
+	Scrypt ScryptParams
+}
+
+// passphrase returns the passphrase from opts.Passphrase.
+func (opts KeyOptions) passphrase(encrypt bool) ([]byte, error) {
+	if opts.Passphrase == nil {
+		return nil, ErrKeyEncrypted
+	}
+	passphrase, err := opts.Passphrase(encrypt)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("%w: the passphrase is empty", ErrKeyEncrypted)
+	}
+	return passphrase, nil
+}
+
+// IsEncryptedKey reports whether PEM data holds an encrypted private key.
+func IsEncryptedKey(keyPEM []byte) bool {
+	block, _ := pem.Decode(keyPEM)
+	return block != nil && block.Type == "ENCRYPTED PRIVATE KEY"
+}
+
+// EncryptKey returns the PEM "ENCRYPTED PRIVATE KEY" encoding of a private
+// key encrypted with the passphrase, using DefaultScrypt.
+func EncryptKey(key crypto.Signer, passphrase []byte) ([]byte, error) {
+	return EncryptKeyWithParams(key, passphrase, DefaultScrypt)
+}
+
+// EncryptKeyWithParams is EncryptKey with the given scrypt parameters.
+func EncryptKeyWithParams(key crypto.Signer, passphrase []byte, params ScryptParams) ([]byte, error) {
+	if err := params.check(); err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal key: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, fmt.Errorf("generate IV: %w", err)
+	}
+
+	kdfParams := scryptParams{
+		Salt:                     salt,
+		CostParameter:            params.N,
+		BlockSize:                params.R,
+		ParallelizationParameter: params.P,
+		KeyLength:                scryptKeyLen,
+	}
+	encKey, err := kdfParams.deriveKey(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+
+	// PKCS #7 padding
+	pad := aes.BlockSize - len(der)%aes.BlockSize
+	plaintext := append(der, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, plaintext)
+
+	kdfDER, err := asn1.Marshal(kdfParams)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+	ivDER, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+	paramsDER, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: kdfDER}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivDER}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+	infoDER, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: paramsDER}},
+		EncryptedData: ciphertext,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encrypt key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: infoDER}), nil
+}
+
+// decryptKey decrypts the DER of an "ENCRYPTED PRIVATE KEY" block to the
+// PKCS #8 DER of the key.
+func decryptKey(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, errors.New("decrypt key: malformed encrypted key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("decrypt key: unsupported encryption %s (only PBES2 with scrypt is supported)", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("decrypt key: malformed PBES2 parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidScrypt) {
+		return nil, fmt.Errorf("decrypt key: unsupported key derivation %s (only scrypt is supported)", params.KeyDerivationFunc.Algorithm)
+	}
+	if !params.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		return nil, fmt.Errorf("decrypt key: unsupported cipher %s (only AES-256-CBC is supported)", params.EncryptionScheme.Algorithm)
+	}
+
+	var kdfParams scryptParams
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New("decrypt key: malformed scrypt parameters")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("decrypt key: malformed IV")
+	}
+	ciphertext := info.EncryptedData
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("decrypt key: malformed ciphertext")
+	}
+
+	encKey, err := kdfParams.deriveKey(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt key: %w", err)
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt key: %w", err)
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+
+	// A wrong passphrase almost always shows up as bad padding; the rare
+	// rest fails to parse as PKCS #8
+	wrong := errors.New("decrypt key: wrong passphrase")
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, wrong
+	}
+	plaintext = plaintext[:len(plaintext)-pad]
+	if _, err := x509.ParsePKCS8PrivateKey(plaintext); err != nil {
+		return nil, wrong
+	}
+	return plaintext, nil
+}
+
+// deriveKey derives the AES-256 key from the passphrase.
+func (p scryptParams) deriveKey(passphrase []byte) ([]byte, error) {
+	if p.KeyLength != 0 && p.KeyLength != scryptKeyLen {
+		return nil, fmt.Errorf("unsupported key length %d", p.KeyLength)
+	}
+	params := ScryptParams{N: p.CostParameter, R: p.BlockSize, P: p.ParallelizationParameter}
+	if err := params.check(); err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, scryptKeyLen)
+	if err != nil {
+		return nil, fmt.Errorf("derive key: %w", err)
+	}
+	return key, nil
+}
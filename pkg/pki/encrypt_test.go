@@ -0,0 +1,206 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// protectKeys returns key options with a fixed passphrase, and a pointer to
+// the encrypt argument of each time it was asked for.
+func protectKeys(encrypt bool, passphrase string) (KeyOptions, *[]bool) {
+	calls := new([]bool)
+	return KeyOptions{
+		Encrypt: encrypt,
+		Passphrase: func(encrypt bool) ([]byte, error) {
+			*calls = append(*calls, encrypt)
+			return []byte(passphrase), nil
+		},
+	}, calls
+}
+
+func TestKeyProtection_Cert(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	for _, alg := range []KeyAlgorithm{KeyECDSAP256, KeyECDSAP384, KeyEd25519} {
+		t.Run(string(alg), func(t *testing.T) {
+			opts, calls := protectKeys(true, "hunter2")
+			dir := t.TempDir()
+			certPath := filepath.Join(dir, "test.crt")
+			keyPath := filepath.Join(dir, "test.key")
+
+			cert, err := GenerateCertWithOptions(ca, "spiffe://tndrl/test", true, true, CertOptions{KeyAlgorithm: alg})
+			if err != nil {
+				t.Fatalf("GenerateCertWithOptions() error = %v", err)
+			}
+			if err := cert.SaveWithOptions(certPath, keyPath, opts); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			keyPEM, err := os.ReadFile(keyPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !IsEncryptedKey(keyPEM) {
+				t.Fatalf("saved key is not encrypted:\n%s", keyPEM)
+			}
+
+			loaded, err := LoadCertWithOptions(certPath, keyPath, opts)
+			if err != nil {
+				t.Fatalf("LoadCert() error = %v", err)
+			}
+			if got, err := KeyAlgorithmOf(loaded.Key.Public()); err != nil || got != alg {
+				t.Errorf("loaded key algorithm = %q, %v, want %q", got, err, alg)
+			}
+			if !slices.Equal(*calls, []bool{true, false}) {
+				t.Errorf("passphrase asked for with encrypt = %v, want [true false]", *calls)
+			}
+		})
+	}
+}
+
+func TestKeyProtection_CA(t *testing.T) {
+	opts, _ := protectKeys(true, "hunter2")
+	dir := t.TempDir()
+
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.SaveWithOptions(dir, opts); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	loaded, err := LoadCAFromDirWithOptions(dir, opts)
+	if err != nil {
+		t.Fatalf("LoadCAFromDir() error = %v", err)
+	}
+	if !loaded.Key.Public().(*ecdsa.PublicKey).Equal(ca.Key.Public()) {
+		t.Error("loaded CA key does not match")
+	}
+
+	// Without a passphrase the key cannot be loaded
+	if _, err := LoadCAFromDir(dir); !errors.Is(err, ErrKeyEncrypted) {
+		t.Errorf("LoadCAFromDir() without passphrase error = %v, want ErrKeyEncrypted", err)
+	}
+
+	// Nor with the wrong one
+	wrong, _ := protectKeys(false, "wrong")
+	if _, err := LoadCAFromDirWithOptions(dir, wrong); err == nil {
+		t.Error("LoadCAFromDir() with the wrong passphrase succeeded")
+	}
+}
+
+func TestKeyProtection_PlainKeys(t *testing.T) {
+	// Not encrypting, unencrypted keys never need the passphrase
+	opts, calls := protectKeys(false, "hunter2")
+	dir := t.TempDir()
+
+	key, err := GenerateKey(KeyEd25519)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	keyPath := filepath.Join(dir, "plain.key")
+	if err := SaveKeyWithOptions(keyPath, key, opts); err != nil {
+		t.Fatalf("SaveKey() error = %v", err)
+	}
+	if _, err := LoadKeyWithOptions(keyPath, opts); err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	if len(*calls) != 0 {
+		t.Errorf("passphrase asked for %d times, want 0", len(*calls))
+	}
+
+	// An encrypted key written by EncryptKey is decrypted on load
+	keyPEM, err := EncryptKey(key, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("EncryptKey() error = %v", err)
+	}
+	encPath := filepath.Join(dir, "enc.key")
+	if err := os.WriteFile(encPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKeyWithOptions(encPath, opts)
+	if err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+	if !key.(ed25519.PrivateKey).Equal(loaded) {
+		t.Error("decrypted key does not match")
+	}
+}
+
+func TestKeyProtection_EmptyPassphrase(t *testing.T) {
+	opts, _ := protectKeys(true, "")
+
+	key, err := GenerateKey(DefaultKeyAlgorithm)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	if err := SaveKeyWithOptions(filepath.Join(t.TempDir(), "test.key"), key, opts); !errors.Is(err, ErrKeyEncrypted) {
+		t.Errorf("SaveKey() with an empty passphrase error = %v, want ErrKeyEncrypted", err)
+	}
+}
+
+func TestKeyProtection_ScryptParams(t *testing.T) {
+	opts, _ := protectKeys(true, "hunter2")
+	opts.Scrypt = ScryptParams{N: 1 << 10, R: 4, P: 2}
+
+	key, err := GenerateKey(DefaultKeyAlgorithm)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "test.key")
+	if err := SaveKeyWithOptions(keyPath, key, opts); err != nil {
+		t.Fatalf("SaveKey() error = %v", err)
+	}
+	if _, err := LoadKeyWithOptions(keyPath, opts); err != nil {
+		t.Fatalf("LoadKey() error = %v", err)
+	}
+
+	// Parameters beyond the bound are refused rather than written
+	opts.Scrypt = ScryptParams{N: 1 << 20, R: 16, P: 1}
+	if err := SaveKeyWithOptions(keyPath, key, opts); err == nil {
+		t.Error("SaveKey() with excessive scrypt cost succeeded")
+	}
+}
+
+func TestScryptParams_Bounds(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ScryptParams
+		ok     bool
+	}{
+		{"default", DefaultScrypt, true},
+		{"at bound", ScryptParams{N: 1 << 20, R: 8, P: 1}, true},
+		{"large N", ScryptParams{N: 1 << 21, R: 8, P: 1}, false},
+		{"large r", ScryptParams{N: 1 << 14, R: 1 << 20, P: 1}, false},
+		{"large p", ScryptParams{N: 1 << 14, R: 8, P: 1 << 20}, false},
+		{"overflowing r", ScryptParams{N: 1 << 14, R: 1 << 62, P: 1}, false},
+		{"N not a power of two", ScryptParams{N: 1000, R: 8, P: 1}, false},
+		{"zero p", ScryptParams{N: 1 << 14, R: 8, P: 0}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.check(); (err == nil) != tt.ok {
+				t.Errorf("check() error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+
+	// A key file asking for more is refused before any work is done
+	p := scryptParams{Salt: []byte("salt"), CostParameter: 1 << 14, BlockSize: 1 << 20, ParallelizationParameter: 1}
+	if _, err := p.deriveKey([]byte("hunter2")); err == nil {
+		t.Error("deriveKey() with excessive block size succeeded")
+	}
+}
+
+func TestDecryptKey_Malformed(t *testing.T) {
+	if _, err := decryptKey([]byte("not DER"), []byte("hunter2")); err == nil {
+		t.Error("decryptKey() of garbage succeeded")
+	}
+}
@@ -1,19 +1,69 @@
 package pki
 
 import (
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"strings"
 )
 
-const (
-	// TrustDomain is the SPIFFE trust domain for Tndrl.
-	TrustDomain = "tndrl"
-)
+// TrustDomain is a SPIFFE trust domain, the authority part of the identity
+// URIs in certificates. Nodes sharing a CA normally share a trust domain.
+type TrustDomain string
+
+// DefaultTrustDomain is the SPIFFE trust domain used unless configured.
+const DefaultTrustDomain TrustDomain = "tndrl"
+
+// ParseTrustDomain checks a trust domain name. SPIFFE allows lowercase
+// letters, digits, dots, dashes and underscores. An empty name selects
+// DefaultTrustDomain.
+func ParseTrustDomain(name string) (TrustDomain, error) {
+	if name == "" {
+		return DefaultTrustDomain, nil
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '_') {
+			return "", fmt.Errorf("invalid trust domain %q: character %q not allowed", name, r)
+		}
+	}
+	return TrustDomain(name), nil
+}
+
+// NodeIdentity returns the SPIFFE identity URI for a node with the given ID
+// in the trust domain.
+func (td TrustDomain) NodeIdentity(id string) string {
+	return fmt.Sprintf("spiffe://%s/node/%s", td, id)
+}
+
+// NodeID returns the ID of the node whose identity this is, or an error if
+// it is not a node identity in the trust domain.
+func (td TrustDomain) NodeID(identity string) (string, error) {
+	id, ok := strings.CutPrefix(identity, "spiffe://"+string(td)+"/node/")
+	if !ok || id == "" || id == "." || id == ".." || strings.ContainsAny(id, "/?#%") {
+		return "", fmt.Errorf("%s is not a node identity in trust domain %s", identity, td)
+	}
+	return id, nil
+}
 
-// NodeIdentity returns the SPIFFE identity URI for a node with the given ID.
+// NodeIdentity returns the SPIFFE identity URI for a node with the given ID
+// in DefaultTrustDomain.
 func NodeIdentity(id string) string {
-	return fmt.Sprintf("spiffe://%s/node/%s", TrustDomain, id)
+	return DefaultTrustDomain.NodeIdentity(id)
 }
 
 // UnitIdentity is deprecated, use NodeIdentity instead.
 // Kept for backwards compatibility during transition.
 var UnitIdentity = NodeIdentity
+
+// IdentityFromCert returns the SPIFFE identity URI in a certificate's URI SANs.
+func IdentityFromCert(cert *x509.Certificate) (string, error) {
+	if cert == nil {
+		return "", errors.New("no certificate")
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			return uri.String(), nil
+		}
+	}
+	return "", errors.New("certificate has no SPIFFE identity")
+}
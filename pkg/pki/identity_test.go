@@ -22,6 +22,25 @@ func TestNodeIdentity(t *testing.T) {
 	}
 }
 
+func TestTrustDomain(t *testing.T) {
+	td, err := ParseTrustDomain("example.org")
+	if err != nil {
+		t.Fatalf("ParseTrustDomain: %v", err)
+	}
+	if got, want := td.NodeIdentity("web"), "spiffe://example.org/node/web"; got != want {
+		t.Errorf("NodeIdentity = %q, want %q", got, want)
+	}
+
+	if td, err := ParseTrustDomain(""); err != nil || td != DefaultTrustDomain {
+		t.Errorf("ParseTrustDomain(\"\") = %q, %v, want default", td, err)
+	}
+	for _, bad := range []string{"Example.org", "a/b", "a:443"} {
+		if _, err := ParseTrustDomain(bad); err == nil {
+			t.Errorf("ParseTrustDomain(%q) expected error", bad)
+		}
+	}
+}
+
 func TestUnitIdentityAlias(t *testing.T) {
 	// UnitIdentity should be an alias for NodeIdentity
 	got := UnitIdentity("test")
@@ -30,3 +49,28 @@ func TestUnitIdentityAlias(t *testing.T) {
 		t.Errorf("UnitIdentity should equal NodeIdentity, got %q vs %q", got, want)
 	}
 }
+
+func TestIdentityFromCert(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+
+	cert, err := GenerateCert(ca, NodeIdentity("worker-1"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert: %v", err)
+	}
+
+	got, err := IdentityFromCert(cert.Cert)
+	if err != nil {
+		t.Fatalf("IdentityFromCert: %v", err)
+	}
+	if want := NodeIdentity("worker-1"); got != want {
+		t.Errorf("IdentityFromCert = %q, want %q", got, want)
+	}
+
+	// The CA certificate has no URI SANs
+	if _, err := IdentityFromCert(ca.Cert); err == nil {
+		t.Error("expected error for certificate without SPIFFE identity")
+	}
+}
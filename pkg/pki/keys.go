@@ -0,0 +1,199 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+// KeyAlgorithm names the kind of private key generated for a certificate.
+type KeyAlgorithm string
+
+// Supported key algorithms.
+const (
+	KeyECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyEd25519   KeyAlgorithm = "ed25519"
+)
+
+// DefaultKeyAlgorithm is used when no algorithm is chosen.
+const DefaultKeyAlgorithm = KeyECDSAP256
+
+// ParseKeyAlgorithm returns the key algorithm with the given name.
+// An empty name selects DefaultKeyAlgorithm.
+func ParseKeyAlgorithm(name string) (KeyAlgorithm, error) {
+	switch alg := KeyAlgorithm(name); alg {
+	case "":
+		return DefaultKeyAlgorithm, nil
+	case KeyECDSAP256, KeyECDSAP384, KeyEd25519:
+		return alg, nil
+	default:
+		return "", fmt.Errorf("unknown key algorithm %q (options: %s, %s, %s)", name, KeyECDSAP256, KeyECDSAP384, KeyEd25519)
+	}
+}
+
+// GenerateKey generates a private key using the algorithm.
+func GenerateKey(alg KeyAlgorithm) (crypto.Signer, error) {
+	alg, err := ParseKeyAlgorithm(string(alg))
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	switch alg {
+	case KeyECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		key, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	return key, nil
+}
+
+// KeyAlgorithmOf returns the algorithm of a public key, or an error if it is
+// not one Tndrl supports.
+func KeyAlgorithmOf(pub crypto.PublicKey) (KeyAlgorithm, error) {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return KeyECDSAP256, nil
+		case elliptic.P384():
+			return KeyECDSAP384, nil
+		}
+		return "", fmt.Errorf("unsupported ECDSA curve %s", pub.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return KeyEd25519, nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// LoadKey loads a private key written by SaveKey. The key must not be
+// encrypted; see LoadKeyWithOptions.
+func LoadKey(keyPath string) (crypto.Signer, error) {
+	return LoadKeyWithOptions(keyPath, KeyOptions{})
+}
+
+// LoadKeyWithOptions is LoadKey decrypting an encrypted key with the
+// passphrase from opts.
+func LoadKeyWithOptions(keyPath string, opts KeyOptions) (crypto.Signer, error) {
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	key, err := parseKey(keyPEM, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyPath, err)
+	}
+	return key, nil
+}
+
+// SaveKey writes a private key with 0600 permissions, unencrypted.
+func SaveKey(keyPath string, key crypto.Signer) error {
+	return SaveKeyWithOptions(keyPath, key, KeyOptions{})
+}
+
+// SaveKeyWithOptions is SaveKey encrypting the key if opts asks for it.
+func SaveKeyWithOptions(keyPath string, key crypto.Signer, opts KeyOptions) error {
+	keyPEM, err := encodeKey(key, opts)
+	if err != nil {
+		return err
+	}
+	return writeKey(keyPath, keyPEM)
+}
+
+// writeKey writes an encoded private key with 0600 permissions.
+func writeKey(keyPath string, keyPEM []byte) error {
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("write key: %w", err)
+	}
+	return nil
+}
+
+// encodeKey returns the PEM encoding of a private key. If opts asks for
+// encryption, it is an "ENCRYPTED PRIVATE KEY". Otherwise ECDSA keys keep the
+// SEC 1 "EC PRIVATE KEY" form used before other algorithms were supported,
+// and Ed25519 keys are PKCS #8.
+func encodeKey(key crypto.Signer, opts KeyOptions) ([]byte, error) {
+	if opts.Encrypt {
+		passphrase, err := opts.passphrase(true)
+		if err != nil {
+			return nil, err
+		}
+		params := opts.Scrypt
+		if params == (ScryptParams{}) {
+			params = DefaultScrypt
+		}
+		return EncryptKeyWithParams(key, passphrase, params)
+	}
+
+	if ecKey, ok := key.(*ecdsa.PrivateKey); ok {
+		der, err := x509.MarshalECPrivateKey(ecKey)
+		if err != nil {
+			return nil, fmt.Errorf("marshal key: %w", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("marshal key: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// parseKey parses a PEM private key written by encodeKey, decrypting it
+// with the passphrase from opts if it is encrypted.
+func parseKey(keyPEM []byte, opts KeyOptions) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("decode key PEM: no PEM data found")
+	}
+
+	if block.Type == "ENCRYPTED PRIVATE KEY" {
+		passphrase, err := opts.passphrase(false)
+		if err != nil {
+			return nil, err
+		}
+		der, err := decryptKey(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key: %w", err)
+		}
+		return key, nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("parse key: unsupported key type %T", key)
+		}
+		if _, err := KeyAlgorithmOf(signer.Public()); err != nil {
+			return nil, fmt.Errorf("parse key: %w", err)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("parse key: unexpected PEM type %q", block.Type)
+	}
+}
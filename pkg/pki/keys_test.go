@@ -0,0 +1,70 @@
+package pki
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseKeyAlgorithm(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    KeyAlgorithm
+		wantErr bool
+	}{
+		{"", DefaultKeyAlgorithm, false},
+		{"ecdsa-p256", KeyECDSAP256, false},
+		{"ecdsa-p384", KeyECDSAP384, false},
+		{"ed25519", KeyEd25519, false},
+		{"rsa-2048", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseKeyAlgorithm(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKeyAlgorithm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseKeyAlgorithm() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateCert_KeyAlgorithms(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	for _, alg := range []KeyAlgorithm{KeyECDSAP256, KeyECDSAP384, KeyEd25519} {
+		t.Run(string(alg), func(t *testing.T) {
+			dir := t.TempDir()
+			certPath := filepath.Join(dir, "test.crt")
+			keyPath := filepath.Join(dir, "test.key")
+
+			cert, err := GenerateCertWithOptions(ca, "spiffe://tndrl/test", true, true, CertOptions{KeyAlgorithm: alg})
+			if err != nil {
+				t.Fatalf("GenerateCertWithOptions() error = %v", err)
+			}
+			if got, err := KeyAlgorithmOf(cert.Cert.PublicKey); err != nil || got != alg {
+				t.Errorf("KeyAlgorithmOf() = %q, %v, want %q", got, err, alg)
+			}
+
+			if err := cert.Save(certPath, keyPath); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+			loaded, err := LoadCert(certPath, keyPath)
+			if err != nil {
+				t.Fatalf("LoadCert() error = %v", err)
+			}
+			if got, _ := KeyAlgorithmOf(loaded.Key.Public()); got != alg {
+				t.Errorf("loaded key algorithm = %q, want %q", got, alg)
+			}
+
+			if _, err := loaded.TLSCertificate(); err != nil {
+				t.Errorf("TLSCertificate() error = %v", err)
+			}
+		})
+	}
+}
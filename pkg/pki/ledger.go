@@ -0,0 +1,113 @@
+package pki
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LedgerFile is the name of the issuance ledger, stored next to ca.crt.
+const LedgerFile = "issued.jsonl"
+
+// ledgerEntry is one line of the ledger. Serial, identity and expiry are
+// written out for reading the file by hand; the certificate is the record.
+type ledgerEntry struct {
+	Issued      time.Time `json:"issued"`
+	Serial      string    `json:"serial"`
+	Identity    string    `json:"identity,omitempty"`
+	NotAfter    time.Time `json:"notAfter"`
+	Certificate []byte    `json:"certificate"`
+}
+
+// Ledger records every certificate a CA issues, so the CA host can list
+// them later. It is a file of JSON lines that is only appended to, so a
+// running server and the CLI can record issuances at the same time.
+type Ledger struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewLedger returns the ledger kept in the file at path.
+// The file is created when the first certificate is recorded.
+func NewLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Path returns the ledger file's path.
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Record appends an issued certificate to the ledger.
+func (l *Ledger) Record(cert *x509.Certificate) error {
+	identity, _ := IdentityFromCert(cert)
+	line, err := json.Marshal(ledgerEntry{
+		Issued:      time.Now().UTC(),
+		Serial:      cert.SerialNumber.Text(16),
+		Identity:    identity,
+		NotAfter:    cert.NotAfter.UTC(),
+		Certificate: cert.Raw,
+	})
+	if err != nil {
+		return fmt.Errorf("encode ledger entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("open ledger: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("write ledger: %w", err)
+	}
+	return nil
+}
+
+// Certificates returns the recorded certificates, oldest first. A missing
+// ledger holds no certificates.
+func (l *Ledger) Certificates() ([]*x509.Certificate, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read ledger: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry ledgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", l.path, n, err)
+		}
+		cert, err := x509.ParseCertificate(entry.Certificate)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: parse certificate: %w", l.path, n, err)
+		}
+		certs = append(certs, cert)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ledger: %w", err)
+	}
+	return certs, nil
+}
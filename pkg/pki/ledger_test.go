@@ -0,0 +1,63 @@
+package pki
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLedger(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	ledger := NewLedger(filepath.Join(dir, LedgerFile))
+	if certs, err := ledger.Certificates(); err != nil || len(certs) != 0 {
+		t.Fatalf("Certificates() of a missing ledger = %d, %v, want none", len(certs), err)
+	}
+
+	// Only a CA loaded with its key records issuances
+	loaded, err := LoadCAFromDir(dir)
+	if err != nil {
+		t.Fatalf("LoadCAFromDir() error = %v", err)
+	}
+	web, err := GenerateCert(loaded, NodeIdentity("web"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	renewed, err := loaded.Reissue(web.Cert)
+	if err != nil {
+		t.Fatalf("Reissue() error = %v", err)
+	}
+
+	certs, err := ledger.Certificates()
+	if err != nil {
+		t.Fatalf("Certificates() error = %v", err)
+	}
+	if len(certs) != 2 || !certs[0].Equal(web.Cert) || !certs[1].Equal(renewed.Cert) {
+		t.Fatalf("Certificates() = %d certs, want the issued and the renewed certificate", len(certs))
+	}
+
+	info, err := os.Stat(ledger.Path())
+	if err != nil {
+		t.Fatalf("stat ledger: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("ledger permissions = %o, want 600", perm)
+	}
+}
+
+func TestLedger_Corrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), LedgerFile)
+	if err := os.WriteFile(path, []byte("{not json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLedger(path).Certificates(); err == nil {
+		t.Error("Certificates() of a corrupt ledger expected error")
+	}
+}
@@ -1,11 +1,16 @@
 package pki
 
 import (
+	"os"
 	"testing"
 
 	"go.uber.org/goleak"
 )
 
 func TestMain(m *testing.M) {
+	// Run as the stand-in signing plugin started by TestExternalSigner_Plugin
+	if keyPath := os.Getenv(testSignerKeyEnv); keyPath != "" {
+		os.Exit(runTestSigner(keyPath))
+	}
 	goleak.VerifyTestMain(m)
 }
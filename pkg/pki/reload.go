@@ -0,0 +1,227 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often a Reloader checks its files by default.
+const DefaultReloadInterval = time.Minute
+
+// ReloaderOptions configures a Reloader.
+type ReloaderOptions struct {
+	// Interval is the time between checks of the certificate files.
+	// Defaults to DefaultReloadInterval.
+	Interval time.Duration
+
+	// RenewBefore renews the certificate when it expires within this window.
+	// Zero disables renewal.
+	RenewBefore time.Duration
+
+	// Renew issues a replacement for a certificate about to expire, for
+	// example CA.Reissue. Without it, a certificate within RenewBefore is
+	// only warned about, since it has to be renewed where the CA key is and
+	// is picked up once its file is replaced.
+	Renew func(old *x509.Certificate) (*Cert, error)
+
+	// Keys protects the key when it is loaded and when a renewed one is
+	// saved.
+	Keys KeyOptions
+
+	// CRL, if set, is re-read on each check if its file changed, so
+	// revocations are picked up without a restart.
+	CRL *CRL
+}
+
+// Reloader serves a certificate loaded from files. It reloads the files when
+// their content changes and, if configured, renews the certificate before it
+// expires, so TLS configs built on it pick up a new certificate without a
+// restart. It can also keep a CRL up to date with its file.
+//
+// Checks run in a background goroutine once per interval, so TLS handshakes
+// only read the current certificate and revocation list. Stop ends the checks.
+type Reloader struct {
+	certPath string
+	keyPath  string
+	opts     ReloaderOptions
+
+	mu      sync.RWMutex
+	cert    *Cert
+	tlsCert *tls.Certificate
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewReloader loads the certificate and key and returns a reloader for them.
+// A certificate already within the renewal window is renewed immediately.
+// Callers must call Stop when done with it.
+func NewReloader(certPath, keyPath string, opts ReloaderOptions) (*Reloader, error) {
+	if opts.Interval == 0 {
+		opts.Interval = DefaultReloadInterval
+	}
+
+	r := &Reloader{
+		certPath: certPath,
+		keyPath:  keyPath,
+		opts:     opts,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+	r.renewIfDue()
+	go r.run()
+	return r, nil
+}
+
+// Stop ends the background checks and waits for a check in progress. The
+// last certificate is still served.
+func (r *Reloader) Stop() {
+	select {
+	case <-r.stop:
+	default:
+		close(r.stop)
+	}
+	<-r.done
+}
+
+// Certificate returns the current certificate.
+func (r *Reloader) Certificate() *Cert {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+// current returns the current TLS certificate.
+func (r *Reloader) current() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tlsCert
+}
+
+// run checks the files once per interval until Stop is called.
+func (r *Reloader) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.check()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// check reloads changed files and renews an expiring certificate. Failures
+// are logged and the current certificate kept.
+func (r *Reloader) check() {
+	if r.opts.CRL != nil {
+		r.opts.CRL.refresh()
+	}
+	if changed, err := r.load(); err != nil {
+		slog.Warn("reload certificate", "path", r.certPath, "err", err)
+	} else if changed {
+		slog.Info("certificate reloaded", "path", r.certPath, "expires", r.Certificate().Cert.NotAfter)
+	}
+	r.renewIfDue()
+}
+
+// renewIfDue renews the certificate if it expires within the renewal
+// window, or warns that it must be renewed elsewhere.
+func (r *Reloader) renewIfDue() {
+	expires := r.Certificate().Cert.NotAfter
+	if r.opts.RenewBefore <= 0 || time.Until(expires) >= r.opts.RenewBefore {
+		return
+	}
+	if r.opts.Renew == nil {
+		slog.Warn("certificate expires soon and cannot be renewed without the CA key; renew it on the CA host",
+			"path", r.certPath, "expires", expires)
+		return
+	}
+	if err := r.renew(); err != nil {
+		slog.Warn("renew certificate", "path", r.certPath, "expires", expires, "err", err)
+	}
+}
+
+// renew issues a new certificate, saves it over the old files and serves it.
+func (r *Reloader) renew() error {
+	cert, err := r.opts.Renew(r.Certificate().Cert)
+	if err != nil {
+		return err
+	}
+	if err := cert.SaveWithOptions(r.certPath, r.keyPath, r.opts.Keys); err != nil {
+		return err
+	}
+	if _, err := r.load(); err != nil {
+		return err
+	}
+	slog.Info("certificate renewed", "path", r.certPath, "expires", cert.Cert.NotAfter)
+	return nil
+}
+
+// load reads the certificate files and, if the certificate differs from the
+// one being served, serves it instead. The files are compared by content
+// rather than modification time, which may not change between quick
+// successive writes. Only the goroutine checking the files calls it, or
+// NewReloader before starting it.
+func (r *Reloader) load() (bool, error) {
+	cert, err := LoadCertWithOptions(r.certPath, r.keyPath, r.opts.Keys)
+	if err != nil {
+		return false, err
+	}
+	if current := r.Certificate(); current != nil && bytes.Equal(cert.Cert.Raw, current.Cert.Raw) {
+		return false, nil
+	}
+	tlsCert, err := cert.TLSCertificate()
+	if err != nil {
+		return false, fmt.Errorf("create TLS certificate: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = cert
+	r.tlsCert = &tlsCert
+	return true, nil
+}
+
+// Reissue issues a new certificate with the same identity, roles, SANs and
+// key algorithm as an existing one. It is suitable as a
+// ReloaderOptions.Renew function.
+func (ca *CA) Reissue(old *x509.Certificate) (*Cert, error) {
+	identity, err := IdentityFromCert(old)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := KeyAlgorithmOf(old.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	isServer := slices.Contains(old.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	isClient := slices.Contains(old.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	return GenerateCertWithOptions(ca, identity, isServer, isClient, CertOptions{
+		DNSNames:     old.DNSNames,
+		IPAddresses:  old.IPAddresses,
+		KeyAlgorithm: alg,
+	})
+}
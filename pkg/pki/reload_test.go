@@ -0,0 +1,242 @@
+package pki
+
+import (
+	"crypto/tls"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// saveTestCert issues a certificate for the identity and saves it in dir.
+func saveTestCert(t *testing.T, ca *CA, dir, identity string) (*Cert, string, string) {
+	t.Helper()
+
+	cert, err := GenerateCert(ca, identity, true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	certPath := filepath.Join(dir, "tndrl.crt")
+	keyPath := filepath.Join(dir, "tndrl.key")
+	if err := cert.Save(certPath, keyPath); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return cert, certPath, keyPath
+}
+
+// waitForSerial waits for the reloader to serve the certificate with the
+// given serial.
+func waitForSerial(t *testing.T, r *Reloader, want *big.Int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Certificate().Cert.SerialNumber.Cmp(want) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("serial = %x, want %x", r.Certificate().Cert.SerialNumber, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	first, certPath, keyPath := saveTestCert(t, ca, dir, NodeIdentity("a"))
+
+	r, err := NewReloader(certPath, keyPath, ReloaderOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	defer r.Stop()
+	if got := r.Certificate().Cert.SerialNumber; got.Cmp(first.Cert.SerialNumber) != 0 {
+		t.Fatalf("serial = %x, want %x", got, first.Cert.SerialNumber)
+	}
+
+	second, _, _ := saveTestCert(t, ca, dir, NodeIdentity("a"))
+	waitForSerial(t, r, second.Cert.SerialNumber)
+}
+
+func TestReloader_RefreshesCRL(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	cert, certPath, keyPath := saveTestCert(t, ca, dir, NodeIdentity("a"))
+
+	loaded, err := LoadCACertificate(filepath.Join(dir, "ca.crt"))
+	if err != nil {
+		t.Fatalf("LoadCACertificate() error = %v", err)
+	}
+	r, err := NewReloader(certPath, keyPath, ReloaderOptions{Interval: time.Millisecond, CRL: loaded.CRL})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	defer r.Stop()
+
+	ca.CRL.RevokeSerial(cert.Cert.SerialNumber)
+	if err := ca.SaveCRL(dir); err != nil {
+		t.Fatalf("SaveCRL() error = %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !loaded.CRL.IsRevoked(cert.Cert) {
+		if time.Now().After(deadline) {
+			t.Fatal("reloader did not pick up the saved CRL")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReloader_Stop(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	first, certPath, keyPath := saveTestCert(t, ca, dir, NodeIdentity("a"))
+
+	r, err := NewReloader(certPath, keyPath, ReloaderOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	r.Stop()
+	r.Stop() // idempotent
+
+	// The files are no longer checked; the last certificate is still served
+	saveTestCert(t, ca, dir, NodeIdentity("a"))
+	time.Sleep(20 * time.Millisecond)
+	if got := r.Certificate().Cert.SerialNumber; got.Cmp(first.Cert.SerialNumber) != 0 {
+		t.Errorf("serial after Stop = %x, want %x", got, first.Cert.SerialNumber)
+	}
+	if cert, err := r.GetCertificate(nil); err != nil || cert == nil {
+		t.Errorf("GetCertificate() after Stop = %v, %v", cert, err)
+	}
+}
+
+func TestReloader_Renews(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	old, certPath, keyPath := saveTestCert(t, ca, dir, NodeIdentity("a"))
+
+	// A window longer than the certificate's lifetime makes it due at once
+	r, err := NewReloader(certPath, keyPath, ReloaderOptions{
+		RenewBefore: 2 * 365 * 24 * time.Hour,
+		Renew:       ca.Reissue,
+	})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	defer r.Stop()
+
+	renewed := r.Certificate()
+	if renewed.Cert.SerialNumber.Cmp(old.Cert.SerialNumber) == 0 {
+		t.Fatal("certificate was not renewed")
+	}
+	identity, err := IdentityFromCert(renewed.Cert)
+	if err != nil || identity != NodeIdentity("a") {
+		t.Errorf("renewed identity = %q (%v), want %q", identity, err, NodeIdentity("a"))
+	}
+	if len(renewed.Cert.ExtKeyUsage) != 2 {
+		t.Errorf("renewed ExtKeyUsage = %v, want server and client", renewed.Cert.ExtKeyUsage)
+	}
+
+	// The renewed certificate was written over the old files
+	onDisk, err := LoadCertificate(certPath)
+	if err != nil {
+		t.Fatalf("LoadCertificate() error = %v", err)
+	}
+	if onDisk.SerialNumber.Cmp(renewed.Cert.SerialNumber) != 0 {
+		t.Errorf("serial on disk = %x, want %x", onDisk.SerialNumber, renewed.Cert.SerialNumber)
+	}
+}
+
+func TestReloader_RenewWithoutFunc(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	old, certPath, keyPath := saveTestCert(t, ca, dir, NodeIdentity("a"))
+
+	// Without the CA key the certificate is kept, and a replacement issued
+	// on the CA host is picked up
+	r, err := NewReloader(certPath, keyPath, ReloaderOptions{
+		Interval:    time.Millisecond,
+		RenewBefore: 2 * 365 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	defer r.Stop()
+	if got := r.Certificate().Cert.SerialNumber; got.Cmp(old.Cert.SerialNumber) != 0 {
+		t.Fatalf("serial = %x, want %x", got, old.Cert.SerialNumber)
+	}
+
+	renewed, _, _ := saveTestCert(t, ca, dir, NodeIdentity("a"))
+	waitForSerial(t, r, renewed.Cert.SerialNumber)
+}
+
+func TestReloadingServerTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	_, certPath, keyPath := saveTestCert(t, ca, dir, NodeIdentity("server"))
+	clientCert, err := GenerateCert(ca, NodeIdentity("client"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	r, err := NewReloader(certPath, keyPath, ReloaderOptions{Interval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewReloader() error = %v", err)
+	}
+	defer r.Stop()
+	clientConfig, err := ClientTLSConfig(clientCert, ca, "localhost")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig() error = %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", ReloadingServerTLSConfig(r, ca))
+	if err != nil {
+		t.Fatalf("tls.Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	// Each handshake serves the certificate last loaded from disk
+	for range 2 {
+		want, _, _ := saveTestCert(t, ca, dir, NodeIdentity("server"))
+		waitForSerial(t, r, want.Cert.SerialNumber)
+
+		conn, err := tls.Dial("tcp", listener.Addr().String(), clientConfig)
+		if err != nil {
+			t.Fatalf("tls.Dial() error = %v", err)
+		}
+		got := conn.ConnectionState().PeerCertificates[0].SerialNumber
+		conn.Close()
+
+		if got.Cmp(want.Cert.SerialNumber) != 0 {
+			t.Errorf("served serial = %x, want %x", got, want.Cert.SerialNumber)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package pki
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// ExternalSigner is a crypto.Signer for a key held by another process: a
+// signing daemon listening on a Unix socket, or a plugin process (such as a
+// wrapper around a PKCS #11 token) that is spoken to over its stdin and
+// stdout. Passed to LoadCAWithSigner, it keeps the CA key out of this
+// process.
+//
+// Requests and responses are single lines of JSON. A request is either
+// {"op":"public"}, answered with {"publicKey":<PKIX DER>}, or
+// {"op":"sign","digest":<bytes>,"hash":"SHA-256"}, answered with
+// {"signature":<bytes>}. Bytes are base64. The hash is empty for Ed25519
+// keys, whose digest is the whole message. A failed request is answered
+// with {"error":<message>}. ServeSigner and ServeSignerConn implement the
+// other side.
+type ExternalSigner struct {
+	mu sync.Mutex
+
+	// socket is the daemon's socket, dialed for each request, or empty for
+	// a plugin process
+	socket string
+
+	// cmd, stdin and stdout are the plugin process and its pipes
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+
+	pub crypto.PublicKey
+}
+
+type signerRequest struct {
+	Op     string `json:"op"`
+	Digest []byte `json:"digest,omitempty"`
+	Hash   string `json:"hash,omitempty"`
+}
+
+type signerResponse struct {
+	PublicKey []byte `json:"publicKey,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// signerHashes are the hashes a digest may be signed with.
+var signerHashes = map[string]crypto.Hash{
+	"":        0,
+	"SHA-256": crypto.SHA256,
+	"SHA-384": crypto.SHA384,
+	"SHA-512": crypto.SHA512,
+}
+
+// OpenSigner connects to the external signer at addr: "unix:<path>" for a
+// daemon listening on a Unix socket, or "exec:<command> [<arg>...]" for a
+// plugin process that is started now and stopped by Close.
+func OpenSigner(addr string) (*ExternalSigner, error) {
+	kind, arg, _ := strings.Cut(addr, ":")
+	switch kind {
+	case "unix":
+		if arg == "" {
+			return nil, fmt.Errorf("signer %q: socket path required", addr)
+		}
+		return DialSigner(arg)
+	case "exec":
+		args := strings.Fields(arg)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("signer %q: command required", addr)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		return StartSigner(cmd)
+	default:
+		return nil, fmt.Errorf("signer %q: want unix:<path> or exec:<command>", addr)
+	}
+}
+
+// DialSigner connects to a signing daemon listening on the Unix socket at
+// path. Each request is made on a new connection, so the daemon may be
+// restarted while the signer is in use.
+func DialSigner(path string) (*ExternalSigner, error) {
+	s := &ExternalSigner{socket: path}
+	if err := s.loadPublic(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// StartSigner starts a signing plugin process and speaks to it over its
+// stdin and stdout, which must not be set. The plugin should exit when its
+// stdin is closed.
+func StartSigner(cmd *exec.Cmd) (*ExternalSigner, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("start signer: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("start signer: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start signer: %w", err)
+	}
+
+	s := &ExternalSigner{cmd: cmd, stdin: stdin, stdout: bufio.NewReader(stdout)}
+	if err := s.loadPublic(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// loadPublic asks the signer for its public key.
+func (s *ExternalSigner) loadPublic() error {
+	resp, err := s.call(signerRequest{Op: "public"})
+	if err != nil {
+		return err
+	}
+	pub, err := x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return fmt.Errorf("signer public key: %w", err)
+	}
+	if _, err := KeyAlgorithmOf(pub); err != nil {
+		return fmt.Errorf("signer public key: %w", err)
+	}
+	s.pub = pub
+	return nil
+}
+
+// Public implements crypto.Signer.
+func (s *ExternalSigner) Public() crypto.PublicKey {
+	return s.pub
+}
+
+// Sign implements crypto.Signer. The signer's own randomness is used.
+func (s *ExternalSigner) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	name := ""
+	if hash != 0 {
+		name = hash.String()
+	}
+	if h, ok := signerHashes[name]; !ok || h != hash {
+		return nil, fmt.Errorf("signer: unsupported hash %s", hash)
+	}
+
+	resp, err := s.call(signerRequest{Op: "sign", Digest: digest, Hash: name})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Signature, nil
+}
+
+// Close stops a plugin process. It does nothing for a daemon.
+func (s *ExternalSigner) Close() error {
+	if s.cmd == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stdin.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("signer exited: %w", err)
+	}
+	return nil
+}
+
+// call sends a request and reads the response.
+func (s *ExternalSigner) call(req signerRequest) (*signerResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, r := s.stdin, s.stdout
+	if s.socket != "" {
+		conn, err := net.Dial("unix", s.socket)
+		if err != nil {
+			return nil, fmt.Errorf("connect to signer: %w", err)
+		}
+		defer conn.Close()
+		w, r = conn, bufio.NewReader(conn)
+	}
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("signer request: %w", err)
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("signer request: %w", err)
+	}
+	line, err = r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("signer response: %w", err)
+	}
+
+	var resp signerResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return nil, fmt.Errorf("signer response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("signer: %s", resp.Error)
+	}
+	return &resp, nil
+}
+
+// ServeSigner answers the requests of ExternalSigner clients connecting to
+// l with key, until l is closed. It then closes open connections and
+// returns once their requests are answered.
+func ServeSigner(l net.Listener, key crypto.Signer) error {
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+		wg    sync.WaitGroup
+	)
+	defer func() {
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ServeSignerConn(conn, conn, key); err != nil {
+				slog.Debug("signer connection failed", "err", err)
+			}
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// ServeSignerConn answers ExternalSigner requests read from r with key,
+// writing the responses to w, until r is at EOF. A plugin process serves
+// its stdin and stdout.
+func ServeSignerConn(r io.Reader, w io.Writer, key crypto.Signer) error {
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return fmt.Errorf("marshal public key: %w", err)
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var req signerRequest
+		var resp signerResponse
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = "malformed request: " + err.Error()
+		} else {
+			switch req.Op {
+			case "public":
+				resp.PublicKey = pub
+			case "sign":
+				resp.Signature, err = signDigest(key, req)
+				if err != nil {
+					resp.Error = err.Error()
+				}
+			default:
+				resp.Error = fmt.Sprintf("unknown op %q", req.Op)
+			}
+		}
+
+		line, err := json.Marshal(resp)
+		if err != nil {
+			return fmt.Errorf("encode response: %w", err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write response: %w", err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read request: %w", err)
+	}
+	return nil
+}
+
+// signDigest signs the digest of a sign request.
+func signDigest(key crypto.Signer, req signerRequest) ([]byte, error) {
+	hash, ok := signerHashes[req.Hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash %q", req.Hash)
+	}
+	if hash != 0 && len(req.Digest) != hash.Size() {
+		return nil, fmt.Errorf("digest is %d bytes, want %d for %s", len(req.Digest), hash.Size(), req.Hash)
+	}
+	slog.Debug("signing", "hash", req.Hash, "bytes", len(req.Digest))
+	return key.Sign(rand.Reader, req.Digest, hash)
+}
@@ -0,0 +1,192 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// testSignerKeyEnv makes the test binary a signing plugin for the key at
+// the path it names.
+const testSignerKeyEnv = "TNDRL_TEST_SIGNER_KEY"
+
+func runTestSigner(keyPath string) int {
+	key, err := LoadKey(keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := ServeSignerConn(os.Stdin, os.Stdout, key); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// serveSigner serves key on a Unix socket until the test ends and returns
+// the socket's path.
+func serveSigner(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- ServeSigner(l, key) }()
+	t.Cleanup(func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("ServeSigner() error = %v", err)
+		}
+	})
+	return path
+}
+
+// checkSigningCA checks that a CA signs certificates, intermediates and
+// revocation lists that verify against its certificate.
+func checkSigningCA(t *testing.T, ca *CA) {
+	t.Helper()
+
+	cert, err := GenerateCert(ca, NodeIdentity("web"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+	if err := cert.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("certificate signature: %v", err)
+	}
+
+	inter, err := GenerateIntermediateCA(ca, "prod")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+	if err := inter.Cert.CheckSignatureFrom(ca.Cert); err != nil {
+		t.Errorf("intermediate signature: %v", err)
+	}
+
+	ca.CRL.RevokeSerial(cert.Cert.SerialNumber)
+	dir := t.TempDir()
+	if err := ca.SaveCRL(dir); err != nil {
+		t.Fatalf("SaveCRL() error = %v", err)
+	}
+	if _, err := LoadCRL(filepath.Join(dir, CRLFile), ca.Cert); err != nil {
+		t.Errorf("LoadCRL() error = %v", err)
+	}
+}
+
+func TestExternalSigner_Socket(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	signer, err := DialSigner(serveSigner(t, ca.Key))
+	if err != nil {
+		t.Fatalf("DialSigner() error = %v", err)
+	}
+	loaded, err := LoadCAWithSigner(filepath.Join(dir, "ca.crt"), signer)
+	if err != nil {
+		t.Fatalf("LoadCAWithSigner() error = %v", err)
+	}
+	checkSigningCA(t, loaded)
+
+	if err := loaded.Save(t.TempDir()); err == nil {
+		t.Error("Save() of a CA with an external signer succeeded")
+	}
+
+	// The signer must hold the CA's key
+	other, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	wrong, err := DialSigner(serveSigner(t, other.Key))
+	if err != nil {
+		t.Fatalf("DialSigner() error = %v", err)
+	}
+	if _, err := LoadCAWithSigner(filepath.Join(dir, "ca.crt"), wrong); err == nil {
+		t.Error("LoadCAWithSigner() with another key succeeded")
+	}
+}
+
+func TestExternalSigner_Plugin(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	if err := ca.Save(dir); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), testSignerKeyEnv+"="+filepath.Join(dir, "ca.key"))
+	cmd.Stderr = os.Stderr
+	signer, err := StartSigner(cmd)
+	if err != nil {
+		t.Fatalf("StartSigner() error = %v", err)
+	}
+	defer func() {
+		if err := signer.Close(); err != nil {
+			t.Errorf("Close() error = %v", err)
+		}
+	}()
+
+	loaded, err := LoadCAWithSigner(filepath.Join(dir, "ca.crt"), signer)
+	if err != nil {
+		t.Fatalf("LoadCAWithSigner() error = %v", err)
+	}
+	checkSigningCA(t, loaded)
+}
+
+func TestExternalSigner_Ed25519(t *testing.T) {
+	key, err := GenerateKey(KeyEd25519)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	signer, err := DialSigner(serveSigner(t, key))
+	if err != nil {
+		t.Fatalf("DialSigner() error = %v", err)
+	}
+
+	msg := []byte("to be signed")
+	sig, err := signer.Sign(nil, msg, crypto.Hash(0))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if !ed25519.Verify(signer.Public().(ed25519.PublicKey), msg, sig) {
+		t.Error("signature does not verify")
+	}
+
+	// Digests of the wrong size and unsupported hashes are refused
+	digest := sha256.Sum256(msg)
+	if _, err := signer.Sign(nil, digest[:16], crypto.SHA256); err == nil {
+		t.Error("Sign() of a short digest succeeded")
+	}
+	if _, err := signer.Sign(nil, digest[:], crypto.SHA1); err == nil {
+		t.Error("Sign() with SHA-1 succeeded")
+	}
+}
+
+func TestOpenSigner(t *testing.T) {
+	for _, addr := range []string{"", "unix:", "exec:", "tcp:localhost:1"} {
+		if _, err := OpenSigner(addr); err == nil {
+			t.Errorf("OpenSigner(%q) succeeded", addr)
+		}
+	}
+
+	var opErr *net.OpError
+	if _, err := OpenSigner("unix:" + filepath.Join(t.TempDir(), "missing.sock")); !errors.As(err, &opErr) {
+		t.Errorf("OpenSigner() of a missing socket error = %v, want a dial error", err)
+	}
+}
@@ -1,21 +1,32 @@
 package pki
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 )
 
 // ServerTLSConfig creates a TLS config for a server that requires client certificates.
+// Clients whose certificate is in the CA's revocation list are rejected.
+// The server's chain is sent up to and including the root CA certificate,
+// so that a node enrolling with a join token can check the root against the
+// pinned fingerprint. Peers trust the root and verify through any
+// intermediates.
 func ServerTLSConfig(cert *Cert, ca *CA) (*tls.Config, error) {
 	tlsCert, err := cert.TLSCertificate()
 	if err != nil {
 		return nil, fmt.Errorf("create TLS certificate: %w", err)
 	}
+	tlsCert.Certificate = ca.withRoot(tlsCert.Certificate)
 
-	caPool := x509.NewCertPool()
-	caPool.AddCert(ca.Cert)
+	caPool := ca.pool()
 
 	return &tls.Config{
 		Certificates: []tls.Certificate{tlsCert},
@@ -23,27 +34,281 @@ func ServerTLSConfig(cert *Cert, ca *CA) (*tls.Config, error) {
 		ClientCAs:    caPool,
 		NextProtos:   []string{"tndrl"},
 		MinVersion:   tls.VersionTLS13,
+
+		VerifyPeerCertificate: ca.verifyClient,
 	}, nil
 }
 
+// verifyClient checks a client certificate verified by crypto/tls against
+// the revocation list and, if the CA has a bundle, the client's trust domain.
+func (ca *CA) verifyClient(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	if err := ca.verifyNotRevoked(rawCerts, chains); err != nil {
+		return err
+	}
+	return ca.verifyTrustDomain(chains, nil)
+}
+
+// ServerVerification selects what a client checks about the server it
+// connects to, besides its certificate chaining to a trusted root and not
+// being revoked.
+type ServerVerification struct {
+	// Identity, if set, is the SPIFFE ID the server certificate must carry.
+	Identity string
+
+	// TrustDomains lists foreign trust domains the server may be in. If the
+	// CA has a bundle, the server must otherwise be in the local trust
+	// domain or, when Identity is set, in Identity's.
+	TrustDomains []TrustDomain
+
+	// ServerName, if set, must match a DNS name or IP address in the server
+	// certificate. It may be left empty when Identity is set, for servers
+	// whose addresses change.
+	ServerName string
+}
+
+// configure sets up verification of the server in a client TLS config.
+func (v ServerVerification) configure(config *tls.Config, ca *CA) {
+	config.RootCAs = ca.pool()
+	config.ServerName = v.ServerName
+	if v.ServerName == "" {
+		// crypto/tls only verifies chains together with a host name, so the
+		// chain is verified in VerifyPeerCertificate instead
+		config.InsecureSkipVerify = true
+	}
+	config.VerifyPeerCertificate = func(rawCerts [][]byte, chains [][]*x509.Certificate) error {
+		return v.verify(ca, rawCerts, chains)
+	}
+}
+
+// verify checks a server certificate. chains are those verified by
+// crypto/tls, which are empty if it skipped verification.
+func (v ServerVerification) verify(ca *CA, rawCerts [][]byte, chains [][]*x509.Certificate) error {
+	if v.ServerName == "" {
+		var err error
+		chains, err = ca.verifyChain(rawCerts, x509.ExtKeyUsageServerAuth)
+		if err != nil {
+			return err
+		}
+	}
+	if err := ca.verifyNotRevoked(rawCerts, chains); err != nil {
+		return err
+	}
+	if err := ca.verifyTrustDomain(chains, v.trustDomains(ca)); err != nil {
+		return err
+	}
+
+	if v.Identity != "" {
+		identity, err := IdentityFromCert(chains[0][0])
+		if err != nil {
+			return fmt.Errorf("server certificate: %w", err)
+		}
+		if identity != v.Identity {
+			return fmt.Errorf("server identity is %s, expected %s", identity, v.Identity)
+		}
+	}
+	return nil
+}
+
+// trustDomains returns the trust domains the server may be in, or nil if
+// the CA has no bundle.
+func (v ServerVerification) trustDomains(ca *CA) []TrustDomain {
+	if ca.Bundle == nil {
+		return nil
+	}
+	allowed := append([]TrustDomain{ca.Bundle.TrustDomain}, v.TrustDomains...)
+	if td, err := TrustDomainOf(v.Identity); err == nil {
+		allowed = append(allowed, td)
+	}
+	return allowed
+}
+
+// VerifyCertificate checks a certificate, followed by its chain, the way a
+// peer would in a handshake: it must chain to a trusted root, not be revoked
+// and, if the CA has a bundle, be issued by a root trusted for its trust
+// domain. Its key usages are not checked.
+func (ca *CA) VerifyCertificate(certs []*x509.Certificate) error {
+	rawCerts := make([][]byte, len(certs))
+	for i, cert := range certs {
+		rawCerts[i] = cert.Raw
+	}
+	chains, err := ca.verifyChain(rawCerts, x509.ExtKeyUsageAny)
+	if err != nil {
+		return err
+	}
+	if err := ca.verifyNotRevoked(rawCerts, chains); err != nil {
+		return err
+	}
+	return ca.verifyTrustDomain(chains, nil)
+}
+
+// verifyChain verifies a presented certificate chain against the trusted roots
+// for the given key usage.
+func (ca *CA) verifyChain(rawCerts [][]byte, usage x509.ExtKeyUsage) ([][]*x509.Certificate, error) {
+	if len(rawCerts) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         ca.pool(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verify certificate: %w", err)
+	}
+	return chains, nil
+}
+
 // ClientTLSConfig creates a TLS config for a client with its own certificate.
 // serverName should match the server certificate's DNS name (e.g., "localhost").
+// Servers whose certificate is in the CA's revocation list are rejected.
 func ClientTLSConfig(cert *Cert, ca *CA, serverName string) (*tls.Config, error) {
+	return ClientTLSConfigFor(cert, ca, ServerVerification{ServerName: serverName})
+}
+
+// ClientTLSConfigFor is like ClientTLSConfig, verifying the server's SPIFFE
+// ID, host name or both as selected by v.
+func ClientTLSConfigFor(cert *Cert, ca *CA, v ServerVerification) (*tls.Config, error) {
 	tlsCert, err := cert.TLSCertificate()
 	if err != nil {
 		return nil, fmt.Errorf("create TLS certificate: %w", err)
 	}
 
-	caPool := x509.NewCertPool()
-	caPool.AddCert(ca.Cert)
-
-	return &tls.Config{
+	config := &tls.Config{
 		Certificates: []tls.Certificate{tlsCert},
-		RootCAs:      caPool,
-		ServerName:   serverName,
 		NextProtos:   []string{"tndrl"},
 		MinVersion:   tls.VersionTLS13,
-	}, nil
+	}
+	v.configure(config, ca)
+	return config, nil
+}
+
+// ReloadingServerTLSConfig is like ServerTLSConfig but serves the reloader's
+// current certificate, so a replaced or renewed certificate is used for new
+// connections without a restart.
+func ReloadingServerTLSConfig(r *Reloader, ca *CA) *tls.Config {
+	caPool := ca.pool()
+
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert := *r.current()
+			cert.Certificate = ca.withRoot(cert.Certificate)
+			return &cert, nil
+		},
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  caPool,
+		NextProtos: []string{"tndrl"},
+		MinVersion: tls.VersionTLS13,
+
+		VerifyPeerCertificate: ca.verifyClient,
+	}
+}
+
+// ReloadingClientTLSConfig is like ClientTLSConfig but presents the
+// reloader's current certificate.
+func ReloadingClientTLSConfig(r *Reloader, ca *CA, serverName string) *tls.Config {
+	return ReloadingClientTLSConfigFor(r, ca, ServerVerification{ServerName: serverName})
+}
+
+// ReloadingClientTLSConfigFor is like ClientTLSConfigFor but presents the
+// reloader's current certificate.
+func ReloadingClientTLSConfigFor(r *Reloader, ca *CA, v ServerVerification) *tls.Config {
+	config := &tls.Config{
+		GetClientCertificate: r.GetClientCertificate,
+		NextProtos:           []string{"tndrl"},
+		MinVersion:           tls.VersionTLS13,
+	}
+	v.configure(config, ca)
+	return config
+}
+
+// withRoot returns a TLS certificate chain with the CA's root appended,
+// unless the chain already ends with it.
+func (ca *CA) withRoot(chain [][]byte) [][]byte {
+	root := ca.Root().Raw
+	if len(chain) > 0 && bytes.Equal(chain[len(chain)-1], root) {
+		return chain
+	}
+	return append(slices.Clip(chain), root)
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a certificate as lowercase hex.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// PinnedTLSConfig creates a TLS config for a client that has no certificate
+// and does not yet trust the CA, such as a node enrolling with a join token.
+// The server must present, along with its own certificate, a root CA
+// certificate whose fingerprint matches caFingerprint, and its certificate
+// must chain to that root. The server name is not checked.
+func PinnedTLSConfig(caFingerprint string) *tls.Config {
+	want, _ := hex.DecodeString(strings.ToLower(caFingerprint))
+
+	return &tls.Config{
+		// Verification is done by VerifyPeerCertificate against the pinned CA
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"tndrl"},
+		MinVersion:         tls.VersionTLS13,
+
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyPinned(rawCerts, want)
+		},
+	}
+}
+
+// verifyPinned verifies a server chain against the CA certificate in it
+// whose SHA-256 hash is fingerprint.
+func verifyPinned(rawCerts [][]byte, fingerprint []byte) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	var root *x509.Certificate
+	intermediates := x509.NewCertPool()
+	for _, raw := range rawCerts[1:] {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("parse server chain: %w", err)
+		}
+		if sum := sha256.Sum256(raw); bytes.Equal(sum[:], fingerprint) {
+			root = cert
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if root == nil {
+		return errors.New("server did not present the CA certificate matching the pinned fingerprint")
+	}
+
+	leaf, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return fmt.Errorf("parse server certificate: %w", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return fmt.Errorf("verify server certificate against pinned CA: %w", err)
+	}
+	return nil
 }
 
 // LoadCACert loads just the CA certificate (without private key) for verification.
@@ -3,6 +3,7 @@ package pki
 import (
 	"crypto/tls"
 	"net"
+	"strings"
 	"testing"
 	"time"
 )
@@ -180,6 +181,72 @@ func TestMTLSHandshake(t *testing.T) {
 	}
 }
 
+func TestMTLSHandshake_Intermediates(t *testing.T) {
+	// Server and client certificates come from different intermediates of
+	// the same root; each side trusts only the root.
+	root, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	serverCA, err := GenerateIntermediateCA(root, "server")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+	clientCA, err := GenerateIntermediateCA(root, "client")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+
+	// Also mix key algorithms
+	serverCert, err := GenerateCertWithOptions(serverCA, "spiffe://tndrl/node/test", true, false, CertOptions{KeyAlgorithm: KeyEd25519})
+	if err != nil {
+		t.Fatalf("GenerateCert() for server error = %v", err)
+	}
+	clientCert, err := GenerateCertWithOptions(clientCA, "spiffe://tndrl/node/client", false, true, CertOptions{KeyAlgorithm: KeyECDSAP384})
+	if err != nil {
+		t.Fatalf("GenerateCert() for client error = %v", err)
+	}
+
+	serverConfig, err := ServerTLSConfig(serverCert, serverCA)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+	clientConfig, err := ClientTLSConfig(clientCert, clientCA, "localhost")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig() error = %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("tls.Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		defer conn.Close()
+		serverDone <- conn.(*tls.Conn).Handshake()
+	}()
+
+	dialer := &net.Dialer{
+		Timeout: 2 * time.Second,
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatalf("Client handshake error: %v", err)
+	}
+	defer conn.Close()
+
+	if err := <-serverDone; err != nil {
+		t.Fatalf("Server handshake error: %v", err)
+	}
+}
+
 type testError struct {
 	msg string
 }
@@ -259,3 +326,247 @@ func TestMTLSHandshake_WrongCA(t *testing.T) {
 	// Wait for server goroutine to clean up
 	<-serverDone
 }
+
+func TestMTLSHandshake_RevokedClient(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	serverCert, err := GenerateCert(ca, "spiffe://tndrl/node/test", true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() for server error = %v", err)
+	}
+
+	clientCert, err := GenerateCert(ca, "spiffe://tndrl/node/client", false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() for client error = %v", err)
+	}
+
+	serverConfig, err := ServerTLSConfig(serverCert, ca)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+
+	clientConfig, err := ClientTLSConfig(clientCert, ca, "localhost")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig() error = %v", err)
+	}
+
+	// Revoke after the configs are built; the check runs at handshake time
+	ca.CRL.RevokeSerial(clientCert.Cert.SerialNumber)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatalf("tls.Listen() error = %v", err)
+	}
+	defer listener.Close()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		defer conn.Close()
+		serverDone <- conn.(*tls.Conn).Handshake()
+	}()
+
+	dialer := &net.Dialer{
+		Timeout: 2 * time.Second,
+	}
+	conn, err := tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), clientConfig)
+	if err == nil {
+		defer conn.Close()
+	}
+
+	err = <-serverDone
+	if err == nil || !strings.Contains(err.Error(), "revoked") {
+		t.Errorf("server handshake error = %v, want revoked certificate", err)
+	}
+}
+
+func TestPinnedTLSConfig(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	otherCA, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	serverCert, err := GenerateCert(ca, "spiffe://tndrl/node/test", true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() for server error = %v", err)
+	}
+	serverConfig, err := ServerTLSConfig(serverCert, ca)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig() error = %v", err)
+	}
+	// As on a node accepting enrollments
+	serverConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		wantErr     bool
+	}{
+		{"matching CA", Fingerprint(ca.Cert), false},
+		{"other CA", Fingerprint(otherCA.Cert), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+			if err != nil {
+				t.Fatalf("tls.Listen() error = %v", err)
+			}
+			defer listener.Close()
+
+			serverDone := make(chan struct{})
+			go func() {
+				defer close(serverDone)
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+
+			dialer := &net.Dialer{
+				Timeout: 2 * time.Second,
+			}
+			conn, err := tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), PinnedTLSConfig(tt.fingerprint))
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+			<-serverDone
+		})
+	}
+}
+
+func TestClientTLSConfigFor(t *testing.T) {
+	ca, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	otherCA, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	serverCert, err := GenerateCert(ca, NodeIdentity("backend"), true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() for server error = %v", err)
+	}
+	revokedCert, err := GenerateCert(ca, NodeIdentity("backend"), true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() for server error = %v", err)
+	}
+	ca.CRL.RevokeSerial(revokedCert.Cert.SerialNumber)
+	otherCert, err := GenerateCert(otherCA, NodeIdentity("backend"), true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert() for server error = %v", err)
+	}
+	clientCert, err := GenerateCert(ca, NodeIdentity("client"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() for client error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		server  *Cert
+		verify  ServerVerification
+		wantErr bool
+	}{
+		{"identity only", serverCert, ServerVerification{Identity: NodeIdentity("backend")}, false},
+		{"identity and host name", serverCert, ServerVerification{Identity: NodeIdentity("backend"), ServerName: "localhost"}, false},
+		{"wrong identity", serverCert, ServerVerification{Identity: NodeIdentity("frontend")}, true},
+		{"identity but wrong host name", serverCert, ServerVerification{Identity: NodeIdentity("backend"), ServerName: "backend.example.com"}, true},
+		{"revoked", revokedCert, ServerVerification{Identity: NodeIdentity("backend")}, true},
+		{"other CA", otherCert, ServerVerification{Identity: NodeIdentity("backend")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig, err := ServerTLSConfig(tt.server, ca)
+			if err != nil {
+				t.Fatalf("ServerTLSConfig() error = %v", err)
+			}
+			clientConfig, err := ClientTLSConfigFor(clientCert, ca, tt.verify)
+			if err != nil {
+				t.Fatalf("ClientTLSConfigFor() error = %v", err)
+			}
+
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+			if err != nil {
+				t.Fatalf("tls.Listen() error = %v", err)
+			}
+			defer listener.Close()
+
+			serverDone := make(chan struct{})
+			go func() {
+				defer close(serverDone)
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+			}()
+
+			dialer := &net.Dialer{
+				Timeout: 2 * time.Second,
+			}
+			conn, err := tls.DialWithDialer(dialer, "tcp", listener.Addr().String(), clientConfig)
+			if err == nil {
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+			<-serverDone
+		})
+	}
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	root, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+	intermediate, err := GenerateIntermediateCA(root, "prod")
+	if err != nil {
+		t.Fatalf("GenerateIntermediateCA() error = %v", err)
+	}
+	other, err := GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA() error = %v", err)
+	}
+
+	cert, err := GenerateCert(intermediate, NodeIdentity("web"), true, true)
+	if err != nil {
+		t.Fatalf("GenerateCert() error = %v", err)
+	}
+
+	if err := root.VerifyCertificate(cert.Certificates()); err != nil {
+		t.Errorf("VerifyCertificate() with chain error = %v", err)
+	}
+	if err := root.VerifyCertificate(cert.Certificates()[:1]); err == nil {
+		t.Error("VerifyCertificate() without the intermediate expected error")
+	}
+	if err := other.VerifyCertificate(cert.Certificates()); err == nil {
+		t.Error("VerifyCertificate() against another CA expected error")
+	}
+
+	root.CRL.RevokeSerial(cert.Cert.SerialNumber)
+	if err := root.VerifyCertificate(cert.Certificates()); err == nil {
+		t.Error("VerifyCertificate() of a revoked certificate expected error")
+	}
+}
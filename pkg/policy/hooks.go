@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/shanemcd/tndrl/pkg/authz"
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// acceptTimeout bounds policy evaluation for a new connection.
+const acceptTimeout = 5 * time.Second
+
+// AcceptConn checks whether a newly accepted connection may be served. It
+// has the signature of transport.AcceptFunc.
+func (e *Engine) AcceptConn(conn transport.Conn) error {
+	if e == nil {
+		return nil
+	}
+
+	info := conn.Info()
+	caller := &Peer{Addr: info.RemoteAddr.String()}
+	caller.Identity, _ = info.PeerIdentity()
+
+	ctx, cancel := context.WithTimeout(conn.Context(), acceptTimeout)
+	defer cancel()
+	return e.Check(ctx, Input{Action: ActionConnect, Caller: caller})
+}
+
+// CheckTool checks whether the agent may call a tool. It has the signature
+// of llm.ToolCheck. The caller is the peer whose request the agent is
+// handling, when ctx carries one.
+func (e *Engine) CheckTool(ctx context.Context, name, args string) error {
+	if e == nil {
+		return nil
+	}
+
+	tool := &Tool{Name: name}
+	if args != "" {
+		// Arguments the model produced may not be valid JSON; policy then sees none
+		_ = json.Unmarshal([]byte(args), &tool.Args)
+	}
+	return e.Check(ctx, Input{Action: ActionToolCall, Caller: callerFrom(ctx), Tool: tool})
+}
+
+// UnaryServerInterceptor returns an interceptor that checks each unary RPC
+// against policy. A nil engine allows every call.
+func (e *Engine) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := e.checkRPC(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that checks each streaming
+// RPC against policy. A nil engine allows every call.
+func (e *Engine) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := e.checkRPC(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// checkRPC checks an RPC and converts a denial to a gRPC status.
+func (e *Engine) checkRPC(ctx context.Context, method string) error {
+	if e == nil {
+		return nil
+	}
+
+	err := e.Check(ctx, Input{Action: ActionRPC, Caller: callerFrom(ctx), Method: method})
+	if errors.Is(err, ErrDenied) {
+		return status.Errorf(codes.PermissionDenied, "%s: %v", method, err)
+	}
+	return err
+}
+
+// callerFrom returns the gRPC caller in ctx, or nil if there is none.
+func callerFrom(ctx context.Context) *Peer {
+	identity, err := authz.PeerIdentity(ctx)
+	if err != nil {
+		return nil
+	}
+	return &Peer{Identity: identity}
+}
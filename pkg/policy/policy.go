@@ -0,0 +1,132 @@
+// Package policy evaluates Rego policy with an embedded OPA engine.
+//
+// Policy is loaded from a bundle directory and queried at three points:
+// when a connection is accepted, before each Control or A2A RPC, and before
+// each tool call made by the mcphost provider. Every decision is logged so
+// that policy enforcement can be audited.
+//
+// The bundle must define data.tndrl.allow. Anything other than true denies
+// the action. The input document is an Input.
+//
+// Rego evaluation is provided by OPA's Go library.
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Query is the Rego query evaluated for every decision.
+const Query = "data.tndrl.allow"
+
+// Actions evaluated by the engine.
+const (
+	// ActionConnect is checked when a peer opens a connection.
+	ActionConnect = "connect"
+
+	// ActionRPC is checked before each Control or A2A RPC.
+	ActionRPC = "rpc"
+
+	// ActionToolCall is checked before the agent invokes a tool.
+	ActionToolCall = "tool.call"
+)
+
+// ErrDenied is returned (wrapped) when policy denies an action.
+var ErrDenied = errors.New("denied by policy")
+
+// Input is the document policy is evaluated against (input in Rego).
+type Input struct {
+	// Action is one of the Action constants.
+	Action string `json:"action"`
+
+	// Caller is the peer performing the action, if known.
+	Caller *Peer `json:"caller,omitempty"`
+
+	// Node is the local node enforcing the policy.
+	Node *Peer `json:"node,omitempty"`
+
+	// Method is the full gRPC method name, for rpc actions.
+	Method string `json:"method,omitempty"`
+
+	// Tool describes the tool call, for tool.call actions.
+	Tool *Tool `json:"tool,omitempty"`
+}
+
+// Peer identifies a node.
+type Peer struct {
+	// Identity is the node's SPIFFE ID.
+	Identity string `json:"identity,omitempty"`
+
+	// Addr is the node's network address, if known.
+	Addr string `json:"addr,omitempty"`
+}
+
+// Tool describes a tool call.
+type Tool struct {
+	// Name is the tool name as seen by the agent (server__tool for mcphost).
+	Name string `json:"name"`
+
+	// Args are the decoded call arguments.
+	Args map[string]any `json:"args,omitempty"`
+}
+
+// evaluator decides a single input.
+type evaluator interface {
+	allowed(ctx context.Context, input Input) (bool, error)
+}
+
+// Engine evaluates policy loaded from a Rego bundle.
+// A nil *Engine allows everything.
+type Engine struct {
+	eval     evaluator
+	identity string
+}
+
+// Load compiles the bundle in dir. identity is the local node's SPIFFE ID,
+// passed to policy as input.node.
+func Load(ctx context.Context, dir, identity string) (*Engine, error) {
+	eval, err := loadBundle(ctx, dir)
+	if err != nil {
+		return nil, fmt.Errorf("load policy bundle %s: %w", dir, err)
+	}
+
+	slog.Debug("policy loaded", "dir", dir)
+	return &Engine{eval: eval, identity: identity}, nil
+}
+
+// Check evaluates the input and returns an error wrapping ErrDenied if
+// policy does not allow it. Evaluation errors also deny.
+func (e *Engine) Check(ctx context.Context, input Input) error {
+	if e == nil {
+		return nil
+	}
+	if input.Node == nil {
+		input.Node = &Peer{Identity: e.identity}
+	}
+
+	allowed, err := e.eval.allowed(ctx, input)
+	attrs := []any{"action", input.Action, "allowed", allowed}
+	if input.Caller != nil {
+		attrs = append(attrs, "caller", input.Caller.Identity)
+	}
+	if input.Method != "" {
+		attrs = append(attrs, "method", input.Method)
+	}
+	if input.Tool != nil {
+		attrs = append(attrs, "tool", input.Tool.Name)
+	}
+
+	if err != nil {
+		slog.Error("policy evaluation failed", append(attrs, "err", err)...)
+		return fmt.Errorf("%w: evaluation failed: %v", ErrDenied, err)
+	}
+
+	// Decisions are logged at info level as the audit trail
+	slog.Info("policy decision", attrs...)
+	if !allowed {
+		return fmt.Errorf("%s: %w", input.Action, ErrDenied)
+	}
+	return nil
+}
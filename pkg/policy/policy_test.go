@@ -0,0 +1,110 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/shanemcd/tndrl/internal/testutil"
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// funcEvaluator decides inputs with a Go function in place of Rego.
+type funcEvaluator func(Input) (bool, error)
+
+func (f funcEvaluator) allowed(_ context.Context, input Input) (bool, error) {
+	return f(input)
+}
+
+func TestEngine_Nil(t *testing.T) {
+	var e *Engine
+	if err := e.Check(context.Background(), Input{Action: ActionRPC}); err != nil {
+		t.Errorf("nil engine denied: %v", err)
+	}
+	if err := e.CheckTool(context.Background(), "fs__write", "{}"); err != nil {
+		t.Errorf("nil engine denied tool: %v", err)
+	}
+}
+
+func TestEngine_Check(t *testing.T) {
+	var got Input
+	e := &Engine{
+		identity: pki.NodeIdentity("self"),
+		eval: funcEvaluator(func(input Input) (bool, error) {
+			got = input
+			return input.Method == "/tndrl.v1.ControlService/Ping", nil
+		}),
+	}
+
+	if err := e.Check(context.Background(), Input{Action: ActionRPC, Method: "/tndrl.v1.ControlService/Ping"}); err != nil {
+		t.Errorf("allowed input denied: %v", err)
+	}
+	if got.Node == nil || got.Node.Identity != pki.NodeIdentity("self") {
+		t.Errorf("input.node = %+v, want local identity", got.Node)
+	}
+
+	err := e.Check(context.Background(), Input{Action: ActionRPC, Method: "/tndrl.v1.ControlService/Shutdown"})
+	if !errors.Is(err, ErrDenied) {
+		t.Errorf("err = %v, want ErrDenied", err)
+	}
+}
+
+func TestEngine_CheckEvaluationError(t *testing.T) {
+	e := &Engine{eval: funcEvaluator(func(Input) (bool, error) {
+		return true, errors.New("undefined function")
+	})}
+
+	if err := e.Check(context.Background(), Input{Action: ActionConnect}); !errors.Is(err, ErrDenied) {
+		t.Errorf("err = %v, want ErrDenied", err)
+	}
+}
+
+func TestEngine_CheckTool(t *testing.T) {
+	var got Input
+	e := &Engine{eval: funcEvaluator(func(input Input) (bool, error) {
+		got = input
+		return input.Tool.Args["path"] != "/etc/passwd", nil
+	})}
+	ctx := testutil.PeerContext(t, "ops-1")
+
+	if err := e.CheckTool(ctx, "fs__read", `{"path": "/tmp/notes"}`); err != nil {
+		t.Errorf("allowed tool denied: %v", err)
+	}
+	if got.Action != ActionToolCall || got.Tool.Name != "fs__read" {
+		t.Errorf("input = %+v", got)
+	}
+	if got.Caller == nil || got.Caller.Identity != pki.NodeIdentity("ops-1") {
+		t.Errorf("input.caller = %+v, want ops-1", got.Caller)
+	}
+
+	if err := e.CheckTool(ctx, "fs__read", `{"path": "/etc/passwd"}`); !errors.Is(err, ErrDenied) {
+		t.Errorf("err = %v, want ErrDenied", err)
+	}
+}
+
+func TestEngine_UnaryServerInterceptor(t *testing.T) {
+	e := &Engine{eval: funcEvaluator(func(input Input) (bool, error) {
+		return input.Caller != nil && input.Caller.Identity == pki.NodeIdentity("ops-1"), nil
+	})}
+	interceptor := e.UnaryServerInterceptor()
+
+	call := func(ctx context.Context) error {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/tndrl.v1.ControlService/Shutdown"},
+			func(ctx context.Context, req any) (any, error) { return "ok", nil })
+		return err
+	}
+
+	if err := call(testutil.PeerContext(t, "ops-1")); err != nil {
+		t.Errorf("allowed caller denied: %v", err)
+	}
+	if code := status.Code(call(testutil.PeerContext(t, "dev-1"))); code != codes.PermissionDenied {
+		t.Errorf("code = %v, want PermissionDenied", code)
+	}
+	if code := status.Code(call(context.Background())); code != codes.PermissionDenied {
+		t.Errorf("unknown caller: code = %v, want PermissionDenied", code)
+	}
+}
@@ -0,0 +1,32 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/open-policy-agent/opa/v1/rego"
+)
+
+// regoEvaluator evaluates a prepared Rego query.
+type regoEvaluator struct {
+	query rego.PreparedEvalQuery
+}
+
+// loadBundle compiles the bundle in dir and prepares Query against it.
+func loadBundle(ctx context.Context, dir string) (evaluator, error) {
+	query, err := rego.New(
+		rego.Query(Query),
+		rego.LoadBundle(dir),
+	).PrepareForEval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return regoEvaluator{query: query}, nil
+}
+
+func (r regoEvaluator) allowed(ctx context.Context, input Input) (bool, error) {
+	rs, err := r.query.Eval(ctx, rego.EvalInput(input))
+	if err != nil {
+		return false, err
+	}
+	return rs.Allowed(), nil
+}
@@ -0,0 +1,55 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPolicy = `package tndrl
+
+default allow := false
+
+allow if input.action == "connect"
+
+allow if {
+	input.action == "rpc"
+	startswith(input.caller.identity, "spiffe://tndrl/node/ops-")
+}
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tndrl.rego"), []byte(testPolicy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := Load(context.Background(), dir, "spiffe://tndrl/node/self")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := e.Check(ctx, Input{Action: ActionConnect}); err != nil {
+		t.Errorf("connect denied: %v", err)
+	}
+	if err := e.Check(ctx, Input{Action: ActionRPC, Caller: &Peer{Identity: "spiffe://tndrl/node/ops-1"}}); err != nil {
+		t.Errorf("ops rpc denied: %v", err)
+	}
+	if err := e.Check(ctx, Input{Action: ActionRPC, Caller: &Peer{Identity: "spiffe://tndrl/node/dev-1"}}); !errors.Is(err, ErrDenied) {
+		t.Errorf("dev rpc: err = %v, want ErrDenied", err)
+	}
+}
+
+func TestLoad_InvalidBundle(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tndrl.rego"), []byte("package tndrl\nallow if {"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(context.Background(), dir, ""); err == nil {
+		t.Fatal("expected error for invalid Rego")
+	}
+}
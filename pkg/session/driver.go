@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"io"
+)
+
+// Driver provisions and manages the execution environment of a session.
+// Implementations live in subpackages (e.g. session/local).
+type Driver interface {
+	// Name returns the driver identifier (e.g. "local", "podman").
+	Name() string
+
+	// Provision prepares a new environment for a session without starting it.
+	Provision(ctx context.Context, opts ProvisionOptions) (*Environment, error)
+
+	// Start boots the tndrl node inside the environment and waits until it
+	// accepts connections. On success env.Endpoint holds the node's address.
+	Start(ctx context.Context, env *Environment) error
+
+	// Stop shuts down the node, keeping the environment for a later Start.
+	Stop(ctx context.Context, env *Environment) error
+
+	// Destroy stops the node if needed and tears down the environment.
+	Destroy(ctx context.Context, env *Environment) error
+
+	// Logs returns a reader for the node's logs.
+	Logs(ctx context.Context, env *Environment) (io.ReadCloser, error)
+
+	// Exec runs a command inside the environment (for debugging), writing
+	// its combined output to out.
+	Exec(ctx context.Context, env *Environment, cmd []string, out io.Writer) error
+}
+
+// ProvisionOptions configures a new environment.
+type ProvisionOptions struct {
+	// SessionID is the session the environment belongs to.
+	SessionID string
+
+	// Task is the initial task description for the agent.
+	Task string
+}
+
+// Environment describes a provisioned environment. It is persisted alongside
+// the session so a later command can stop or destroy it.
+type Environment struct {
+	// ID is the session ID the environment belongs to.
+	ID string `json:"id"`
+
+	// Driver is the driver that provisioned the environment.
+	Driver string `json:"driver"`
+
+	// Endpoint is the address of the tndrl node, set once started.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Workdir is the environment's private working directory, if any.
+	Workdir string `json:"workdir,omitempty"`
+
+	// Details holds driver-specific state (process IDs, container names, ...).
+	Details map[string]string `json:"details,omitempty"`
+}
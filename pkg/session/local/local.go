@@ -0,0 +1,477 @@
+// Package local implements a session driver that runs a tndrl node as a
+// child process on the host. It provides no isolation and is intended for
+// development and tests.
+package local
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/session"
+	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+)
+
+// DriverName is the name of the local driver.
+const DriverName = "local"
+
+// Defaults for Options.
+const (
+	DefaultReadyTimeout = 30 * time.Second
+	DefaultStopTimeout  = 10 * time.Second
+	DefaultRenewBefore  = 30 * 24 * time.Hour
+)
+
+// Keys in session.Environment.Details.
+const (
+	detailPID       = "pid"
+	detailStartTime = "pid-start-time"
+	detailLog       = "log"
+)
+
+// Options configures the local driver.
+type Options struct {
+	// Root is the directory under which each session gets a private workdir.
+	Root string
+
+	// Binary is the tndrl executable to run. Defaults to the current executable.
+	Binary string
+
+	// CACert and CAKey locate the CA that issues each node's certificate.
+	// Only the driver uses the key: nodes are given the CA certificate and
+	// the certificate the driver issued them.
+	CACert string
+	CAKey  string
+
+	// CASigner, if set, is the external signer holding the CA key (see
+	// pki.OpenSigner), used instead of CAKey by the driver.
+	CASigner string
+
+	// RenewBefore makes Start reissue a node's certificate that expires
+	// within this window (default DefaultRenewBefore), since nodes cannot
+	// renew it themselves.
+	RenewBefore time.Duration
+
+	// TrustDomain is the SPIFFE trust domain of each node's identity.
+	// Defaults to pki.DefaultTrustDomain.
+	TrustDomain pki.TrustDomain
+
+	// CertOptions sets the SANs and key algorithm of each node's certificate.
+	CertOptions pki.CertOptions
+
+	// Keys decrypts the CA key and protects each node's key at rest.
+	Keys pki.KeyOptions
+
+	// Args are extra arguments passed to `tndrl serve` (e.g. LLM settings).
+	Args []string
+
+	// Env is extra environment for the child process.
+	Env []string
+
+	// ReadyTimeout bounds how long Start waits for the node (default 30s).
+	ReadyTimeout time.Duration
+
+	// StopTimeout bounds how long Stop waits before killing the node (default 10s).
+	StopTimeout time.Duration
+}
+
+// Driver runs each session's node as a `tndrl serve` child process in a
+// private working directory, with its own certificate and a free port.
+type Driver struct {
+	opts Options
+}
+
+// New creates a local driver.
+func New(opts Options) (*Driver, error) {
+	if opts.Root == "" {
+		return nil, errors.New("local driver: root directory is required")
+	}
+	if opts.CACert == "" || (opts.CAKey == "" && opts.CASigner == "") {
+		return nil, errors.New("local driver: CA certificate and key are required")
+	}
+	if opts.Binary == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("local driver: find executable: %w", err)
+		}
+		opts.Binary = exe
+	}
+	if opts.TrustDomain == "" {
+		opts.TrustDomain = pki.DefaultTrustDomain
+	}
+	if opts.ReadyTimeout == 0 {
+		opts.ReadyTimeout = DefaultReadyTimeout
+	}
+	if opts.StopTimeout == 0 {
+		opts.StopTimeout = DefaultStopTimeout
+	}
+	if opts.RenewBefore == 0 {
+		opts.RenewBefore = DefaultRenewBefore
+	}
+	return &Driver{opts: opts}, nil
+}
+
+// Name implements session.Driver.
+func (d *Driver) Name() string {
+	return DriverName
+}
+
+// Provision implements session.Driver.
+// It creates the session's workdir and issues the node a certificate from the CA.
+func (d *Driver) Provision(ctx context.Context, opts session.ProvisionOptions) (*session.Environment, error) {
+	workdir := filepath.Join(d.opts.Root, opts.SessionID)
+	if err := os.MkdirAll(workdir, 0700); err != nil {
+		return nil, fmt.Errorf("create workdir: %w", err)
+	}
+
+	if err := d.issueCert(workdir, opts.SessionID); err != nil {
+		return nil, err
+	}
+
+	slog.Debug("local environment provisioned", "session", opts.SessionID, "workdir", workdir)
+	return &session.Environment{
+		ID:      opts.SessionID,
+		Driver:  DriverName,
+		Workdir: workdir,
+		Details: map[string]string{
+			detailLog: filepath.Join(workdir, "tndrl.log"),
+		},
+	}, nil
+}
+
+// Start implements session.Driver.
+// It launches `tndrl serve` on a free loopback port and waits until the node
+// answers a Ping.
+func (d *Driver) Start(ctx context.Context, env *session.Environment) error {
+	if pid, ok := nodePID(env); ok {
+		return fmt.Errorf("session %s is already running (pid %d)", env.ID, pid)
+	}
+	if env.Details == nil {
+		env.Details = make(map[string]string)
+	}
+	if env.Details[detailLog] == "" {
+		env.Details[detailLog] = filepath.Join(env.Workdir, "tndrl.log")
+	}
+
+	if err := d.renewCert(env); err != nil {
+		return err
+	}
+
+	port, err := freePort()
+	if err != nil {
+		return fmt.Errorf("find free port: %w", err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(port))
+
+	logFile, err := os.OpenFile(env.Details[detailLog], os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open log: %w", err)
+	}
+	defer logFile.Close()
+
+	// The node gets the CA certificate but never the CA key or signer, nor
+	// uses one from the config file or the default path.
+	certPath, keyPath := certPaths(env.Workdir)
+	args := append([]string{
+		"serve",
+		"--server-addr=" + addr,
+		// The port is only known to be free for UDP
+		"--server-transports=quic",
+		"--pki-ca-cert=" + d.opts.CACert,
+		"--pki-no-ca-key",
+		"--pki-cert=" + certPath,
+		"--pki-key=" + keyPath,
+		"--agent-name=" + env.ID,
+	}, d.opts.Args...)
+
+	cmd := exec.Command(d.opts.Binary, args...)
+	cmd.Dir = env.Workdir
+	cmd.Env = append(os.Environ(), d.opts.Env...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// Detach so the node outlives the CLI invocation that started it
+	cmd.SysProcAttr = detachedProcAttr()
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start node: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	env.Details[detailPID] = strconv.Itoa(cmd.Process.Pid)
+	if start, ok := processStartTime(cmd.Process.Pid); ok {
+		env.Details[detailStartTime] = start
+	}
+	slog.Debug("local node started", "session", env.ID, "pid", cmd.Process.Pid, "addr", addr)
+
+	if err := d.waitReady(ctx, env, addr, exited); err != nil {
+		_ = cmd.Process.Kill()
+		delete(env.Details, detailPID)
+		delete(env.Details, detailStartTime)
+		return err
+	}
+
+	env.Endpoint = addr
+	return nil
+}
+
+// Stop implements session.Driver.
+// It sends SIGTERM and kills the node if it has not exited within StopTimeout.
+// A recorded process that is no longer the node is left alone.
+func (d *Driver) Stop(ctx context.Context, env *session.Environment) error {
+	defer func() {
+		delete(env.Details, detailPID)
+		delete(env.Details, detailStartTime)
+		env.Endpoint = ""
+	}()
+
+	pid, ok := nodePID(env)
+	if !ok {
+		return nil
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return nil
+	}
+
+	slog.Debug("stopping local node", "session", env.ID, "pid", pid)
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			return nil
+		}
+		return fmt.Errorf("signal node: %w", err)
+	}
+
+	deadline := time.Now().Add(d.opts.StopTimeout)
+	for time.Now().Before(deadline) {
+		if _, ok := nodePID(env); !ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	slog.Warn("local node did not stop in time, killing", "session", env.ID, "pid", pid)
+	if err := proc.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("kill node: %w", err)
+	}
+	return nil
+}
+
+// Destroy implements session.Driver.
+// It stops the node and removes the session's workdir.
+func (d *Driver) Destroy(ctx context.Context, env *session.Environment) error {
+	if err := d.Stop(ctx, env); err != nil {
+		return err
+	}
+	if env.Workdir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(env.Workdir); err != nil {
+		return fmt.Errorf("remove workdir: %w", err)
+	}
+	return nil
+}
+
+// Logs implements session.Driver.
+func (d *Driver) Logs(ctx context.Context, env *session.Environment) (io.ReadCloser, error) {
+	f, err := os.Open(env.Details[detailLog])
+	if err != nil {
+		return nil, fmt.Errorf("open log: %w", err)
+	}
+	return f, nil
+}
+
+// Exec implements session.Driver.
+// The command runs on the host in the session's workdir.
+func (d *Driver) Exec(ctx context.Context, env *session.Environment, cmd []string, out io.Writer) error {
+	if len(cmd) == 0 {
+		return errors.New("no command given")
+	}
+
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	c.Dir = env.Workdir
+	c.Env = append(os.Environ(), d.opts.Env...)
+	c.Stdout = out
+	c.Stderr = out
+	return c.Run()
+}
+
+// issueCert issues the session's node a certificate and saves it in the
+// workdir.
+func (d *Driver) issueCert(workdir, sessionID string) error {
+	ca, closeCA, err := d.loadCA()
+	if err != nil {
+		return fmt.Errorf("load CA: %w", err)
+	}
+	defer closeCA()
+
+	cert, err := pki.GenerateCertWithOptions(ca, d.opts.TrustDomain.NodeIdentity(sessionID), true, true, d.opts.CertOptions)
+	if err != nil {
+		return fmt.Errorf("generate cert: %w", err)
+	}
+
+	certPath, keyPath := certPaths(workdir)
+	if err := cert.SaveWithOptions(certPath, keyPath, d.opts.Keys); err != nil {
+		return fmt.Errorf("save cert: %w", err)
+	}
+	return nil
+}
+
+// renewCert reissues the node's certificate if it expires within
+// RenewBefore.
+func (d *Driver) renewCert(env *session.Environment) error {
+	certPath, _ := certPaths(env.Workdir)
+	cert, err := pki.LoadCertificate(certPath)
+	if err != nil {
+		return fmt.Errorf("load cert: %w", err)
+	}
+	if time.Until(cert.NotAfter) >= d.opts.RenewBefore {
+		return nil
+	}
+	slog.Info("renewing session certificate", "session", env.ID, "expires", cert.NotAfter)
+	return d.issueCert(env.Workdir, env.ID)
+}
+
+// loadCA loads the CA with its key, or with the external signer, and
+// returns a function that releases the signer.
+func (d *Driver) loadCA() (*pki.CA, func(), error) {
+	if d.opts.CASigner == "" {
+		ca, err := pki.LoadCAWithOptions(d.opts.CACert, d.opts.CAKey, d.opts.Keys)
+		return ca, func() {}, err
+	}
+	signer, err := pki.OpenSigner(d.opts.CASigner)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := pki.LoadCAWithSigner(d.opts.CACert, signer)
+	if err != nil {
+		signer.Close()
+		return nil, nil, err
+	}
+	return ca, func() { signer.Close() }, nil
+}
+
+// waitReady pings the node until it responds, the process exits, or the timeout passes.
+func (d *Driver) waitReady(ctx context.Context, env *session.Environment, addr string, exited <-chan error) error {
+	ca, err := pki.LoadCACertificate(d.opts.CACert)
+	if err != nil {
+		return fmt.Errorf("load CA: %w", err)
+	}
+	certPath, keyPath := certPaths(env.Workdir)
+	cert, err := pki.LoadCertWithOptions(certPath, keyPath, d.opts.Keys)
+	if err != nil {
+		return fmt.Errorf("load cert: %w", err)
+	}
+	// The node is reached by loopback address; check it is the session's
+	tlsConfig, err := pki.ClientTLSConfigFor(cert, ca, pki.ServerVerification{
+		Identity: d.opts.TrustDomain.NodeIdentity(env.ID),
+	})
+	if err != nil {
+		return fmt.Errorf("client TLS: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.opts.ReadyTimeout)
+	defer cancel()
+
+	for {
+		err := ping(ctx, tlsConfig, addr)
+		if err == nil {
+			return nil
+		}
+		slog.Debug("waiting for local node", "session", env.ID, "err", err)
+
+		select {
+		case err := <-exited:
+			return fmt.Errorf("node exited before becoming ready (see %s): %v", env.Details[detailLog], err)
+		case <-ctx.Done():
+			return fmt.Errorf("node not ready after %s (see %s)", d.opts.ReadyTimeout, env.Details[detailLog])
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
+
+// ping sends a single Control Ping to the node.
+func ping(ctx context.Context, tlsConfig *tls.Config, addr string) error {
+	dialer := quictransport.NewMuxDialer(tlsConfig, nil)
+	defer dialer.Close()
+
+	conn, err := grpc.NewClient(addr,
+		grpc.WithContextDialer(dialer.ControlDialer()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
+	)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err = tndrlv1.NewControlServiceClient(conn).Ping(ctx, &tndrlv1.PingRequest{Timestamp: time.Now().UnixNano()})
+	return err
+}
+
+// certPaths returns the node certificate and key paths inside a workdir.
+func certPaths(workdir string) (string, string) {
+	dir := filepath.Join(workdir, "pki")
+	return filepath.Join(dir, "tndrl.crt"), filepath.Join(dir, "tndrl.key")
+}
+
+// pidOf returns the node's process ID recorded in the environment.
+func pidOf(env *session.Environment) (int, bool) {
+	pid, err := strconv.Atoi(env.Details[detailPID])
+	if err != nil || pid <= 0 {
+		return 0, false
+	}
+	return pid, true
+}
+
+// nodePID returns the process ID recorded in the environment if that
+// process is still the node the driver started. The PID alone is not
+// enough: once the node exits, it may be reused by an unrelated process,
+// so where the platform allows, its start time must match too.
+func nodePID(env *session.Environment) (int, bool) {
+	pid, ok := pidOf(env)
+	if !ok || !processAlive(pid) {
+		return 0, false
+	}
+	start, ok := processStartTime(pid)
+	if !ok {
+		return pid, true
+	}
+	return pid, start == env.Details[detailStartTime]
+}
+
+// freePort returns a UDP port on the loopback interface that is currently unused.
+func freePort() (int, error) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer pc.Close()
+	return pc.LocalAddr().(*net.UDPAddr).Port, nil
+}
+
+var _ session.Driver = (*Driver)(nil)
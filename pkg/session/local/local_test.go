@@ -0,0 +1,308 @@
+package local
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
+	"github.com/shanemcd/tndrl/pkg/control"
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/session"
+	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+)
+
+// helperEnv marks a re-executed test binary acting as a tndrl node.
+const helperEnv = "TNDRL_LOCAL_DRIVER_HELPER"
+
+// runHelperNode serves the Control service with the flags the driver passes
+// to `tndrl serve`, until it receives SIGTERM.
+func runHelperNode(args []string) int {
+	flags := make(map[string]string)
+	for _, arg := range args {
+		if arg == "--fail" {
+			fmt.Fprintln(os.Stderr, "helper: failing on request")
+			return 1
+		}
+		if k, v, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "="); ok {
+			flags[k] = v
+		}
+	}
+
+	// Nodes must never be handed the CA key
+	for _, flag := range []string{"pki-ca-key", "pki-ca-signer"} {
+		if _, ok := flags[flag]; ok {
+			fmt.Fprintf(os.Stderr, "helper: given --%s\n", flag)
+			return 1
+		}
+	}
+
+	ca, err := pki.LoadCACertificate(flags["pki-ca-cert"])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "helper:", err)
+		return 1
+	}
+	cert, err := pki.LoadCert(flags["pki-cert"], flags["pki-key"])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "helper:", err)
+		return 1
+	}
+	tlsConfig, err := pki.ServerTLSConfig(cert, ca)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "helper:", err)
+		return 1
+	}
+
+	listener, err := quictransport.ListenMux(flags["server-addr"], tlsConfig, nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "helper:", err)
+		return 1
+	}
+
+	state := control.NewState(pki.NodeIdentity(flags["agent-name"]))
+	state.SetReady()
+	srv := grpc.NewServer()
+	tndrlv1.RegisterControlServiceServer(srv, control.NewServer(state, nil))
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		listener.Close()
+		srv.Stop()
+	}()
+
+	fmt.Println("helper: ready on", flags["server-addr"])
+	_ = srv.Serve(listener.ControlListener())
+	return 0
+}
+
+func newTestDriver(t *testing.T, args ...string) *Driver {
+	t.Helper()
+	return newTestDriverWithOptions(t, Options{Args: args})
+}
+
+func newTestDriverWithOptions(t *testing.T, opts Options) *Driver {
+	t.Helper()
+
+	pkiDir := t.TempDir()
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	if err := ca.Save(pkiDir); err != nil {
+		t.Fatalf("save CA: %v", err)
+	}
+
+	opts.Root = t.TempDir()
+	opts.Binary = os.Args[0]
+	opts.CACert = filepath.Join(pkiDir, "ca.crt")
+	opts.CAKey = filepath.Join(pkiDir, "ca.key")
+	opts.Env = []string{helperEnv + "=1"}
+	opts.ReadyTimeout = 10 * time.Second
+	opts.StopTimeout = 5 * time.Second
+	d, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return d
+}
+
+func TestNew_RequiresOptions(t *testing.T) {
+	if _, err := New(Options{CACert: "ca.crt", CAKey: "ca.key"}); err == nil {
+		t.Error("expected error without root")
+	}
+	if _, err := New(Options{Root: t.TempDir()}); err == nil {
+		t.Error("expected error without CA")
+	}
+}
+
+func TestDriver_Lifecycle(t *testing.T) {
+	d := newTestDriver(t)
+	ctx := context.Background()
+
+	env, err := d.Provision(ctx, session.ProvisionOptions{SessionID: "s-test", Task: "test"})
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Destroy(ctx, env) })
+
+	// The node gets its own certificate with the session's identity
+	certPath, keyPath := certPaths(env.Workdir)
+	cert, err := pki.LoadCert(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("load node cert: %v", err)
+	}
+	if got := cert.Cert.URIs[0].String(); got != pki.NodeIdentity("s-test") {
+		t.Errorf("cert identity = %q, want %q", got, pki.NodeIdentity("s-test"))
+	}
+
+	if err := d.Start(ctx, env); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if !strings.HasPrefix(env.Endpoint, "127.0.0.1:") {
+		t.Errorf("Endpoint = %q, want loopback address", env.Endpoint)
+	}
+	pid, ok := pidOf(env)
+	if !ok || !processAlive(pid) {
+		t.Fatalf("expected running node, pid=%d", pid)
+	}
+
+	if err := d.Start(ctx, env); err == nil {
+		t.Error("expected error starting an already running node")
+	}
+
+	var out bytes.Buffer
+	if err := d.Exec(ctx, env, []string{"pwd"}, &out); err != nil {
+		t.Fatalf("Exec: %v", err)
+	}
+	if got := strings.TrimSpace(out.String()); got != env.Workdir {
+		t.Errorf("Exec ran in %q, want %q", got, env.Workdir)
+	}
+
+	if err := d.Stop(ctx, env); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if processAlive(pid) {
+		t.Error("expected node to be stopped")
+	}
+	if env.Endpoint != "" {
+		t.Errorf("Endpoint = %q after Stop, want empty", env.Endpoint)
+	}
+
+	logs, err := d.Logs(ctx, env)
+	if err != nil {
+		t.Fatalf("Logs: %v", err)
+	}
+	data, _ := io.ReadAll(logs)
+	logs.Close()
+	if !strings.Contains(string(data), "helper: ready") {
+		t.Errorf("expected node output in logs, got %q", data)
+	}
+
+	if err := d.Destroy(ctx, env); err != nil {
+		t.Fatalf("Destroy: %v", err)
+	}
+	if _, err := os.Stat(env.Workdir); !os.IsNotExist(err) {
+		t.Errorf("expected workdir to be removed, stat err = %v", err)
+	}
+}
+
+func TestDriver_StartRenewsCert(t *testing.T) {
+	// Every certificate expires within the window, so Start reissues it
+	d := newTestDriverWithOptions(t, Options{RenewBefore: 2 * 365 * 24 * time.Hour})
+	ctx := context.Background()
+
+	env, err := d.Provision(ctx, session.ProvisionOptions{SessionID: "s-renew"})
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Destroy(ctx, env) })
+
+	certPath, _ := certPaths(env.Workdir)
+	before, err := pki.LoadCertificate(certPath)
+	if err != nil {
+		t.Fatalf("load node cert: %v", err)
+	}
+	if err := d.Start(ctx, env); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	after, err := pki.LoadCertificate(certPath)
+	if err != nil {
+		t.Fatalf("load node cert: %v", err)
+	}
+	if after.SerialNumber.Cmp(before.SerialNumber) == 0 {
+		t.Error("expected Start to reissue the node certificate")
+	}
+	if got := after.URIs[0].String(); got != pki.NodeIdentity("s-renew") {
+		t.Errorf("renewed cert identity = %q, want %q", got, pki.NodeIdentity("s-renew"))
+	}
+}
+
+func TestDriver_StartFailure(t *testing.T) {
+	d := newTestDriver(t, "--fail")
+	ctx := context.Background()
+
+	env, err := d.Provision(ctx, session.ProvisionOptions{SessionID: "s-fail"})
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Destroy(ctx, env) })
+
+	err = d.Start(ctx, env)
+	if err == nil {
+		t.Fatal("expected Start to fail when the node exits")
+	}
+	if !strings.Contains(err.Error(), "exited") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, ok := pidOf(env); ok {
+		t.Error("expected pid to be cleared after failed start")
+	}
+}
+
+func TestDriver_RecordedPIDReused(t *testing.T) {
+	if _, ok := processStartTime(os.Getpid()); !ok {
+		t.Skip("process start times are not available on this platform")
+	}
+
+	d := newTestDriver(t)
+	ctx := context.Background()
+
+	env, err := d.Provision(ctx, session.ProvisionOptions{SessionID: "s-reused"})
+	if err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	t.Cleanup(func() { _ = d.Destroy(ctx, env) })
+
+	// An unrelated process now has the PID recorded for the node
+	other := exec.Command("sleep", "60")
+	if err := other.Start(); err != nil {
+		t.Fatalf("start other process: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = other.Process.Kill()
+		_ = other.Wait()
+	})
+	reuse := func() {
+		env.Details[detailPID] = strconv.Itoa(other.Process.Pid)
+		env.Details[detailStartTime] = "1"
+	}
+
+	reuse()
+	if err := d.Stop(ctx, env); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !processAlive(other.Process.Pid) {
+		t.Fatal("Stop signalled a process it did not start")
+	}
+	if _, ok := pidOf(env); ok {
+		t.Error("expected pid to be cleared by Stop")
+	}
+
+	reuse()
+	if err := d.Start(ctx, env); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if pid, _ := pidOf(env); pid == other.Process.Pid {
+		t.Error("expected Start to record the new node's pid")
+	}
+	if err := d.Stop(ctx, env); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !processAlive(other.Process.Pid) {
+		t.Error("Stop signalled a process it did not start")
+	}
+}
@@ -0,0 +1,16 @@
+package local
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	// The driver tests re-execute this binary as a stand-in for `tndrl serve`
+	if os.Getenv(helperEnv) == "1" {
+		os.Exit(runHelperNode(os.Args[1:]))
+	}
+	goleak.VerifyTestMain(m)
+}
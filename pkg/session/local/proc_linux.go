@@ -0,0 +1,28 @@
+package local
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+)
+
+// processStartTime returns when the process with the given ID started, in
+// clock ticks since boot, from /proc/<pid>/stat. Together with the PID it
+// identifies the process across PID reuse.
+func processStartTime(pid int) (string, bool) {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return "", false
+	}
+	// The command name may contain spaces and parentheses; the fields after
+	// it start with the state (field 3), so starttime (field 22) is the 20th.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return "", false
+	}
+	fields := bytes.Fields(data[i+1:])
+	if len(fields) < 20 {
+		return "", false
+	}
+	return string(fields[19]), true
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package local
+
+// processStartTime is not available on this platform, so a recorded process
+// is identified by its PID alone.
+func processStartTime(pid int) (string, bool) {
+	return "", false
+}
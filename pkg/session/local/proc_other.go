@@ -0,0 +1,19 @@
+//go:build !unix
+
+package local
+
+import (
+	"os"
+	"syscall"
+)
+
+// detachedProcAttr returns nil: the node is started as a plain child process.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+// processAlive reports whether a process with the given ID exists.
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
@@ -0,0 +1,19 @@
+//go:build unix
+
+package local
+
+import (
+	"syscall"
+)
+
+// detachedProcAttr starts the node in its own session so it is not killed
+// along with the CLI's process group.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// processAlive reports whether a process with the given ID exists.
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -0,0 +1,288 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// File names inside a session directory.
+const (
+	metaFile    = "meta.json"
+	historyFile = "history.json"
+	driverFile  = "driver.json"
+)
+
+// ErrNotFound is returned when a session does not exist in the registry.
+var ErrNotFound = errors.New("session not found")
+
+// validID matches session IDs that are safe to use as directory names.
+var validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Registry persists sessions on disk, one directory per session:
+//
+//	<dir>/<id>/meta.json     session metadata
+//	<dir>/<id>/history.json  conversation history
+//	<dir>/<id>/driver.json   driver environment state
+type Registry struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+// NewRegistry creates a registry rooted at dir, creating it if needed.
+func NewRegistry(dir string) (*Registry, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create session directory: %w", err)
+	}
+	return &Registry{dir: dir}, nil
+}
+
+// Dir returns the directory holding a session's files.
+func (r *Registry) Dir(id string) string {
+	return filepath.Join(r.dir, id)
+}
+
+// Create registers a new session. It fails if the ID is already in use.
+func (r *Registry) Create(s *Session) error {
+	if !validID.MatchString(s.ID) {
+		return fmt.Errorf("invalid session ID %q", s.ID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := os.Mkdir(r.Dir(s.ID), 0700); err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("session %s already exists", s.ID)
+		}
+		return fmt.Errorf("create session: %w", err)
+	}
+	return writeJSON(filepath.Join(r.Dir(s.ID), metaFile), s)
+}
+
+// Save updates the metadata of an existing session.
+func (r *Registry) Save(s *Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.dirFor(s.ID); err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(r.Dir(s.ID), metaFile), s)
+}
+
+// Get loads a session by ID.
+func (r *Registry) Get(id string) (*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := r.dirFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return readSession(dir)
+}
+
+// List returns all sessions, newest first.
+func (r *Registry) List() ([]*Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read session directory: %w", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if !entry.IsDir() || !validID.MatchString(entry.Name()) {
+			continue
+		}
+		s, err := readSession(filepath.Join(r.dir, entry.Name()))
+		if errors.Is(err, ErrNotFound) {
+			// Directory without metadata (e.g. interrupted create)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.After(sessions[j].CreatedAt)
+	})
+	return sessions, nil
+}
+
+// Delete removes a session and all of its files.
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := r.dirFor(id)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// History returns the conversation history recorded for a session.
+func (r *Registry) History(id string) (*History, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := r.dirFor(id)
+	if err != nil {
+		return nil, err
+	}
+	return readHistory(dir)
+}
+
+// AppendHistory adds messages to a session's conversation history.
+// Messages without a timestamp are stamped with the current time.
+func (r *Registry) AppendHistory(id string, msgs ...Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := r.dirFor(id)
+	if err != nil {
+		return err
+	}
+	h, err := readHistory(dir)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, m := range msgs {
+		if m.Timestamp.IsZero() {
+			m.Timestamp = now
+		}
+		h.Messages = append(h.Messages, m)
+	}
+	return writeJSON(filepath.Join(dir, historyFile), h)
+}
+
+// SaveEnvironment records the driver environment of a session.
+func (r *Registry) SaveEnvironment(env *Environment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := r.dirFor(env.ID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(filepath.Join(dir, driverFile), env)
+}
+
+// Environment returns the driver environment recorded for a session.
+// It returns nil without error if the session has no environment.
+func (r *Registry) Environment(id string) (*Environment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir, err := r.dirFor(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, driverFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read environment: %w", err)
+	}
+
+	var env Environment
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("parse environment: %w", err)
+	}
+	return &env, nil
+}
+
+// dirFor returns the directory of an existing session.
+func (r *Registry) dirFor(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	dir := r.Dir(id)
+	if _, err := os.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+		}
+		return "", fmt.Errorf("stat session: %w", err)
+	}
+	return dir, nil
+}
+
+// readSession loads the metadata file from a session directory.
+func readSession(dir string) (*Session, error) {
+	data, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, filepath.Base(dir))
+		}
+		return nil, fmt.Errorf("read session: %w", err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse session %s: %w", filepath.Base(dir), err)
+	}
+	return &s, nil
+}
+
+// readHistory loads the history file from a session directory.
+// A session without recorded history has an empty history.
+func readHistory(dir string) (*History, error) {
+	var h History
+	data, err := os.ReadFile(filepath.Join(dir, historyFile))
+	if os.IsNotExist(err) {
+		return &h, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read history: %w", err)
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, fmt.Errorf("parse history: %w", err)
+	}
+	return &h, nil
+}
+
+// writeJSON atomically writes v as indented JSON to path.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", filepath.Base(path), err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write %s: %w", filepath.Base(path), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
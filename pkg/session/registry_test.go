@@ -0,0 +1,205 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := NewRegistry(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	return r
+}
+
+func TestRegistry_CreateAndGet(t *testing.T) {
+	r := newTestRegistry(t)
+
+	s := New("local", "Fix the failing tests")
+	if err := r.Create(s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	got, err := r.Get(s.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.Task != s.Task || got.Driver != "local" || got.State != StateCreating {
+		t.Errorf("unexpected session: %+v", got)
+	}
+
+	if err := r.Create(s); err == nil {
+		t.Error("expected error creating duplicate session")
+	}
+}
+
+func TestRegistry_Save(t *testing.T) {
+	r := newTestRegistry(t)
+
+	s := New("local", "task")
+	if err := r.Create(s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	if err := s.Transition(StateStarting); err != nil {
+		t.Fatalf("Transition: %v", err)
+	}
+	s.Endpoint = "localhost:4433"
+	if err := r.Save(s); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	got, err := r.Get(s.ID)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got.State != StateStarting || got.Endpoint != "localhost:4433" {
+		t.Errorf("unexpected session: %+v", got)
+	}
+
+	if err := r.Save(&Session{ID: "s-missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Save missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRegistry_NotFound(t *testing.T) {
+	r := newTestRegistry(t)
+
+	for _, id := range []string{"s-missing", "../escape", ""} {
+		if _, err := r.Get(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) error = %v, want ErrNotFound", id, err)
+		}
+		if err := r.Delete(id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Delete(%q) error = %v, want ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestRegistry_List(t *testing.T) {
+	r := newTestRegistry(t)
+
+	now := time.Now().UTC()
+	for i, id := range []string{"s-old", "s-new", "s-mid"} {
+		offsets := []time.Duration{-2 * time.Hour, 0, -time.Hour}
+		s := New("local", "task")
+		s.ID = id
+		s.CreatedAt = now.Add(offsets[i])
+		if err := r.Create(s); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	sessions, err := r.List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	want := []string{"s-new", "s-mid", "s-old"}
+	if len(sessions) != len(want) {
+		t.Fatalf("expected %d sessions, got %d", len(want), len(sessions))
+	}
+	for i, s := range sessions {
+		if s.ID != want[i] {
+			t.Errorf("sessions[%d].ID = %q, want %q", i, s.ID, want[i])
+		}
+	}
+}
+
+func TestRegistry_Delete(t *testing.T) {
+	r := newTestRegistry(t)
+
+	s := New("local", "task")
+	if err := r.Create(s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := r.Delete(s.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := r.Get(s.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestRegistry_History(t *testing.T) {
+	r := newTestRegistry(t)
+
+	s := New("local", "task")
+	if err := r.Create(s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	h, err := r.History(s.ID)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(h.Messages) != 0 {
+		t.Fatalf("expected empty history, got %d messages", len(h.Messages))
+	}
+
+	if err := r.AppendHistory(s.ID,
+		Message{Role: "user", Content: "Fix the tests"},
+		Message{Role: "assistant", Content: "Which ones?"},
+	); err != nil {
+		t.Fatalf("AppendHistory: %v", err)
+	}
+	if err := r.AppendHistory(s.ID, Message{Role: "user", Content: "All of them"}); err != nil {
+		t.Fatalf("AppendHistory: %v", err)
+	}
+
+	h, err = r.History(s.ID)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(h.Messages) != 3 {
+		t.Fatalf("expected 3 messages, got %d", len(h.Messages))
+	}
+	if h.Messages[2].Content != "All of them" {
+		t.Errorf("unexpected last message: %+v", h.Messages[2])
+	}
+	if h.Messages[0].Timestamp.IsZero() {
+		t.Error("expected messages to be timestamped")
+	}
+}
+
+func TestRegistry_Environment(t *testing.T) {
+	r := newTestRegistry(t)
+
+	s := New("local", "task")
+	if err := r.Create(s); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	env, err := r.Environment(s.ID)
+	if err != nil {
+		t.Fatalf("Environment: %v", err)
+	}
+	if env != nil {
+		t.Fatalf("expected no environment, got %+v", env)
+	}
+
+	want := &Environment{
+		ID:       s.ID,
+		Driver:   "local",
+		Endpoint: "127.0.0.1:4433",
+		Workdir:  "/tmp/work",
+		Details:  map[string]string{"pid": "1234"},
+	}
+	if err := r.SaveEnvironment(want); err != nil {
+		t.Fatalf("SaveEnvironment: %v", err)
+	}
+
+	env, err = r.Environment(s.ID)
+	if err != nil {
+		t.Fatalf("Environment: %v", err)
+	}
+	if env.Endpoint != want.Endpoint || env.Workdir != want.Workdir || env.Details["pid"] != "1234" {
+		t.Errorf("unexpected environment: %+v", env)
+	}
+
+	if err := r.SaveEnvironment(&Environment{ID: "s-missing"}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SaveEnvironment missing session error = %v, want ErrNotFound", err)
+	}
+}
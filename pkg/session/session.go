@@ -0,0 +1,149 @@
+// Package session manages tndrl sessions: units of work that run an agent
+// in a provisioned environment until it finishes or needs human input.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// State is the lifecycle state of a session.
+type State string
+
+// Session states. See docs/design/sessions.md for the lifecycle diagram.
+const (
+	// StateCreating means the driver is provisioning the environment.
+	StateCreating State = "creating"
+	// StateStarting means the tndrl node is booting and being connected to.
+	StateStarting State = "starting"
+	// StateWorking means the agent is working on the task.
+	StateWorking State = "working"
+	// StateWaiting means the agent is blocked on human input.
+	StateWaiting State = "waiting"
+	// StateComplete means the task finished (success or failure).
+	StateComplete State = "complete"
+	// StateStopped means the environment has been torn down.
+	StateStopped State = "stopped"
+)
+
+// ErrInvalidTransition is returned when a state change is not allowed by the lifecycle.
+var ErrInvalidTransition = errors.New("invalid session state transition")
+
+// transitions lists the allowed next states for each state.
+// Every state may additionally move to StateStopped.
+var transitions = map[State][]State{
+	StateCreating: {StateStarting},
+	StateStarting: {StateWorking},
+	StateWorking:  {StateWaiting, StateComplete},
+	StateWaiting:  {StateWorking},
+}
+
+// CanTransition reports whether a session may move from one state to another.
+func CanTransition(from, to State) bool {
+	if to == StateStopped {
+		return from != StateStopped
+	}
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Valid reports whether s is a known session state.
+func (s State) Valid() bool {
+	switch s {
+	case StateCreating, StateStarting, StateWorking, StateWaiting, StateComplete, StateStopped:
+		return true
+	}
+	return false
+}
+
+// Session is the persisted metadata for a session.
+type Session struct {
+	// ID is the unique session identifier (e.g. "s-7f3a09c2").
+	ID string `json:"id"`
+
+	// Driver is the name of the driver that provisioned the environment.
+	Driver string `json:"driver"`
+
+	// Task is the initial task description given to the agent.
+	Task string `json:"task"`
+
+	// State is the current lifecycle state.
+	State State `json:"state"`
+
+	// Endpoint is the address of the tndrl node running the session.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// ContextID is the A2A context ID that groups the session's messages.
+	ContextID string `json:"contextId,omitempty"`
+
+	// TaskID is the A2A task awaiting input, if any.
+	TaskID string `json:"taskId,omitempty"`
+
+	// Error describes why the session failed, if it did.
+	Error string `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// New creates a session in the creating state with a fresh ID.
+func New(driver, task string) *Session {
+	now := time.Now().UTC()
+	id := NewID()
+	return &Session{
+		ID:        id,
+		Driver:    driver,
+		Task:      task,
+		State:     StateCreating,
+		ContextID: id,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// NewID returns a new random session ID.
+func NewID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("session: generate id: %v", err))
+	}
+	return "s-" + hex.EncodeToString(b)
+}
+
+// Transition moves the session to a new state, enforcing the lifecycle.
+func (s *Session) Transition(to State) error {
+	if !CanTransition(s.State, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, s.State, to)
+	}
+	s.State = to
+	s.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// Fail records an error and stops the session.
+func (s *Session) Fail(err error) {
+	s.Error = err.Error()
+	if s.State != StateStopped {
+		s.State = StateStopped
+	}
+	s.UpdatedAt = time.Now().UTC()
+}
+
+// Message is one entry in a session's conversation history.
+type Message struct {
+	Role      string    `json:"role"` // "user", "assistant", "system"
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// History is the conversation history of a session.
+type History struct {
+	Messages []Message `json:"messages"`
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	s := New("local", "Fix the failing tests")
+
+	if s.State != StateCreating {
+		t.Errorf("State = %q, want %q", s.State, StateCreating)
+	}
+	if !strings.HasPrefix(s.ID, "s-") {
+		t.Errorf("ID = %q, want s- prefix", s.ID)
+	}
+	if s.ContextID != s.ID {
+		t.Errorf("ContextID = %q, want session ID %q", s.ContextID, s.ID)
+	}
+	if s.CreatedAt.IsZero() {
+		t.Error("CreatedAt not set")
+	}
+}
+
+func TestNewID_Unique(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := NewID()
+		if seen[id] {
+			t.Fatalf("duplicate ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestTransition_Lifecycle(t *testing.T) {
+	s := New("local", "task")
+
+	for _, to := range []State{StateStarting, StateWorking, StateWaiting, StateWorking, StateComplete, StateStopped} {
+		if err := s.Transition(to); err != nil {
+			t.Fatalf("Transition(%s): %v", to, err)
+		}
+		if s.State != to {
+			t.Errorf("State = %q, want %q", s.State, to)
+		}
+	}
+}
+
+func TestTransition_Invalid(t *testing.T) {
+	tests := []struct {
+		from, to State
+	}{
+		{StateCreating, StateWorking},
+		{StateStarting, StateComplete},
+		{StateWaiting, StateComplete},
+		{StateComplete, StateWorking},
+		{StateStopped, StateStarting},
+		{StateStopped, StateStopped},
+	}
+
+	for _, tt := range tests {
+		s := &Session{State: tt.from}
+		err := s.Transition(tt.to)
+		if !errors.Is(err, ErrInvalidTransition) {
+			t.Errorf("%s -> %s: error = %v, want ErrInvalidTransition", tt.from, tt.to, err)
+		}
+		if s.State != tt.from {
+			t.Errorf("%s -> %s: state changed to %q", tt.from, tt.to, s.State)
+		}
+	}
+}
+
+func TestTransition_AnyToStopped(t *testing.T) {
+	for _, from := range []State{StateCreating, StateStarting, StateWorking, StateWaiting, StateComplete} {
+		if !CanTransition(from, StateStopped) {
+			t.Errorf("expected %s -> stopped to be allowed", from)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	s := New("local", "task")
+	s.Fail(errors.New("provision failed"))
+
+	if s.State != StateStopped {
+		t.Errorf("State = %q, want %q", s.State, StateStopped)
+	}
+	if s.Error != "provision failed" {
+		t.Errorf("Error = %q, want %q", s.Error, "provision failed")
+	}
+}
+
+func TestState_Valid(t *testing.T) {
+	if !StateWaiting.Valid() {
+		t.Error("expected waiting to be valid")
+	}
+	if State("running").Valid() {
+		t.Error("expected running to be invalid")
+	}
+}
@@ -0,0 +1,199 @@
+package transfer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DialFunc opens a file transfer stream to the peer.
+type DialFunc func(ctx context.Context) (net.Conn, error)
+
+// Client transfers files to and from one peer.
+type Client struct {
+	dial DialFunc
+}
+
+// NewClient returns a client opening its streams with dial.
+func NewClient(dial DialFunc) *Client {
+	return &Client{dial: dial}
+}
+
+// Upload sends the file at path to the peer, resuming a transfer of the same
+// content that was cut off, and returns a reference to it.
+func (c *Client) Upload(ctx context.Context, path string) (Ref, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Ref{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return Ref{}, fmt.Errorf("hash %s: %w", path, err)
+	}
+	ref := Ref{
+		SHA256:   hex.EncodeToString(h.Sum(nil)),
+		Size:     size,
+		Name:     filepath.Base(path),
+		MimeType: mime.TypeByExtension(filepath.Ext(path)),
+	}
+
+	conn, r, err := c.request(ctx, request{Op: "put", SHA256: ref.SHA256, Size: size})
+	if err != nil {
+		return Ref{}, err
+	}
+	defer conn.Close()
+
+	resp, err := readResponse(r)
+	if err != nil {
+		return Ref{}, err
+	}
+	if resp.Offset < 0 || resp.Offset > size {
+		return Ref{}, fmt.Errorf("peer asked for offset %d of a %d byte file", resp.Offset, size)
+	}
+	switch {
+	case resp.Offset == size:
+		slog.Debug("peer already has file", "sha256", ref.SHA256)
+	case resp.Offset > 0:
+		slog.Info("resuming upload", "file", path, "offset", resp.Offset)
+	}
+
+	if _, err := f.Seek(resp.Offset, io.SeekStart); err != nil {
+		return Ref{}, err
+	}
+	if err := copyChunks(conn, f, size-resp.Offset, conn, DefaultIdleTimeout); err != nil {
+		return Ref{}, fmt.Errorf("send %s: %w", path, err)
+	}
+	if _, err := readResponse(r); err != nil {
+		return Ref{}, err
+	}
+	return ref, nil
+}
+
+// Download fetches the file with the given SHA-256 from the peer to path.
+// Data is written to path with a ".part" suffix first, from which an
+// interrupted download resumes, and moved into place once its content is
+// verified.
+func (c *Client) Download(ctx context.Context, sum, path string) (Ref, error) {
+	if err := validateSum(sum); err != nil {
+		return Ref{}, err
+	}
+	part, err := os.OpenFile(path+partSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return Ref{}, err
+	}
+	defer part.Close()
+	offset, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return Ref{}, err
+	}
+	if offset > 0 {
+		slog.Info("resuming download", "file", path, "offset", offset)
+	}
+
+	conn, r, err := c.request(ctx, request{Op: "get", SHA256: sum, Offset: offset})
+	if err != nil {
+		return Ref{}, err
+	}
+	defer conn.Close()
+
+	resp, err := readResponse(r)
+	if err != nil {
+		return Ref{}, err
+	}
+	if err := copyChunks(part, r, resp.Size-offset, conn, DefaultIdleTimeout); err != nil {
+		return Ref{}, fmt.Errorf("receive %s: %w", sum, err)
+	}
+
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return Ref{}, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, part); err != nil {
+		return Ref{}, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		part.Close()
+		os.Remove(part.Name())
+		return Ref{}, fmt.Errorf("%w: received %s, want %s", ErrHashMismatch, got, sum)
+	}
+	if err := part.Close(); err != nil {
+		return Ref{}, err
+	}
+	if err := os.Rename(part.Name(), path); err != nil {
+		return Ref{}, err
+	}
+	return Ref{
+		SHA256:   sum,
+		Size:     resp.Size,
+		Name:     filepath.Base(path),
+		MimeType: mime.TypeByExtension(filepath.Ext(path)),
+	}, nil
+}
+
+// request opens a stream and writes a request on it. The stream is closed
+// when ctx is done.
+func (c *Client) request(ctx context.Context, req request) (net.Conn, *bufio.Reader, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open transfer stream: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	closer := &stopConn{Conn: conn, stop: stop}
+
+	line, err := json.Marshal(req)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		closer.Close()
+		return nil, nil, fmt.Errorf("send request: %w", err)
+	}
+	return closer, bufio.NewReader(conn), nil
+}
+
+// stopConn stops watching the request's context when the stream is closed.
+type stopConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *stopConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// readResponse reads a response line, returning its error if it has one.
+func readResponse(r *bufio.Reader) (response, error) {
+	line, err := r.ReadBytes('\n')
+	if errors.Is(err, io.EOF) {
+		return response{}, errors.New("peer closed the transfer stream")
+	}
+	if err != nil {
+		return response{}, fmt.Errorf("read response: %w", err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return response{}, fmt.Errorf("read response: %w", err)
+	}
+	if resp.Error != "" {
+		return response{}, fmt.Errorf("peer: %s", resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,246 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/authz"
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// DefaultMaxSize is the largest file a server accepts by default (4 GiB).
+const DefaultMaxSize = 4 << 30
+
+// maxRequestSize bounds a request line. Requests name a file and a size or
+// offset, so they are far smaller.
+const maxRequestSize = 4 << 10
+
+// DefaultIdleTimeout is how long a transfer may go without progress before
+// it is abandoned.
+const DefaultIdleTimeout = time.Minute
+
+// Server answers file transfer requests from the store.
+type Server struct {
+	// Store holds the files served and received.
+	Store *Store
+
+	// Policy restricts MethodPut and MethodGet to allowed identities, as it
+	// restricts gRPC methods. Nil allows any peer with a certificate.
+	Policy *authz.Policy
+
+	// MaxSize is the largest file accepted (default DefaultMaxSize).
+	MaxSize int64
+
+	// IdleTimeout abandons a stalled transfer (default DefaultIdleTimeout).
+	IdleTimeout time.Duration
+}
+
+// Serve answers the requests of clients connecting to l until l is closed.
+// It then closes open connections and returns once their transfers end.
+func (s *Server) Serve(l net.Listener) error {
+	var (
+		mu    sync.Mutex
+		conns = make(map[net.Conn]struct{})
+		wg    sync.WaitGroup
+	)
+	defer func() {
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.ServeConn(conn); err != nil {
+				slog.Warn("file transfer failed", "remote", conn.RemoteAddr(), "err", err)
+			}
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// ServeConn answers the request on one stream. The peer must have presented
+// a certificate.
+func (s *Server) ServeConn(conn net.Conn) error {
+	// The request line is read through a limited reader, so that a peer
+	// cannot make the server buffer an endless line
+	limited := &io.LimitedReader{R: conn, N: maxRequestSize}
+	br := bufio.NewReader(limited)
+	conn.SetReadDeadline(time.Now().Add(s.idleTimeout()))
+	line, err := br.ReadBytes('\n')
+	if err != nil && limited.N == 0 {
+		writeResponse(conn, response{Error: fmt.Sprintf("request exceeds %d bytes", maxRequestSize)})
+		return fmt.Errorf("read request: line exceeds %d bytes", maxRequestSize)
+	}
+	if err != nil {
+		return fmt.Errorf("read request: %w", err)
+	}
+	// File data follows the line: first what br buffered, then the rest
+	r := io.MultiReader(br, conn)
+
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return writeResponse(conn, response{Error: "malformed request: " + err.Error()})
+	}
+
+	var method string
+	switch req.Op {
+	case "put":
+		method = MethodPut
+	case "get":
+		method = MethodGet
+	default:
+		return writeResponse(conn, response{Error: fmt.Sprintf("unknown op %q", req.Op)})
+	}
+
+	identity, err := peerIdentity(conn)
+	if err != nil {
+		writeResponse(conn, response{Error: "permission denied: " + err.Error()})
+		return err
+	}
+	if !s.Policy.Allowed(identity, method) {
+		writeResponse(conn, response{Error: fmt.Sprintf("permission denied: %s may not call %s", identity, method)})
+		return fmt.Errorf("%s denied %s", identity, method)
+	}
+	slog.Debug("file transfer", "op", req.Op, "sha256", req.SHA256, "peer", identity)
+
+	if req.Op == "put" {
+		return s.put(conn, r, req)
+	}
+	return s.get(conn, req)
+}
+
+// put receives a file into the store.
+func (s *Server) put(conn net.Conn, r io.Reader, req request) error {
+	if req.Size < 0 || req.Size > s.maxSize() {
+		return writeResponse(conn, response{Error: fmt.Sprintf("file size %d exceeds the limit of %d bytes", req.Size, s.maxSize())})
+	}
+	offset, part, done, err := s.Store.receive(req.SHA256, req.Size)
+	if err != nil {
+		return writeResponse(conn, response{Error: err.Error()})
+	}
+	defer done()
+	if err := writeResponse(conn, response{Offset: offset}); err != nil {
+		return err
+	}
+	if part == nil {
+		return writeResponse(conn, response{Size: req.Size})
+	}
+	defer part.Close()
+
+	if err := copyChunks(part, r, req.Size-offset, conn, s.idleTimeout()); err != nil {
+		return fmt.Errorf("receive %s: %w", req.SHA256, err)
+	}
+	if err := s.Store.commit(req.SHA256, part); err != nil {
+		writeResponse(conn, response{Error: err.Error()})
+		return err
+	}
+	slog.Info("file received", "sha256", req.SHA256, "size", req.Size, "resumed_at", offset)
+	return writeResponse(conn, response{Size: req.Size})
+}
+
+// get sends a stored file from the requested offset.
+func (s *Server) get(conn net.Conn, req request) error {
+	f, err := s.Store.Open(req.SHA256)
+	if err != nil {
+		return writeResponse(conn, response{Error: err.Error()})
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return writeResponse(conn, response{Error: err.Error()})
+	}
+	if req.Offset < 0 || req.Offset > info.Size() {
+		return writeResponse(conn, response{Error: fmt.Sprintf("offset %d is outside the file's %d bytes", req.Offset, info.Size())})
+	}
+	if err := writeResponse(conn, response{Size: info.Size()}); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(req.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	return copyChunks(conn, f, info.Size()-req.Offset, conn, s.idleTimeout())
+}
+
+func (s *Server) maxSize() int64 {
+	if s.MaxSize > 0 {
+		return s.MaxSize
+	}
+	return DefaultMaxSize
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+	return DefaultIdleTimeout
+}
+
+// copyChunks copies n bytes from r to w a chunk at a time, extending the
+// deadline of conn as each chunk arrives.
+func copyChunks(w io.Writer, r io.Reader, n int64, conn net.Conn, idle time.Duration) error {
+	buf := make([]byte, ChunkSize)
+	for n > 0 {
+		conn.SetDeadline(time.Now().Add(idle))
+		chunk := buf[:min(n, int64(len(buf)))]
+		read, err := io.ReadFull(r, chunk)
+		if read > 0 {
+			if _, werr := w.Write(chunk[:read]); werr != nil {
+				return werr
+			}
+			n -= int64(read)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	conn.SetDeadline(time.Time{})
+	return nil
+}
+
+// writeResponse writes a response line.
+func writeResponse(w io.Writer, resp response) error {
+	line, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// peerIdentity returns the SPIFFE ID in the certificate the peer of a
+// stream presented.
+func peerIdentity(conn net.Conn) (string, error) {
+	info, ok := transport.InfoOf(conn)
+	if !ok {
+		return "", fmt.Errorf("connection %T has no TLS state", conn)
+	}
+	return info.PeerIdentity()
+}
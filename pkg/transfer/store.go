@@ -0,0 +1,307 @@
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// partSuffix marks a file still being received.
+const partSuffix = ".part"
+
+// DefaultMaxStoreSize is how much space a store's files may take by default
+// (16 GiB).
+const DefaultMaxStoreSize = 16 << 30
+
+// DefaultPartMaxAge is how long a partial file that no transfer is
+// resuming is kept by default.
+const DefaultPartMaxAge = 24 * time.Hour
+
+// StoreOptions configures a Store.
+type StoreOptions struct {
+	// MaxSize is how many bytes the stored and partial files may take
+	// together (default DefaultMaxStoreSize). The least recently used files
+	// are removed to make room for new ones.
+	MaxSize int64
+
+	// PartMaxAge is how long a partial file is kept after its transfer was
+	// cut off, for the transfer to resume (default DefaultPartMaxAge).
+	PartMaxAge time.Duration
+}
+
+// Store keeps transferred files in a directory, each named by the hex
+// SHA-256 of its content. Files being received are kept next to them with a
+// ".part" suffix until their content is verified.
+type Store struct {
+	dir        string
+	maxSize    int64
+	partMaxAge time.Duration
+
+	mu sync.Mutex
+	// receiving holds the sizes of the files being received, so that two
+	// uploads of the same file do not write the same partial file, and so
+	// that the space they will take is set aside
+	receiving map[string]int64
+}
+
+// NewStore creates a store rooted at dir, creating it if needed.
+func NewStore(dir string) (*Store, error) {
+	return NewStoreWithOptions(dir, StoreOptions{})
+}
+
+// NewStoreWithOptions creates a store rooted at dir, creating it if needed.
+// Files over the size budget and stale partial files are removed.
+func NewStoreWithOptions(dir string, opts StoreOptions) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("create file directory: %w", err)
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = DefaultMaxStoreSize
+	}
+	if opts.PartMaxAge <= 0 {
+		opts.PartMaxAge = DefaultPartMaxAge
+	}
+	s := &Store{
+		dir:        dir,
+		maxSize:    opts.MaxSize,
+		partMaxAge: opts.PartMaxAge,
+		receiving:  make(map[string]int64),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.makeRoom(""); err != nil {
+		slog.Warn("file store is over its size budget", "dir", dir, "err", err)
+	}
+	return s, nil
+}
+
+// Path returns where the file with the given SHA-256 is kept.
+func (s *Store) Path(sum string) string {
+	return filepath.Join(s.dir, sum)
+}
+
+// Stat returns the size of a stored file, or ErrNotFound.
+func (s *Store) Stat(sum string) (int64, error) {
+	if err := validateSum(sum); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(s.Path(sum))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("%w: %s", ErrNotFound, sum)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Open opens a stored file for reading, or returns ErrNotFound. The file
+// counts as used, so it is among the last removed to make room.
+func (s *Store) Open(sum string) (*os.File, error) {
+	if err := validateSum(sum); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.Path(sum))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, sum)
+	}
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	os.Chtimes(s.Path(sum), now, now)
+	return f, nil
+}
+
+// Add stores the content read from r, for files a node produces itself,
+// such as artifacts of its tasks. Other files are removed to make room for
+// it; if it does not fit, ErrStoreFull is returned.
+func (s *Store) Add(r io.Reader) (Ref, error) {
+	tmp, err := os.CreateTemp(s.dir, "add-*"+partSuffix)
+	if err != nil {
+		return Ref{}, fmt.Errorf("create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if err != nil {
+		return Ref{}, fmt.Errorf("write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Ref{}, fmt.Errorf("write file: %w", err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+	if err := os.Rename(tmp.Name(), s.Path(sum)); err != nil {
+		return Ref{}, fmt.Errorf("store file: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.makeRoom(sum); err != nil {
+		os.Remove(s.Path(sum))
+		return Ref{}, err
+	}
+	return Ref{SHA256: sum, Size: size}, nil
+}
+
+// receive prepares to receive a file of the given size, returning how many
+// bytes of it are already stored and the partial file to append the rest
+// to. The file is nil if it is already stored in full. Other files are
+// removed to make room for it; if it does not fit, ErrStoreFull is
+// returned. done must be called once the transfer ends.
+func (s *Store) receive(sum string, size int64) (offset int64, part *os.File, done func(), err error) {
+	if err := validateSum(sum); err != nil {
+		return 0, nil, nil, err
+	}
+	if stored, err := s.Stat(sum); err == nil {
+		if stored != size {
+			return 0, nil, nil, fmt.Errorf("%w: %s is stored with %d bytes, not %d", ErrHashMismatch, sum, stored, size)
+		}
+		return size, nil, func() {}, nil
+	}
+
+	s.mu.Lock()
+	if _, ok := s.receiving[sum]; ok {
+		s.mu.Unlock()
+		return 0, nil, nil, fmt.Errorf("%s is already being received", sum)
+	}
+	s.receiving[sum] = size
+	if err := s.makeRoom(""); err != nil {
+		delete(s.receiving, sum)
+		s.mu.Unlock()
+		return 0, nil, nil, err
+	}
+	s.mu.Unlock()
+	done = func() {
+		s.mu.Lock()
+		delete(s.receiving, sum)
+		s.mu.Unlock()
+	}
+
+	part, err = os.OpenFile(s.Path(sum)+partSuffix, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		done()
+		return 0, nil, nil, fmt.Errorf("open partial file: %w", err)
+	}
+	offset, err = part.Seek(0, io.SeekEnd)
+	if err == nil && offset > size {
+		// Not a prefix of this file; start over
+		offset = 0
+		err = part.Truncate(0)
+		if err == nil {
+			_, err = part.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		part.Close()
+		done()
+		return 0, nil, nil, fmt.Errorf("open partial file: %w", err)
+	}
+	return offset, part, done, nil
+}
+
+// commit verifies a fully received partial file and moves it into place.
+// A partial file whose content does not match is removed, so the next
+// attempt starts over.
+func (s *Store) commit(sum string, part *os.File) error {
+	if _, err := part.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, part); err != nil {
+		return fmt.Errorf("verify file: %w", err)
+	}
+	if err := part.Close(); err != nil {
+		return fmt.Errorf("write file: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != sum {
+		os.Remove(part.Name())
+		return fmt.Errorf("%w: received %s, want %s", ErrHashMismatch, got, sum)
+	}
+	return os.Rename(part.Name(), s.Path(sum))
+}
+
+// storedFile is a file found in the store directory.
+type storedFile struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+// makeRoom removes stored files, least recently used first, until the
+// files kept and those being received fit in the size budget, returning
+// ErrStoreFull if they cannot. The file named keep is never removed.
+// Partial files no transfer has resumed for PartMaxAge are removed first.
+// The caller must hold s.mu.
+func (s *Store) makeRoom(keep string) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("read file directory: %w", err)
+	}
+
+	// Files being received count at their full size
+	var used int64
+	for _, size := range s.receiving {
+		used += size
+	}
+	var stored []storedFile
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		if sum, ok := strings.CutSuffix(name, partSuffix); ok {
+			if _, ok := s.receiving[sum]; ok {
+				continue
+			}
+			if time.Since(info.ModTime()) > s.partMaxAge {
+				if os.Remove(filepath.Join(s.dir, name)) == nil {
+					slog.Debug("removed stale partial file", "name", name)
+					continue
+				}
+			}
+			used += info.Size()
+			continue
+		}
+		if validateSum(name) != nil {
+			continue
+		}
+		used += info.Size()
+		if name != keep {
+			stored = append(stored, storedFile{name: name, size: info.Size(), modTime: info.ModTime()})
+		}
+	}
+
+	slices.SortFunc(stored, func(a, b storedFile) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, f := range stored {
+		if used <= s.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.dir, f.name)); err != nil {
+			continue
+		}
+		used -= f.size
+		slog.Info("removed file to make room", "sha256", f.name, "size", f.size)
+	}
+	if used > s.maxSize {
+		return fmt.Errorf("%w: %d bytes needed, %d allowed", ErrStoreFull, used, s.maxSize)
+	}
+	return nil
+}
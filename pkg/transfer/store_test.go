@@ -0,0 +1,156 @@
+package transfer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_Add(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	ref, err := store.Add(strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	const want = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if ref.SHA256 != want || ref.Size != 5 {
+		t.Errorf("Add = %+v, want %s with 5 bytes", ref, want)
+	}
+	if size, err := store.Stat(want); err != nil || size != 5 {
+		t.Errorf("Stat = %d, %v, want 5", size, err)
+	}
+
+	entries, _ := os.ReadDir(store.dir)
+	if len(entries) != 1 {
+		t.Errorf("store holds %d files, want only the added one", len(entries))
+	}
+}
+
+func TestStore_Stat(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if _, err := store.Stat(strings.Repeat("00", 32)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a missing file = %v, want ErrNotFound", err)
+	}
+	if _, err := store.Stat("../../etc/passwd"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat of a path = %v, want an invalid SHA-256 error", err)
+	}
+}
+
+func TestStore_ReceiveBusy(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	sum := strings.Repeat("11", 32)
+
+	_, part, done, err := store.receive(sum, 10)
+	if err != nil {
+		t.Fatalf("receive: %v", err)
+	}
+	if _, _, _, err := store.receive(sum, 10); err == nil {
+		t.Error("second concurrent receive succeeded")
+	}
+	part.Close()
+	done()
+
+	_, part, done, err = store.receive(sum, 10)
+	if err != nil {
+		t.Fatalf("receive after done: %v", err)
+	}
+	part.Close()
+	done()
+}
+
+func TestStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir(), StoreOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("NewStoreWithOptions: %v", err)
+	}
+	a, err := store.Add(strings.NewReader("aaaa"))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	b, err := store.Add(strings.NewReader("bbbb"))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	age(t, store.Path(a.SHA256), 2*time.Hour)
+	age(t, store.Path(b.SHA256), time.Hour)
+
+	// Reading a makes b the least recently used
+	f, err := store.Open(a.SHA256)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	f.Close()
+
+	c, err := store.Add(strings.NewReader("cccc"))
+	if err != nil {
+		t.Fatalf("Add over the budget: %v", err)
+	}
+	if _, err := store.Stat(b.SHA256); !errors.Is(err, ErrNotFound) {
+		t.Errorf("least recently used file kept: %v", err)
+	}
+	for _, ref := range []Ref{a, c} {
+		if _, err := store.Stat(ref.SHA256); err != nil {
+			t.Errorf("Stat(%s): %v", ref.SHA256, err)
+		}
+	}
+}
+
+func TestStore_Full(t *testing.T) {
+	store, err := NewStoreWithOptions(t.TempDir(), StoreOptions{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("NewStoreWithOptions: %v", err)
+	}
+	if _, _, _, err := store.receive(strings.Repeat("22", 32), 11); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("receive over the budget = %v, want ErrStoreFull", err)
+	}
+	if _, err := store.Add(strings.NewReader(strings.Repeat("x", 11))); !errors.Is(err, ErrStoreFull) {
+		t.Errorf("Add over the budget = %v, want ErrStoreFull", err)
+	}
+	if entries, _ := os.ReadDir(store.dir); len(entries) != 0 {
+		t.Errorf("store holds %d files, want none", len(entries))
+	}
+}
+
+func TestStore_RemovesStaleParts(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, strings.Repeat("33", 32)+partSuffix)
+	fresh := filepath.Join(dir, strings.Repeat("44", 32)+partSuffix)
+	for _, path := range []string{stale, fresh} {
+		if err := os.WriteFile(path, []byte("partial"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age(t, stale, 2*time.Hour)
+
+	if _, err := NewStoreWithOptions(dir, StoreOptions{PartMaxAge: time.Hour}); err != nil {
+		t.Fatalf("NewStoreWithOptions: %v", err)
+	}
+	if _, err := os.Stat(stale); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stale partial file kept: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh partial file removed: %v", err)
+	}
+}
+
+// age sets the modification time of path to d ago.
+func age(t *testing.T, path string, d time.Duration) {
+	t.Helper()
+	then := time.Now().Add(-d)
+	if err := os.Chtimes(path, then, then); err != nil {
+		t.Fatal(err)
+	}
+}
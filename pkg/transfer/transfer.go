@@ -0,0 +1,150 @@
+// Package transfer moves files between nodes over a dedicated stream
+// type, outside of gRPC, so that repository tarballs and build logs need not
+// fit in a message.
+//
+// Files are content-addressed: each is named by the SHA-256 of its
+// content, verified on both ends. A transfer that is cut off resumes from the
+// bytes already received. A2A messages and artifacts refer to a file with a
+// FilePart whose URI is the file's Ref.URI.
+//
+// Each stream carries one request. The opener writes a request as a line of
+// JSON and the server answers with a line of JSON:
+//
+//	{"op":"put","sha256":<hex>,"size":<n>}  ->  {"offset":<k>}
+//
+// after which the client sends bytes k to n of the file and the server
+// answers {"size":<n>} once it has verified the content (or {"error":...}).
+// An offset equal to the size means the server already has the file, and no
+// bytes are sent before the final answer.
+//
+//	{"op":"get","sha256":<hex>,"offset":<k>}  ->  {"size":<n>}
+//
+// after which the server sends bytes k to n. A failed request is answered
+// with {"error":<message>}.
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/a2aproject/a2a-go/a2a"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// StreamType is the stream type file transfers run on.
+const StreamType transport.StreamType = 0x03
+
+// StreamTypeName is the name StreamType is registered under.
+const StreamTypeName = "file"
+
+// Methods name the operations for authz rules, as gRPC method names do.
+const (
+	MethodPut = "/tndrl.transfer/Put"
+	MethodGet = "/tndrl.transfer/Get"
+)
+
+// ChunkSize is how much file data is read or written at a time. Received
+// data is written to disk a chunk at a time, so an interrupted transfer
+// resumes from the last chunk stored.
+const ChunkSize = 256 << 10
+
+// URIScheme is the scheme of URIs referring to transferred files.
+const URIScheme = "tndrl-file"
+
+// ErrNotFound is returned when the requested file is not in the store.
+var ErrNotFound = errors.New("file not found")
+
+// ErrStoreFull is returned when a file does not fit in the store's size
+// budget, even with all other files removed.
+var ErrStoreFull = errors.New("file store is full")
+
+// ErrHashMismatch is returned when received content does not have the
+// expected SHA-256.
+var ErrHashMismatch = errors.New("content hash mismatch")
+
+// Ref refers to a transferred file.
+type Ref struct {
+	// SHA256 is the hex SHA-256 of the content.
+	SHA256 string
+
+	// Size is the content length in bytes.
+	Size int64
+
+	// Name and MimeType describe the file; they are not part of its
+	// identity.
+	Name     string
+	MimeType string
+}
+
+// URI returns the URI referring to the file, "tndrl-file:sha256:<hex>".
+func (r Ref) URI() string {
+	return URIScheme + ":sha256:" + r.SHA256
+}
+
+// FilePart returns an A2A file part referring to the file.
+func (r Ref) FilePart() a2a.FilePart {
+	return a2a.FilePart{
+		File: a2a.FileURI{
+			URI:      r.URI(),
+			FileMeta: a2a.FileMeta{Name: r.Name, MimeType: r.MimeType},
+		},
+		Metadata: map[string]any{"size": r.Size},
+	}
+}
+
+// ParseURI returns the hex SHA-256 of the file a URI refers to.
+func ParseURI(uri string) (string, error) {
+	sum, ok := strings.CutPrefix(uri, URIScheme+":sha256:")
+	if !ok {
+		return "", fmt.Errorf("not a %s URI: %q", URIScheme, uri)
+	}
+	if err := validateSum(sum); err != nil {
+		return "", err
+	}
+	return sum, nil
+}
+
+// RefFromPart returns the file an A2A file part refers to, if it is a
+// transferred file.
+func RefFromPart(part a2a.FilePart) (Ref, bool) {
+	file, ok := part.File.(a2a.FileURI)
+	if !ok {
+		return Ref{}, false
+	}
+	sum, err := ParseURI(file.URI)
+	if err != nil {
+		return Ref{}, false
+	}
+	ref := Ref{SHA256: sum, Name: file.Name, MimeType: file.MimeType}
+	if size, ok := part.Metadata["size"].(float64); ok {
+		ref.Size = int64(size)
+	} else if size, ok := part.Metadata["size"].(int64); ok {
+		ref.Size = size
+	}
+	return ref, true
+}
+
+// validateSum checks that sum is a hex SHA-256.
+func validateSum(sum string) error {
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != sha256.Size || strings.ToLower(sum) != sum {
+		return fmt.Errorf("invalid SHA-256 %q", sum)
+	}
+	return nil
+}
+
+type request struct {
+	Op     string `json:"op"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size,omitempty"`
+	Offset int64  `json:"offset,omitempty"`
+}
+
+type response struct {
+	Offset int64  `json:"offset,omitempty"`
+	Size   int64  `json:"size,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
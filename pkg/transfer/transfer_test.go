@@ -0,0 +1,300 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a2aproject/a2a-go/a2a"
+
+	"github.com/shanemcd/tndrl/pkg/authz"
+	"github.com/shanemcd/tndrl/pkg/pki"
+	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+)
+
+// testPeer is a node serving file transfers, and a client of it.
+type testPeer struct {
+	store  *Store
+	client *Client
+	dial   func(ctx context.Context) (net.Conn, error)
+}
+
+func newTestPeer(t *testing.T, policy *authz.Policy) *testPeer {
+	t.Helper()
+
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("GenerateCA: %v", err)
+	}
+	serverCert, err := pki.GenerateCert(ca, pki.NodeIdentity("server"), true, false)
+	if err != nil {
+		t.Fatalf("GenerateCert: %v", err)
+	}
+	clientCert, err := pki.GenerateCert(ca, pki.NodeIdentity("client"), false, true)
+	if err != nil {
+		t.Fatalf("GenerateCert: %v", err)
+	}
+	serverTLS, err := pki.ServerTLSConfig(serverCert, ca)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig: %v", err)
+	}
+	clientTLS, err := pki.ClientTLSConfig(clientCert, ca, "localhost")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig: %v", err)
+	}
+
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+
+	listener, err := quictransport.ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	fileListener, err := listener.RegisterStreamType(StreamType, StreamTypeName)
+	if err != nil {
+		t.Fatalf("RegisterStreamType: %v", err)
+	}
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		(&Server{Store: store, Policy: policy}).Serve(fileListener)
+	}()
+
+	dialer := quictransport.NewMuxDialer(clientTLS, nil)
+	addr := listener.Addr().String()
+	t.Cleanup(func() {
+		dialer.Close()
+		listener.Close()
+		<-served
+	})
+
+	dial := func(ctx context.Context) (net.Conn, error) {
+		return dialer.Dial(ctx, addr, StreamType)
+	}
+	return &testPeer{
+		store:  store,
+		client: NewClient(dial),
+		dial:   dial,
+	}
+}
+
+// writeRandom writes a file of random content and returns its SHA-256.
+func writeRandom(t *testing.T, path string, size int) ([]byte, string) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return data, hex.EncodeToString(sum[:])
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestUploadDownload(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	ctx := testContext(t)
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "build.log")
+	data, sum := writeRandom(t, src, 3*ChunkSize+17)
+
+	ref, err := peer.client.Upload(ctx, src)
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if ref.SHA256 != sum || ref.Size != int64(len(data)) || ref.Name != "build.log" {
+		t.Errorf("ref = %+v, want %s with %d bytes", ref, sum, len(data))
+	}
+	if stored, err := os.ReadFile(peer.store.Path(sum)); err != nil || !bytes.Equal(stored, data) {
+		t.Fatalf("stored file differs: %v", err)
+	}
+
+	// Uploading the same content again sends nothing
+	if _, err := peer.client.Upload(ctx, src); err != nil {
+		t.Fatalf("second Upload: %v", err)
+	}
+
+	dst := filepath.Join(dir, "copy.log")
+	if _, err := peer.client.Download(ctx, sum, dst); err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if got, err := os.ReadFile(dst); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("downloaded file differs: %v", err)
+	}
+	if _, err := os.Stat(dst + partSuffix); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("partial file left behind: %v", err)
+	}
+}
+
+func TestUpload_Empty(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	ctx := testContext(t)
+
+	src := filepath.Join(t.TempDir(), "empty.log")
+	_, sum := writeRandom(t, src, 0)
+	for range 2 {
+		if _, err := peer.client.Upload(ctx, src); err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+	}
+	if size, err := peer.store.Stat(sum); err != nil || size != 0 {
+		t.Errorf("Stat = %d, %v, want an empty file", size, err)
+	}
+}
+
+func TestUpload_Resume(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	ctx := testContext(t)
+
+	src := filepath.Join(t.TempDir(), "repo.tar")
+	data, sum := writeRandom(t, src, 2*ChunkSize)
+
+	// The first chunk arrived before the transfer was cut off
+	if err := os.WriteFile(peer.store.Path(sum)+partSuffix, data[:ChunkSize], 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.client.Upload(ctx, src); err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	if stored, err := os.ReadFile(peer.store.Path(sum)); err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("resumed file differs: %v", err)
+	}
+}
+
+func TestUpload_HashMismatch(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	ctx := testContext(t)
+
+	src := filepath.Join(t.TempDir(), "repo.tar")
+	data, sum := writeRandom(t, src, 1000)
+
+	// A corrupt partial file is detected once the rest arrives
+	corrupt := bytes.Clone(data[:500])
+	corrupt[0] ^= 0xff
+	if err := os.WriteFile(peer.store.Path(sum)+partSuffix, corrupt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.client.Upload(ctx, src); err == nil || !strings.Contains(err.Error(), ErrHashMismatch.Error()) {
+		t.Fatalf("Upload error = %v, want a hash mismatch", err)
+	}
+	if _, err := peer.store.Stat(sum); !errors.Is(err, ErrNotFound) {
+		t.Errorf("corrupt file stored: %v", err)
+	}
+
+	// The partial file was discarded, so the next attempt succeeds
+	if _, err := peer.client.Upload(ctx, src); err != nil {
+		t.Fatalf("retried Upload: %v", err)
+	}
+}
+
+func TestDownload_Resume(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	ctx := testContext(t)
+	dir := t.TempDir()
+
+	ref, err := peer.store.Add(strings.NewReader(strings.Repeat("log line\n", 50000)))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	data, _ := os.ReadFile(peer.store.Path(ref.SHA256))
+
+	dst := filepath.Join(dir, "out.log")
+	if err := os.WriteFile(dst+partSuffix, data[:1234], 0600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := peer.client.Download(ctx, ref.SHA256, dst)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if got.Size != ref.Size {
+		t.Errorf("downloaded %d bytes, want %d", got.Size, ref.Size)
+	}
+	if out, _ := os.ReadFile(dst); !bytes.Equal(out, data) {
+		t.Error("resumed download differs")
+	}
+}
+
+func TestDownload_NotFound(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	sum := strings.Repeat("ab", sha256.Size)
+	_, err := peer.client.Download(testContext(t), sum, filepath.Join(t.TempDir(), "missing"))
+	if err == nil || !strings.Contains(err.Error(), ErrNotFound.Error()) {
+		t.Errorf("Download error = %v, want not found", err)
+	}
+}
+
+func TestServer_RequestTooLong(t *testing.T) {
+	peer := newTestPeer(t, nil)
+	ctx := testContext(t)
+
+	conn, err := peer.dial(ctx)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// A request line that never ends is refused once it passes the limit
+	if _, err := conn.Write(bytes.Repeat([]byte("x"), 2*maxRequestSize)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	if !strings.Contains(line, "request exceeds") {
+		t.Errorf("response = %q, want the request refused as too long", line)
+	}
+}
+
+func TestServer_Policy(t *testing.T) {
+	policy, err := authz.NewPolicy([]authz.Rule{{
+		Methods: []string{MethodPut},
+		Allow:   []string{pki.NodeIdentity("ci-*")},
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	peer := newTestPeer(t, policy)
+
+	src := filepath.Join(t.TempDir(), "x")
+	writeRandom(t, src, 10)
+	if _, err := peer.client.Upload(testContext(t), src); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("Upload error = %v, want permission denied", err)
+	}
+}
+
+func TestRefFilePart(t *testing.T) {
+	ref := Ref{SHA256: strings.Repeat("0f", sha256.Size), Size: 42, Name: "a.txt", MimeType: "text/plain"}
+	part := ref.FilePart()
+	if got, ok := RefFromPart(part); !ok || got != ref {
+		t.Errorf("RefFromPart = %+v, %v, want %+v", got, ok, ref)
+	}
+
+	if _, ok := RefFromPart(a2a.FilePart{File: a2a.FileURI{URI: "https://example.com/a.txt"}}); ok {
+		t.Error("RefFromPart accepted a URI of another scheme")
+	}
+	for _, uri := range []string{"tndrl-file:sha256:xyz", "tndrl-file:sha256:" + strings.Repeat("AB", sha256.Size), "tndrl-file:md5:00"} {
+		if _, err := ParseURI(uri); err == nil {
+			t.Errorf("ParseURI(%q) succeeded", uri)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// authType identifies AuthInfo in gRPC peer information.
+const authType = "tndrl-tls"
+
+// AuthInfo carries the TLS state of the connection a gRPC stream runs
+// over. gRPC handlers read it from peer.FromContext.
+type AuthInfo struct {
+	credentials.CommonAuthInfo
+
+	// State is the connection's TLS state, including the verified peer
+	// certificates.
+	State tls.ConnectionState
+}
+
+// AuthType implements credentials.AuthInfo.
+func (AuthInfo) AuthType() string {
+	return authType
+}
+
+// PeerIdentity returns the SPIFFE ID of the peer that made the gRPC call in
+// ctx, taken from its verified TLS certificate. It understands AuthInfo as
+// well as the standard gRPC TLS credentials.
+func PeerIdentity(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", errors.New("no peer in context")
+	}
+
+	var state tls.ConnectionState
+	switch info := p.AuthInfo.(type) {
+	case AuthInfo:
+		state = info.State
+	case credentials.TLSInfo:
+		state = info.State
+	default:
+		return "", fmt.Errorf("peer has no TLS state (%T)", p.AuthInfo)
+	}
+
+	if len(state.PeerCertificates) == 0 {
+		return "", errors.New("peer presented no certificate")
+	}
+	return pki.IdentityFromCert(state.PeerCertificates[0])
+}
+
+// Credentials returns gRPC transport credentials for streams opened by a
+// Dialer or accepted by a Listener. The connection is already secured by
+// TLS, so no handshake takes place; the credentials only expose the
+// connection's TLS state to gRPC as AuthInfo.
+func Credentials() credentials.TransportCredentials {
+	return streamCredentials{}
+}
+
+type streamCredentials struct{}
+
+// ClientHandshake implements credentials.TransportCredentials.
+func (streamCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info, err := authInfo(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, info, nil
+}
+
+// ServerHandshake implements credentials.TransportCredentials.
+func (streamCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	info, err := authInfo(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, info, nil
+}
+
+// Info implements credentials.TransportCredentials.
+func (streamCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: authType}
+}
+
+// Clone implements credentials.TransportCredentials.
+func (c streamCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+// OverrideServerName implements credentials.TransportCredentials.
+func (streamCredentials) OverrideServerName(string) error {
+	return nil
+}
+
+// authInfo builds the AuthInfo for a stream.
+func authInfo(conn net.Conn) (AuthInfo, error) {
+	info, ok := InfoOf(conn)
+	if !ok {
+		return AuthInfo{}, fmt.Errorf("transport credentials: unexpected connection type %T", conn)
+	}
+	return AuthInfo{
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		State:          info.TLS,
+	}, nil
+}
@@ -0,0 +1,451 @@
+// Package memory implements pkg/transport in memory, for tests.
+//
+// Listeners and dialers on a Network reach each other by address without
+// sockets, and streams are buffered pipes. Each side of a connection sees
+// the certificate the other was given as its peer's, so code reading the
+// caller's identity from the TLS state, such as authz and the transport
+// credentials, works unchanged. No TLS handshake takes place: certificates
+// are not verified.
+//
+// Addresses are plain names that DNS cannot resolve, so gRPC clients dial
+// them with the passthrough scheme:
+//
+//	grpc.NewClient("passthrough:///"+addr,
+//		grpc.WithContextDialer(dialer.StreamDialer(transport.StreamTypeControl)),
+//		grpc.WithTransportCredentials(transport.Credentials()),
+//	)
+package memory
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// Transport is the transport name memory connections report.
+const Transport = "memory"
+
+// errConnClosed ends the streams of a closed connection.
+var errConnClosed = fmt.Errorf("connection closed: %w", net.ErrClosed)
+
+// Addr is the address of a listener or dialer on a Network.
+type Addr string
+
+// Network returns "memory".
+func (a Addr) Network() string { return Transport }
+
+func (a Addr) String() string { return string(a) }
+
+// Network connects the listeners and dialers created from it.
+type Network struct {
+	mu        sync.Mutex
+	listeners map[Addr]*Listener
+	next      int
+}
+
+// NewNetwork returns an empty network.
+func NewNetwork() *Network {
+	return &Network{listeners: make(map[Addr]*Listener)}
+}
+
+// Listen starts a listener that dialers on the network reach at addr. An
+// empty addr picks an unused one. cert is the certificate the listener
+// presents to dialers; nil presents none.
+func (n *Network) Listen(addr string, cert *x509.Certificate) (*Listener, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	a := Addr(addr)
+	if a == "" {
+		a = n.newAddrLocked("listener")
+	}
+	if _, ok := n.listeners[a]; ok {
+		return nil, fmt.Errorf("listen %s: address already in use", a)
+	}
+
+	l := &Listener{
+		network: n,
+		addr:    a,
+		cert:    cert,
+		conns:   make(map[*link]struct{}),
+		streams: map[transport.StreamType]chan net.Conn{
+			transport.StreamTypeControl: make(chan net.Conn, 16),
+			transport.StreamTypeA2A:     make(chan net.Conn, 16),
+		},
+		done: make(chan struct{}),
+	}
+	n.listeners[a] = l
+	return l, nil
+}
+
+// Dialer returns a dialer presenting cert to listeners; nil presents none.
+func (n *Network) Dialer(cert *x509.Certificate) *Dialer {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return &Dialer{
+		network: n,
+		addr:    n.newAddrLocked("dialer"),
+		cert:    cert,
+		conns:   make(map[string]*link),
+	}
+}
+
+func (n *Network) newAddrLocked(kind string) Addr {
+	n.next++
+	return Addr(fmt.Sprintf("%s-%d", kind, n.next))
+}
+
+func (n *Network) lookup(addr string) (*Listener, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	l, ok := n.listeners[Addr(addr)]
+	return l, ok
+}
+
+func (n *Network) remove(l *Listener) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.listeners[l.addr] == l {
+		delete(n.listeners, l.addr)
+	}
+}
+
+// link is a connection between a dialer and a listener.
+type link struct {
+	client, server *conn
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// onClose runs once the link is closed
+	onClose func()
+
+	mu      sync.Mutex
+	streams map[*Stream]struct{}
+}
+
+func newLink(clientAddr Addr, clientCert *x509.Certificate, serverAddr Addr, serverCert *x509.Certificate) *link {
+	ctx, cancel := context.WithCancel(context.Background())
+	lk := &link{ctx: ctx, cancel: cancel, streams: make(map[*Stream]struct{})}
+	lk.client = &conn{link: lk, info: connInfo(clientAddr, serverAddr, serverCert)}
+	lk.server = &conn{link: lk, info: connInfo(serverAddr, clientAddr, clientCert)}
+	return lk
+}
+
+func connInfo(local, remote Addr, peerCert *x509.Certificate) transport.ConnInfo {
+	info := transport.ConnInfo{
+		Transport:  Transport,
+		LocalAddr:  local,
+		RemoteAddr: remote,
+		TLS:        tls.ConnectionState{Version: tls.VersionTLS13, HandshakeComplete: true},
+	}
+	if peerCert != nil {
+		info.TLS.PeerCertificates = []*x509.Certificate{peerCert}
+	}
+	return info
+}
+
+// openStream returns the two ends of a new stream.
+func (lk *link) openStream() (client, server *Stream, err error) {
+	client, server = newStreamPair(lk)
+
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	if lk.ctx.Err() != nil {
+		return nil, nil, errConnClosed
+	}
+	lk.streams[client] = struct{}{}
+	lk.streams[server] = struct{}{}
+	return client, server, nil
+}
+
+func (lk *link) removeStream(st *Stream) {
+	lk.mu.Lock()
+	delete(lk.streams, st)
+	lk.mu.Unlock()
+}
+
+// close ends the connection and its streams.
+func (lk *link) close() {
+	lk.mu.Lock()
+	if lk.ctx.Err() != nil {
+		lk.mu.Unlock()
+		return
+	}
+	lk.cancel()
+	streams := lk.streams
+	lk.streams = nil
+	lk.mu.Unlock()
+
+	for st := range streams {
+		st.fail(errConnClosed)
+	}
+	if lk.onClose != nil {
+		lk.onClose()
+	}
+}
+
+// conn is one side of a link.
+type conn struct {
+	link *link
+	info transport.ConnInfo
+}
+
+// Info implements transport.Conn.
+func (c *conn) Info() transport.ConnInfo {
+	return c.info
+}
+
+// Context implements transport.Conn.
+func (c *conn) Context() context.Context {
+	return c.link.ctx
+}
+
+// Listener accepts connections from dialers on its network.
+type Listener struct {
+	network *Network
+	addr    Addr
+	cert    *x509.Certificate
+
+	mu      sync.Mutex
+	closed  bool
+	accept  transport.AcceptFunc
+	conns   map[*link]struct{}
+	streams map[transport.StreamType]chan net.Conn
+	done    chan struct{}
+}
+
+// connect accepts a connection from a dialer.
+func (l *Listener) connect(clientAddr Addr, clientCert *x509.Certificate) (*link, error) {
+	lk := newLink(clientAddr, clientCert, l.addr, l.cert)
+	lk.onClose = func() {
+		l.mu.Lock()
+		delete(l.conns, lk)
+		l.mu.Unlock()
+	}
+
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil, errors.New("connection refused")
+	}
+	accept := l.accept
+	l.conns[lk] = struct{}{}
+	l.mu.Unlock()
+
+	if accept != nil {
+		if err := accept(lk.server); err != nil {
+			lk.close()
+			return nil, fmt.Errorf("connection rejected: %s", err)
+		}
+	}
+	return lk, nil
+}
+
+// deliver hands the server end of a stream to the listener for its type.
+func (l *Listener) deliver(ctx context.Context, lk *link, t transport.StreamType, st *Stream) error {
+	l.mu.Lock()
+	ch, ok := l.streams[t]
+	l.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("stream rejected: no service for stream type %s (0x%02x)", t, byte(t))
+	}
+
+	select {
+	case ch <- st:
+		return nil
+	case <-l.done:
+		return net.ErrClosed
+	case <-lk.ctx.Done():
+		return errConnClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Listener returns a net.Listener for the given stream type. Accept fails
+// unless the type is registered.
+func (l *Listener) Listener(t transport.StreamType) net.Listener {
+	return &streamListener{l: l, streamType: t}
+}
+
+// RegisterStreamType makes the listener accept streams of type t, returning
+// a net.Listener for them.
+func (l *Listener) RegisterStreamType(t transport.StreamType, name string) (net.Listener, error) {
+	if err := transport.RegisterStreamType(t, name); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+	if _, ok := l.streams[t]; ok {
+		return nil, fmt.Errorf("stream type %s (0x%02x) is already registered on this listener", t, byte(t))
+	}
+	l.streams[t] = make(chan net.Conn, 16)
+	return l.Listener(t), nil
+}
+
+// SetAcceptFunc installs a check that runs on every new connection.
+func (l *Listener) SetAcceptFunc(fn transport.AcceptFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accept = fn
+}
+
+// Addr returns the address dialers reach the listener at.
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// Transport returns Transport.
+func (l *Listener) Transport() string {
+	return Transport
+}
+
+// Close stops accepting connections and closes those accepted.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.done)
+	conns := l.conns
+	l.conns = nil
+	l.mu.Unlock()
+
+	l.network.remove(l)
+	for lk := range conns {
+		lk.close()
+	}
+	return nil
+}
+
+// streamListener implements net.Listener for a specific stream type.
+type streamListener struct {
+	l          *Listener
+	streamType transport.StreamType
+}
+
+func (sl *streamListener) Accept() (net.Conn, error) {
+	sl.l.mu.Lock()
+	ch, ok := sl.l.streams[sl.streamType]
+	sl.l.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("stream type %s (0x%02x) is not registered", sl.streamType, byte(sl.streamType))
+	}
+
+	select {
+	case conn := <-ch:
+		return conn, nil
+	case <-sl.l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (sl *streamListener) Close() error {
+	// Individual stream listeners don't close the whole listener
+	return nil
+}
+
+func (sl *streamListener) Addr() net.Addr {
+	return sl.l.addr
+}
+
+// Dialer opens streams to listeners on its network, reusing one connection
+// per address.
+type Dialer struct {
+	network *Network
+	addr    Addr
+	cert    *x509.Certificate
+
+	mu    sync.Mutex
+	conns map[string]*link
+}
+
+// Dial opens a stream of the given type to the listener at addr.
+func (d *Dialer) Dial(ctx context.Context, addr string, t transport.StreamType) (net.Conn, error) {
+	lk, l, err := d.getOrCreateConn(addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+
+	client, server, err := lk.openStream()
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	if err := l.deliver(ctx, lk, t, server); err != nil {
+		client.Close()
+		server.Close()
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
+	return client, nil
+}
+
+// getOrCreateConn returns the connection to addr, connecting if there is
+// none.
+func (d *Dialer) getOrCreateConn(addr string) (*link, *Listener, error) {
+	l, ok := d.network.lookup(addr)
+	if !ok {
+		return nil, nil, errors.New("connection refused")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if lk, ok := d.conns[addr]; ok && lk.ctx.Err() == nil {
+		return lk, l, nil
+	}
+	lk, err := l.connect(d.addr, d.cert)
+	if err != nil {
+		return nil, nil, err
+	}
+	d.conns[addr] = lk
+	return lk, l, nil
+}
+
+// StreamDialer returns a function compatible with grpc.WithContextDialer for
+// streams of the given type.
+func (d *Dialer) StreamDialer(t transport.StreamType) transport.DialFunc {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return d.Dial(ctx, addr, t)
+	}
+}
+
+// RegisterStreamType registers the name of stream type t and returns a
+// function opening streams of that type.
+func (d *Dialer) RegisterStreamType(t transport.StreamType, name string) (transport.DialFunc, error) {
+	if err := transport.RegisterStreamType(t, name); err != nil {
+		return nil, err
+	}
+	return d.StreamDialer(t), nil
+}
+
+// Close closes all connections.
+func (d *Dialer) Close() error {
+	d.mu.Lock()
+	conns := d.conns
+	d.conns = make(map[string]*link)
+	d.mu.Unlock()
+
+	for _, lk := range conns {
+		lk.close()
+	}
+	return nil
+}
+
+// Ensure Listener and Dialer implement the transport interfaces
+var (
+	_ transport.Listener = (*Listener)(nil)
+	_ transport.Dialer   = (*Dialer)(nil)
+	_ transport.Conn     = (*conn)(nil)
+)
@@ -0,0 +1,219 @@
+package memory
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+func testCerts(t *testing.T) (server, client *x509.Certificate) {
+	t.Helper()
+
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	serverCert, err := pki.GenerateCert(ca, pki.NodeIdentity("test-server"), true, false)
+	if err != nil {
+		t.Fatalf("generate server cert: %v", err)
+	}
+	clientCert, err := pki.GenerateCert(ca, pki.NodeIdentity("test-client"), false, true)
+	if err != nil {
+		t.Fatalf("generate client cert: %v", err)
+	}
+	return serverCert.Cert, clientCert.Cert
+}
+
+func TestGRPC(t *testing.T) {
+	serverCert, clientCert := testCerts(t)
+	network := NewNetwork()
+
+	listener, err := network.Listen("", serverCert)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	// The server sees the caller's certificate as it does over QUIC
+	callers := make(chan string, 1)
+	srv := grpc.NewServer(
+		grpc.Creds(transport.Credentials()),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if p, ok := peer.FromContext(ctx); ok {
+				if info, ok := p.AuthInfo.(transport.AuthInfo); ok && len(info.State.PeerCertificates) > 0 {
+					id, _ := pki.IdentityFromCert(info.State.PeerCertificates[0])
+					callers <- id
+				}
+			}
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(listener.Listener(transport.StreamTypeControl))
+	defer func() {
+		listener.Close()
+		srv.Stop()
+	}()
+
+	dialer := network.Dialer(clientCert)
+	defer dialer.Close()
+	conn, err := grpc.NewClient("passthrough:///"+listener.Addr().String(),
+		grpc.WithContextDialer(dialer.StreamDialer(transport.StreamTypeControl)),
+		grpc.WithTransportCredentials(transport.Credentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %s", resp.Status)
+	}
+	if id := <-callers; id != pki.NodeIdentity("test-client") {
+		t.Errorf("caller = %q, want %q", id, pki.NodeIdentity("test-client"))
+	}
+}
+
+func TestStreams(t *testing.T) {
+	serverCert, clientCert := testCerts(t)
+	network := NewNetwork()
+
+	listener, err := network.Listen("node-a", serverCert)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+	if _, err := network.Listen("node-a", serverCert); err == nil {
+		t.Error("expected error listening on an address in use")
+	}
+
+	dialer := network.Dialer(clientCert)
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := dialer.Dial(ctx, "node-a", transport.StreamTypeA2A)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	server, err := listener.Listener(transport.StreamTypeA2A).Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+
+	// Each end reports the other's identity
+	info, ok := transport.InfoOf(client)
+	if !ok {
+		t.Fatal("stream carries no connection info")
+	}
+	if info.Transport != Transport {
+		t.Errorf("Transport = %q, want %q", info.Transport, Transport)
+	}
+	if id, err := info.PeerIdentity(); err != nil || id != pki.NodeIdentity("test-server") {
+		t.Errorf("client PeerIdentity = %q, %v", id, err)
+	}
+	info, _ = transport.InfoOf(server)
+	if id, err := info.PeerIdentity(); err != nil || id != pki.NodeIdentity("test-client") {
+		t.Errorf("server PeerIdentity = %q, %v", id, err)
+	}
+
+	// Data written before close is read before EOF
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	client.Close()
+	got, err := io.ReadAll(server)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("ReadAll = %q, %v", got, err)
+	}
+	if _, err := server.Write([]byte("late")); err == nil {
+		t.Error("expected write to a closed stream to fail")
+	}
+	server.Close()
+
+	// Reads honor deadlines
+	client, err = dialer.Dial(ctx, "node-a", transport.StreamTypeA2A)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	client.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read = %v, want os.ErrDeadlineExceeded", err)
+	}
+
+	// Unregistered stream types are rejected
+	if _, err := dialer.Dial(ctx, "node-a", 0x20); err == nil || !strings.Contains(err.Error(), "no service for stream type") {
+		t.Errorf("dial unknown type = %v", err)
+	}
+	if _, err := dialer.Dial(ctx, "node-b", transport.StreamTypeA2A); err == nil {
+		t.Error("expected error dialing an address nothing listens on")
+	}
+
+	// Closing the listener ends its connections and stream listeners
+	server, err = listener.Listener(transport.StreamTypeA2A).Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer server.Close()
+	listener.Close()
+	if _, err := server.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Read after listener close = %v, want net.ErrClosed", err)
+	}
+	if _, err := listener.Listener(transport.StreamTypeA2A).Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Accept after close = %v, want net.ErrClosed", err)
+	}
+	if _, err := dialer.Dial(ctx, "node-a", transport.StreamTypeA2A); err == nil {
+		t.Error("expected error dialing a closed listener")
+	}
+}
+
+func TestAcceptFunc(t *testing.T) {
+	serverCert, clientCert := testCerts(t)
+	network := NewNetwork()
+
+	listener, err := network.Listen("", serverCert)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	callers := make(chan string, 1)
+	listener.SetAcceptFunc(func(conn transport.Conn) error {
+		id, _ := conn.Info().PeerIdentity()
+		callers <- id
+		return errors.New("not today")
+	})
+
+	dialer := network.Dialer(clientCert)
+	defer dialer.Close()
+
+	_, err = dialer.Dial(context.Background(), listener.Addr().String(), transport.StreamTypeControl)
+	if err == nil || !strings.Contains(err.Error(), "not today") {
+		t.Errorf("error %v does not carry the rejection reason", err)
+	}
+	if id := <-callers; id != pki.NodeIdentity("test-client") {
+		t.Errorf("caller = %q, want %q", id, pki.NodeIdentity("test-client"))
+	}
+}
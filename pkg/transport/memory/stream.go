@@ -0,0 +1,223 @@
+package memory
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// Stream is one end of an in-memory stream, usable as a net.Conn. Writes
+// are buffered without limit, so they never block.
+type Stream struct {
+	r, w *buffer
+	info transport.ConnInfo
+	link *link
+
+	mu            sync.Mutex
+	writeDeadline time.Time
+}
+
+// newStreamPair returns the client and server ends of a new stream of the
+// link.
+func newStreamPair(lk *link) (client, server *Stream) {
+	toServer, toClient := newBuffer(), newBuffer()
+	client = &Stream{r: toClient, w: toServer, info: lk.client.info, link: lk}
+	server = &Stream{r: toServer, w: toClient, info: lk.server.info, link: lk}
+	return client, server
+}
+
+// Read reads data the other end wrote. It returns io.EOF once the other end
+// has closed and all data has been read.
+func (st *Stream) Read(b []byte) (int, error) {
+	return st.r.read(b)
+}
+
+// Write sends data to the other end.
+func (st *Stream) Write(b []byte) (int, error) {
+	st.mu.Lock()
+	deadline := st.writeDeadline
+	st.mu.Unlock()
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return st.w.write(b)
+}
+
+// Close closes the stream: the other end reads io.EOF, and its writes fail.
+func (st *Stream) Close() error {
+	st.r.closeRead()
+	st.w.closeWrite()
+	st.link.removeStream(st)
+	return nil
+}
+
+// fail ends the stream with err, discarding unread data.
+func (st *Stream) fail(err error) {
+	st.r.fail(err)
+	st.w.fail(err)
+}
+
+// LocalAddr returns the local address of the connection.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.info.LocalAddr
+}
+
+// RemoteAddr returns the remote address of the connection.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.info.RemoteAddr
+}
+
+// SetDeadline sets the read and write deadlines.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline makes Read fail with os.ErrDeadlineExceeded after t. A
+// zero t disables the deadline.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline makes Write fail with os.ErrDeadlineExceeded after t. A
+// zero t disables the deadline.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	return nil
+}
+
+// Info describes the connection the stream belongs to.
+func (st *Stream) Info() transport.ConnInfo {
+	return st.info
+}
+
+// buffer carries one direction of a stream.
+type buffer struct {
+	mu       sync.Mutex
+	data     bytes.Buffer
+	eof      bool  // the writer closed
+	closed   bool  // the reader closed
+	err      error // the connection ended
+	deadline time.Time
+
+	// ready wakes a blocked read to check the buffer's state again
+	ready chan struct{}
+}
+
+func newBuffer() *buffer {
+	return &buffer{ready: make(chan struct{}, 1)}
+}
+
+func (b *buffer) read(p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		switch {
+		case b.closed:
+			b.mu.Unlock()
+			return 0, net.ErrClosed
+		case b.err != nil:
+			b.mu.Unlock()
+			return 0, b.err
+		case b.data.Len() > 0:
+			n, _ := b.data.Read(p)
+			b.mu.Unlock()
+			return n, nil
+		case b.eof:
+			b.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := b.deadline
+		b.mu.Unlock()
+
+		if err := wait(b.ready, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (b *buffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case b.err != nil:
+		return 0, b.err
+	case b.eof:
+		return 0, net.ErrClosed
+	case b.closed:
+		return 0, io.ErrClosedPipe
+	}
+	b.data.Write(p)
+	b.notify()
+	return len(p), nil
+}
+
+func (b *buffer) closeRead() {
+	b.mu.Lock()
+	b.closed = true
+	b.data.Reset()
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *buffer) closeWrite() {
+	b.mu.Lock()
+	b.eof = true
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *buffer) fail(err error) {
+	b.mu.Lock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.data.Reset()
+	b.mu.Unlock()
+	b.notify()
+}
+
+func (b *buffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	b.deadline = t
+	b.mu.Unlock()
+	b.notify()
+}
+
+// notify wakes a blocked read.
+func (b *buffer) notify() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until ch is signaled or the deadline passes.
+func wait(ch <-chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-ch
+		return nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-t.C:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// Ensure Stream implements net.Conn
+var _ net.Conn = (*Stream)(nil)
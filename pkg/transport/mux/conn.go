@@ -0,0 +1,193 @@
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// errorCodeRejected is the application error code sent when a connection
+// is refused by the listener's AcceptFunc.
+const errorCodeRejected = 0x1
+
+// streamErrorHandshake is the stream error code sent when a stream is
+// abandoned during its handshake.
+const streamErrorHandshake = 0x1
+
+// Conn wraps a session and provides multiplexed stream access. It routes
+// incoming streams by type and provides methods to open typed streams.
+type Conn struct {
+	sess   Session
+	local  net.Addr
+	remote net.Addr
+
+	mu       sync.Mutex
+	closed   bool
+	closeErr error
+}
+
+// NewConn wraps a session for multiplexed stream handling.
+func NewConn(sess Session) *Conn {
+	return &Conn{
+		sess:   sess,
+		local:  sess.LocalAddr(),
+		remote: sess.RemoteAddr(),
+	}
+}
+
+// OpenStream opens a new stream of the given type. It writes the stream
+// preamble and waits for the peer to accept the stream, returning a
+// *StreamRejectedError if it refuses, or ErrHandshakeUnsupported if it
+// predates the handshake.
+func (c *Conn) OpenStream(ctx context.Context, streamType StreamType) (net.Conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("connection closed: %w", c.closeErr)
+	}
+	c.mu.Unlock()
+
+	stream, err := c.sess.OpenStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("open stream: %w", err)
+	}
+	conn := c.newStreamConn(stream, streamType)
+
+	if err := conn.handshake(ctx); err != nil {
+		stream.CancelRead(streamErrorHandshake)
+		stream.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// AcceptStream accepts an incoming stream and reads its preamble, rejecting
+// streams whose protocol version is not supported. The stream is neither
+// accepted nor rejected by its type: the caller must do that with
+// StreamConn.Accept or StreamConn.Reject.
+func (c *Conn) AcceptStream(ctx context.Context) (*StreamConn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("connection closed: %w", c.closeErr)
+	}
+	c.mu.Unlock()
+
+	stream, err := c.sess.AcceptStream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("accept stream: %w", err)
+	}
+	conn := c.newStreamConn(stream, 0)
+
+	stream.SetReadDeadline(time.Now().Add(DefaultHandshakeTimeout))
+	p, err := readPreamble(stream)
+	stream.SetReadDeadline(time.Time{})
+	if err != nil {
+		stream.CancelRead(streamErrorHandshake)
+		stream.Close()
+		return nil, fmt.Errorf("%w: read preamble: %w", errHandshakeFailed, err)
+	}
+	conn.streamType = p.streamType
+
+	// A node that predates the handshake expects no reply
+	if p.maxVersion == 0 {
+		return conn, nil
+	}
+	conn.replyPending = true
+
+	r := negotiate(p, MinProtocolVersion, ProtocolVersion, SupportedFeatures)
+	if r.reason != 0 {
+		conn.Reject(r.reason, r.message)
+		return nil, fmt.Errorf("%w: %s stream: %s: %s", errHandshakeFailed, p.streamType, r.reason, r.message)
+	}
+	conn.version, conn.features = r.version, r.features
+	return conn, nil
+}
+
+// newStreamConn wraps a stream of the connection.
+func (c *Conn) newStreamConn(stream Stream, streamType StreamType) *StreamConn {
+	return &StreamConn{
+		stream:     stream,
+		sess:       c.sess,
+		local:      c.local,
+		remote:     c.remote,
+		streamType: streamType,
+	}
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Transport returns the transport the connection runs over, such as "quic"
+// or "tcp".
+func (c *Conn) Transport() string {
+	return c.sess.Info().Transport
+}
+
+// Close closes the underlying connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return c.closeErr
+	}
+	c.closed = true
+	c.closeErr = c.sess.CloseWithError(0, "connection closed")
+	return c.closeErr
+}
+
+// ConnectionState returns the TLS state of the connection, including the
+// peer's verified certificates.
+func (c *Conn) ConnectionState() tls.ConnectionState {
+	return c.sess.Info().TLS
+}
+
+// reject closes the connection, telling the peer why it was refused.
+func (c *Conn) reject(reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.closeErr = c.sess.CloseWithError(errorCodeRejected, "connection rejected: "+reason)
+}
+
+// isRefusal reports whether err is the peer refusing the stream or the
+// connection, as opposed to a failure of the connection.
+func (c *Conn) isRefusal(err error) bool {
+	var rejected *StreamRejectedError
+	if errors.As(err, &rejected) || errors.Is(err, ErrHandshakeUnsupported) {
+		return true
+	}
+	code, ok := c.sess.PeerCloseCode(err)
+	return ok && code == errorCodeRejected
+}
+
+// Info describes the connection.
+func (c *Conn) Info() transport.ConnInfo {
+	return c.sess.Info()
+}
+
+// Context returns the connection's context, which is canceled when the connection is closed.
+func (c *Conn) Context() context.Context {
+	return c.sess.Context()
+}
+
+// Ensure Conn implements transport.Conn
+var _ transport.Conn = (*Conn)(nil)
@@ -1,44 +1,47 @@
-package quic
+package mux
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"log/slog"
 	"net"
 	"sync"
 
-	"github.com/quic-go/quic-go"
+	"github.com/shanemcd/tndrl/pkg/transport"
 )
 
-// MuxDialer manages multiplexed QUIC connections to remote endpoints.
-// It maintains a single QUIC connection per address and creates typed streams on demand.
-type MuxDialer struct {
-	tlsConfig  *tls.Config
-	quicConfig *quic.Config
+// Dialer manages multiplexed sessions to remote endpoints. It maintains a
+// single connection per address and creates typed streams on demand.
+type Dialer struct {
+	dial DialSessionFunc
 
 	mu    sync.Mutex
-	conns map[string]*MuxConn // addr -> connection
+	conns map[string]*Conn // addr -> connection
 }
 
-// NewMuxDialer creates a new multiplexed dialer.
-func NewMuxDialer(tlsConfig *tls.Config, quicConfig *quic.Config) *MuxDialer {
-	return &MuxDialer{
-		tlsConfig:  tlsConfig,
-		quicConfig: quicConfig,
-		conns:      make(map[string]*MuxConn),
+// NewDialer creates a dialer establishing sessions with dial.
+func NewDialer(dial DialSessionFunc) *Dialer {
+	return &Dialer{
+		dial:  dial,
+		conns: make(map[string]*Conn),
 	}
 }
 
 // Dial opens a stream of the given type to the address.
 // If a connection already exists, it reuses it; otherwise it creates a new one.
-func (d *MuxDialer) Dial(ctx context.Context, addr string, streamType StreamType) (net.Conn, error) {
+// If the peer refuses the stream, the error is a *StreamRejectedError, or
+// ErrHandshakeUnsupported for a peer that predates the stream handshake.
+func (d *Dialer) Dial(ctx context.Context, addr string, streamType StreamType) (net.Conn, error) {
 	muxConn, err := d.getOrCreateConn(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
 
 	stream, err := muxConn.OpenStream(ctx, streamType)
+	if muxConn.isRefusal(err) {
+		// The peer answered; reconnecting will not change its mind
+		return nil, fmt.Errorf("dial %s: %w", addr, err)
+	}
 	if err != nil {
 		// Connection may be dead, remove it and retry once
 		d.removeConn(addr)
@@ -56,17 +59,17 @@ func (d *MuxDialer) Dial(ctx context.Context, addr string, streamType StreamType
 }
 
 // DialControl opens a control stream to the address.
-func (d *MuxDialer) DialControl(ctx context.Context, addr string) (net.Conn, error) {
+func (d *Dialer) DialControl(ctx context.Context, addr string) (net.Conn, error) {
 	return d.Dial(ctx, addr, StreamTypeControl)
 }
 
 // DialA2A opens an A2A stream to the address.
-func (d *MuxDialer) DialA2A(ctx context.Context, addr string) (net.Conn, error) {
+func (d *Dialer) DialA2A(ctx context.Context, addr string) (net.Conn, error) {
 	return d.Dial(ctx, addr, StreamTypeA2A)
 }
 
 // getOrCreateConn returns an existing connection or creates a new one.
-func (d *MuxDialer) getOrCreateConn(ctx context.Context, addr string) (*MuxConn, error) {
+func (d *Dialer) getOrCreateConn(ctx context.Context, addr string) (*Conn, error) {
 	d.mu.Lock()
 	if muxConn, ok := d.conns[addr]; ok {
 		d.mu.Unlock()
@@ -77,13 +80,13 @@ func (d *MuxDialer) getOrCreateConn(ctx context.Context, addr string) (*MuxConn,
 
 	// Create new connection
 	slog.Debug("establishing connection", "addr", addr)
-	qconn, err := quic.DialAddr(ctx, addr, d.tlsConfig, d.quicConfig)
+	sess, err := d.dial(ctx, addr)
 	if err != nil {
 		slog.Debug("connection failed", "addr", addr, "err", err)
 		return nil, fmt.Errorf("dial %s: %w", addr, err)
 	}
 
-	muxConn := NewMuxConn(qconn)
+	muxConn := NewConn(sess)
 
 	d.mu.Lock()
 	// Check again in case another goroutine created it
@@ -108,14 +111,14 @@ func (d *MuxDialer) getOrCreateConn(ctx context.Context, addr string) (*MuxConn,
 }
 
 // removeConn removes a connection from the pool.
-func (d *MuxDialer) removeConn(addr string) {
+func (d *Dialer) removeConn(addr string) {
 	d.mu.Lock()
 	delete(d.conns, addr)
 	d.mu.Unlock()
 }
 
 // Close closes all connections.
-func (d *MuxDialer) Close() error {
+func (d *Dialer) Close() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
@@ -129,16 +132,34 @@ func (d *MuxDialer) Close() error {
 	return lastErr
 }
 
-// ControlDialer returns a function compatible with grpc.WithContextDialer for control streams.
-func (d *MuxDialer) ControlDialer() func(context.Context, string) (net.Conn, error) {
-	return func(ctx context.Context, addr string) (net.Conn, error) {
-		return d.DialControl(ctx, addr)
+// RegisterStreamType registers the name of stream type t, as
+// Listener.RegisterStreamType does on the accepting side, and returns a
+// function compatible with grpc.WithContextDialer that opens streams of
+// that type.
+func (d *Dialer) RegisterStreamType(t StreamType, name string) (transport.DialFunc, error) {
+	if err := transport.RegisterStreamType(t, name); err != nil {
+		return nil, err
 	}
+	return d.StreamDialer(t), nil
 }
 
-// A2ADialer returns a function compatible with grpc.WithContextDialer for A2A streams.
-func (d *MuxDialer) A2ADialer() func(context.Context, string) (net.Conn, error) {
+// StreamDialer returns a function compatible with grpc.WithContextDialer for
+// streams of the given type.
+func (d *Dialer) StreamDialer(streamType StreamType) transport.DialFunc {
 	return func(ctx context.Context, addr string) (net.Conn, error) {
-		return d.DialA2A(ctx, addr)
+		return d.Dial(ctx, addr, streamType)
 	}
 }
+
+// ControlDialer returns a function compatible with grpc.WithContextDialer for control streams.
+func (d *Dialer) ControlDialer() func(context.Context, string) (net.Conn, error) {
+	return d.StreamDialer(StreamTypeControl)
+}
+
+// A2ADialer returns a function compatible with grpc.WithContextDialer for A2A streams.
+func (d *Dialer) A2ADialer() func(context.Context, string) (net.Conn, error) {
+	return d.StreamDialer(StreamTypeA2A)
+}
+
+// Ensure Dialer implements transport.Dialer
+var _ transport.Dialer = (*Dialer)(nil)
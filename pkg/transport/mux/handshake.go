@@ -0,0 +1,225 @@
+package mux
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// Every stream starts with a handshake. The opening side writes a preamble:
+//
+//	magic (1) | min version (1) | max version (1) | stream type (1) | features (2)
+//
+// and the accepting side replies with:
+//
+//	reason (1) | version (1) | features (2) | message length (1) | message
+//
+// A zero reason accepts the stream at the negotiated version and features;
+// anything else rejects it, and the message says why. The magic byte,
+// transport.PreambleMagic, is never a stream type, so a stream opened by a
+// node that predates the handshake, which writes the bare stream type, is
+// still recognized and accepted without a reply.
+const (
+	preambleSize = 6
+	replySize    = 5
+)
+
+// Protocol versions of the stream handshake this package speaks.
+const (
+	// ProtocolVersion is the newest version supported.
+	ProtocolVersion = 1
+
+	// MinProtocolVersion is the oldest version supported.
+	MinProtocolVersion = 1
+)
+
+// DefaultHandshakeTimeout bounds how long the accepting side waits for a
+// stream's preamble.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Features are optional stream capabilities, negotiated per stream as the
+// bits both sides set.
+type Features uint16
+
+// SupportedFeatures are the features this package offers. None are defined
+// yet; the bits are reserved so that later versions can add some without a
+// new protocol version.
+const SupportedFeatures Features = 0
+
+// RejectReason says why the accepting side refused a stream.
+type RejectReason byte
+
+const (
+	// RejectUnsupportedVersion means no protocol version is supported by
+	// both sides.
+	RejectUnsupportedVersion RejectReason = 0x01
+
+	// RejectUnknownStreamType means the peer serves no such stream type.
+	RejectUnknownStreamType RejectReason = 0x02
+
+	// RejectUnavailable means the peer is shutting down.
+	RejectUnavailable RejectReason = 0x03
+
+	// RejectMalformed means the preamble could not be parsed.
+	RejectMalformed RejectReason = 0x04
+)
+
+func (r RejectReason) String() string {
+	switch r {
+	case RejectUnsupportedVersion:
+		return "unsupported version"
+	case RejectUnknownStreamType:
+		return "unknown stream type"
+	case RejectUnavailable:
+		return "unavailable"
+	case RejectMalformed:
+		return "malformed preamble"
+	default:
+		return fmt.Sprintf("reason 0x%02x", byte(r))
+	}
+}
+
+// StreamRejectedError is returned when opening a stream the peer refused.
+type StreamRejectedError struct {
+	StreamType StreamType
+	Reason     RejectReason
+	Message    string
+}
+
+func (e *StreamRejectedError) Error() string {
+	msg := fmt.Sprintf("%s stream (0x%02x) rejected by peer: %s", e.StreamType, byte(e.StreamType), e.Reason)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// ErrHandshakeUnsupported is returned when opening a stream to a peer that
+// closed it without replying to the preamble, as nodes that predate the
+// stream handshake do.
+var ErrHandshakeUnsupported = errors.New("peer closed the stream without a handshake reply (it may run an older version)")
+
+// errHandshakeFailed marks accepted streams that were rejected during the
+// handshake, so that the connection keeps accepting streams.
+var errHandshakeFailed = errors.New("stream handshake failed")
+
+// preamble is the first frame of a stream.
+type preamble struct {
+	minVersion byte
+	maxVersion byte
+	streamType StreamType
+	features   Features
+}
+
+func (p preamble) marshal() []byte {
+	b := []byte{byte(transport.PreambleMagic), p.minVersion, p.maxVersion, byte(p.streamType), 0, 0}
+	binary.BigEndian.PutUint16(b[4:], uint16(p.features))
+	return b
+}
+
+// reply is the accepting side's answer to a preamble.
+type reply struct {
+	reason   RejectReason
+	version  byte
+	features Features
+	message  string
+}
+
+func (r reply) marshal() []byte {
+	msg := r.message
+	if len(msg) > 255 {
+		msg = msg[:255]
+	}
+	b := []byte{byte(r.reason), r.version, 0, 0, byte(len(msg))}
+	binary.BigEndian.PutUint16(b[2:], uint16(r.features))
+	return append(b, msg...)
+}
+
+// readPreamble reads a stream's preamble. A stream opened by a node that
+// predates the handshake starts with its bare type, and is returned as a
+// version 0 preamble.
+func readPreamble(r io.Reader) (preamble, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return preamble{}, err
+	}
+	if StreamType(first[0]) != transport.PreambleMagic {
+		return preamble{streamType: StreamType(first[0])}, nil
+	}
+
+	b := make([]byte, preambleSize-1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return preamble{}, err
+	}
+	return preamble{
+		minVersion: b[0],
+		maxVersion: b[1],
+		streamType: StreamType(b[2]),
+		features:   Features(binary.BigEndian.Uint16(b[3:])),
+	}, nil
+}
+
+// readReply reads the reply to a preamble.
+func readReply(r io.Reader) (reply, error) {
+	b := make([]byte, replySize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return reply{}, err
+	}
+	msg := make([]byte, b[4])
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return reply{}, err
+	}
+	return reply{
+		reason:   RejectReason(b[0]),
+		version:  b[1],
+		features: Features(binary.BigEndian.Uint16(b[2:])),
+		message:  string(msg),
+	}, nil
+}
+
+// negotiate picks the newest version and the features both sides support,
+// or returns the reply rejecting the stream.
+func negotiate(p preamble, minVersion, maxVersion byte, features Features) reply {
+	if p.minVersion > p.maxVersion {
+		return reply{reason: RejectMalformed, message: fmt.Sprintf("version range %d-%d is empty", p.minVersion, p.maxVersion)}
+	}
+	version := min(p.maxVersion, maxVersion)
+	if version < max(p.minVersion, minVersion) {
+		return reply{
+			reason:  RejectUnsupportedVersion,
+			message: fmt.Sprintf("requested versions %d-%d, supported %d-%d", p.minVersion, p.maxVersion, minVersion, maxVersion),
+		}
+	}
+	return reply{version: version, features: p.features & features}
+}
+
+// deadlineFromContext makes blocked reads and writes on the stream fail
+// when ctx is done, until the returned function is called.
+func deadlineFromContext(ctx context.Context, c *StreamConn) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.SetDeadline(deadline)
+	}
+
+	var mu sync.Mutex
+	stopped := false
+	stop := context.AfterFunc(ctx, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !stopped {
+			c.SetDeadline(time.Now())
+		}
+	})
+	return func() {
+		stop()
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		c.SetDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,66 @@
+package mux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	// This side speaks versions minVersion-3 with features 0b1100
+	tests := []struct {
+		name       string
+		p          preamble
+		minVersion byte
+		reason     RejectReason
+		version    byte
+		features   Features
+	}{
+		{"same", preamble{minVersion: 1, maxVersion: 1}, 1, 0, 1, 0},
+		{"newer peer", preamble{minVersion: 1, maxVersion: 5}, 1, 0, 3, 0},
+		{"older peer", preamble{minVersion: 1, maxVersion: 2}, 1, 0, 2, 0},
+		{"features", preamble{minVersion: 1, maxVersion: 3, features: 0b0110}, 1, 0, 3, 0b0100},
+		{"too new", preamble{minVersion: 4, maxVersion: 6}, 1, RejectUnsupportedVersion, 0, 0},
+		{"too old", preamble{minVersion: 1, maxVersion: 1}, 2, RejectUnsupportedVersion, 0, 0},
+		{"empty range", preamble{minVersion: 3, maxVersion: 2}, 1, RejectMalformed, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := negotiate(tt.p, tt.minVersion, 3, 0b1100)
+			if r.reason != tt.reason {
+				t.Fatalf("reason = %s, want %s", r.reason, tt.reason)
+			}
+			if r.reason == 0 && (r.version != tt.version || r.features != tt.features) {
+				t.Errorf("negotiated version %d features %04b, want %d %04b", r.version, r.features, tt.version, tt.features)
+			}
+			if r.reason != 0 && r.message == "" {
+				t.Error("rejection carries no message")
+			}
+		})
+	}
+}
+
+func TestHandshakeFrames(t *testing.T) {
+	p := preamble{minVersion: 1, maxVersion: 2, streamType: StreamTypeA2A, features: 0x8001}
+	got, err := readPreamble(bytes.NewReader(p.marshal()))
+	if err != nil || got != p {
+		t.Errorf("preamble round trip = %+v, %v, want %+v", got, err, p)
+	}
+
+	// A bare stream type is a stream from a node that predates the handshake
+	got, err = readPreamble(bytes.NewReader([]byte{byte(StreamTypeControl), 'x'}))
+	if err != nil || got != (preamble{streamType: StreamTypeControl}) {
+		t.Errorf("legacy preamble = %+v, %v", got, err)
+	}
+
+	r := reply{reason: RejectUnknownStreamType, message: "no such service"}
+	gotReply, err := readReply(bytes.NewReader(r.marshal()))
+	if err != nil || gotReply != r {
+		t.Errorf("reply round trip = %+v, %v, want %+v", gotReply, err, r)
+	}
+
+	if _, err := readReply(bytes.NewReader([]byte{0, 1})); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short reply error = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -0,0 +1,270 @@
+package mux
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// AcceptFunc decides whether a newly accepted connection may be served.
+// Returning an error closes the connection before any stream is accepted.
+// The connection is a *Conn.
+type AcceptFunc = transport.AcceptFunc
+
+// Listener accepts sessions and routes their streams by type. It provides
+// separate net.Listener interfaces for each stream type, allowing different
+// gRPC servers to handle different stream types.
+type Listener struct {
+	ln SessionListener
+
+	mu      sync.Mutex
+	closed  bool
+	conns   map[*Conn]struct{}
+	streams map[StreamType]chan net.Conn
+	errors  chan error
+	accept  AcceptFunc
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewListener routes the streams of the sessions ln accepts. The listener
+// takes ownership of ln and closes it on Close.
+func NewListener(ln SessionListener) *Listener {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	l := &Listener{
+		ln:    ln,
+		conns: make(map[*Conn]struct{}),
+		streams: map[StreamType]chan net.Conn{
+			StreamTypeControl: make(chan net.Conn, 16),
+			StreamTypeA2A:     make(chan net.Conn, 16),
+		},
+		errors: make(chan error, 8),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	go l.acceptLoop()
+
+	return l
+}
+
+// acceptLoop accepts connections and spawns stream handlers.
+func (l *Listener) acceptLoop() {
+	for {
+		sess, err := l.ln.Accept(l.ctx)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				select {
+				case l.errors <- fmt.Errorf("accept connection: %w", err):
+				default:
+				}
+			}
+			return
+		}
+
+		muxConn := NewConn(sess)
+
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			muxConn.Close()
+			return
+		}
+		l.conns[muxConn] = struct{}{}
+		l.mu.Unlock()
+
+		go l.handleConnection(muxConn)
+	}
+}
+
+// SetAcceptFunc installs a check that runs on every new connection.
+func (l *Listener) SetAcceptFunc(fn AcceptFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.accept = fn
+}
+
+// handleConnection accepts streams from a connection and routes them by type.
+func (l *Listener) handleConnection(muxConn *Conn) {
+	slog.Debug("handling connection", "remote", muxConn.RemoteAddr(), "transport", muxConn.Transport())
+	defer func() {
+		slog.Debug("connection handler done", "remote", muxConn.RemoteAddr())
+		l.mu.Lock()
+		delete(l.conns, muxConn)
+		l.mu.Unlock()
+	}()
+
+	l.mu.Lock()
+	accept := l.accept
+	l.mu.Unlock()
+
+	if accept != nil {
+		if err := accept(muxConn); err != nil {
+			slog.Warn("connection rejected", "remote", muxConn.RemoteAddr(), "err", err)
+			muxConn.reject(err.Error())
+			return
+		}
+	}
+
+	for {
+		conn, err := muxConn.AcceptStream(l.ctx)
+		if errors.Is(err, errHandshakeFailed) {
+			slog.Warn("stream handshake failed", "remote", muxConn.RemoteAddr(), "err", err)
+			continue
+		}
+		if err != nil {
+			// Connection closed or context canceled
+			if !errors.Is(err, context.Canceled) {
+				slog.Debug("accept stream error", "err", err)
+			}
+			return
+		}
+		streamType := conn.StreamType()
+
+		slog.Debug("stream accepted", "type", streamType, "version", conn.Version(), "remote", conn.RemoteAddr())
+
+		l.mu.Lock()
+		streamChan, ok := l.streams[streamType]
+		l.mu.Unlock()
+
+		if !ok {
+			slog.Warn("unknown stream type", "type", streamType, "remote", conn.RemoteAddr())
+			conn.Reject(RejectUnknownStreamType, fmt.Sprintf("no service for stream type 0x%02x", byte(streamType)))
+			continue
+		}
+		if l.ctx.Err() != nil {
+			conn.Reject(RejectUnavailable, "node is shutting down")
+			return
+		}
+		if err := conn.Accept(); err != nil {
+			slog.Debug("accept stream error", "err", err)
+			conn.Close()
+			continue
+		}
+
+		select {
+		case streamChan <- conn:
+		case <-l.ctx.Done():
+			conn.Close()
+			return
+		}
+	}
+}
+
+// RegisterStreamType makes the listener accept streams of type t, returning
+// a net.Listener for them. Control and A2A streams are always accepted;
+// other protocols (file transfer, metrics, tunneling) register their own
+// types. Streams of types that are not registered are rejected.
+func (l *Listener) RegisterStreamType(t StreamType, name string) (net.Listener, error) {
+	if err := transport.RegisterStreamType(t, name); err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, net.ErrClosed
+	}
+	if _, ok := l.streams[t]; ok {
+		return nil, fmt.Errorf("stream type %s (0x%02x) is already registered on this listener", t, byte(t))
+	}
+	l.streams[t] = make(chan net.Conn, 16)
+	return l.Listener(t), nil
+}
+
+// Listener returns a net.Listener for the given stream type.
+// This can be passed to grpc.Server.Serve(). Accept fails unless the type
+// is registered.
+func (l *Listener) Listener(streamType StreamType) net.Listener {
+	return &streamListener{
+		mux:        l,
+		streamType: streamType,
+	}
+}
+
+// ControlListener returns a net.Listener for control streams.
+func (l *Listener) ControlListener() net.Listener {
+	return l.Listener(StreamTypeControl)
+}
+
+// A2AListener returns a net.Listener for A2A streams.
+func (l *Listener) A2AListener() net.Listener {
+	return l.Listener(StreamTypeA2A)
+}
+
+// Addr returns the listener's network address.
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Transport returns the transport the listener accepts connections over.
+func (l *Listener) Transport() string {
+	return l.ln.Transport()
+}
+
+// Close closes the listener and all connections.
+func (l *Listener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	// Stream listeners see the context canceled. The stream channels stay
+	// open, as connection handlers may still be sending on them.
+	l.cancel()
+
+	// Close all connections
+	for conn := range l.conns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	return l.ln.Close()
+}
+
+// streamListener implements net.Listener for a specific stream type.
+type streamListener struct {
+	mux        *Listener
+	streamType StreamType
+}
+
+func (l *streamListener) Accept() (net.Conn, error) {
+	l.mux.mu.Lock()
+	streamChan, ok := l.mux.streams[l.streamType]
+	l.mux.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("stream type %s (0x%02x) is not registered", l.streamType, byte(l.streamType))
+	}
+
+	if l.mux.ctx.Err() != nil {
+		return nil, net.ErrClosed
+	}
+	select {
+	case conn := <-streamChan:
+		return conn, nil
+	case <-l.mux.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *streamListener) Close() error {
+	// Individual stream listeners don't close the whole mux
+	return nil
+}
+
+func (l *streamListener) Addr() net.Addr {
+	return l.mux.Addr()
+}
+
+var _ net.Listener = (*streamListener)(nil)
+
+// Ensure Listener implements transport.Listener
+var _ transport.Listener = (*Listener)(nil)
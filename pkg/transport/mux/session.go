@@ -0,0 +1,74 @@
+// Package mux carries typed streams over any secured, multiplexed session,
+// implementing transport.Listener and transport.Dialer.
+//
+// Every stream starts with a handshake naming its type and negotiating the
+// protocol version, and a Listener routes accepted streams to a
+// net.Listener per type. The sessions themselves come from a transport:
+// pkg/transport/quic runs the mux over QUIC connections and
+// pkg/transport/tcp over its TCP sessions, by adapting them to Session.
+package mux
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// Session is a secured connection carrying streams, such as a QUIC
+// connection.
+type Session interface {
+	// OpenStream opens a stream, blocking until the peer allows it.
+	OpenStream(ctx context.Context) (Stream, error)
+
+	// AcceptStream waits for the peer to open a stream.
+	AcceptStream(ctx context.Context) (Stream, error)
+
+	// CloseWithError closes the session, sending the peer an application
+	// error code and message.
+	CloseWithError(code uint64, message string) error
+
+	// PeerCloseCode reports whether err, returned by the session, means the
+	// peer closed it with an application error, and the code it sent.
+	PeerCloseCode(err error) (code uint64, ok bool)
+
+	// Info describes the session.
+	Info() transport.ConnInfo
+
+	// Context is canceled when the session closes.
+	Context() context.Context
+
+	LocalAddr() net.Addr
+	RemoteAddr() net.Addr
+}
+
+// Stream is a bidirectional stream of a Session. Close ends only the
+// sending side.
+type Stream interface {
+	io.ReadWriteCloser
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+
+	// CancelRead asks the peer to stop sending, with an error code.
+	CancelRead(code uint64)
+
+	// StreamID returns the stream's ID within its session.
+	StreamID() int64
+}
+
+// SessionListener accepts sessions.
+type SessionListener interface {
+	// Accept waits for the next session.
+	Accept(ctx context.Context) (Session, error)
+
+	// Transport names the transport, such as "quic" or "tcp".
+	Transport() string
+
+	Addr() net.Addr
+	Close() error
+}
+
+// DialSessionFunc establishes a session to the address.
+type DialSessionFunc func(ctx context.Context, addr string) (Session, error)
@@ -0,0 +1,177 @@
+package mux
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// StreamConn wraps a session stream to implement net.Conn.
+// Unlike Conn, closing a StreamConn only closes the stream, not the connection.
+type StreamConn struct {
+	stream     Stream
+	sess       Session
+	local      net.Addr
+	remote     net.Addr
+	streamType StreamType
+
+	// version and features are those negotiated in the stream handshake;
+	// version is 0 for a stream opened by a node that predates it
+	version  byte
+	features Features
+
+	// replyPending is set on accepted streams until the handshake reply
+	// is written
+	replyPending bool
+}
+
+// Read reads data from the stream.
+func (c *StreamConn) Read(b []byte) (int, error) {
+	return c.stream.Read(b)
+}
+
+// Write writes data to the stream.
+func (c *StreamConn) Write(b []byte) (int, error) {
+	return c.stream.Write(b)
+}
+
+// Close closes the stream only (not the connection).
+func (c *StreamConn) Close() error {
+	return c.stream.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *StreamConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+// RemoteAddr returns the remote network address.
+func (c *StreamConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *StreamConn) SetDeadline(t time.Time) error {
+	if err := c.stream.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.stream.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *StreamConn) SetReadDeadline(t time.Time) error {
+	return c.stream.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline.
+func (c *StreamConn) SetWriteDeadline(t time.Time) error {
+	return c.stream.SetWriteDeadline(t)
+}
+
+// StreamType returns the type of this stream.
+func (c *StreamConn) StreamType() StreamType {
+	return c.streamType
+}
+
+// StreamID returns the stream's ID within its connection.
+func (c *StreamConn) StreamID() int64 {
+	return c.stream.StreamID()
+}
+
+// Version returns the stream protocol version negotiated in the handshake,
+// or 0 if the peer predates the handshake.
+func (c *StreamConn) Version() int {
+	return int(c.version)
+}
+
+// Features returns the features negotiated in the handshake.
+func (c *StreamConn) Features() Features {
+	return c.features
+}
+
+// Accept completes the handshake of an accepted stream, telling the peer it
+// may use the stream.
+func (c *StreamConn) Accept() error {
+	if !c.replyPending {
+		return nil
+	}
+	c.replyPending = false
+	if _, err := c.stream.Write(reply{version: c.version, features: c.features}.marshal()); err != nil {
+		return fmt.Errorf("write handshake reply: %w", err)
+	}
+	return nil
+}
+
+// Reject refuses an accepted stream, telling the peer why, and closes it.
+func (c *StreamConn) Reject(reason RejectReason, message string) error {
+	var err error
+	if c.replyPending {
+		c.replyPending = false
+		if _, werr := c.stream.Write(reply{reason: reason, message: message}.marshal()); werr != nil {
+			err = fmt.Errorf("write handshake reply: %w", werr)
+		}
+	}
+	c.stream.CancelRead(streamErrorHandshake)
+	c.stream.Close()
+	return err
+}
+
+// handshake writes the preamble of an opened stream and reads the peer's
+// reply.
+func (c *StreamConn) handshake(ctx context.Context) error {
+	defer deadlineFromContext(ctx, c)()
+
+	p := preamble{
+		minVersion: MinProtocolVersion,
+		maxVersion: ProtocolVersion,
+		streamType: c.streamType,
+		features:   SupportedFeatures,
+	}
+	if _, err := c.stream.Write(p.marshal()); err != nil {
+		return fmt.Errorf("write stream preamble: %w", err)
+	}
+
+	r, err := readReply(c.stream)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%s stream: %w", c.streamType, ErrHandshakeUnsupported)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+		return fmt.Errorf("read handshake reply: %w", err)
+	}
+	if r.reason != 0 {
+		return &StreamRejectedError{StreamType: c.streamType, Reason: r.reason, Message: r.message}
+	}
+	if r.version < MinProtocolVersion || r.version > ProtocolVersion {
+		return fmt.Errorf("%s stream: peer chose unsupported version %d", c.streamType, r.version)
+	}
+	c.version, c.features = r.version, r.features&SupportedFeatures
+	return nil
+}
+
+// ConnectionState returns the TLS state of the connection the stream belongs to.
+func (c *StreamConn) ConnectionState() tls.ConnectionState {
+	return c.sess.Info().TLS
+}
+
+// Transport returns the transport the stream runs over, such as "quic" or
+// "tcp".
+func (c *StreamConn) Transport() string {
+	return c.sess.Info().Transport
+}
+
+// Info describes the connection the stream belongs to.
+func (c *StreamConn) Info() transport.ConnInfo {
+	return c.sess.Info()
+}
+
+// Ensure StreamConn implements net.Conn
+var _ net.Conn = (*StreamConn)(nil)
@@ -0,0 +1,15 @@
+package mux
+
+import "github.com/shanemcd/tndrl/pkg/transport"
+
+// StreamType identifies the purpose of a stream. It is named in the
+// preamble that starts every stream.
+type StreamType = transport.StreamType
+
+const (
+	// StreamTypeControl is for control plane operations (lifecycle, health, etc.)
+	StreamTypeControl = transport.StreamTypeControl
+
+	// StreamTypeA2A is for A2A protocol traffic (agent-to-agent communication)
+	StreamTypeA2A = transport.StreamTypeA2A
+)
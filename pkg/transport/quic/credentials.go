@@ -0,0 +1,17 @@
+package quic
+
+import (
+	"google.golang.org/grpc/credentials"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+// AuthInfo carries the TLS state of the connection a gRPC stream runs
+// over. See transport.AuthInfo.
+type AuthInfo = transport.AuthInfo
+
+// Credentials returns gRPC transport credentials for connections made of
+// QUIC or TCP streams. See transport.Credentials.
+func Credentials() credentials.TransportCredentials {
+	return transport.Credentials()
+}
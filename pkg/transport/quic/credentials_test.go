@@ -0,0 +1,97 @@
+package quic
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc/peer"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+func TestCredentials_ExposePeerCertificate(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.ControlListener().Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn
+	}()
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+
+	clientConn, err := dialer.DialControl(context.Background(), listener.Addr().String())
+	if err != nil {
+		t.Fatalf("DialControl: %v", err)
+	}
+	defer clientConn.Close()
+
+	serverConn := <-accepted
+	defer serverConn.Close()
+
+	creds := Credentials()
+
+	_, info, err := creds.ServerHandshake(serverConn)
+	if err != nil {
+		t.Fatalf("ServerHandshake: %v", err)
+	}
+	if info.AuthType() != "tndrl-tls" {
+		t.Errorf("AuthType = %q, want %q", info.AuthType(), "tndrl-tls")
+	}
+	state := info.(AuthInfo).State
+	if len(state.PeerCertificates) == 0 {
+		t.Fatal("expected client certificate in server AuthInfo")
+	}
+	if id, _ := pki.IdentityFromCert(state.PeerCertificates[0]); id != pki.NodeIdentity("test-client") {
+		t.Errorf("server sees peer %q, want %q", id, pki.NodeIdentity("test-client"))
+	}
+
+	// Handlers read the same identity from the gRPC peer
+	peerCtx := peer.NewContext(context.Background(), &peer.Peer{AuthInfo: info})
+	if id, err := transport.PeerIdentity(peerCtx); err != nil || id != pki.NodeIdentity("test-client") {
+		t.Errorf("transport.PeerIdentity = %q, %v", id, err)
+	}
+	if _, err := transport.PeerIdentity(context.Background()); err == nil {
+		t.Error("expected error without a gRPC peer")
+	}
+
+	_, info, err = creds.ClientHandshake(context.Background(), "", clientConn)
+	if err != nil {
+		t.Fatalf("ClientHandshake: %v", err)
+	}
+	state = info.(AuthInfo).State
+	if id, _ := pki.IdentityFromCert(state.PeerCertificates[0]); id != pki.NodeIdentity("test-server") {
+		t.Errorf("client sees peer %q, want %q", id, pki.NodeIdentity("test-server"))
+	}
+
+	if _, _, err := creds.ServerHandshake(&net.TCPConn{}); err == nil {
+		t.Error("expected error for non-QUIC connection")
+	}
+
+	// The stream also reports the connection it runs over
+	connInfo, ok := transport.InfoOf(clientConn)
+	if !ok {
+		t.Fatal("stream carries no connection info")
+	}
+	if connInfo.Transport != TransportQUIC {
+		t.Errorf("Transport = %q, want %q", connInfo.Transport, TransportQUIC)
+	}
+	if connInfo.RTT <= 0 {
+		t.Errorf("RTT = %v, want the measured round trip", connInfo.RTT)
+	}
+	if id, err := connInfo.PeerIdentity(); err != nil || id != pki.NodeIdentity("test-server") {
+		t.Errorf("PeerIdentity = %q, %v", id, err)
+	}
+}
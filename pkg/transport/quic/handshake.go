@@ -0,0 +1,38 @@
+package quic
+
+import "github.com/shanemcd/tndrl/pkg/transport/mux"
+
+// Aliases of the stream handshake in pkg/transport/mux.
+
+// Protocol versions of the stream handshake.
+const (
+	ProtocolVersion    = mux.ProtocolVersion
+	MinProtocolVersion = mux.MinProtocolVersion
+)
+
+// DefaultHandshakeTimeout bounds how long the accepting side waits for a
+// stream's preamble.
+const DefaultHandshakeTimeout = mux.DefaultHandshakeTimeout
+
+// Features are optional stream capabilities, negotiated per stream.
+type Features = mux.Features
+
+// SupportedFeatures are the features offered.
+const SupportedFeatures = mux.SupportedFeatures
+
+// RejectReason says why the accepting side refused a stream.
+type RejectReason = mux.RejectReason
+
+const (
+	RejectUnsupportedVersion = mux.RejectUnsupportedVersion
+	RejectUnknownStreamType  = mux.RejectUnknownStreamType
+	RejectUnavailable        = mux.RejectUnavailable
+	RejectMalformed          = mux.RejectMalformed
+)
+
+// StreamRejectedError is returned when opening a stream the peer refused.
+type StreamRejectedError = mux.StreamRejectedError
+
+// ErrHandshakeUnsupported is returned when opening a stream to a peer that
+// predates the stream handshake.
+var ErrHandshakeUnsupported = mux.ErrHandshakeUnsupported
@@ -0,0 +1,181 @@
+package quic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+)
+
+func TestMuxDialer_UnknownStreamType(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = dialer.Dial(ctx, listener.Addr().String(), StreamType(0x7f))
+	var rejected *StreamRejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("Dial error = %v, want *StreamRejectedError", err)
+	}
+	if rejected.Reason != RejectUnknownStreamType || rejected.StreamType != StreamType(0x7f) {
+		t.Errorf("rejection = %+v, want unknown stream type 0x7f", rejected)
+	}
+
+	// The connection is still usable for known stream types
+	go func() {
+		conn, err := listener.ControlListener().Accept()
+		if err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := dialer.DialControl(ctx, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("DialControl after rejection: %v", err)
+	}
+	if sc := conn.(*StreamConn); sc.Version() != ProtocolVersion {
+		t.Errorf("negotiated version = %d, want %d", sc.Version(), ProtocolVersion)
+	}
+	conn.Close()
+}
+
+func TestMuxListener_UnsupportedVersion(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	qconn, err := quic.DialAddr(ctx, listener.Addr().String(), clientTLS, nil)
+	if err != nil {
+		t.Fatalf("DialAddr: %v", err)
+	}
+	defer qconn.CloseWithError(0, "")
+
+	stream, err := qconn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync: %v", err)
+	}
+	defer stream.Close()
+	// A preamble offering only versions newer than the listener's
+	preamble := []byte{byte(transport.PreambleMagic), ProtocolVersion + 1, ProtocolVersion + 2, byte(StreamTypeControl), 0, 0}
+	if _, err := stream.Write(preamble); err != nil {
+		t.Fatalf("write preamble: %v", err)
+	}
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	reply := make([]byte, 5)
+	if _, err := io.ReadFull(stream, reply); err != nil {
+		t.Fatalf("read reply: %v", err)
+	}
+	if reason := RejectReason(reply[0]); reason != RejectUnsupportedVersion {
+		t.Errorf("reply reason = %s, want %s", reason, RejectUnsupportedVersion)
+	}
+}
+
+// TestMuxListener_LegacyClient checks that a node that predates the
+// handshake, writing only the stream type, is still served.
+func TestMuxListener_LegacyClient(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.ControlListener().Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	qconn, err := quic.DialAddr(ctx, listener.Addr().String(), clientTLS, nil)
+	if err != nil {
+		t.Fatalf("DialAddr: %v", err)
+	}
+	defer qconn.CloseWithError(0, "")
+
+	stream, err := qconn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatalf("OpenStreamSync: %v", err)
+	}
+	if _, err := stream.Write([]byte{byte(StreamTypeControl), 'h', 'i'}); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	stream.Close()
+
+	stream.SetReadDeadline(time.Now().Add(5 * time.Second))
+	echo, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(echo) != "hi" {
+		t.Errorf("echo = %q, want %q with no handshake reply", echo, "hi")
+	}
+}
+
+// TestMuxDialer_LegacyServer checks that dialing a node that predates the
+// handshake, which closes streams of unknown type, fails fast.
+func TestMuxDialer_LegacyServer(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	ql, err := quic.ListenAddr("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenAddr: %v", err)
+	}
+	defer ql.Close()
+
+	done := make(chan struct{})
+	defer func() { <-done }()
+	go func() {
+		defer close(done)
+		qconn, err := ql.Accept(context.Background())
+		if err != nil {
+			return
+		}
+		defer qconn.CloseWithError(0, "")
+		stream, err := qconn.AcceptStream(context.Background())
+		if err != nil {
+			return
+		}
+		// The magic byte is not a stream type it knows
+		stream.Read(make([]byte, 1))
+		stream.Close()
+		<-qconn.Context().Done()
+	}()
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := dialer.DialControl(ctx, ql.Addr().String()); !errors.Is(err, ErrHandshakeUnsupported) {
+		t.Errorf("DialControl error = %v, want ErrHandshakeUnsupported", err)
+	}
+}
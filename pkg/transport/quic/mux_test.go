@@ -3,12 +3,15 @@ package quic
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"io"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transport"
 )
 
 func setupTestTLS(t *testing.T) (serverConfig, clientConfig *tls.Config) {
@@ -219,13 +222,12 @@ func TestMuxDialer_ConnectionReuse(t *testing.T) {
 	testEcho(conn2, "a2a-msg")
 	testEcho(conn3, "control-2")
 
-	// Check that only one connection exists in the dialer
-	dialer.mu.Lock()
-	numConns := len(dialer.conns)
-	dialer.mu.Unlock()
-
-	if numConns != 1 {
-		t.Errorf("expected 1 connection, got %d", numConns)
+	// Check that all streams share one connection: each new QUIC
+	// connection dials from its own UDP socket
+	local := conn1.LocalAddr().String()
+	if conn2.LocalAddr().String() != local || conn3.LocalAddr().String() != local {
+		t.Errorf("streams dialed from %s, %s and %s, want one connection",
+			local, conn2.LocalAddr(), conn3.LocalAddr())
 	}
 
 	conn1.(io.Closer).Close()
@@ -233,6 +235,63 @@ func TestMuxDialer_ConnectionReuse(t *testing.T) {
 	conn3.(io.Closer).Close()
 }
 
+func TestMuxListener_AcceptFunc(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	// Reject every connection, recording the peer's identity
+	identities := make(chan string, 1)
+	listener.SetAcceptFunc(func(conn transport.Conn) error {
+		if id, err := conn.Info().PeerIdentity(); err == nil {
+			identities <- id
+		}
+		return errors.New("not today")
+	})
+
+	go func() {
+		for {
+			conn, err := listener.ControlListener().Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The stream may open before the rejection arrives, but it never echoes
+	conn, err := dialer.DialControl(ctx, listener.Addr().String())
+	if err == nil {
+		defer conn.Close()
+		conn.Write([]byte("hello"))
+		if _, err = conn.Read(make([]byte, 5)); err == nil {
+			t.Fatal("expected rejected connection to fail")
+		}
+	}
+	if !strings.Contains(err.Error(), "not today") {
+		t.Errorf("error %q does not carry the rejection reason", err)
+	}
+
+	select {
+	case id := <-identities:
+		if id != pki.NodeIdentity("test-client") {
+			t.Errorf("identity = %q, want %q", id, pki.NodeIdentity("test-client"))
+		}
+	case <-ctx.Done():
+		t.Fatal("accept func not called")
+	}
+}
+
 func TestStreamType_String(t *testing.T) {
 	tests := []struct {
 		st   StreamType
@@ -249,3 +308,76 @@ func TestStreamType_String(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterStreamType(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	const echoType StreamType = 0x10
+	echoListener, err := listener.RegisterStreamType(echoType, "echo")
+	if err != nil {
+		t.Fatalf("RegisterStreamType: %v", err)
+	}
+	go func() {
+		for {
+			conn, err := echoListener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+	dialEcho, err := dialer.RegisterStreamType(echoType, "echo")
+	if err != nil {
+		t.Fatalf("dialer RegisterStreamType: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := dialEcho(ctx, listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial echo stream: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo = %q, %v, want %q", buf, err, "ping")
+	}
+	if got := echoType.String(); got != "echo" {
+		t.Errorf("String() = %q, want %q", got, "echo")
+	}
+
+	// Conflicting and reserved registrations fail
+	if _, err := listener.RegisterStreamType(echoType, "echo"); err == nil {
+		t.Error("registering a type twice on a listener succeeded")
+	}
+	if _, err := dialer.RegisterStreamType(echoType, "other"); err == nil {
+		t.Error("registering a type under another name succeeded")
+	}
+	if _, err := dialer.RegisterStreamType(0x11, "control"); err == nil {
+		t.Error("registering a name already in use succeeded")
+	}
+	if _, err := dialer.RegisterStreamType(transport.PreambleMagic, "magic"); err == nil {
+		t.Error("registering the preamble magic succeeded")
+	}
+
+	// Unregistered types have no listener
+	if _, err := listener.Listener(0x12).Accept(); err == nil {
+		t.Error("Accept on an unregistered type succeeded")
+	}
+}
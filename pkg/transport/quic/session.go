@@ -0,0 +1,100 @@
+package quic
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+	"github.com/shanemcd/tndrl/pkg/transport/mux"
+)
+
+// TransportQUIC is the transport name QUIC connections report.
+const TransportQUIC = "quic"
+
+// quicSession adapts a QUIC connection to mux.Session.
+type quicSession struct {
+	conn *quic.Conn
+}
+
+func (s quicSession) OpenStream(ctx context.Context) (mux.Stream, error) {
+	st, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{st}, nil
+}
+
+func (s quicSession) AcceptStream(ctx context.Context) (mux.Stream, error) {
+	st, err := s.conn.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicStream{st}, nil
+}
+
+func (s quicSession) CloseWithError(code uint64, message string) error {
+	return s.conn.CloseWithError(quic.ApplicationErrorCode(code), message)
+}
+
+func (s quicSession) PeerCloseCode(err error) (uint64, bool) {
+	var appErr *quic.ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote {
+		return uint64(appErr.ErrorCode), true
+	}
+	return 0, false
+}
+
+func (s quicSession) Info() transport.ConnInfo {
+	return transport.ConnInfo{
+		Transport:  TransportQUIC,
+		LocalAddr:  s.conn.LocalAddr(),
+		RemoteAddr: s.conn.RemoteAddr(),
+		TLS:        s.conn.ConnectionState().TLS,
+		RTT:        s.conn.ConnectionStats().SmoothedRTT,
+	}
+}
+
+func (s quicSession) Context() context.Context {
+	return s.conn.Context()
+}
+
+func (s quicSession) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s quicSession) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// quicStream adapts a QUIC stream to mux.Stream.
+type quicStream struct {
+	*quic.Stream
+}
+
+func (s quicStream) CancelRead(code uint64) {
+	s.Stream.CancelRead(quic.StreamErrorCode(code))
+}
+
+func (s quicStream) StreamID() int64 {
+	return int64(s.Stream.StreamID())
+}
+
+// quicListener adapts a QUIC listener to mux.SessionListener.
+type quicListener struct {
+	*quic.Listener
+}
+
+func (l quicListener) Accept(ctx context.Context) (mux.Session, error) {
+	conn, err := l.Listener.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return quicSession{conn}, nil
+}
+
+func (l quicListener) Transport() string {
+	return TransportQUIC
+}
@@ -1,24 +1,15 @@
 package quic
 
-// StreamType identifies the purpose of a QUIC stream.
-// The first byte written to a stream indicates its type.
-type StreamType byte
+import "github.com/shanemcd/tndrl/pkg/transport"
+
+// StreamType identifies the purpose of a stream. It is named in the
+// preamble that starts every stream.
+type StreamType = transport.StreamType
 
 const (
 	// StreamTypeControl is for control plane operations (lifecycle, health, etc.)
-	StreamTypeControl StreamType = 0x01
+	StreamTypeControl = transport.StreamTypeControl
 
 	// StreamTypeA2A is for A2A protocol traffic (agent-to-agent communication)
-	StreamTypeA2A StreamType = 0x02
+	StreamTypeA2A = transport.StreamTypeA2A
 )
-
-func (t StreamType) String() string {
-	switch t {
-	case StreamTypeControl:
-		return "control"
-	case StreamTypeA2A:
-		return "a2a"
-	default:
-		return "unknown"
-	}
-}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"fmt"
+	"sync"
+)
+
+// StreamType identifies the purpose of a stream.
+// It is named in the preamble that starts every stream.
+type StreamType byte
+
+const (
+	// StreamTypeControl is for control plane operations (lifecycle, health, etc.)
+	StreamTypeControl StreamType = 0x01
+
+	// StreamTypeA2A is for A2A protocol traffic (agent-to-agent communication)
+	StreamTypeA2A StreamType = 0x02
+)
+
+// PreambleMagic is the first byte of the stream preamble (see
+// pkg/transport/mux). It is reserved, never a stream type, so that a stream
+// opened by a node that predates the preamble is told apart by its first
+// byte.
+const PreambleMagic StreamType = 0x54 // 'T'
+
+// streamTypes holds the names of registered stream types.
+var streamTypes = struct {
+	mu    sync.RWMutex
+	names map[StreamType]string
+}{
+	names: map[StreamType]string{
+		StreamTypeControl: "control",
+		StreamTypeA2A:     "a2a",
+	},
+}
+
+// RegisterStreamType records the name of a stream type. Registering a type
+// again under the same name is allowed, so that a listener and a dialer in
+// the same process can both register it. Listener and Dialer
+// implementations call it from their RegisterStreamType methods.
+func RegisterStreamType(t StreamType, name string) error {
+	if t == 0 || t == PreambleMagic {
+		return fmt.Errorf("stream type 0x%02x is reserved", byte(t))
+	}
+	if name == "" {
+		return fmt.Errorf("stream type 0x%02x: name required", byte(t))
+	}
+
+	streamTypes.mu.Lock()
+	defer streamTypes.mu.Unlock()
+	for other, otherName := range streamTypes.names {
+		if other == t && otherName != name {
+			return fmt.Errorf("stream type 0x%02x is already registered as %q", byte(t), otherName)
+		}
+		if other != t && otherName == name {
+			return fmt.Errorf("stream type name %q is already used by 0x%02x", name, byte(other))
+		}
+	}
+	streamTypes.names[t] = name
+	return nil
+}
+
+func (t StreamType) String() string {
+	streamTypes.mu.RLock()
+	defer streamTypes.mu.RUnlock()
+	if name, ok := streamTypes.names[t]; ok {
+		return name
+	}
+	return "unknown"
+}
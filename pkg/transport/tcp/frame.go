@@ -0,0 +1,86 @@
+package tcp
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Every frame starts with a header:
+//
+//	type (1) | flags (1) | stream ID (4) | length (4)
+//
+// For data frames the length is that of the payload that follows. For
+// window frames it is the number of bytes the receiver is ready for beyond
+// those already allowed, and for a frame with the stop flag the error code
+// the receiver stopped with. A go-away frame is sent on stream 0 with a
+// payload of an error code (8) and a message, and ends the session.
+const headerSize = 10
+
+// Frame types.
+const (
+	frameData   byte = 0x0
+	frameWindow byte = 0x1
+	frameGoAway byte = 0x2
+)
+
+// Frame flags, which apply to frames of any type on a stream.
+const (
+	// flagSYN opens the stream.
+	flagSYN byte = 0x1
+
+	// flagFIN ends the sender's side of the stream.
+	flagFIN byte = 0x2
+
+	// flagSTOP asks the receiver to stop sending on the stream.
+	flagSTOP byte = 0x4
+)
+
+// maxFrameSize bounds the payload of a data frame.
+const maxFrameSize = 16 << 10
+
+// maxGoAwaySize bounds the payload of a go-away frame.
+const maxGoAwaySize = 8 + 1024
+
+type header struct {
+	typ      byte
+	flags    byte
+	streamID uint32
+	length   uint32
+}
+
+func (h header) marshal(b []byte) {
+	b[0] = h.typ
+	b[1] = h.flags
+	binary.BigEndian.PutUint32(b[2:], h.streamID)
+	binary.BigEndian.PutUint32(b[6:], h.length)
+}
+
+func parseHeader(b []byte) header {
+	return header{
+		typ:      b[0],
+		flags:    b[1],
+		streamID: binary.BigEndian.Uint32(b[2:]),
+		length:   binary.BigEndian.Uint32(b[6:]),
+	}
+}
+
+func (h header) String() string {
+	return fmt.Sprintf("frame type 0x%x flags 0x%x stream %d length %d", h.typ, h.flags, h.streamID, h.length)
+}
+
+// goAway encodes the payload of a go-away frame.
+func goAway(code uint64, message string) []byte {
+	if len(message) > maxGoAwaySize-8 {
+		message = message[:maxGoAwaySize-8]
+	}
+	b := binary.BigEndian.AppendUint64(nil, code)
+	return append(b, message...)
+}
+
+// parseGoAway decodes the payload of a go-away frame.
+func parseGoAway(b []byte) (uint64, string, error) {
+	if len(b) < 8 {
+		return 0, "", fmt.Errorf("go-away frame of %d bytes", len(b))
+	}
+	return binary.BigEndian.Uint64(b), string(b[8:]), nil
+}
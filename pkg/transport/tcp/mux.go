@@ -0,0 +1,123 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+
+	"github.com/shanemcd/tndrl/pkg/transport"
+	"github.com/shanemcd/tndrl/pkg/transport/mux"
+)
+
+// Transport is the transport name TCP sessions report.
+const Transport = "tcp"
+
+// ListenMux creates a multiplexed listener over TCP with TLS 1.3, for
+// clients on networks that drop UDP. It serves the same typed streams as
+// quic.ListenMux.
+func ListenMux(addr string, tlsConfig *tls.Config, config *Config) (*mux.Listener, error) {
+	ln, err := Listen(addr, tlsConfig, config)
+	if err != nil {
+		return nil, err
+	}
+	return mux.NewListener(muxListener{ln}), nil
+}
+
+// NewMuxDialer creates a multiplexed dialer connecting over TCP with TLS
+// 1.3. The peer must listen with ListenMux.
+func NewMuxDialer(tlsConfig *tls.Config, config *Config) *mux.Dialer {
+	return mux.NewDialer(func(ctx context.Context, addr string) (mux.Session, error) {
+		sess, err := Dial(ctx, addr, tlsConfig, config)
+		if err != nil {
+			return nil, err
+		}
+		return muxSession{sess}, nil
+	})
+}
+
+// NewMuxConn wraps a session for multiplexed stream handling.
+func NewMuxConn(sess *Session) *mux.Conn {
+	return mux.NewConn(muxSession{sess})
+}
+
+// muxSession adapts a Session to mux.Session.
+type muxSession struct {
+	sess *Session
+}
+
+func (s muxSession) OpenStream(ctx context.Context) (mux.Stream, error) {
+	st, err := s.sess.OpenStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return muxStream{st}, nil
+}
+
+func (s muxSession) AcceptStream(ctx context.Context) (mux.Stream, error) {
+	st, err := s.sess.AcceptStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return muxStream{st}, nil
+}
+
+func (s muxSession) CloseWithError(code uint64, message string) error {
+	return s.sess.CloseWithError(code, message)
+}
+
+func (s muxSession) PeerCloseCode(err error) (uint64, bool) {
+	var appErr *ApplicationError
+	if errors.As(err, &appErr) && appErr.Remote {
+		return appErr.Code, true
+	}
+	return 0, false
+}
+
+// Info leaves RTT unset: sessions do not measure it.
+func (s muxSession) Info() transport.ConnInfo {
+	return transport.ConnInfo{
+		Transport:  Transport,
+		LocalAddr:  s.sess.LocalAddr(),
+		RemoteAddr: s.sess.RemoteAddr(),
+		TLS:        s.sess.ConnectionState(),
+	}
+}
+
+func (s muxSession) Context() context.Context {
+	return s.sess.Context()
+}
+
+func (s muxSession) LocalAddr() net.Addr {
+	return s.sess.LocalAddr()
+}
+
+func (s muxSession) RemoteAddr() net.Addr {
+	return s.sess.RemoteAddr()
+}
+
+// muxStream adapts a Stream to mux.Stream.
+type muxStream struct {
+	*Stream
+}
+
+func (s muxStream) StreamID() int64 {
+	return int64(s.Stream.StreamID())
+}
+
+// muxListener adapts a Listener to mux.SessionListener.
+type muxListener struct {
+	*Listener
+}
+
+func (l muxListener) Accept(ctx context.Context) (mux.Session, error) {
+	sess, err := l.Listener.Accept(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return muxSession{sess}, nil
+}
+
+func (l muxListener) Transport() string {
+	return Transport
+}
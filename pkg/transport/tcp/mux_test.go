@@ -0,0 +1,118 @@
+package tcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+	"github.com/shanemcd/tndrl/pkg/transport"
+	"github.com/shanemcd/tndrl/pkg/transport/mux"
+)
+
+func TestMuxTCP_GRPC(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+	if got := listener.Transport(); got != Transport {
+		t.Errorf("Transport() = %q, want %q", got, Transport)
+	}
+
+	// The server sees the caller's certificate as it does over QUIC
+	callers := make(chan string, 1)
+	srv := grpc.NewServer(
+		grpc.Creds(transport.Credentials()),
+		grpc.UnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			if p, ok := peer.FromContext(ctx); ok {
+				if info, ok := p.AuthInfo.(transport.AuthInfo); ok && len(info.State.PeerCertificates) > 0 {
+					id, _ := pki.IdentityFromCert(info.State.PeerCertificates[0])
+					callers <- id
+				}
+			}
+			return handler(ctx, req)
+		}),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go srv.Serve(listener.ControlListener())
+	defer func() {
+		// Stream listeners only stop accepting once the mux closes
+		listener.Close()
+		srv.Stop()
+	}()
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+	conn, err := grpc.NewClient(listener.Addr().String(),
+		grpc.WithContextDialer(dialer.ControlDialer()),
+		grpc.WithTransportCredentials(transport.Credentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %s", resp.Status)
+	}
+	if id := <-callers; id != pki.NodeIdentity("test-client") {
+		t.Errorf("caller = %q, want %q", id, pki.NodeIdentity("test-client"))
+	}
+
+	// Streams of types the listener does not serve are rejected
+	var rejected *mux.StreamRejectedError
+	if _, err := dialer.Dial(ctx, listener.Addr().String(), 0x20); !errors.As(err, &rejected) || rejected.Reason != mux.RejectUnknownStreamType {
+		t.Errorf("dial unknown type = %v, want RejectUnknownStreamType", err)
+	}
+}
+
+func TestMuxTCP_AcceptFunc(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+
+	listener, err := ListenMux("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer listener.Close()
+
+	transports := make(chan string, 1)
+	listener.SetAcceptFunc(func(conn transport.Conn) error {
+		transports <- conn.Info().Transport
+		return errors.New("not today")
+	})
+
+	dialer := NewMuxDialer(clientTLS, nil)
+	defer dialer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The refusal is reported rather than retried
+	conn, err := dialer.DialControl(ctx, listener.Addr().String())
+	if err == nil {
+		defer conn.Close()
+		_, err = conn.Read(make([]byte, 1))
+	}
+	if err == nil || !strings.Contains(err.Error(), "not today") {
+		t.Errorf("error %v does not carry the rejection reason", err)
+	}
+	if got := <-transports; got != Transport {
+		t.Errorf("Transport() = %q, want %q", got, Transport)
+	}
+}
@@ -0,0 +1,393 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultStreamWindow is how many bytes a stream's sender may have in
+// flight before the receiver reads them.
+const DefaultStreamWindow = 256 << 10
+
+// DefaultAcceptBacklog is how many streams the peer may open before they
+// are accepted. Streams beyond it are refused.
+const DefaultAcceptBacklog = 256
+
+// closeTimeout bounds how long closing a session waits to tell the peer.
+const closeTimeout = time.Second
+
+// Config configures sessions. A nil Config uses the defaults.
+type Config struct {
+	// StreamWindow is the flow control window of each stream (default
+	// DefaultStreamWindow).
+	StreamWindow uint32
+
+	// AcceptBacklog is how many opened streams wait to be accepted
+	// (default DefaultAcceptBacklog).
+	AcceptBacklog int
+
+	// HandshakeTimeout bounds the TLS handshake of accepted connections
+	// (default DefaultHandshakeTimeout).
+	HandshakeTimeout time.Duration
+}
+
+func (c *Config) streamWindow() uint32 {
+	if c != nil && c.StreamWindow > 0 {
+		return c.StreamWindow
+	}
+	return DefaultStreamWindow
+}
+
+func (c *Config) acceptBacklog() int {
+	if c != nil && c.AcceptBacklog > 0 {
+		return c.AcceptBacklog
+	}
+	return DefaultAcceptBacklog
+}
+
+func (c *Config) handshakeTimeout() time.Duration {
+	if c != nil && c.HandshakeTimeout > 0 {
+		return c.HandshakeTimeout
+	}
+	return DefaultHandshakeTimeout
+}
+
+// ApplicationError is the error a session ends with when either side closes
+// it with CloseWithError.
+type ApplicationError struct {
+	// Remote is set when the peer closed the session.
+	Remote  bool
+	Code    uint64
+	Message string
+}
+
+func (e *ApplicationError) Error() string {
+	who := "closed"
+	if e.Remote {
+		who = "closed by peer"
+	}
+	if e.Message == "" {
+		return fmt.Sprintf("session %s (code %d)", who, e.Code)
+	}
+	return fmt.Sprintf("session %s (code %d): %s", who, e.Code, e.Message)
+}
+
+// errProtocol marks a peer breaking the framing protocol.
+var errProtocol = errors.New("protocol violation")
+
+// errBacklogFull is returned for a stream opened while too many wait to be
+// accepted.
+var errBacklogFull = errors.New("accept backlog full")
+
+// Session multiplexes streams over a connection, with per-stream flow
+// control. Streams opened by the dialing side have odd IDs and those opened
+// by the accepting side even ones.
+type Session struct {
+	conn   net.Conn
+	window uint32
+
+	// wmu serializes frames written to conn
+	wmu sync.Mutex
+
+	mu           sync.Mutex
+	streams      map[uint32]*Stream
+	nextID       uint32
+	lastRemoteID uint32
+	closeErr     error
+
+	accept   chan *Stream
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	readDone chan struct{}
+}
+
+// Client starts a session over conn as the side that dialed it.
+func Client(conn net.Conn, config *Config) *Session {
+	return newSession(conn, config, 1)
+}
+
+// Server starts a session over conn as the side that accepted it.
+func Server(conn net.Conn, config *Config) *Session {
+	return newSession(conn, config, 2)
+}
+
+func newSession(conn net.Conn, config *Config, firstID uint32) *Session {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	s := &Session{
+		conn:     conn,
+		window:   config.streamWindow(),
+		streams:  make(map[uint32]*Stream),
+		nextID:   firstID,
+		accept:   make(chan *Stream, config.acceptBacklog()),
+		ctx:      ctx,
+		cancel:   cancel,
+		readDone: make(chan struct{}),
+	}
+	go s.readLoop()
+	return s
+}
+
+// OpenStream opens a new stream. The peer learns of it immediately, before
+// any data is written.
+func (s *Session) OpenStream(ctx context.Context) (*Stream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.closeErr != nil {
+		s.mu.Unlock()
+		return nil, s.closeErr
+	}
+	id := s.nextID
+	if id >= math.MaxUint32-1 {
+		s.mu.Unlock()
+		return nil, errors.New("stream IDs exhausted")
+	}
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.writeFrame(header{typ: frameWindow, flags: flagSYN, streamID: id}, nil); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// AcceptStream waits for the peer to open a stream.
+func (s *Session) AcceptStream(ctx context.Context) (*Stream, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-s.ctx.Done():
+		return nil, s.err()
+	}
+}
+
+// CloseWithError closes the session and its streams, telling the peer the
+// code and message. It waits for the session's reader to stop.
+func (s *Session) CloseWithError(code uint64, message string) error {
+	if !s.shutdown(&ApplicationError{Code: code, Message: message}) {
+		<-s.readDone
+		return nil
+	}
+
+	// Unblock a writer stuck on a peer that stopped reading
+	s.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	payload := goAway(code, message)
+	s.wmu.Lock()
+	s.write(header{typ: frameGoAway, length: uint32(len(payload))}, payload)
+	s.wmu.Unlock()
+
+	err := s.conn.Close()
+	<-s.readDone
+	return err
+}
+
+// Context returns a context canceled when the session ends.
+func (s *Session) Context() context.Context {
+	return s.ctx
+}
+
+// ConnectionState returns the TLS state of the session's connection, if it
+// is a TLS connection.
+func (s *Session) ConnectionState() tls.ConnectionState {
+	if tc, ok := s.conn.(*tls.Conn); ok {
+		return tc.ConnectionState()
+	}
+	return tls.ConnectionState{}
+}
+
+// LocalAddr returns the local network address.
+func (s *Session) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// err returns the error the session ended with.
+func (s *Session) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closeErr
+}
+
+// shutdown ends the session with err, failing its streams. It reports
+// whether the session was still open.
+func (s *Session) shutdown(err error) bool {
+	s.mu.Lock()
+	if s.closeErr != nil {
+		s.mu.Unlock()
+		return false
+	}
+	s.closeErr = err
+	streams := s.streams
+	s.streams = nil
+	s.mu.Unlock()
+
+	for _, st := range streams {
+		st.fail(err)
+	}
+	s.cancel(err)
+	return true
+}
+
+// fail ends the session after its connection broke.
+func (s *Session) fail(err error) {
+	if s.shutdown(err) {
+		s.conn.Close()
+	}
+}
+
+// writeFrame writes a frame, unless the session has ended.
+func (s *Session) writeFrame(h header, payload []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	if err := s.err(); err != nil {
+		return err
+	}
+	if err := s.write(h, payload); err != nil {
+		err = fmt.Errorf("write frame: %w", err)
+		s.fail(err)
+		return err
+	}
+	return nil
+}
+
+// write writes a frame in a single write. s.wmu must be held.
+func (s *Session) write(h header, payload []byte) error {
+	b := make([]byte, headerSize+len(payload))
+	h.marshal(b)
+	copy(b[headerSize:], payload)
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// removeStream forgets a stream once both of its sides are done.
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// readLoop reads frames and dispatches them to their streams until the
+// connection ends.
+func (s *Session) readLoop() {
+	defer close(s.readDone)
+
+	r := bufio.NewReader(s.conn)
+	b := make([]byte, headerSize)
+	for {
+		if _, err := io.ReadFull(r, b); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			s.fail(fmt.Errorf("connection lost: %w", err))
+			return
+		}
+		if err := s.handleFrame(parseHeader(b), r); err != nil {
+			s.fail(err)
+			return
+		}
+	}
+}
+
+// handleFrame handles a frame whose header has been read, reading its
+// payload from r.
+func (s *Session) handleFrame(h header, r io.Reader) error {
+	if h.typ == frameGoAway {
+		if h.length > maxGoAwaySize {
+			return fmt.Errorf("%w: %s", errProtocol, h)
+		}
+		payload := make([]byte, h.length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+		code, message, err := parseGoAway(payload)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errProtocol, err)
+		}
+		return &ApplicationError{Remote: true, Code: code, Message: message}
+	}
+	if h.typ != frameData && h.typ != frameWindow {
+		return fmt.Errorf("%w: unknown %s", errProtocol, h)
+	}
+
+	st, err := s.stream(h)
+	if errors.Is(err, errBacklogFull) {
+		// Refuse the stream: stop its sender and end it at once
+		s.writeFrame(header{typ: frameWindow, flags: flagSTOP | flagFIN, streamID: h.streamID}, nil)
+	} else if err != nil {
+		return err
+	}
+
+	if h.typ == frameData {
+		if h.length > s.window {
+			return fmt.Errorf("%w: %s exceeds the stream window", errProtocol, h)
+		}
+		payload := make([]byte, h.length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return fmt.Errorf("connection lost: %w", err)
+		}
+		if st != nil {
+			if err := st.receive(payload); err != nil {
+				return err
+			}
+		}
+	} else if st != nil && h.flags&flagSTOP == 0 {
+		st.addSendWindow(h.length)
+	}
+
+	if st != nil {
+		if h.flags&flagSTOP != 0 {
+			st.receiveStop(h.length)
+		}
+		if h.flags&flagFIN != 0 {
+			st.receiveFIN()
+		}
+	}
+	return nil
+}
+
+// stream returns the stream a frame is for, creating it if the frame opens
+// it. It returns nil for a stream that is already done.
+func (s *Session) stream(h header) (*Stream, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.streams == nil {
+		return nil, nil
+	}
+
+	if h.flags&flagSYN == 0 {
+		return s.streams[h.streamID], nil
+	}
+
+	// The peer opens streams of the other parity, in increasing order
+	if h.streamID%2 == s.nextID%2 || h.streamID <= s.lastRemoteID {
+		return nil, fmt.Errorf("%w: %s opens an invalid stream", errProtocol, h)
+	}
+	s.lastRemoteID = h.streamID
+	st := newStream(s, h.streamID)
+	select {
+	case s.accept <- st:
+		s.streams[h.streamID] = st
+		return st, nil
+	default:
+		return nil, errBacklogFull
+	}
+}
@@ -0,0 +1,240 @@
+package tcp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeSessions returns the two ends of a session over an in-memory pipe.
+func pipeSessions(t *testing.T, config *Config) (client, server *Session) {
+	t.Helper()
+	c, s := net.Pipe()
+	client, server = Client(c, config), Server(s, config)
+	t.Cleanup(func() {
+		client.CloseWithError(0, "")
+		server.CloseWithError(0, "")
+	})
+	return client, server
+}
+
+func openPair(t *testing.T, client, server *Session) (opened, accepted *Stream) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opened, err := client.OpenStream(ctx)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	accepted, err = server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	if opened.StreamID() != accepted.StreamID() {
+		t.Fatalf("opened stream %d, accepted %d", opened.StreamID(), accepted.StreamID())
+	}
+	return opened, accepted
+}
+
+func TestSession_Streams(t *testing.T) {
+	client, server := pipeSessions(t, nil)
+
+	// Streams are independent, and either side may open them
+	a, a2 := openPair(t, client, server)
+	b2, b := openPair(t, server, client)
+	if a.StreamID()%2 != 1 || b.StreamID()%2 != 0 {
+		t.Errorf("stream IDs %d and %d do not have the opener's parity", a.StreamID(), b.StreamID())
+	}
+
+	go func() {
+		a.Write([]byte("to server"))
+		a.Close()
+		b2.Write([]byte("to client"))
+		b2.Close()
+	}()
+	if got, err := io.ReadAll(a2); err != nil || string(got) != "to server" {
+		t.Errorf("server read %q, %v", got, err)
+	}
+	if got, err := io.ReadAll(b); err != nil || string(got) != "to client" {
+		t.Errorf("client read %q, %v", got, err)
+	}
+
+	// Closing a stream ends only the local side
+	if _, err := a2.Write([]byte("reply")); err != nil {
+		t.Fatalf("write after peer closed: %v", err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(a, buf); err != nil || string(buf) != "reply" {
+		t.Errorf("read after close = %q, %v", buf, err)
+	}
+}
+
+func TestSession_FlowControl(t *testing.T) {
+	// A small window makes the sender wait for the reader many times
+	client, server := pipeSessions(t, &Config{StreamWindow: 1024})
+	opened, accepted := openPair(t, client, server)
+
+	data := make([]byte, 100_000)
+	rand.Read(data)
+	go func() {
+		opened.Write(data)
+		opened.Close()
+	}()
+
+	got, err := io.ReadAll(accepted)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("received %d bytes that differ from the %d sent", len(got), len(data))
+	}
+}
+
+func TestSession_BlockedStreamDoesNotStallOthers(t *testing.T) {
+	client, server := pipeSessions(t, &Config{StreamWindow: 1024})
+	slow, _ := openPair(t, client, server)
+	fast, fastAccepted := openPair(t, client, server)
+
+	// Fill the slow stream's window; nobody reads it
+	slow.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, err := slow.Write(make([]byte, 4096)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("write past the window = %v, want a deadline error", err)
+	}
+
+	go fast.Write([]byte("still moving"))
+	buf := make([]byte, 12)
+	if _, err := io.ReadFull(fastAccepted, buf); err != nil {
+		t.Fatalf("read other stream: %v", err)
+	}
+}
+
+func TestStream_CancelRead(t *testing.T) {
+	client, server := pipeSessions(t, nil)
+	opened, accepted := openPair(t, client, server)
+
+	accepted.CancelRead(7)
+	if _, err := accepted.Read(make([]byte, 1)); err == nil {
+		t.Error("read after CancelRead succeeded")
+	}
+
+	// The opener learns to stop once the frame arrives
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := opened.Write([]byte("x"))
+		if errors.Is(err, ErrStreamStopped) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("write = %v, want ErrStreamStopped", err)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("writes never stopped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Data written before the cancel still reaches the opener
+	go func() {
+		accepted.Write([]byte("bye"))
+		accepted.Close()
+	}()
+	if got, err := io.ReadAll(opened); err != nil || string(got) != "bye" {
+		t.Errorf("read = %q, %v", got, err)
+	}
+}
+
+func TestStream_ReadDeadline(t *testing.T) {
+	client, server := pipeSessions(t, nil)
+	opened, _ := openPair(t, client, server)
+
+	opened.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := opened.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("read = %v, want a timeout", err)
+	}
+
+	// Moving the deadline wakes a blocked read
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		opened.SetReadDeadline(time.Time{})
+		_, err = opened.Read(make([]byte, 1))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	opened.SetReadDeadline(time.Now())
+	wg.Wait()
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("read = %v, want a deadline error", err)
+	}
+}
+
+func TestSession_CloseWithError(t *testing.T) {
+	client, server := pipeSessions(t, nil)
+	opened, accepted := openPair(t, client, server)
+
+	server.CloseWithError(42, "go away")
+
+	var appErr *ApplicationError
+	if _, err := opened.Read(make([]byte, 1)); !errors.As(err, &appErr) || !appErr.Remote || appErr.Code != 42 || appErr.Message != "go away" {
+		t.Errorf("client read = %v, want the server's close error", err)
+	}
+	if _, err := accepted.Write([]byte("x")); !errors.As(err, &appErr) || appErr.Remote {
+		t.Errorf("server write = %v, want its own close error", err)
+	}
+	if _, err := client.OpenStream(context.Background()); err == nil {
+		t.Error("OpenStream on a closed session succeeded")
+	}
+	select {
+	case <-client.Context().Done():
+	case <-time.After(5 * time.Second):
+		t.Error("client context not canceled")
+	}
+}
+
+func TestSession_AcceptBacklog(t *testing.T) {
+	client, server := pipeSessions(t, &Config{AcceptBacklog: 1})
+	ctx := context.Background()
+
+	if _, err := client.OpenStream(ctx); err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	refused, err := client.OpenStream(ctx)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+
+	// The server cannot queue the second stream, so it ends it
+	if _, err := refused.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("read refused stream = %v, want EOF", err)
+	}
+	if _, err := server.AcceptStream(ctx); err != nil {
+		t.Errorf("AcceptStream: %v", err)
+	}
+}
+
+func TestSession_ProtocolViolation(t *testing.T) {
+	c, s := net.Pipe()
+	server := Server(c, nil)
+	defer server.CloseWithError(0, "")
+
+	// A stream opened with the server's own parity is invalid
+	b := make([]byte, headerSize)
+	header{typ: frameWindow, flags: flagSYN, streamID: 2}.marshal(b)
+	go s.Write(b)
+
+	<-server.Context().Done()
+	if err := context.Cause(server.Context()); !errors.Is(err, errProtocol) {
+		t.Errorf("session ended with %v, want a protocol violation", err)
+	}
+	s.Close()
+}
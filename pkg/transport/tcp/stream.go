@@ -0,0 +1,318 @@
+package tcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrStreamStopped is returned when writing to a stream whose peer stopped
+// reading it.
+var ErrStreamStopped = errors.New("peer stopped reading the stream")
+
+// errReadCanceled is returned when reading a stream after CancelRead.
+var errReadCanceled = errors.New("read canceled")
+
+// errWriteClosed is returned when writing a stream after Close.
+var errWriteClosed = errors.New("write on closed stream")
+
+// Stream is a bidirectional stream of a session, usable as a net.Conn. Like
+// a QUIC stream, closing it only ends the local side.
+type Stream struct {
+	id   uint32
+	sess *Session
+
+	mu            sync.Mutex
+	recvBuf       bytes.Buffer
+	consumed      uint32 // bytes read since the last window update
+	sendWindow    uint32
+	finRecv       bool
+	finSent       bool
+	stopRecv      bool
+	stopCode      uint64
+	readCanceled  bool
+	err           error // the session's error once it ended
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// readReady and writeReady wake a blocked Read or Write to check the
+	// stream's state again
+	readReady  chan struct{}
+	writeReady chan struct{}
+}
+
+func newStream(sess *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		sess:       sess,
+		sendWindow: sess.window,
+		readReady:  make(chan struct{}, 1),
+		writeReady: make(chan struct{}, 1),
+	}
+}
+
+// StreamID returns the stream's ID within its session.
+func (st *Stream) StreamID() uint32 {
+	return st.id
+}
+
+// Read reads data from the stream. It returns io.EOF once the peer has
+// closed its side and all data has been read.
+func (st *Stream) Read(b []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.readCanceled {
+			st.mu.Unlock()
+			return 0, errReadCanceled
+		}
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(b)
+			var update uint32
+			st.consumed += uint32(n)
+			if st.consumed >= st.sess.window/2 && !st.finRecv {
+				update, st.consumed = st.consumed, 0
+			}
+			st.mu.Unlock()
+
+			if update > 0 {
+				st.sess.writeFrame(header{typ: frameWindow, streamID: st.id, length: update}, nil)
+			}
+			return n, nil
+		}
+		if st.finRecv {
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		if st.err != nil {
+			st.mu.Unlock()
+			return 0, st.err
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := wait(st.readReady, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write writes data to the stream, blocking while the peer's window is
+// full.
+func (st *Stream) Write(b []byte) (int, error) {
+	var n int
+	for len(b) > 0 {
+		st.mu.Lock()
+		var err error
+		switch {
+		case st.finSent:
+			err = errWriteClosed
+		case st.stopRecv:
+			err = fmt.Errorf("%w (code %d)", ErrStreamStopped, st.stopCode)
+		case st.err != nil:
+			err = st.err
+		case !st.writeDeadline.IsZero() && !time.Now().Before(st.writeDeadline):
+			err = os.ErrDeadlineExceeded
+		}
+		if err != nil {
+			st.mu.Unlock()
+			return n, err
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err := wait(st.writeReady, deadline); err != nil {
+				return n, err
+			}
+			continue
+		}
+		chunk := min(len(b), int(st.sendWindow), maxFrameSize)
+		st.sendWindow -= uint32(chunk)
+		st.mu.Unlock()
+
+		if err := st.sess.writeFrame(header{typ: frameData, streamID: st.id, length: uint32(chunk)}, b[:chunk]); err != nil {
+			return n, err
+		}
+		n += chunk
+		b = b[chunk:]
+	}
+	return n, nil
+}
+
+// Close ends the local side of the stream: the peer reads io.EOF once it
+// has read the data written before. Reading is not affected.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.finSent || st.err != nil {
+		st.mu.Unlock()
+		return nil
+	}
+	st.finSent = true
+	done := st.doneLocked()
+	st.mu.Unlock()
+	st.notify(st.writeReady)
+
+	err := st.sess.writeFrame(header{typ: frameWindow, flags: flagFIN, streamID: st.id}, nil)
+	if done {
+		st.sess.removeStream(st.id)
+	}
+	return err
+}
+
+// CancelRead abandons the receiving side of the stream, discarding data not
+// yet read and asking the peer to stop sending, with code as the reason.
+func (st *Stream) CancelRead(code uint64) {
+	st.mu.Lock()
+	if st.readCanceled || st.err != nil {
+		st.mu.Unlock()
+		return
+	}
+	st.readCanceled = true
+	st.recvBuf.Reset()
+	finRecv := st.finRecv
+	done := st.doneLocked()
+	st.mu.Unlock()
+	st.notify(st.readReady)
+
+	if !finRecv {
+		st.sess.writeFrame(header{typ: frameWindow, flags: flagSTOP, streamID: st.id, length: uint32(code)}, nil)
+	}
+	if done {
+		st.sess.removeStream(st.id)
+	}
+}
+
+// SetDeadline sets the read and write deadlines.
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+// SetReadDeadline makes Read fail with os.ErrDeadlineExceeded after t. A
+// zero t disables the deadline.
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	st.notify(st.readReady)
+	return nil
+}
+
+// SetWriteDeadline makes Write fail with os.ErrDeadlineExceeded after t. A
+// zero t disables the deadline.
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	st.notify(st.writeReady)
+	return nil
+}
+
+// LocalAddr returns the local network address of the session.
+func (st *Stream) LocalAddr() net.Addr {
+	return st.sess.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address of the session.
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.sess.RemoteAddr()
+}
+
+// receive queues data the peer sent.
+func (st *Stream) receive(data []byte) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.readCanceled || st.finRecv {
+		// Sent before the peer learned we stopped reading
+		return nil
+	}
+	if uint64(st.recvBuf.Len())+uint64(st.consumed)+uint64(len(data)) > uint64(st.sess.window) {
+		return fmt.Errorf("%w: stream %d exceeded its window", errProtocol, st.id)
+	}
+	st.recvBuf.Write(data)
+	st.notify(st.readReady)
+	return nil
+}
+
+// addSendWindow allows n more bytes to be sent.
+func (st *Stream) addSendWindow(n uint32) {
+	st.mu.Lock()
+	st.sendWindow += n
+	st.mu.Unlock()
+	st.notify(st.writeReady)
+}
+
+// receiveFIN ends the peer's side of the stream.
+func (st *Stream) receiveFIN() {
+	st.mu.Lock()
+	st.finRecv = true
+	done := st.doneLocked()
+	st.mu.Unlock()
+	st.notify(st.readReady)
+	if done {
+		st.sess.removeStream(st.id)
+	}
+}
+
+// receiveStop records that the peer stopped reading.
+func (st *Stream) receiveStop(code uint32) {
+	st.mu.Lock()
+	st.stopRecv = true
+	st.stopCode = uint64(code)
+	done := st.doneLocked()
+	st.mu.Unlock()
+	st.notify(st.writeReady)
+	if done {
+		st.sess.removeStream(st.id)
+	}
+}
+
+// fail ends the stream with its session.
+func (st *Stream) fail(err error) {
+	st.mu.Lock()
+	st.err = err
+	st.mu.Unlock()
+	st.notify(st.readReady)
+	st.notify(st.writeReady)
+}
+
+// doneLocked reports whether neither side will send anything more, so that
+// the session can forget the stream. st.mu must be held.
+func (st *Stream) doneLocked() bool {
+	return (st.finSent || st.stopRecv) && (st.finRecv || st.readCanceled)
+}
+
+// notify wakes a Read or Write blocked on ch.
+func (st *Stream) notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until ch is signaled or the deadline passes.
+func wait(ch <-chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-ch
+		return nil
+	}
+	d := time.Until(deadline)
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ch:
+		return nil
+	case <-t.C:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+// Ensure Stream implements net.Conn
+var _ net.Conn = (*Stream)(nil)
@@ -0,0 +1,157 @@
+// Package tcp carries multiplexed streams over TCP with TLS 1.3, for
+// networks that drop the UDP QUIC needs.
+//
+// A Session multiplexes streams over one TLS connection, in the manner of
+// yamux: each frame names its stream, and each stream has its own flow
+// control window, so that a slow reader of one stream does not stall the
+// others. Streams behave like QUIC streams: closing one ends only the local
+// side, and CancelRead asks the peer to stop sending. Unlike QUIC, all
+// streams share one TCP connection, so a lost packet delays every stream.
+//
+// ListenMux and NewMuxDialer run the typed streams of pkg/transport/mux
+// over sessions, as pkg/transport/quic does over QUIC connections.
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultHandshakeTimeout bounds the TLS handshake of an accepted
+// connection.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// Listener accepts TCP connections and starts a session on each once its
+// TLS handshake completes.
+type Listener struct {
+	ln        net.Listener
+	tlsConfig *tls.Config
+	config    *Config
+
+	sessions chan *Session
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	// err is set when accepting connections failed, before done is closed
+	err  error
+	done chan struct{}
+}
+
+// Listen listens for TCP connections on addr, secured with tlsConfig.
+func Listen(addr string, tlsConfig *tls.Config, config *Config) (*Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Listener{
+		ln:        ln,
+		tlsConfig: tls13(tlsConfig),
+		config:    config,
+		sessions:  make(chan *Session),
+		ctx:       ctx,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l, nil
+}
+
+// acceptLoop accepts connections and hands each to a handshake goroutine,
+// so that a slow client does not hold up the others.
+func (l *Listener) acceptLoop() {
+	defer close(l.done)
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			l.err = err
+			return
+		}
+		l.wg.Add(1)
+		go func() {
+			defer l.wg.Done()
+			l.handshake(conn)
+		}()
+	}
+}
+
+// handshake completes the TLS handshake of an accepted connection and
+// queues its session.
+func (l *Listener) handshake(conn net.Conn) {
+	ctx, cancel := context.WithTimeout(l.ctx, l.config.handshakeTimeout())
+	defer cancel()
+
+	tc := tls.Server(conn, l.tlsConfig)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		slog.Debug("TLS handshake failed", "remote", conn.RemoteAddr(), "err", err)
+		conn.Close()
+		return
+	}
+
+	sess := Server(tc, l.config)
+	select {
+	case l.sessions <- sess:
+	case <-l.ctx.Done():
+		sess.CloseWithError(0, "listener closed")
+	}
+}
+
+// Accept waits for a session.
+func (l *Listener) Accept(ctx context.Context) (*Session, error) {
+	select {
+	case sess := <-l.sessions:
+		return sess, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.ctx.Done():
+		return nil, net.ErrClosed
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Addr returns the listener's network address.
+func (l *Listener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Close stops accepting connections. Sessions already accepted are not
+// closed.
+func (l *Listener) Close() error {
+	l.cancel()
+	err := l.ln.Close()
+	<-l.done
+	l.wg.Wait()
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Dial connects to addr, completes a TLS handshake with tlsConfig and
+// starts a session.
+func Dial(ctx context.Context, addr string, tlsConfig *tls.Config, config *Config) (*Session, error) {
+	d := tls.Dialer{Config: tls13(tlsConfig)}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return Client(conn, config), nil
+}
+
+// tls13 returns tlsConfig, requiring TLS 1.3.
+func tls13(tlsConfig *tls.Config) *tls.Config {
+	if tlsConfig.MinVersion >= tls.VersionTLS13 {
+		return tlsConfig
+	}
+	c := tlsConfig.Clone()
+	c.MinVersion = tls.VersionTLS13
+	return c
+}
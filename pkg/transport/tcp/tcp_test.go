@@ -0,0 +1,112 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+func setupTestTLS(t *testing.T) (serverConfig, clientConfig *tls.Config) {
+	t.Helper()
+
+	ca, err := pki.GenerateCA()
+	if err != nil {
+		t.Fatalf("generate CA: %v", err)
+	}
+	serverCert, err := pki.GenerateCert(ca, pki.NodeIdentity("test-server"), true, false)
+	if err != nil {
+		t.Fatalf("generate server cert: %v", err)
+	}
+	clientCert, err := pki.GenerateCert(ca, pki.NodeIdentity("test-client"), false, true)
+	if err != nil {
+		t.Fatalf("generate client cert: %v", err)
+	}
+	serverConfig, err = pki.ServerTLSConfig(serverCert, ca)
+	if err != nil {
+		t.Fatalf("server TLS config: %v", err)
+	}
+	clientConfig, err = pki.ClientTLSConfig(clientCert, ca, "localhost")
+	if err != nil {
+		t.Fatalf("client TLS config: %v", err)
+	}
+	return serverConfig, clientConfig
+}
+
+func TestListenDial(t *testing.T) {
+	serverTLS, clientTLS := setupTestTLS(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	listener, err := Listen("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := Dial(ctx, listener.Addr().String(), clientTLS, nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.CloseWithError(0, "")
+	server, err := listener.Accept(ctx)
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	defer server.CloseWithError(0, "")
+
+	state := server.ConnectionState()
+	if state.Version != tls.VersionTLS13 {
+		t.Errorf("TLS version = %x, want TLS 1.3", state.Version)
+	}
+	if len(state.PeerCertificates) == 0 {
+		t.Fatal("server sees no client certificate")
+	}
+	if id, _ := pki.IdentityFromCert(state.PeerCertificates[0]); id != pki.NodeIdentity("test-client") {
+		t.Errorf("client identity = %q", id)
+	}
+
+	stream, err := client.OpenStream(ctx)
+	if err != nil {
+		t.Fatalf("OpenStream: %v", err)
+	}
+	go func() {
+		stream.Write([]byte("hello over tcp"))
+		stream.Close()
+	}()
+	accepted, err := server.AcceptStream(ctx)
+	if err != nil {
+		t.Fatalf("AcceptStream: %v", err)
+	}
+	if got, err := io.ReadAll(accepted); err != nil || string(got) != "hello over tcp" {
+		t.Errorf("read %q, %v", got, err)
+	}
+}
+
+func TestListen_RejectsUntrustedClient(t *testing.T) {
+	serverTLS, _ := setupTestTLS(t)
+	_, otherClientTLS := setupTestTLS(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	listener, err := Listen("127.0.0.1:0", serverTLS, nil)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer listener.Close()
+
+	if sess, err := Dial(ctx, listener.Addr().String(), otherClientTLS, nil); err == nil {
+		sess.CloseWithError(0, "")
+		t.Fatal("Dial with a certificate from another CA succeeded")
+	}
+
+	acceptCtx, cancelAccept := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancelAccept()
+	if sess, err := listener.Accept(acceptCtx); err == nil {
+		sess.CloseWithError(0, "")
+		t.Error("listener accepted a session that failed the TLS handshake")
+	}
+}
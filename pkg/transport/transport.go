@@ -0,0 +1,119 @@
+// Package transport defines how nodes carry typed streams to each other,
+// independently of the network underneath.
+//
+// A Listener accepts connections from peers and hands out their streams by
+// type; a Dialer opens typed streams to peers, reusing one connection per
+// address. Every stream is a net.Conn, so the control, A2A and file servers
+// neither know nor care which transport carries it.
+//
+// pkg/transport/mux implements both over any multiplexed session;
+// pkg/transport/quic runs it over QUIC, and pkg/transport/tcp over TCP
+// where UDP is blocked. pkg/transport/memory implements them in memory, for
+// tests.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/shanemcd/tndrl/pkg/pki"
+)
+
+// ConnInfo describes the connection a stream runs over.
+type ConnInfo struct {
+	// Transport names the transport, such as "quic" or "tcp".
+	Transport string
+
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+
+	// TLS is the connection's TLS state, including the verified peer
+	// certificates.
+	TLS tls.ConnectionState
+
+	// RTT is the smoothed round-trip time to the peer, or zero if the
+	// transport does not measure it.
+	RTT time.Duration
+}
+
+// PeerIdentity returns the SPIFFE ID in the certificate the peer presented.
+func (i ConnInfo) PeerIdentity() (string, error) {
+	if len(i.TLS.PeerCertificates) == 0 {
+		return "", errors.New("peer presented no certificate")
+	}
+	return pki.IdentityFromCert(i.TLS.PeerCertificates[0])
+}
+
+// Conn is a secured connection to a peer, carrying typed streams.
+type Conn interface {
+	// Info describes the connection.
+	Info() ConnInfo
+
+	// Context is canceled when the connection closes.
+	Context() context.Context
+}
+
+// AcceptFunc decides whether a newly accepted connection may be served.
+// Returning an error closes the connection before any stream is accepted.
+type AcceptFunc func(conn Conn) error
+
+// Listener accepts connections and routes their streams by type.
+type Listener interface {
+	// Listener returns a net.Listener for streams of type t, which can be
+	// passed to grpc.Server.Serve. Accept fails unless the type is
+	// registered; control and A2A streams always are.
+	Listener(t StreamType) net.Listener
+
+	// RegisterStreamType makes the listener accept streams of type t,
+	// returning a net.Listener for them. Streams of types that are not
+	// registered are rejected.
+	RegisterStreamType(t StreamType, name string) (net.Listener, error)
+
+	// SetAcceptFunc sets the function deciding whether a new connection may
+	// be served. It must be called before connections arrive.
+	SetAcceptFunc(fn AcceptFunc)
+
+	// Addr returns the address peers dial.
+	Addr() net.Addr
+
+	// Transport names the transport the listener accepts connections over.
+	Transport() string
+
+	// Close stops accepting connections and closes those accepted. Accept
+	// on the stream listeners then fails with net.ErrClosed.
+	Close() error
+}
+
+// DialFunc opens a stream to the address. It is compatible with
+// grpc.WithContextDialer.
+type DialFunc func(ctx context.Context, addr string) (net.Conn, error)
+
+// Dialer opens typed streams to peers, reusing a connection per address.
+type Dialer interface {
+	// Dial opens a stream of type t to the address.
+	Dial(ctx context.Context, addr string, t StreamType) (net.Conn, error)
+
+	// StreamDialer returns a DialFunc for streams of type t.
+	StreamDialer(t StreamType) DialFunc
+
+	// RegisterStreamType registers the name of stream type t, as
+	// Listener.RegisterStreamType does on the accepting side, and returns a
+	// DialFunc for streams of that type.
+	RegisterStreamType(t StreamType, name string) (DialFunc, error)
+
+	// Close closes all connections.
+	Close() error
+}
+
+// InfoOf returns the connection info of a stream opened by a Dialer or
+// accepted by a Listener.
+func InfoOf(conn net.Conn) (ConnInfo, bool) {
+	c, ok := conn.(interface{ Info() ConnInfo })
+	if !ok {
+		return ConnInfo{}, false
+	}
+	return c.Info(), true
+}
@@ -9,12 +9,15 @@ import (
 	"github.com/a2aproject/a2a-go/a2a"
 	"github.com/a2aproject/a2a-go/a2aclient"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	tndrlv1 "github.com/shanemcd/tndrl/gen/go/tndrl/v1"
 	"github.com/shanemcd/tndrl/pkg/a2aexec"
+	"github.com/shanemcd/tndrl/pkg/authz"
 	"github.com/shanemcd/tndrl/pkg/pki"
 	quictransport "github.com/shanemcd/tndrl/pkg/transport/quic"
+	tcptransport "github.com/shanemcd/tndrl/pkg/transport/tcp"
 )
 
 // muxTestEnv holds the multiplexed test environment
@@ -67,7 +70,7 @@ func (s *testControlServer) Shutdown(ctx context.Context, req *tndrlv1.ShutdownR
 	}, nil
 }
 
-func setupMuxTestEnv(t *testing.T) *muxTestEnv {
+func setupMuxTestEnv(t *testing.T, serverOpts ...grpc.ServerOption) *muxTestEnv {
 	t.Helper()
 
 	// Generate PKI
@@ -99,7 +102,7 @@ func setupMuxTestEnv(t *testing.T) *muxTestEnv {
 	}
 
 	// Create and start Control gRPC server
-	controlServer := grpc.NewServer()
+	controlServer := grpc.NewServer(serverOpts...)
 	testControl := &testControlServer{
 		identity:   "spiffe://tndrl/node/test-mux",
 		shutdownCh: make(chan struct{}, 1),
@@ -112,7 +115,7 @@ func setupMuxTestEnv(t *testing.T) *muxTestEnv {
 	}()
 
 	// Create and start A2A gRPC server
-	a2aServer := grpc.NewServer()
+	a2aServer := grpc.NewServer(serverOpts...)
 	executor := a2aexec.NewExecutor()
 	a2aexec.RegisterWithGRPC(a2aServer, &a2aexec.ServerConfig{
 		Executor: executor,
@@ -165,7 +168,7 @@ func (e *muxTestEnv) connectControl(t *testing.T) (tndrlv1.ControlServiceClient,
 	conn, err := grpc.NewClient(
 		e.addr,
 		grpc.WithContextDialer(muxDialer.ControlDialer()),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
 	)
 	if err != nil {
 		t.Fatalf("NewClient: %v", err)
@@ -191,7 +194,7 @@ func (e *muxTestEnv) connectA2A(t *testing.T) (a2aclient.Transport, func()) {
 	conn, err := grpc.NewClient(
 		e.addr,
 		grpc.WithContextDialer(muxDialer.A2ADialer()),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
 	)
 	if err != nil {
 		t.Fatalf("NewClient: %v", err)
@@ -291,6 +294,38 @@ func TestControlShutdown(t *testing.T) {
 	t.Logf("Shutdown accepted")
 }
 
+func TestControlAuthzPolicy(t *testing.T) {
+	policy, err := authz.NewPolicy([]authz.Rule{{
+		Methods: []string{"/tndrl.v1.ControlService/Shutdown"},
+		Allow:   []string{"spiffe://tndrl/node/ops-*"},
+	}})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	env := setupMuxTestEnv(t,
+		grpc.Creds(quictransport.Credentials()),
+		grpc.UnaryInterceptor(policy.UnaryServerInterceptor()),
+	)
+	defer env.cleanup()
+
+	client, cleanup := env.connectControl(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The client (spiffe://tndrl/node/test-client) may ping but not shut down
+	if _, err := client.Ping(ctx, &tndrlv1.PingRequest{Timestamp: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	_, err = client.Shutdown(ctx, &tndrlv1.ShutdownRequest{Reason: "integration test"})
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("Shutdown error = %v, want PermissionDenied", err)
+	}
+}
+
 func TestControlMultiplePings(t *testing.T) {
 	env := setupMuxTestEnv(t)
 	defer env.cleanup()
@@ -340,7 +375,7 @@ func TestConnectionReuse(t *testing.T) {
 		conn, err := grpc.NewClient(
 			env.addr,
 			grpc.WithContextDialer(muxDialer.ControlDialer()),
-			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithTransportCredentials(quictransport.Credentials()),
 		)
 		if err != nil {
 			t.Fatalf("NewClient %d: %v", i, err)
@@ -398,7 +433,7 @@ func TestConnectionRequiresMTLS(t *testing.T) {
 	conn, err := grpc.NewClient(
 		env.addr,
 		grpc.WithContextDialer(muxDialer.ControlDialer()),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
 	)
 	if err != nil {
 		// Connection creation might fail
@@ -636,3 +671,60 @@ func TestWrongCleanupOrderHangs(t *testing.T) {
 		<-done // Wait for the goroutine to finish
 	}
 }
+
+// TestTCPFallback serves the same gRPC servers over QUIC and TCP at one
+// address, as tndrl serve does, and reaches both services over TCP.
+func TestTCPFallback(t *testing.T) {
+	env := setupMuxTestEnv(t)
+	defer env.cleanup()
+
+	serverTLS, err := pki.ServerTLSConfig(env.serverCert, env.ca)
+	if err != nil {
+		t.Fatalf("ServerTLSConfig: %v", err)
+	}
+	tcpListener, err := tcptransport.ListenMux(env.addr, serverTLS, nil)
+	if err != nil {
+		t.Fatalf("ListenMux: %v", err)
+	}
+	defer tcpListener.Close()
+	go env.controlServer.Serve(tcpListener.ControlListener())
+	go env.a2aServer.Serve(tcpListener.A2AListener())
+
+	clientTLS, err := pki.ClientTLSConfig(env.clientCert, env.ca, "localhost")
+	if err != nil {
+		t.Fatalf("ClientTLSConfig: %v", err)
+	}
+	muxDialer := tcptransport.NewMuxDialer(clientTLS, nil)
+	defer muxDialer.Close()
+
+	controlConn, err := grpc.NewClient(env.addr,
+		grpc.WithContextDialer(muxDialer.ControlDialer()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer controlConn.Close()
+	a2aConn, err := grpc.NewClient(env.addr,
+		grpc.WithContextDialer(muxDialer.A2ADialer()),
+		grpc.WithTransportCredentials(quictransport.Credentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	defer a2aConn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := tndrlv1.NewControlServiceClient(controlConn).Ping(ctx, &tndrlv1.PingRequest{Timestamp: time.Now().UnixNano()}); err != nil {
+		t.Fatalf("Ping over TCP: %v", err)
+	}
+
+	transport := a2aclient.NewGRPCTransport(a2aConn)
+	defer transport.Destroy()
+	msg := a2a.NewMessage(a2a.MessageRoleUser, a2a.TextPart{Text: "over tcp"})
+	if _, err := transport.SendMessage(ctx, &a2a.MessageSendParams{Message: msg}); err != nil {
+		t.Fatalf("SendMessage over TCP: %v", err)
+	}
+}